@@ -0,0 +1,181 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AdaptiveTimeoutConfig derives per-statement timeouts from the latencies
+// observed for the same statement, identified by its label or fingerprint
+type AdaptiveTimeoutConfig struct {
+	// Percentile of the observed latencies the timeout is based on, default 0.99
+	Percentile float64
+	// Multiplier applied to the percentile, default 3
+	Multiplier float64
+	// Floor is the shortest timeout, default 1s
+	Floor time.Duration
+	// Ceiling is the longest timeout, default Config.Timeout
+	Ceiling time.Duration
+	// MinSamples is the number of observations needed before a statement
+	// gets an adaptive timeout, default 20; until then Ceiling applies
+	MinSamples int
+	// Window is the number of recent latencies kept per statement, default 200
+	Window int
+}
+
+// validate checks the adaptive timeout configuration
+func (cfg *AdaptiveTimeoutConfig) validate() error {
+	var errs []error
+	if cfg.Percentile < 0 || cfg.Percentile > 1 {
+		errs = append(errs, fmt.Errorf("adaptive timeout percentile must be between 0 and 1, got %g", cfg.Percentile))
+	}
+	if cfg.Multiplier < 0 {
+		errs = append(errs, fmt.Errorf("adaptive timeout multiplier cannot be negative, got %g", cfg.Multiplier))
+	}
+	if cfg.Floor < 0 || cfg.Ceiling < 0 {
+		errs = append(errs, errors.New("adaptive timeout floor and ceiling cannot be negative"))
+	}
+	if cfg.Ceiling > 0 && cfg.Floor > cfg.Ceiling {
+		errs = append(errs, fmt.Errorf("adaptive timeout floor %s is above the ceiling %s", cfg.Floor, cfg.Ceiling))
+	}
+	if cfg.MinSamples < 0 || cfg.Window < 0 {
+		errs = append(errs, errors.New("adaptive timeout sample counts cannot be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// withDefaults fills unset fields; timeout is the request timeout of the configuration
+func (cfg AdaptiveTimeoutConfig) withDefaults(timeout time.Duration) AdaptiveTimeoutConfig {
+	if cfg.Percentile == 0 {
+		cfg.Percentile = 0.99
+	}
+	if cfg.Multiplier == 0 {
+		cfg.Multiplier = 3
+	}
+	if cfg.Floor == 0 {
+		cfg.Floor = time.Second
+	}
+	if cfg.Ceiling == 0 {
+		cfg.Ceiling = timeout
+	}
+	if cfg.MinSamples == 0 {
+		cfg.MinSamples = 20
+	}
+	if cfg.Window == 0 {
+		cfg.Window = 200
+	}
+	return cfg
+}
+
+// AdaptiveTimeoutError is returned when a statement exceeds its adaptive timeout
+type AdaptiveTimeoutError struct {
+	// Key is the label or fingerprint of the statement
+	Key string
+	// Timeout is the timeout derived from its observed latencies
+	Timeout time.Duration
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements the error interface
+func (e *AdaptiveTimeoutError) Error() string {
+	return fmt.Sprintf("statement %q exceeded its adaptive timeout of %s: %v", e.Key, e.Timeout, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *AdaptiveTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// latencyTracker keeps the recent latencies of each statement
+type latencyTracker struct {
+	mu      sync.Mutex
+	windows map[string]*latencyWindow
+	// recent evicts the windows of the least recently run statements
+	recent keyLRU
+}
+
+// latencyWindow is a ring buffer of latencies
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+// record adds a successful statement's latency, keeping windows for at most
+// maxStatements statements
+func (t *latencyTracker) record(key string, latency time.Duration, window, maxStatements int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.windows == nil {
+		t.windows = make(map[string]*latencyWindow)
+	}
+	w, ok := t.windows[key]
+	if !ok {
+		w = &latencyWindow{}
+		t.windows[key] = w
+	}
+	if evicted, ok := t.recent.touch(key, maxStatements); ok {
+		delete(t.windows, evicted)
+	}
+
+	if len(w.samples) < window {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next%len(w.samples)] = latency
+	w.next++
+}
+
+// timeout returns the adaptive timeout for a statement
+func (t *latencyTracker) timeout(key string, cfg AdaptiveTimeoutConfig) time.Duration {
+	t.mu.Lock()
+	w, ok := t.windows[key]
+	var samples []time.Duration
+	if ok && len(w.samples) >= cfg.MinSamples {
+		samples = append(samples, w.samples...)
+	}
+	t.mu.Unlock()
+
+	if samples == nil {
+		return cfg.Ceiling
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	p := samples[int(cfg.Percentile*float64(len(samples)-1))]
+
+	timeout := time.Duration(float64(p) * cfg.Multiplier)
+	if timeout < cfg.Floor {
+		timeout = cfg.Floor
+	}
+	if timeout > cfg.Ceiling {
+		timeout = cfg.Ceiling
+	}
+	return timeout
+}
+
+// adaptiveTimeout bounds ctx by the adaptive timeout of the statement, when
+// enabled. The returned function maps a timeout caused by the bound to an
+// *AdaptiveTimeoutError and must be called with the statement's error.
+func (c *Conn) adaptiveTimeout(ctx context.Context, query string) (context.Context, context.CancelFunc, func(error) error) {
+	passthrough := func(err error) error { return err }
+	if c.cfg.AdaptiveTimeout == nil || c.connector == nil {
+		return ctx, func() {}, passthrough
+	}
+
+	cfg := c.cfg.AdaptiveTimeout.withDefaults(c.cfg.Timeout)
+	key := QueryEvent{Label: LabelFromContext(ctx), Fingerprint: c.warmCache().fingerprint(query)}.key()
+	timeout := c.connector.latency.timeout(key, cfg)
+
+	bounded, cancel := context.WithTimeout(ctx, timeout)
+	return bounded, cancel, func(err error) error {
+		if err != nil && ctx.Err() == nil && errors.Is(bounded.Err(), context.DeadlineExceeded) {
+			return &AdaptiveTimeoutError{Key: key, Timeout: timeout, Err: err}
+		}
+		return err
+	}
+}
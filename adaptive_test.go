@@ -0,0 +1,89 @@
+package rsqlite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveTimeout(t *testing.T) {
+	var tracker latencyTracker
+	// 1ms to 100ms, recorded out of order
+	for i := 100; i > 0; i-- {
+		tracker.record("q", time.Duration(i)*time.Millisecond, 200, 10)
+	}
+	for i := 0; i < 5; i++ {
+		tracker.record("new", time.Hour, 200, 10)
+	}
+
+	base := AdaptiveTimeoutConfig{Percentile: 0.9, Multiplier: 2, Floor: time.Millisecond, Ceiling: time.Second, MinSamples: 10}
+	tests := []struct {
+		name   string
+		key    string
+		modify func(cfg *AdaptiveTimeoutConfig)
+		want   time.Duration
+	}{
+		{name: "percentile times multiplier", key: "q", want: 180 * time.Millisecond},
+		{name: "median", key: "q", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.Percentile = 0.5 }, want: 100 * time.Millisecond},
+		{name: "maximum", key: "q", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.Percentile = 1 }, want: 200 * time.Millisecond},
+		{name: "floor", key: "q", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.Floor = 500 * time.Millisecond }, want: 500 * time.Millisecond},
+		{name: "ceiling", key: "q", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.Ceiling = 150 * time.Millisecond }, want: 150 * time.Millisecond},
+		{name: "too few samples", key: "q", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.MinSamples = 101 }, want: time.Second},
+		{name: "enough samples", key: "q", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.MinSamples = 100 }, want: 180 * time.Millisecond},
+		// A slow statement without enough samples isn't clamped to its latencies yet
+		{name: "new statement", key: "new", want: time.Second},
+		{name: "new statement with samples", key: "new", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.MinSamples = 5 }, want: time.Second},
+		{name: "unknown statement", key: "other", modify: func(cfg *AdaptiveTimeoutConfig) { cfg.MinSamples = 0 }, want: time.Second},
+	}
+	for _, tt := range tests {
+		cfg := base
+		if tt.modify != nil {
+			tt.modify(&cfg)
+		}
+		if got := tracker.timeout(tt.key, cfg); got != tt.want {
+			t.Errorf("%s: timeout %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLatencyTrackerWindow(t *testing.T) {
+	var tracker latencyTracker
+	cfg := AdaptiveTimeoutConfig{Percentile: 0, Multiplier: 1, Ceiling: time.Hour, MinSamples: 1}
+
+	// Only the last 10 latencies count
+	for i := 1; i <= 25; i++ {
+		tracker.record("q", time.Duration(i)*time.Millisecond, 10, 2)
+	}
+	if got := tracker.timeout("q", cfg); got != 16*time.Millisecond {
+		t.Errorf("fastest recent latency %v, want 16ms", got)
+	}
+
+	// The least recently run statement is dropped
+	tracker.record("a", time.Millisecond, 10, 2)
+	tracker.record("q", time.Millisecond, 10, 2)
+	tracker.record("b", time.Millisecond, 10, 2)
+	if got := tracker.timeout("a", cfg); got != time.Hour {
+		t.Errorf("evicted statement timeout %v, want the ceiling", got)
+	}
+	if got := tracker.timeout("q", cfg); got != time.Millisecond {
+		t.Errorf("kept statement timeout %v", got)
+	}
+}
+
+func TestAdaptiveTimeoutDefaults(t *testing.T) {
+	cfg := AdaptiveTimeoutConfig{}.withDefaults(30 * time.Second)
+	want := AdaptiveTimeoutConfig{Percentile: 0.99, Multiplier: 3, Floor: time.Second, Ceiling: 30 * time.Second, MinSamples: 20, Window: 200}
+	if cfg != want {
+		t.Errorf("defaults %+v, want %+v", cfg, want)
+	}
+
+	for _, bad := range []AdaptiveTimeoutConfig{
+		{Percentile: 1.5},
+		{Multiplier: -1},
+		{Floor: 2 * time.Second, Ceiling: time.Second},
+		{MinSamples: -1},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("config %+v accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package rsqlite
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// dsnAliases maps names registered with RegisterDSN to their DSNs
+var (
+	dsnAliasesMu sync.RWMutex
+	dsnAliases   = map[string]string{}
+)
+
+// RegisterDSN registers name as an alias of dsn, so sql.Open("rqlite",
+// "prod"), ParseDSN and OpenPair accept the short name and long multi-node
+// DSNs with credentials stay in one place. Registering a name again replaces
+// its DSN, e.g. after rotating credentials; an empty dsn removes the alias.
+// Names can't contain DSN syntax, an alias can't name another alias, and an
+// alias takes precedence over a node of the same name given without a port.
+func RegisterDSN(name, dsn string) error {
+	if name == "" || strings.ContainsAny(name, ":/@?,=&") {
+		return fmt.Errorf("invalid dsn alias %q: use a plain name such as \"prod\"", name)
+	}
+
+	dsnAliasesMu.Lock()
+	defer dsnAliasesMu.Unlock()
+
+	if dsn == "" {
+		delete(dsnAliases, name)
+		return nil
+	}
+	if _, ok := dsnAliases[dsn]; ok {
+		return fmt.Errorf("dsn alias %s names another alias %q", name, dsn)
+	}
+
+	// Local files are only checked once a fallback driver opens them
+	if !looksLikeFilePath(strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite://"), "rqlite://")) {
+		if _, err := parseDSN(dsn); err != nil {
+			return fmt.Errorf("dsn alias %s: %w", name, err)
+		}
+	}
+
+	dsnAliases[name] = dsn
+	return nil
+}
+
+// resolveDSN returns the DSN registered under the alias dsn, or dsn itself
+func resolveDSN(dsn string) string {
+	dsnAliasesMu.RLock()
+	defer dsnAliasesMu.RUnlock()
+
+	if aliased, ok := dsnAliases[dsn]; ok {
+		return aliased
+	}
+	return dsn
+}
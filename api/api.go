@@ -0,0 +1,425 @@
+// Package api is a client for the rqlite HTTP API that doesn't go through
+// database/sql, for tools that want the driver's cluster-aware transport
+// (leader discovery and redirects, authentication, TLS and retries) without
+// the sql abstraction:
+//
+//	client, err := api.Open("rqlite://localhost:4001?consistency=strong")
+//	if err != nil {
+//		...
+//	}
+//	defer client.Close()
+//
+//	result, err := client.Execute(ctx, "INSERT INTO users (name) VALUES (?)", "alice")
+//	rows, err := client.Query(ctx, "SELECT id, name FROM users")
+//
+// The package shares the protocol code of the driver but doesn't import it,
+// so using it neither links database/sql nor registers the driver. A Client
+// is configured by the driver's DSN format or a Config, and is safe for
+// concurrent use.
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// Statement is a single parameterized SQL statement
+type Statement = transport.Statement
+
+// NodeStatus describes a cluster member, see Client.Nodes
+type NodeStatus = transport.NodeStatus
+
+// Status is the raft progress of the leader, see Client.Status. Node is the
+// API address of the reporting node: the leader, or the first configured
+// node when the leader can't be discovered.
+type Status = transport.RaftStatus
+
+// NotLeaderError is returned when a follower redirected a statement to the
+// leader and the retries ran out before the leader ran it
+type NotLeaderError = transport.NotLeaderError
+
+// ErrReadOnly is returned by Execute and ExecuteBatch when Config.ReadOnly is set
+var ErrReadOnly = errors.New("client is read-only")
+
+// ErrClosed is returned by the methods of a closed Client
+var ErrClosed = errors.New("client is closed")
+
+// QueryResult holds the rows returned by a read statement
+type QueryResult struct {
+	Columns []string `json:"columns"`
+	// Types are the declared SQLite types of the columns
+	Types []string `json:"types"`
+	// Values holds one slice per row, in column order. Numbers are
+	// json.Number.
+	Values [][]interface{} `json:"values"`
+	// Error is the statement's error in a batch, "" when it succeeded
+	Error string `json:"error"`
+}
+
+// ExecuteResult holds the outcome of a write statement
+type ExecuteResult struct {
+	LastInsertID int64 `json:"last_insert_id"`
+	RowsAffected int64 `json:"rows_affected"`
+	// Error is the statement's error in a batch, "" when it succeeded
+	Error string `json:"error"`
+}
+
+// StatementError is returned by Query and Execute when the server rejected
+// the statement, e.g. for a syntax error or a constraint violation
+type StatementError struct {
+	Message string
+}
+
+// Error implements the error interface
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement error: %s", e.Message)
+}
+
+// Client talks to an rqlite cluster over its HTTP API
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+	header     transport.Header
+	retry      transport.Retry
+
+	mu sync.Mutex
+	// leader is the API address statements are sent to, "" until discovered
+	leader string
+	closed bool
+}
+
+// Open creates a client from a DSN in the driver's format
+func Open(dsn string) (*Client, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// New creates a client from a configuration
+func New(cfg *Config) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		cfg:    *cfg,
+		header: transport.Header{AppName: cfg.AppName, Username: cfg.Username, Password: cfg.Password},
+		retry:  transport.NewRetry(cfg.Retry, transport.SystemClock{}, transport.SystemRand{}),
+		httpClient: &http.Client{
+			Timeout:       cfg.Timeout,
+			Transport:     transport.For(cfg.TLSConfig, 0),
+			CheckRedirect: transport.CheckRedirect,
+		},
+	}
+	c.cfg.Nodes = make([]string, len(cfg.Nodes))
+	for i, node := range cfg.Nodes {
+		c.cfg.Nodes[i] = transport.NormalizeNode(node)
+	}
+	return c, nil
+}
+
+// Query runs a read statement at the configured read consistency
+func (c *Client) Query(ctx context.Context, query string, args ...interface{}) (*QueryResult, error) {
+	return c.QueryAt(ctx, "", query, args...)
+}
+
+// QueryAt runs a read statement at the given consistency level: none, weak,
+// strong, linearizable or auto
+func (c *Client) QueryAt(ctx context.Context, level string, query string, args ...interface{}) (*QueryResult, error) {
+	results, err := c.QueryBatch(ctx, level, Statement{Query: query, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Error != "" {
+		return nil, &StatementError{Message: results[0].Error}
+	}
+	return &results[0], nil
+}
+
+// QueryBatch runs read statements in one request on the leader at the given
+// consistency level, the configured read consistency when "". A statement
+// the server rejects has its Error set and doesn't fail the others. Failed
+// requests are retried following the retry policy.
+func (c *Client) QueryBatch(ctx context.Context, level string, statements ...Statement) ([]QueryResult, error) {
+	if len(statements) == 0 {
+		return nil, errors.New("no statements")
+	}
+	if level == "" {
+		level = c.cfg.Consistency
+	}
+
+	params := url.Values{}
+	params.Set("level", level)
+
+	var results []QueryResult
+	err := c.do(ctx, transport.Retryable, func(node string) error {
+		return c.post(ctx, node, "/db/query", params, statements, &results)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(statements) {
+		return nil, fmt.Errorf("%d results for %d statements", len(results), len(statements))
+	}
+	return results, nil
+}
+
+// Execute runs a write statement on the leader
+func (c *Client) Execute(ctx context.Context, query string, args ...interface{}) (*ExecuteResult, error) {
+	results, err := c.ExecuteBatch(ctx, false, Statement{Query: query, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Error != "" {
+		return nil, &StatementError{Message: results[0].Error}
+	}
+	return &results[0], nil
+}
+
+// ExecuteBatch runs write statements in one request on the leader. With
+// transaction set they are applied atomically: all of them or none.
+// Otherwise a statement the server rejects has its Error set and doesn't
+// stop the others. Only requests that can't have reached the leader are
+// retried, so the statements are applied at most once.
+func (c *Client) ExecuteBatch(ctx context.Context, transaction bool, statements ...Statement) ([]ExecuteResult, error) {
+	if c.cfg.ReadOnly {
+		return nil, ErrReadOnly
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("no statements")
+	}
+
+	params := url.Values{}
+	if transaction {
+		params.Set("transaction", "")
+	}
+
+	var results []ExecuteResult
+	err := c.do(ctx, func(err error) bool {
+		return transport.Retryable(err) && !maybeDelivered(err)
+	}, func(node string) error {
+		return c.post(ctx, node, "/db/execute", params, statements, &results)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(statements) {
+		return nil, fmt.Errorf("%d results for %d statements", len(results), len(statements))
+	}
+	return results, nil
+}
+
+// Status returns the raft progress of the leader, or of the first
+// configured node when the leader can't be discovered
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status *Status
+	err := c.do(ctx, transport.Retryable, func(node string) (err error) {
+		status, err = transport.QueryRaftStatus(ctx, c.httpClient, c.header, node)
+		return err
+	})
+	return status, err
+}
+
+// Nodes returns the status of every cluster member, as reported by the first
+// configured node that answers
+func (c *Client) Nodes(ctx context.Context) ([]NodeStatus, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, node := range c.cfg.Nodes {
+		nodes, err := transport.QueryNodes(ctx, c.httpClient, c.header, node)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for i := range nodes {
+			nodes[i].APIAddr = c.resolve(nodes[i].APIAddr)
+		}
+		return nodes, nil
+	}
+	return nil, fmt.Errorf("failed to query nodes from any node: %w", lastErr)
+}
+
+// Close releases the idle connections of the client; later calls fail
+// with ErrClosed
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// checkOpen returns ErrClosed once the client is closed
+func (c *Client) checkOpen() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// do runs op on the leader under the retry policy. A follower's redirect is
+// remembered, so the retry goes to the leader it named; after a failure to
+// reach the leader it is discovered again.
+func (c *Client) do(ctx context.Context, retryable func(error) bool, op func(node string) error) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+
+	return c.retry.Do(ctx, func() error {
+		node := c.leaderNode(ctx)
+		err := op(node)
+
+		var notLeader *NotLeaderError
+		var netErr net.Error
+		switch {
+		case errors.As(err, &notLeader):
+			c.setLeader(notLeader.Leader)
+		case errors.As(err, &netErr):
+			c.setLeader("")
+		}
+		return err
+	}, retryable, nil)
+}
+
+// leaderNode returns the leader, discovering it from the /nodes listing of
+// the configured nodes when unknown. Without a listing the first configured
+// node is used, whose redirect then names the leader.
+func (c *Client) leaderNode(ctx context.Context) string {
+	c.mu.Lock()
+	leader := c.leader
+	c.mu.Unlock()
+	if leader != "" {
+		return leader
+	}
+
+	for _, node := range c.cfg.Nodes {
+		nodes, err := transport.QueryNodes(ctx, c.httpClient, c.header, node)
+		if err != nil {
+			continue
+		}
+		for _, n := range nodes {
+			if n.Leader && n.APIAddr != "" {
+				leader := c.resolve(n.APIAddr)
+				c.setLeader(leader)
+				return leader
+			}
+		}
+	}
+	return c.cfg.Nodes[0]
+}
+
+// setLeader records the leader statements are sent to, "" to discover it again
+func (c *Client) setLeader(leader string) {
+	c.mu.Lock()
+	c.leader = leader
+	c.mu.Unlock()
+}
+
+// resolve turns a node address reported by the cluster, which usually has
+// no scheme, into one the client can reach: an address whose host matches
+// a configured node takes that node's scheme and base path, others get
+// https with a TLS configuration and http without
+func (c *Client) resolve(addr string) string {
+	if addr == "" || transport.HasScheme(addr) {
+		return addr
+	}
+
+	host := transport.NodeHost(addr)
+	for _, node := range c.cfg.Nodes {
+		if transport.NodeHost(node) == host {
+			return node
+		}
+	}
+	if c.cfg.TLSConfig != nil {
+		return transport.NormalizeNode("https://" + addr)
+	}
+	return transport.NormalizeNode("http://" + addr)
+}
+
+// post sends statements to path on node and decodes their results into
+// results, a pointer to a slice of QueryResult or ExecuteResult
+func (c *Client) post(ctx context.Context, node, path string, params url.Values, statements []Statement, results interface{}) error {
+	body, err := transport.EncodeStatements(statements)
+	if err != nil {
+		return err
+	}
+
+	endpoint := node + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.header.Apply(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if leader := transport.RedirectedTo(resp, node, path); leader != "" {
+		return &NotLeaderError{Node: node, Leader: leader}
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &transport.StatusError{Path: path, Code: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+
+	var apiResp struct {
+		Results json.RawMessage `json:"results"`
+		Error   string          `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return err
+	}
+	if apiResp.Error != "" {
+		return &transport.RequestError{Msg: apiResp.Error}
+	}
+
+	// Numbers are kept as json.Number so large integers stay exact
+	decoder := json.NewDecoder(bytes.NewReader(apiResp.Results))
+	decoder.UseNumber()
+	if err := decoder.Decode(results); err != nil {
+		return fmt.Errorf("invalid results in response: %w", err)
+	}
+	return nil
+}
+
+// maybeDelivered reports whether a failed request may have reached the
+// server. Only failures to connect, and requests a follower redirected
+// instead of running, are known not to have.
+func maybeDelivered(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	var notLeader *NotLeaderError
+	return !errors.As(err, &notLeader)
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := ParseDSN("rqlite://bob:s%40cret@n1:4001,n2:4001/base?read_consistency=strong&timeout=5s&app_name=tool&read_only=true&max_retries=4&retry_backoff=10ms&retry_max_elapsed=1s&pool_size=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Username != "bob" || cfg.Password != "s@cret" {
+		t.Errorf("credentials %q:%q", cfg.Username, cfg.Password)
+	}
+	if want := []string{"http://n1:4001", "http://n2:4001/base"}; strings.Join(cfg.Nodes, ",") != strings.Join(want, ",") {
+		t.Errorf("nodes %q, want %q", cfg.Nodes, want)
+	}
+	if cfg.Consistency != "strong" || cfg.Timeout != 5*time.Second || cfg.AppName != "tool" || !cfg.ReadOnly {
+		t.Errorf("config %+v", cfg)
+	}
+	if cfg.Retry.MaxRetries != 4 || cfg.Retry.InitialInterval != 10*time.Millisecond || cfg.Retry.MaxElapsed != time.Second {
+		t.Errorf("retry policy %+v", cfg.Retry)
+	}
+
+	cfg, err = ParseDSN("n1:4001?tls=true&tls_insecure=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Nodes[0] != "https://n1:4001" || cfg.TLSConfig == nil || !cfg.TLSConfig.InsecureSkipVerify {
+		t.Errorf("tls config: nodes %q, %+v", cfg.Nodes, cfg.TLSConfig)
+	}
+
+	for _, dsn := range []string{
+		"rqlite://",
+		"rqlite://n1:4001?timeout=soon",
+		"rqlite://n1:4001?read_only=maybe",
+		"rqlite://n1:4001?tls_ca=/does/not/exist.pem",
+	} {
+		if _, err := ParseDSN(dsn); err == nil {
+			t.Errorf("ParseDSN(%q) succeeded", dsn)
+		}
+	}
+
+	if _, err := Open("rqlite://n1:4001?consistency=eventual"); err == nil {
+		t.Error("unknown consistency level accepted")
+	}
+}
+
+func TestClientFollowsRedirect(t *testing.T) {
+	var leaderExecs atomic.Int32
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/execute":
+			leaderExecs.Add(1)
+			w.Write([]byte(`{"results": [{"last_insert_id": 7, "rows_affected": 1}, {"error": "UNIQUE constraint failed"}]}`))
+		case "/db/query":
+			if r.URL.Query().Get("level") != "strong" {
+				t.Errorf("query level = %q, want strong", r.URL.Query().Get("level"))
+			}
+			w.Write([]byte(`{"results": [{"columns": ["id"], "types": ["integer"], "values": [[7]]}]}`))
+		case "/status":
+			w.Write([]byte(`{"store": {"raft": {"applied_index": 12, "commit_index": 13}}}`))
+		}
+	}))
+	defer leader.Close()
+
+	// The follower still believes it leads, as right after an election
+	var follower *httptest.Server
+	follower = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nodes" {
+			fmt.Fprintf(w, `{"nodes": [{"id": "n2", "api_addr": %q, "leader": true, "reachable": true, "voter": true}]}`, follower.URL)
+			return
+		}
+		http.Redirect(w, r, leader.URL+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}))
+	defer follower.Close()
+
+	client, err := Open("rqlite://" + strings.TrimPrefix(follower.URL, "http://") + "?consistency=strong&retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	results, err := client.ExecuteBatch(ctx, false,
+		Statement{Query: "INSERT INTO t (id) VALUES (?)", Args: []interface{}{7}},
+		Statement{Query: "INSERT INTO t (id) VALUES (?)", Args: []interface{}{7}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].LastInsertID != 7 || results[1].Error == "" {
+		t.Errorf("execute results = %+v", results)
+	}
+	if n := leaderExecs.Load(); n != 1 {
+		t.Errorf("leader ran %d writes, want 1", n)
+	}
+
+	result, err := client.Query(ctx, "SELECT id FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Values) != 1 || result.Values[0][0] != json.Number("7") {
+		t.Errorf("query result = %+v", result)
+	}
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Node != leader.URL || status.AppliedIndex != 12 || status.CommitIndex != 13 {
+		t.Errorf("status = %+v, want the leader's", status)
+	}
+}
+
+func TestClientRedirectKeepsBasePath(t *testing.T) {
+	// Both nodes sit behind a proxy under a base path
+	var leaderExecs atomic.Int32
+	leaderMux := http.NewServeMux()
+	leaderMux.HandleFunc("/leader/db/execute", func(w http.ResponseWriter, r *http.Request) {
+		leaderExecs.Add(1)
+		w.Write([]byte(`{"results": [{"last_insert_id": 1, "rows_affected": 1}]}`))
+	})
+	leader := httptest.NewServer(leaderMux)
+	defer leader.Close()
+
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/follower/db/execute" {
+			http.Redirect(w, r, leader.URL+"/leader/db/execute", http.StatusMovedPermanently)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer follower.Close()
+
+	client, err := Open(follower.URL + "/follower?retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Execute(ctx, "INSERT INTO t (id) VALUES (1)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := leaderExecs.Load(); n != 2 {
+		t.Errorf("leader ran %d writes, want 2", n)
+	}
+	if want := leader.URL + "/leader"; client.leaderNode(ctx) != want {
+		t.Errorf("leader %q, want %q", client.leaderNode(ctx), want)
+	}
+}
+
+func TestClientStatementErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/query":
+			w.Write([]byte(`{"results": [{"error": "no such table: t"}]}`))
+		case "/db/execute":
+			// Two results for one statement
+			w.Write([]byte(`{"results": [{"rows_affected": 1}, {"rows_affected": 1}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := Open(server.URL + "?retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	var stmtErr *StatementError
+	if _, err := client.Query(ctx, "SELECT id FROM t"); !errors.As(err, &stmtErr) || stmtErr.Message != "no such table: t" {
+		t.Errorf("query of a missing table = %v, want a StatementError", err)
+	}
+	if _, err := client.Execute(ctx, "DELETE FROM t"); err == nil {
+		t.Error("response with a result per statement missing accepted")
+	}
+	if _, err := client.QueryBatch(ctx, ""); err == nil {
+		t.Error("empty batch accepted")
+	}
+}
+
+func TestClientQueryAndStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bob" || pass != "secret" {
+			t.Errorf("%s sent without credentials", r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/db/query":
+			if level := r.URL.Query().Get("level"); level != "none" {
+				t.Errorf("query level = %q, want none", level)
+			}
+			w.Write([]byte(`{"results": [{"columns": ["id", "name"], "types": ["integer", "text"], "values": [[9007199254740993, "alice"]]}]}`))
+		case "/status":
+			w.Write([]byte(`{"store": {"raft": {"applied_index": 12, "commit_index": 13}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := Open("rqlite://bob:secret@" + strings.TrimPrefix(server.URL, "http://") + "?retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	result, err := client.QueryAt(ctx, "none", "SELECT id, name FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Values) != 1 || result.Values[0][0] != json.Number("9007199254740993") || result.Values[0][1] != "alice" {
+		t.Errorf("query result %+v", result)
+	}
+
+	// Without a /nodes listing the first node is asked
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Node != server.URL || status.AppliedIndex != 12 || status.CommitIndex != 13 {
+		t.Errorf("status = %+v", status)
+	}
+
+	client.Close()
+	if _, err := client.Query(ctx, "SELECT 1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("query after close = %v, want ErrClosed", err)
+	}
+}
+
+func TestClientReadOnly(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+	}))
+	defer server.Close()
+
+	client, err := Open(server.URL + "?read_only=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	if _, err := client.Execute(ctx, "DELETE FROM t"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("execute on a read-only client = %v, want ErrReadOnly", err)
+	}
+	if _, err := client.ExecuteBatch(ctx, true, Statement{Query: "DELETE FROM t"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("batch on a read-only client = %v, want ErrReadOnly", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("read-only client sent %d requests", n)
+	}
+	if _, err := client.Query(ctx, "SELECT 1"); err != nil {
+		t.Errorf("query on a read-only client: %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var queries, execs atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/query":
+			// Reads are retried through a restart
+			if queries.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+		case "/db/execute":
+			execs.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := Open(server.URL + "?max_retries=3&retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	if _, err := client.Query(ctx, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("query sent %d times, want 2", n)
+	}
+
+	// A write the server may have run isn't sent again
+	if _, err := client.Execute(ctx, "INSERT INTO t VALUES (1)"); err == nil {
+		t.Fatal("execute succeeded")
+	}
+	if n := execs.Load(); n != 1 {
+		t.Errorf("write sent %d times, want once", n)
+	}
+}
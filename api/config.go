@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// RetryPolicy controls how failed requests are retried, see the driver's
+// Config.Retry
+type RetryPolicy = transport.RetryPolicy
+
+// Config configures a Client
+type Config struct {
+	// Nodes are the API addresses of cluster members, such as
+	// "http://localhost:4001"
+	Nodes []string
+	// Username and Password are sent with HTTP Basic Auth when Username is set
+	Username string
+	Password string
+	// AppName identifies the application in request headers
+	AppName string
+	// TLSConfig is used for https nodes; nil uses the system defaults
+	TLSConfig *tls.Config
+	// Timeout bounds every request; 0 means no limit
+	Timeout time.Duration
+	// Consistency is the read consistency of Query: none, weak, strong,
+	// linearizable or auto
+	Consistency string
+	// ReadOnly rejects Execute and ExecuteBatch with ErrReadOnly
+	ReadOnly bool
+	// Retry controls how failed requests are retried
+	Retry RetryPolicy
+}
+
+// consistencyLevels lists the read consistency levels understood by rqlite
+var consistencyLevels = map[string]bool{
+	"none":         true,
+	"weak":         true,
+	"strong":       true,
+	"linearizable": true,
+	"auto":         true,
+}
+
+// Validate checks the configuration
+func (cfg *Config) Validate() error {
+	var errs []error
+	if len(cfg.Nodes) == 0 {
+		errs = append(errs, errors.New("no nodes specified"))
+	}
+	if !consistencyLevels[cfg.Consistency] {
+		errs = append(errs, fmt.Errorf("unknown consistency level %q: use none, weak, strong, linearizable or auto", cfg.Consistency))
+	}
+	if cfg.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout cannot be negative, got %s", cfg.Timeout))
+	}
+	if err := cfg.Retry.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// ParseDSN parses a DSN in the driver's format,
+// rqlite://[user:password@]host1:port1,host2:port2?key=value. The keys
+// consistency (or read_consistency), timeout, app_name, read_only, tls,
+// tls_ca, tls_insecure, max_retries, retry_backoff and retry_max_elapsed
+// configure the client; the driver's other keys are ignored, so a DSN can
+// be shared with database/sql.
+func ParseDSN(dsn string) (*Config, error) {
+	cfg := &Config{
+		Timeout:     30 * time.Second,
+		Consistency: "weak",
+		Retry:       RetryPolicy{MaxRetries: 2, InitialInterval: 100 * time.Millisecond, Jitter: 0.2},
+	}
+
+	dsn = strings.TrimPrefix(dsn, "sqlite://")
+	dsn = strings.TrimPrefix(dsn, "rqlite://")
+
+	if userinfo, rest, ok := transport.SplitUserinfo(dsn); ok {
+		dsn = rest
+
+		var err error
+		if cfg.Username, cfg.Password, err = transport.ParseCredentials(userinfo); err != nil {
+			return nil, err
+		}
+	}
+
+	scheme := "http"
+	if hosts, rawQuery, ok := strings.Cut(dsn, "?"); ok {
+		dsn = hosts
+
+		params, err := transport.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, err
+		}
+		for _, param := range params {
+			key, value := param.Key, param.Value
+			switch key {
+			case "consistency", "read_consistency":
+				cfg.Consistency = value
+			case "timeout":
+				cfg.Timeout, err = time.ParseDuration(value)
+			case "app_name":
+				cfg.AppName = value
+			case "read_only":
+				cfg.ReadOnly, err = strconv.ParseBool(value)
+			case "tls":
+				var enabled bool
+				if enabled, err = strconv.ParseBool(value); enabled {
+					scheme = "https"
+					cfg.tlsConfig()
+				}
+			case "tls_ca":
+				cfg.tlsConfig().RootCAs, err = transport.LoadCAFile(value)
+			case "tls_insecure":
+				cfg.tlsConfig().InsecureSkipVerify, err = strconv.ParseBool(value)
+			case "max_retries":
+				cfg.Retry.MaxRetries, err = strconv.Atoi(value)
+			case "retry_backoff":
+				cfg.Retry.InitialInterval, err = time.ParseDuration(value)
+			case "retry_max_elapsed":
+				cfg.Retry.MaxElapsed, err = time.ParseDuration(value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("dsn parameter %s=%q: %w", key, value, err)
+			}
+		}
+	}
+
+	for _, node := range strings.Split(dsn, ",") {
+		node = strings.TrimSpace(node)
+		if node == "" {
+			continue
+		}
+		if !transport.HasScheme(node) {
+			node = scheme + "://" + node
+		}
+		cfg.Nodes = append(cfg.Nodes, transport.NormalizeNode(node))
+	}
+	if len(cfg.Nodes) == 0 {
+		return nil, errors.New("no nodes specified")
+	}
+
+	return cfg, nil
+}
+
+// tlsConfig returns the TLS configuration, creating it if unset
+func (cfg *Config) tlsConfig() *tls.Config {
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{}
+	}
+	return cfg.TLSConfig
+}
@@ -0,0 +1,159 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newAuthServer starts a fake rqlite node that requires the given credentials
+func newAuthServer(t *testing.T, username, password string) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	var rejected atomic.Int64
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != username || pass != password {
+			rejected.Add(1)
+			w.Header().Set("WWW-Authenticate", `Basic realm="rqlite"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/status":
+			fmt.Fprintf(w, `{"cluster": {"leader": %q}, "store": {"raft": {"applied_index": 7}}}`, server.URL)
+		case "/db/query", "/db/execute":
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]], "rows_affected": 1}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &rejected
+}
+
+func TestBasicAuth(t *testing.T) {
+	server, rejected := newAuthServer(t, "alice", "s3cret")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	cfg, err := ParseDSN("rqlite://alice:s3cret@" + host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := NewConn(cfg)
+	if err != nil {
+		t.Fatalf("connecting with credentials: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Errorf("exec: %v", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT 1", nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		t.Errorf("reading row: %v", err)
+	}
+	rows.Close()
+
+	cm := newClusterManagerForConfig(cfg)
+	if err := cm.DiscoverLeader(ctx); err != nil {
+		t.Errorf("discovering leader: %v", err)
+	}
+	if index, err := cm.AppliedIndex(ctx, server.URL); err != nil || index != 7 {
+		t.Errorf("applied index: got %d, %v", index, err)
+	}
+	if !cm.IsLeaderHealthy(ctx) {
+		t.Error("leader reported unhealthy")
+	}
+
+	if n := rejected.Load(); n != 0 {
+		t.Errorf("%d requests were sent without valid credentials", n)
+	}
+}
+
+func TestBasicAuthRejected(t *testing.T) {
+	server, _ := newAuthServer(t, "alice", "s3cret")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	cfg, err := ParseDSN("rqlite://alice:wrong@" + host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conn, err := NewConn(cfg); err == nil {
+		conn.Close()
+		t.Fatal("expected connecting with wrong credentials to fail")
+	}
+}
+
+func TestCredentialProviderRotation(t *testing.T) {
+	server, _ := newAuthServer(t, "alice", "s3cret")
+
+	var password atomic.Value
+	password.Store("s3cret")
+	cfg := NewConfig(
+		WithNodes(server.URL),
+		WithCredentialProvider(CredentialProviderFunc(func(ctx context.Context) (Credentials, error) {
+			return Credentials{Username: "alice", Password: password.Load().(string)}, nil
+		})),
+	)
+	cfg.MaxRetries = 0
+
+	conn, err := NewConn(cfg)
+	if err != nil {
+		t.Fatalf("connecting with provided credentials: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	// The server rotates the password; the connection picks up the new one
+	password.Store("rotated")
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err == nil {
+		t.Fatal("expected exec with a password the server doesn't know to fail")
+	}
+	password.Store("s3cret")
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+		t.Fatalf("exec after rotation: %v", err)
+	}
+}
+
+func TestCredentialProviderError(t *testing.T) {
+	server, rejected := newAuthServer(t, "alice", "s3cret")
+
+	errVault := errors.New("vault sealed")
+	cfg := NewConfig(
+		WithNodes(server.URL),
+		WithCredentialProvider(CredentialProviderFunc(func(ctx context.Context) (Credentials, error) {
+			return Credentials{}, errVault
+		})),
+	)
+
+	_, err := NewConn(cfg)
+	var credErr *CredentialError
+	if !errors.As(err, &credErr) || !errors.Is(err, errVault) {
+		t.Fatalf("got %v, want a CredentialError wrapping the provider's error", err)
+	}
+	if n := rejected.Load(); n != 0 {
+		t.Errorf("%d requests were sent despite the provider failing", n)
+	}
+}
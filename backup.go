@@ -0,0 +1,102 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// Backup streams a SQLite snapshot of the cluster's database into w. The
+// leader is tried first, then the configured nodes; a node is only retried
+// on another when nothing has been written to w yet.
+func (c *Connector) Backup(ctx context.Context, w io.Writer) error {
+	return c.backup(ctx, "", w)
+}
+
+// backup streams a backup in the given format from the first node able to serve it
+func (c *Connector) backup(ctx context.Context, format string, w io.Writer) error {
+	cfg, _ := c.current()
+
+	// No overall client timeout: snapshots can be large, ctx bounds the transfer
+	httpClient := newHTTPClient(cfg, 0)
+
+	var lastErr error
+	for _, node := range c.candidateNodes(ctx) {
+		client := newAPIClientForConfig(node, httpClient, cfg)
+
+		cw := &countingWriter{w: w}
+		err := client.backup(ctx, format, cw)
+		if err == nil || errors.Is(err, errSQLDumpUnsupported) {
+			return err
+		}
+		if cw.n > 0 {
+			return fmt.Errorf("backup from %s failed after %d bytes: %w", node, cw.n, err)
+		}
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return fmt.Errorf("backup failed on every node: %w", lastErr)
+	}
+	return errors.New("no nodes available")
+}
+
+// leaderClient returns an API client for the leader, or for the first
+// configured node when the leader can't be discovered
+func (c *Connector) leaderClient(ctx context.Context) (*apiClient, error) {
+	cfg, _ := c.current()
+
+	nodes := c.candidateNodes(ctx)
+	if len(nodes) == 0 {
+		return nil, errors.New("no nodes available")
+	}
+
+	return newAPIClientForConfig(nodes[0], newHTTPClient(cfg, cfg.Timeout), cfg), nil
+}
+
+// candidateNodes returns the discovered leader followed by the configured
+// nodes, or only the configured nodes when discovery is disabled
+func (c *Connector) candidateNodes(ctx context.Context) []string {
+	cfg, _ := c.current()
+	cm := c.sharedClusterManager()
+
+	var nodes []string
+	seen := make(map[string]bool)
+	add := func(node string) {
+		if node == "" {
+			return
+		}
+		node = transport.NormalizeNode(node)
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+
+	if !cfg.DisableDiscovery {
+		if err := cm.DiscoverLeader(ctx); err == nil {
+			add(cm.GetLeader())
+		}
+	}
+	for _, node := range cfg.Nodes {
+		add(node)
+	}
+
+	return nodes
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements the io.Writer interface
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
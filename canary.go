@@ -0,0 +1,237 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CanaryConfig configures the synthetic canary of a Connector, which
+// periodically writes a row to a dedicated table on the leader and measures
+// how long the followers take to return it
+type CanaryConfig struct {
+	// Interval between canary runs
+	Interval time.Duration
+	// Table holds the canary row, default "rsqlite_canary". It is created
+	// when missing and must not be used by the application.
+	Table string
+	// Timeout bounds how long followers are polled for the write; followers
+	// that haven't applied it by then are reported as lagging. Defaults to Interval.
+	Timeout time.Duration
+	// PollInterval is the delay between follower reads, default 10ms
+	PollInterval time.Duration
+}
+
+// validate checks the canary configuration
+func (cfg *CanaryConfig) validate() error {
+	var errs []error
+	if cfg.Interval <= 0 {
+		errs = append(errs, errors.New("canary interval must be positive"))
+	}
+	if cfg.Timeout < 0 {
+		errs = append(errs, errors.New("canary timeout cannot be negative"))
+	}
+	if cfg.PollInterval < 0 {
+		errs = append(errs, errors.New("canary poll interval cannot be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// CanaryResult describes one canary run
+type CanaryResult struct {
+	// Time is when the run started
+	Time time.Time
+	// WriteLatency is the time the leader took to commit the canary write
+	WriteLatency time.Duration
+	// ReplicationLatency is the time from the commit until the slowest
+	// follower returned the write, or the timeout when some lag behind
+	ReplicationLatency time.Duration
+	// Followers maps every follower that returned the write to its latency
+	Followers map[string]time.Duration
+	// Lagging lists followers that hadn't applied the write within the timeout
+	Lagging []string
+	// Err is set when the canary write or the follower discovery failed
+	Err error
+}
+
+// canary runs the canary of a Connector in the background
+type canary struct {
+	cfg       CanaryConfig
+	connector *Connector
+
+	mu          sync.Mutex
+	last        *CanaryResult
+	initialized bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newCanary creates a canary and starts its loop, which runs until ctx is
+// cancelled or the canary is closed
+func newCanary(ctx context.Context, cfg CanaryConfig, connector *Connector) *canary {
+	if cfg.Table == "" {
+		cfg.Table = "rsqlite_canary"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 10 * time.Millisecond
+	}
+
+	cn := &canary{
+		cfg:       cfg,
+		connector: connector,
+		done:      make(chan struct{}),
+	}
+	ctx, cn.cancel = context.WithCancel(ctx)
+	go cn.run(ctx)
+	return cn
+}
+
+// run probes the cluster until ctx is cancelled
+func (cn *canary) run(ctx context.Context) {
+	defer close(cn.done)
+
+	ticker := time.NewTicker(cn.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result := cn.probe(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			cn.mu.Lock()
+			cn.last = &result
+			cn.mu.Unlock()
+
+			cfg, _ := cn.connector.current()
+			if cfg.Hooks != nil && cfg.Hooks.Canary != nil {
+				cfg.Hooks.Canary(ctx, result)
+			}
+		}
+	}
+}
+
+// probe writes the canary row and waits for the followers to return it
+func (cn *canary) probe(ctx context.Context) CanaryResult {
+	result := CanaryResult{Time: time.Now(), Followers: make(map[string]time.Duration)}
+
+	client, err := cn.connector.leaderClient(ctx)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if !cn.initialized {
+		create := "CREATE TABLE IF NOT EXISTS " + quoteIdent(cn.cfg.Table) + " (id INTEGER PRIMARY KEY, seq INTEGER NOT NULL)"
+		if _, err := client.execute(ctx, create, nil); err != nil {
+			result.Err = fmt.Errorf("creating canary table: %w", err)
+			return result
+		}
+		cn.initialized = true
+	}
+
+	seq := result.Time.UnixMicro()
+	write := "INSERT OR REPLACE INTO " + quoteIdent(cn.cfg.Table) + " (id, seq) VALUES (1, ?)"
+	if _, err := client.execute(ctx, write, []interface{}{seq}); err != nil {
+		result.Err = fmt.Errorf("canary write: %w", err)
+		return result
+	}
+	committed := time.Now()
+	result.WriteLatency = committed.Sub(result.Time)
+
+	nodes, err := cn.connector.Nodes(ctx)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	cfg, _ := cn.connector.current()
+	httpClient := newHTTPClient(cfg, cfg.Timeout)
+	read := "SELECT seq FROM " + quoteIdent(cn.cfg.Table) + " WHERE id = 1"
+
+	pollCtx, cancel := context.WithTimeout(ctx, cn.cfg.Timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		if node.Leader || !node.Reachable || node.APIAddr == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+
+			follower := newAPIClientForConfig(node, httpClient, cfg)
+			applied := cn.poll(pollCtx, follower, read, seq)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if applied {
+				result.Followers[node] = time.Since(committed)
+			} else {
+				result.Lagging = append(result.Lagging, node)
+			}
+		}(node.APIAddr)
+	}
+	wg.Wait()
+
+	sort.Strings(result.Lagging)
+	if len(result.Lagging) > 0 {
+		result.ReplicationLatency = cn.cfg.Timeout
+	}
+	for _, latency := range result.Followers {
+		if latency > result.ReplicationLatency {
+			result.ReplicationLatency = latency
+		}
+	}
+
+	return result
+}
+
+// poll reads the canary row from a follower at none consistency until it
+// holds seq or ctx is done
+func (cn *canary) poll(ctx context.Context, follower *apiClient, read string, seq int64) bool {
+	for {
+		if rows, err := follower.query(ctx, "none", read, nil); err == nil && len(rows.Values) > 0 && len(rows.Values[0]) > 0 {
+			if got, err := toInt64(rows.Values[0][0]); err == nil && got >= seq {
+				return true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(cn.cfg.PollInterval):
+		}
+	}
+}
+
+// lastResult returns the result of the latest canary run, nil before the first
+func (cn *canary) lastResult() *CanaryResult {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if cn.last == nil {
+		return nil
+	}
+	result := *cn.last
+	return &result
+}
+
+// close stops the canary loop
+func (cn *canary) close() {
+	cn.cancel()
+	<-cn.done
+}
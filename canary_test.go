@@ -0,0 +1,118 @@
+package rsqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCanaryLaggingFollower(t *testing.T) {
+	// seq is the canary row on the leader; behind holds the lagging follower back
+	var seq, behind atomic.Int64
+	behind.Store(1)
+
+	var leader, fast, slow, down *httptest.Server
+	leader = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			http.NotFound(w, r)
+		case "/nodes":
+			fmt.Fprintf(w, `{"nodes": [
+				{"id": "n1", "api_addr": %q, "leader": true, "reachable": true, "voter": true},
+				{"id": "n2", "api_addr": %q, "leader": false, "reachable": true, "voter": true},
+				{"id": "n3", "api_addr": %q, "leader": false, "reachable": true, "voter": true},
+				{"id": "n4", "api_addr": %q, "leader": false, "reachable": false, "voter": true}]}`,
+				leader.URL, fast.URL, slow.URL, down.URL)
+		case "/db/execute":
+			body, _ := io.ReadAll(r.Body)
+			var statements [][]interface{}
+			json.Unmarshal(body, &statements)
+			if len(statements[0]) > 1 {
+				seq.Store(int64(statements[0][1].(float64)))
+			}
+			w.Write([]byte(`{"results": [{"rows_affected": 1}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer leader.Close()
+
+	follower := func(lagging bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/db/query" {
+				http.NotFound(w, r)
+				return
+			}
+			if r.URL.Query().Get("level") != "none" {
+				t.Errorf("canary read at level %q, want none", r.URL.Query().Get("level"))
+			}
+			applied := seq.Load()
+			if lagging && behind.Load() == 1 {
+				applied--
+			}
+			fmt.Fprintf(w, `{"results": [{"columns": ["seq"], "types": ["integer"], "values": [[%d]]}]}`, applied)
+		}
+	}
+	fast = httptest.NewServer(follower(false))
+	defer fast.Close()
+	slow = httptest.NewServer(follower(true))
+	defer slow.Close()
+	down = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unreachable follower polled: %s", r.URL)
+	}))
+	defer down.Close()
+
+	results := make(chan CanaryResult, 16)
+	cfg, err := ParseDSN(leader.URL + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Canary = &CanaryConfig{Interval: 20 * time.Millisecond, Timeout: 50 * time.Millisecond, PollInterval: time.Millisecond}
+	cfg.Hooks = &Hooks{Canary: func(_ context.Context, result CanaryResult) {
+		select {
+		case results <- result:
+		default:
+		}
+	}}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+
+	result := <-results
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if len(result.Lagging) != 1 || result.Lagging[0] != slow.URL {
+		t.Errorf("lagging followers %q, want %s", result.Lagging, slow.URL)
+	}
+	if _, ok := result.Followers[fast.URL]; !ok || len(result.Followers) != 1 {
+		t.Errorf("followers %v, want only %s", result.Followers, fast.URL)
+	}
+	// A lagging follower counts as the timeout
+	if result.ReplicationLatency != 50*time.Millisecond || result.WriteLatency <= 0 {
+		t.Errorf("replication latency %v, write latency %v", result.ReplicationLatency, result.WriteLatency)
+	}
+	if last := connector.Stats().Canary; last == nil {
+		t.Error("canary result missing from the stats")
+	}
+
+	// Once the follower catches up every follower returns the write in time
+	behind.Store(0)
+	for {
+		result = <-results
+		if len(result.Lagging) == 0 {
+			break
+		}
+	}
+	if len(result.Followers) != 2 || result.ReplicationLatency >= 50*time.Millisecond {
+		t.Errorf("caught up result %+v", result)
+	}
+}
@@ -0,0 +1,560 @@
+package rsqlite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// linearizableMinVersion is the first rqlite release serving linearizable reads
+// from the leader without a raft round-trip
+const linearizableMinVersion = "v8.26.0"
+
+// sqliteFileHeader starts every SQLite database file
+const sqliteFileHeader = "SQLite format 3\x00"
+
+// errSQLDumpUnsupported reports a server that can't produce SQL text backups
+var errSQLDumpUnsupported = errors.New("server does not support SQL dumps")
+
+// apiClient talks to the HTTP API of a single rqlite node
+type apiClient struct {
+	node       string
+	httpClient *http.Client
+	codec      Codec
+	// maxRequestBytes rejects larger request bodies before sending; 0 disables the check
+	maxRequestBytes int64
+	// header identifies the application and carries the credentials
+	header transport.Header
+	// compression is requested for backup transfers when set
+	compression Compression
+	// queue sends single writes through the queued write endpoint
+	queue bool
+	// raftIndex asks writes to report the raft index they were committed at
+	raftIndex bool
+	// queryTimeout and execTimeout replace the HTTP client's timeout for
+	// query and write requests when set
+	queryTimeout time.Duration
+	execTimeout  time.Duration
+	// sample, if set, is told the round-trip of every statement request
+	sample func(node string, latency time.Duration, err error)
+	// warm holds precomputed statements whose encoded text the JSON codec reuses
+	warm *warmCache
+
+	mu      sync.RWMutex
+	version string
+	// answeredAt is when the node last answered a request, in Unix
+	// nanoseconds, 0 before the first answer
+	answeredAt atomic.Int64
+}
+
+// newAPIClient creates a client for the given node
+func newAPIClient(node string, httpClient *http.Client, codec Codec) *apiClient {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	return &apiClient{
+		node:       transport.NormalizeNode(node),
+		httpClient: httpClient,
+		codec:      codec,
+	}
+}
+
+// newAPIClientForConfig creates a client for the given node applying the
+// request settings of the configuration
+func newAPIClientForConfig(node string, httpClient *http.Client, cfg *Config) *apiClient {
+	client := newAPIClient(node, httpClient, cfg.Codec)
+	client.maxRequestBytes = cfg.MaxRequestBytes
+	client.header = transport.Header{AppName: cfg.AppName, Username: cfg.Username, Password: cfg.Password}
+	client.compression = cfg.BackupCompression
+	client.queue = cfg.Queue
+	client.raftIndex = cfg.ReadYourWrites
+	client.queryTimeout = cfg.QueryTimeout
+	client.execTimeout = cfg.ExecTimeout
+	return client
+}
+
+// query runs a read statement at the given consistency level
+func (c *apiClient) query(ctx context.Context, level string, query string, args []interface{}) (*StatementResult, error) {
+	params := url.Values{}
+	if level != "" {
+		params.Set("level", level)
+	}
+
+	return c.do(ctx, "/db/query", params, query, args)
+}
+
+// execute runs a write statement
+func (c *apiClient) execute(ctx context.Context, query string, args []interface{}) (*StatementResult, error) {
+	if c.queue {
+		return c.executeQueued(ctx, []Statement{{Query: query, Args: args}}, false)
+	}
+	return c.do(ctx, "/db/execute", c.executeParams(), query, args)
+}
+
+// executeParams returns the query parameters of a write request
+func (c *apiClient) executeParams() url.Values {
+	params := url.Values{}
+	if c.raftIndex {
+		params.Set("raft_index", "")
+	}
+	return params
+}
+
+// executeBatch runs several write statements in one request. With transaction
+// set, rqlite applies them atomically: either all of them or none.
+func (c *apiClient) executeBatch(ctx context.Context, statements []Statement, transaction bool) ([]StatementResult, error) {
+	params := c.executeParams()
+	if transaction {
+		params.Set("transaction", "")
+	}
+
+	return c.doBatch(ctx, "/db/execute", params, statements)
+}
+
+// do posts a single parameterized statement to the given endpoint
+func (c *apiClient) do(ctx context.Context, path string, params url.Values, query string, args []interface{}) (*StatementResult, error) {
+	results, err := c.doBatch(ctx, path, params, []Statement{{Query: query, Args: args}})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &results[0]
+	if result.Error != "" {
+		return nil, &statementError{msg: result.Error}
+	}
+
+	return result, nil
+}
+
+// doBatch posts statements to the given endpoint and returns their results.
+// Per-statement errors are left in the results for the caller to inspect.
+func (c *apiClient) doBatch(ctx context.Context, path string, params url.Values, statements []Statement) ([]StatementResult, error) {
+	apiResp, sent, received, err := c.roundTrip(ctx, path, params, statements)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(apiResp.Results) == 0 {
+		return nil, errors.New("no results in response")
+	}
+
+	// Request accounting is attributed to the first statement
+	result := &apiResp.Results[0]
+	result.node = c.node
+	result.bytesSent = sent
+	result.bytesReceived = received
+	result.raftIndex = apiResp.RaftIndex
+	return apiResp.Results, nil
+}
+
+// roundTrip posts statements to the given endpoint and decodes the response,
+// returning it with the sizes of the request and response bodies
+func (c *apiClient) roundTrip(ctx context.Context, path string, params url.Values, statements []Statement) (*Response, int, int, error) {
+	resp, body, err := c.post(ctx, path, params, statements)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if resp.StatusCode == http.StatusRequestEntityTooLarge {
+		return nil, 0, 0, &RequestTooLargeError{Size: len(body)}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, 0, &transport.StatusError{Path: path, Code: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+
+	apiResp, err := c.codec.DecodeResponse(respBody)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if apiResp.Error != "" {
+		return nil, 0, 0, &transport.RequestError{Msg: apiResp.Error}
+	}
+
+	return apiResp, len(body), len(respBody), nil
+}
+
+// executeQueued hands write statements to the leader's write queue. It
+// returns once they are queued, or with wait once the queue holding them is
+// persisted. The result carries no insert id or affected rows, which aren't
+// known until the queue is applied.
+func (c *apiClient) executeQueued(ctx context.Context, statements []Statement, wait bool) (*StatementResult, error) {
+	params := url.Values{}
+	params.Set("queue", "")
+	if wait {
+		params.Set("wait", "")
+	}
+
+	apiResp, sent, received, err := c.roundTrip(ctx, "/db/execute", params, statements)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatementResult{
+		SequenceNumber: apiResp.SequenceNumber,
+		node:           c.node,
+		bytesSent:      sent,
+		bytesReceived:  received,
+		queued:         true,
+	}, nil
+}
+
+// encodeStatements encodes a request body with the client's codec. A single
+// warmed statement sent as JSON reuses its encoded query text.
+func (c *apiClient) encodeStatements(statements []Statement) ([]byte, error) {
+	if _, ok := c.codec.(JSONCodec); ok && len(statements) == 1 {
+		if ws := c.warm.lookup(statements[0].Query); ws != nil {
+			return encodeWarm(ws, statements[0].Args)
+		}
+	}
+	return c.codec.EncodeStatements(statements)
+}
+
+// post encodes statements and posts them to the given endpoint, returning
+// the response, whose body the caller must close, and the request body
+func (c *apiClient) post(ctx context.Context, path string, params url.Values, statements []Statement) (*http.Response, []byte, error) {
+	body, err := c.encodeStatements(statements)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.maxRequestBytes > 0 && int64(len(body)) > c.maxRequestBytes {
+		return nil, nil, &RequestTooLargeError{Size: len(body), Limit: c.maxRequestBytes}
+	}
+
+	endpoint := c.node + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", c.codec.ContentType())
+	c.header.Apply(req)
+
+	start := time.Now()
+	resp, err := c.httpClientFor(path).Do(req)
+	c.recordSample(start, resp, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.recordVersion(resp)
+	if resp.StatusCode < http.StatusInternalServerError {
+		c.answeredAt.Store(time.Now().UnixNano())
+	}
+	if leader := transport.RedirectedTo(resp, c.node, path); leader != "" {
+		resp.Body.Close()
+		return nil, nil, &NotLeaderError{Node: c.node, Leader: leader}
+	}
+	return resp, body, nil
+}
+
+// httpClientFor returns the HTTP client for statements posted to path,
+// applying the query or exec timeout
+func (c *apiClient) httpClientFor(path string) *http.Client {
+	timeout := c.queryTimeout
+	if path == "/db/execute" {
+		timeout = c.execTimeout
+	}
+	if timeout == 0 || timeout == c.httpClient.Timeout {
+		return c.httpClient
+	}
+
+	httpClient := *c.httpClient
+	httpClient.Timeout = timeout
+	return &httpClient
+}
+
+// backup streams a snapshot of the database into w, in SQLite format or,
+// with format "sql", as SQL text. Servers without SQL dumps ignore the format
+// and answer with a SQLite file; that is reported as errSQLDumpUnsupported
+// before anything is written.
+func (c *apiClient) backup(ctx context.Context, format string, w io.Writer) error {
+	params := url.Values{}
+	if format != "" {
+		params.Set("fmt", format)
+	}
+	// rqlite compresses backups with gzip when asked with ?compress
+	if c.compression != nil && c.compression.Name() == "gzip" {
+		params.Set("compress", "")
+	}
+
+	endpoint := c.node + "/db/backup"
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	c.header.Apply(req)
+	if c.compression != nil {
+		req.Header.Set("Accept-Encoding", c.compression.Name())
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	c.recordVersion(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("/db/backup request failed: %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if c.compressed(resp, body) {
+		decompressed, err := c.compression.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer decompressed.Close()
+		body = bufio.NewReader(decompressed)
+	}
+
+	if format == "sql" {
+		if header, _ := body.Peek(len(sqliteFileHeader)); string(header) == sqliteFileHeader {
+			return errSQLDumpUnsupported
+		}
+	}
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// load replaces the database with the SQLite file read from r through
+// /db/load, or through /boot when boot is set, which only single-node
+// clusters accept but which avoids streaming the file through the raft log
+func (c *apiClient) load(ctx context.Context, boot bool, r io.Reader) error {
+	path := "/db/load"
+	if boot {
+		path = "/boot"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.node+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	c.header.Apply(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	c.recordVersion(resp)
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s request failed: %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var apiResp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &apiResp) == nil && apiResp.Error != "" {
+		return errors.New(apiResp.Error)
+	}
+
+	return nil
+}
+
+// backupPart describes a ranged backup response
+type backupPart struct {
+	// partial is true when the server honoured the range and sent only the rest
+	partial bool
+	// etag identifies the snapshot, "" when the server sent none
+	etag string
+	// digest is the SHA-256 announced by the server for the whole snapshot, or nil
+	digest []byte
+}
+
+// backupFrom streams the SQLite snapshot starting at offset into the writer
+// returned by open, which is called once the response headers are known. The
+// range is only requested together with the etag of the snapshot being
+// resumed; servers that can't resume it answer with the whole snapshot.
+func (c *apiClient) backupFrom(ctx context.Context, offset int64, etag string, open func(part *backupPart) (io.Writer, error)) (*backupPart, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.node+"/db/backup", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.header.Apply(req)
+	if offset > 0 && etag != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", etag)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	c.recordVersion(resp)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("/db/backup request failed: %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	part := &backupPart{
+		partial: resp.StatusCode == http.StatusPartialContent,
+		etag:    resp.Header.Get("ETag"),
+		digest:  parseSHA256Digest(resp.Header),
+	}
+
+	w, err := open(part)
+	if err != nil {
+		return part, err
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return part, err
+}
+
+// parseSHA256Digest extracts a SHA-256 digest from the Repr-Digest or
+// Digest response headers, returning nil when none is announced
+func parseSHA256Digest(header http.Header) []byte {
+	for _, value := range []string{header.Get("Repr-Digest"), header.Get("Digest")} {
+		for _, item := range strings.Split(value, ",") {
+			algorithm, encoded, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok || !strings.EqualFold(algorithm, "sha-256") {
+				continue
+			}
+			// Repr-Digest wraps the value in colons
+			encoded = strings.Trim(encoded, ":")
+			if digest, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(digest) == sha256.Size {
+				return digest
+			}
+		}
+	}
+	return nil
+}
+
+// compressed reports whether a backup response body is compressed with the
+// client's codec, either announced by Content-Encoding or, for gzip, which
+// rqlite sends as a plain body, recognized by its magic bytes
+func (c *apiClient) compressed(resp *http.Response, body *bufio.Reader) bool {
+	if c.compression == nil {
+		return false
+	}
+
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), c.compression.Name()) {
+		return true
+	}
+
+	if c.compression.Name() == "gzip" {
+		magic, _ := body.Peek(2)
+		return len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+	}
+	return false
+}
+
+// recordVersion remembers the server version advertised in the response headers
+func (c *apiClient) recordVersion(resp *http.Response) {
+	version := resp.Header.Get("X-Rqlite-Version")
+	if version == "" {
+		return
+	}
+
+	c.mu.Lock()
+	c.version = version
+	c.mu.Unlock()
+}
+
+// answeredWithin reports whether the node answered a request in the last d
+func (c *apiClient) answeredWithin(d time.Duration) bool {
+	answeredAt := c.answeredAt.Load()
+	return answeredAt != 0 && time.Since(time.Unix(0, answeredAt)) <= d
+}
+
+// serverVersion returns the last server version seen, or "" if unknown
+func (c *apiClient) serverVersion() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
+
+// supportsLinearizable reports whether the node can serve linearizable reads
+func (c *apiClient) supportsLinearizable() bool {
+	return versionAtLeast(c.serverVersion(), linearizableMinVersion)
+}
+
+// versionAtLeast reports whether version is greater than or equal to min.
+// Versions look like "v8.26.0"; unparsable versions never satisfy the check.
+func versionAtLeast(version, min string) bool {
+	v, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+
+	m, ok := parseVersion(min)
+	if !ok {
+		return false
+	}
+
+	for i := range v {
+		if v[i] != m[i] {
+			return v[i] > m[i]
+		}
+	}
+
+	return true
+}
+
+// parseVersion parses a semantic version into its major, minor and patch parts
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+
+	fields := strings.Split(version, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+
+	return parts, true
+}
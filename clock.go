@@ -0,0 +1,52 @@
+package rsqlite
+
+import "github.com/zhenruyan/rsqlite/internal/transport"
+
+// Clock tells the time and starts the timers of the cluster manager and the
+// retry engine, so tests can drive discovery caching, quarantines and retry
+// backoff without sleeping; see Config.Clock
+type Clock = transport.Clock
+
+// Timer is a timer started by a Clock
+type Timer = transport.Timer
+
+// Rand is the randomness of node selection and retry jitter; see Config.Rand. A seeded
+// *rand.Rand of math/rand/v2 implements it, but must be guarded by a lock
+// as Rand must be safe for concurrent use.
+type Rand = transport.Rand
+
+// clockFor returns the configured clock, or the system clock
+func clockFor(cfg *Config) Clock {
+	if cfg.Clock != nil {
+		return cfg.Clock
+	}
+	return transport.SystemClock{}
+}
+
+// randFor returns the configured randomness, or math/rand/v2's
+func randFor(cfg *Config) Rand {
+	if cfg.Rand != nil {
+		return cfg.Rand
+	}
+	return transport.SystemRand{}
+}
+
+// SetClock replaces the clock of cache and quarantine expiry and of
+// WaitForIndex polling; nil restores the system clock. It must be called
+// before the cluster manager is used.
+func (cm *ClusterManager) SetClock(clock Clock) {
+	if clock == nil {
+		clock = transport.SystemClock{}
+	}
+	cm.clock = clock
+}
+
+// SetRand replaces the randomness of the follower and random read
+// preferences; nil restores the math/rand/v2 source. It must be called before
+// the cluster manager is used.
+func (cm *ClusterManager) SetRand(r Rand) {
+	if r == nil {
+		r = transport.SystemRand{}
+	}
+	cm.rand = r
+}
@@ -0,0 +1,86 @@
+package rsqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ClusterInfo describes the cluster a Connector talks to
+type ClusterInfo struct {
+	// Leader is the API address of the leader, "" if unknown
+	Leader string
+	// Peers are the other nodes reported by the leader
+	Peers []string
+	// Version is the rqlite version advertised by the answering node
+	Version string
+	// ForeignKeys reports whether the server enforces foreign key constraints,
+	// which rqlite only does when started with -fk
+	ForeignKeys bool
+}
+
+// ClusterInfo discovers the leader and queries the server settings
+func (c *Connector) ClusterInfo(ctx context.Context) (*ClusterInfo, error) {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fk, err := foreignKeysEnabled(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	cm := c.sharedClusterManager()
+	return &ClusterInfo{
+		Leader:      cm.GetLeader(),
+		Peers:       cm.GetPeers(),
+		Version:     client.serverVersion(),
+		ForeignKeys: fk,
+	}, nil
+}
+
+// foreignKeysEnabled reads PRAGMA foreign_keys on the node
+func foreignKeysEnabled(ctx context.Context, client *apiClient) (bool, error) {
+	result, err := client.query(ctx, "", "PRAGMA foreign_keys", nil)
+	if err != nil {
+		return false, err
+	}
+
+	if len(result.Values) == 0 || len(result.Values[0]) == 0 {
+		return false, fmt.Errorf("unexpected PRAGMA foreign_keys result")
+	}
+
+	enabled, err := toInt64(result.Values[0][0])
+	if err != nil {
+		return false, err
+	}
+	return enabled == 1, nil
+}
+
+// declaresForeignKeys reports whether a statement creates a table with foreign keys
+func declaresForeignKeys(query string) bool {
+	fp := Fingerprint(query)
+	return strings.HasPrefix(fp, "create ") && strings.Contains(fp, " table ") &&
+		(strings.Contains(fp, " references ") || strings.Contains(fp, "foreign key"))
+}
+
+// adviseForeignKeys reports through the Advisory hook when a statement declares
+// foreign keys the server won't enforce
+func (c *Conn) adviseForeignKeys(ctx context.Context, query string) {
+	if c.cfg.Hooks == nil || c.cfg.Hooks.Advisory == nil || !declaresForeignKeys(query) {
+		return
+	}
+
+	c.mu.RLock()
+	client := c.client
+	c.mu.RUnlock()
+	if client == nil {
+		return
+	}
+
+	if enabled, err := foreignKeysEnabled(ctx, client); err == nil && !enabled {
+		c.cfg.Hooks.Advisory(ctx, fmt.Sprintf(
+			"statement declares foreign keys but %s does not enforce them; start rqlite with -fk: %s", client.node, Fingerprint(query)))
+	}
+}
@@ -0,0 +1,101 @@
+package rsqlite
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// Statement is a single parameterized SQL statement
+type Statement = transport.Statement
+
+// StatementResult holds the result of a single statement returned by the rqlite HTTP API
+type StatementResult struct {
+	Columns      []string        `json:"columns"`
+	Types        []string        `json:"types"`
+	Values       [][]interface{} `json:"values"`
+	LastInsertID int64           `json:"last_insert_id"`
+	RowsAffected int64           `json:"rows_affected"`
+	Error        string          `json:"error"`
+	// SequenceNumber identifies a queued write, see Config.Queue
+	SequenceNumber int64 `json:"-"`
+
+	// Accounting filled in by the client, not part of the response body
+	node          string
+	bytesSent     int
+	bytesReceived int
+	// queued marks a write acknowledged by the write queue, see Config.Queue
+	queued bool
+	// raftIndex is the raft index the request was committed at, when requested
+	raftIndex uint64
+}
+
+// Response is the envelope returned by /db/query and /db/execute
+type Response struct {
+	Results []StatementResult `json:"results"`
+	Error   string            `json:"error"`
+	// SequenceNumber identifies the request of a queued write
+	SequenceNumber int64 `json:"sequence_number"`
+	// RaftIndex is the raft index a write was committed at, returned when
+	// the request asks for raft_index
+	RaftIndex uint64 `json:"raft_index"`
+}
+
+// Codec abstracts the wire encoding of requests and responses, so custom
+// gateways or future rqlite protocols can be supported without changing Conn.
+//
+// Numbers in decoded result values should be json.Number, float64 or int64;
+// Rows converts them according to the StrictNumbers setting.
+type Codec interface {
+	// ContentType is sent as the Content-Type header of requests
+	ContentType() string
+	// EncodeStatements encodes statements into a request body
+	EncodeStatements(statements []Statement) ([]byte, error)
+	// DecodeResponse decodes a response body
+	DecodeResponse(body []byte) (*Response, error)
+}
+
+// JSONCodec implements the JSON encoding of the rqlite HTTP API
+type JSONCodec struct{}
+
+// ContentType implements the Codec interface
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// EncodeStatements implements the Codec interface. Each statement is encoded
+// as an array holding the query followed by its positional arguments.
+func (JSONCodec) EncodeStatements(statements []Statement) ([]byte, error) {
+	return transport.EncodeStatements(statements)
+}
+
+// encodeWarm encodes a single warmed statement, reusing its encoded query text
+func encodeWarm(ws *warmStatement, args []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(ws.encoded) + 16*len(args) + 4)
+	buf.WriteString("[[")
+	buf.Write(ws.encoded)
+	for _, arg := range args {
+		encoded, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(encoded)
+	}
+	buf.WriteString("]]")
+	return buf.Bytes(), nil
+}
+
+// DecodeResponse implements the Codec interface. Numbers are decoded as
+// json.Number so Rows can choose how to convert them.
+func (JSONCodec) DecodeResponse(body []byte) (*Response, error) {
+	var resp Response
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,71 @@
+package rsqlite
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Compression is a stream compression codec used for backup transfers.
+// Implementations for codecs outside the standard library, such as zstd,
+// can be added with RegisterCompression.
+type Compression interface {
+	// Name is the Content-Encoding token of the codec, e.g. "gzip"
+	Name() string
+	// NewReader decompresses r
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	// NewWriter compresses into w
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// GzipCompression implements gzip compression, which rqlite serves natively
+type GzipCompression struct {
+	// Level is the compression level; gzip.DefaultCompression when 0
+	Level int
+}
+
+// Name implements the Compression interface
+func (GzipCompression) Name() string {
+	return "gzip"
+}
+
+// NewReader implements the Compression interface
+func (GzipCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// NewWriter implements the Compression interface
+func (g GzipCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = map[string]Compression{"gzip": GzipCompression{}}
+)
+
+// RegisterCompression makes a codec selectable by name with the
+// backup_compression DSN parameter
+func RegisterCompression(c Compression) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	compressions[strings.ToLower(c.Name())] = c
+}
+
+// lookupCompression returns the registered codec with the given name
+func lookupCompression(name string) (Compression, error) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+
+	c, ok := compressions[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q", name)
+	}
+	return c, nil
+}
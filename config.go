@@ -0,0 +1,241 @@
+package rsqlite
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// validConsistencyLevels lists the read consistency levels understood by rqlite
+var validConsistencyLevels = map[string]bool{
+	"none":         true,
+	"weak":         true,
+	"strong":       true,
+	"linearizable": true,
+	"auto":         true,
+}
+
+// Validate checks the configuration and returns an error listing every problem found
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if len(cfg.Nodes) == 0 {
+		errs = append(errs, errors.New("no nodes configured: add at least one host:port"))
+	}
+
+	seen := make(map[string]bool, len(cfg.Nodes))
+	httpsNodes := 0
+	for _, node := range cfg.Nodes {
+		if seen[node] {
+			errs = append(errs, fmt.Errorf("node %q is listed more than once", node))
+		}
+		seen[node] = true
+
+		u, err := url.Parse(node)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("node %q is not a valid URL: %v", node, err))
+			continue
+		}
+		if u.Scheme == "https" {
+			httpsNodes++
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("node %q has unsupported scheme %q: use http or https", node, u.Scheme))
+		}
+		if u.Host == "" {
+			errs = append(errs, fmt.Errorf("node %q has no host: use host:port", node))
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("node %q must not contain a query or fragment: only a base path is allowed", node))
+		}
+	}
+
+	if !validConsistencyLevels[cfg.ConsistencyLevel] {
+		errs = append(errs, fmt.Errorf("unknown consistency level %q: use none, weak, strong, linearizable or auto", cfg.ConsistencyLevel))
+	}
+	if cfg.ReadConsistency != "" && !validConsistencyLevels[cfg.ReadConsistency] {
+		errs = append(errs, fmt.Errorf("unknown read consistency level %q: use none, weak, strong, linearizable or auto", cfg.ReadConsistency))
+	}
+	if cfg.WriteConsistency != "" && !validConsistencyLevels[cfg.WriteConsistency] {
+		errs = append(errs, fmt.Errorf("unknown write consistency level %q: use none, weak, strong, linearizable or auto", cfg.WriteConsistency))
+	}
+
+	if !validReadPreferences[cfg.ReadPreference] {
+		errs = append(errs, fmt.Errorf("unknown read preference %q: use leader, follower, round_robin, random or nearest", cfg.ReadPreference))
+	}
+
+	if !validTimeFormats[cfg.TimeFormat] {
+		errs = append(errs, fmt.Errorf("unknown time format %q: use rfc3339, datetime, unix or unix_milli", cfg.TimeFormat))
+	}
+
+	if !validDeliveries[cfg.Delivery] {
+		errs = append(errs, fmt.Errorf("unknown delivery %q: use at_least_once or at_most_once", cfg.Delivery))
+	}
+
+	if cfg.DefaultScheme != "" && cfg.DefaultScheme != "http" && cfg.DefaultScheme != "https" {
+		errs = append(errs, fmt.Errorf("unknown default scheme %q: use http or https", cfg.DefaultScheme))
+	}
+
+	if cfg.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("timeout must be positive, got %s", cfg.Timeout))
+	} else if cfg.Timeout < time.Millisecond {
+		errs = append(errs, fmt.Errorf("timeout %s is shorter than a millisecond: durations are in nanoseconds, e.g. 30 * time.Second", cfg.Timeout))
+	}
+
+	for _, t := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"dial", cfg.DialTimeout},
+		{"query", cfg.QueryTimeout},
+		{"exec", cfg.ExecTimeout},
+	} {
+		if t.timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s timeout cannot be negative, got %s", t.name, t.timeout))
+		} else if t.timeout > 0 && t.timeout < time.Millisecond {
+			errs = append(errs, fmt.Errorf("%s timeout %s is shorter than a millisecond: durations are in nanoseconds, e.g. 30 * time.Second", t.name, t.timeout))
+		}
+	}
+
+	if cfg.MaxRequestBytes < 0 {
+		errs = append(errs, fmt.Errorf("max request size cannot be negative, got %d", cfg.MaxRequestBytes))
+	}
+
+	if cfg.SlowQueryThreshold < 0 {
+		errs = append(errs, fmt.Errorf("slow query threshold cannot be negative, got %s", cfg.SlowQueryThreshold))
+	}
+
+	if cfg.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("max retries cannot be negative, got %d", cfg.MaxRetries))
+	}
+
+	if cfg.RetryBackoff < 0 || cfg.RetryMaxElapsed < 0 {
+		errs = append(errs, errors.New("retry backoff and max elapsed time cannot be negative"))
+	}
+
+	if cfg.MaxResultMemory < 0 {
+		errs = append(errs, fmt.Errorf("max result memory cannot be negative, got %d", cfg.MaxResultMemory))
+	}
+
+	if cfg.MaxRows < 0 {
+		errs = append(errs, fmt.Errorf("max rows cannot be negative, got %d", cfg.MaxRows))
+	}
+
+	if cfg.MaxQuarantine < 0 {
+		errs = append(errs, fmt.Errorf("max quarantine cannot be negative, got %s", cfg.MaxQuarantine))
+	}
+
+	if cfg.StaleAfter < 0 {
+		errs = append(errs, fmt.Errorf("stale after cannot be negative, got %s", cfg.StaleAfter))
+	}
+
+	if cfg.InteractiveLimit < 0 {
+		errs = append(errs, fmt.Errorf("interactive limit cannot be negative, got %d", cfg.InteractiveLimit))
+	}
+
+	if cfg.ReplicaCache != nil {
+		if err := cfg.ReplicaCache.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.AdaptiveTimeout != nil {
+		if err := cfg.AdaptiveTimeout.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.Canary != nil {
+		if err := cfg.Canary.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.Retry != nil {
+		if err := cfg.Retry.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.Throttle != nil {
+		if err := cfg.Throttle.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.Idempotency != nil {
+		if err := cfg.Idempotency.validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if cfg.Queue {
+			errs = append(errs, errors.New("idempotency keys can't be used with queued writes"))
+		}
+	}
+
+	if cfg.Username == "" && cfg.Password != "" {
+		errs = append(errs, errors.New("password set without username"))
+	}
+	if strings.Contains(cfg.Username, ":") {
+		errs = append(errs, errors.New("username must not contain \":\", which HTTP Basic Auth uses as the separator"))
+	}
+
+	if cfg.TLSConfig != nil && len(cfg.Nodes) > 0 && httpsNodes == 0 {
+		errs = append(errs, errors.New("TLS is configured but no node uses https: use https:// nodes or default_scheme=https"))
+	}
+	if cfg.TLSConfig != nil {
+		if cfg.TLSConfig.InsecureSkipVerify && cfg.TLSConfig.RootCAs != nil {
+			errs = append(errs, errors.New("tls_insecure skips verifying the server against tls_ca: set only one of them"))
+		}
+		for i, cert := range cfg.TLSConfig.Certificates {
+			if cert.PrivateKey == nil {
+				errs = append(errs, fmt.Errorf("TLS client certificate %d has no private key", i))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ReplicaConfig returns a copy of the configuration for a second sql.DB
+// dedicated to reporting reads: consistency level none, served by followers
+// when possible, with writes rejected
+func (cfg *Config) ReplicaConfig() *Config {
+	replica := cfg.clone()
+	replica.ConsistencyLevel = "none"
+	replica.ReadConsistency = ""
+	replica.PreferFollowers = true
+	replica.ReadOnly = true
+	return replica
+}
+
+// readConsistency returns the consistency level of queries
+func (cfg *Config) readConsistency() string {
+	if cfg.ReadConsistency != "" {
+		return cfg.ReadConsistency
+	}
+	return cfg.ConsistencyLevel
+}
+
+// writeConsistency returns the consistency level of Exec
+func (cfg *Config) writeConsistency() string {
+	if cfg.WriteConsistency != "" {
+		return cfg.WriteConsistency
+	}
+	return cfg.ConsistencyLevel
+}
+
+// clone returns a deep copy of the configuration
+func (cfg *Config) clone() *Config {
+	c := *cfg
+	c.Nodes = append([]string(nil), cfg.Nodes...)
+	c.ParamsOnlyAllow = append([]string(nil), cfg.ParamsOnlyAllow...)
+	if cfg.Databases != nil {
+		c.Databases = make(map[string]string, len(cfg.Databases))
+		for name, prefix := range cfg.Databases {
+			c.Databases[name] = prefix
+		}
+	}
+	return &c
+}
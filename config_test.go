@@ -0,0 +1,104 @@
+package rsqlite
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	base := func() *Config {
+		cfg, err := ParseDSN("https://n1:4001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		errs   []string
+	}{
+		{name: "valid", modify: func(cfg *Config) {}},
+		{
+			name: "client certificate with key",
+			modify: func(cfg *Config) {
+				cfg.TLSConfig = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{{1}}, PrivateKey: struct{}{}}}}
+			},
+		},
+		{
+			name:   "no nodes",
+			modify: func(cfg *Config) { cfg.Nodes = nil },
+			errs:   []string{"no nodes configured"},
+		},
+		{
+			name:   "duplicate node and bad scheme",
+			modify: func(cfg *Config) { cfg.Nodes = []string{"https://n1:4001", "https://n1:4001", "ftp://n2"} },
+			errs:   []string{"listed more than once", `unsupported scheme "ftp"`},
+		},
+		{
+			name:   "tls without https",
+			modify: func(cfg *Config) { cfg.Nodes = []string{"http://n1:4001"}; cfg.TLSConfig = &tls.Config{} },
+			errs:   []string{"no node uses https"},
+		},
+		{
+			name: "insecure with a CA",
+			modify: func(cfg *Config) {
+				cfg.TLSConfig = &tls.Config{InsecureSkipVerify: true, RootCAs: x509.NewCertPool()}
+			},
+			errs: []string{"set only one of them"},
+		},
+		{
+			name: "client certificate without key",
+			modify: func(cfg *Config) {
+				cfg.TLSConfig = &tls.Config{Certificates: []tls.Certificate{
+					{Certificate: [][]byte{{1}}, PrivateKey: struct{}{}},
+					{Certificate: [][]byte{{2}}},
+				}}
+			},
+			errs: []string{"certificate 1 has no private key"},
+		},
+	}
+	for _, tt := range tests {
+		cfg := base()
+		tt.modify(cfg)
+		err := cfg.Validate()
+		if len(tt.errs) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: configuration accepted", tt.name)
+			continue
+		}
+		for _, want := range tt.errs {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q lacks %q", tt.name, err, want)
+			}
+		}
+	}
+
+	// The DSN parameters conflict the same way
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseDSN(server.URL + "?tls_insecure=true&tls_ca=" + ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewConnector(cfg); err == nil || !strings.Contains(err.Error(), "tls_insecure") {
+		t.Errorf("tls_insecure with tls_ca = %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+// Package conformancetest runs the database/sql behavior the rsqlite driver
+// promises against a live rqlite cluster, so applications can check their
+// rqlite version and driver combination in their own CI:
+//
+//	func TestRqlite(t *testing.T) {
+//		dsn := os.Getenv("RQLITE_DSN")
+//		if dsn == "" {
+//			t.Skip("RQLITE_DSN not set")
+//		}
+//		conformancetest.Run(t, dsn)
+//	}
+//
+// Every test creates its own table with a unique name and drops it again, so
+// the suite can run against a shared cluster.
+package conformancetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	// Registers the rqlite driver
+	_ "github.com/zhenruyan/rsqlite"
+)
+
+// Run opens dsn with the rsqlite driver and runs the suite against it
+func Run(t *testing.T, dsn string) {
+	t.Helper()
+
+	db, err := sql.Open("rqlite", dsn)
+	if err != nil {
+		t.Fatalf("opening %q: %v", dsn, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	RunDB(t, db)
+}
+
+// RunDB runs the suite against an open database handle, e.g. one returned by
+// rsqlite.OpenDB
+func RunDB(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	t.Run("Nulls", func(t *testing.T) { testNulls(t, db) })
+	t.Run("Types", func(t *testing.T) { testTypes(t, db) })
+	t.Run("NoRows", func(t *testing.T) { testNoRows(t, db) })
+	t.Run("ExecResult", func(t *testing.T) { testExecResult(t, db) })
+	t.Run("Prepared", func(t *testing.T) { testPrepared(t, db) })
+	t.Run("TxCommit", func(t *testing.T) { testTxCommit(t, db) })
+	t.Run("TxRollback", func(t *testing.T) { testTxRollback(t, db) })
+	t.Run("ContextCanceled", func(t *testing.T) { testContextCanceled(t, db) })
+	t.Run("ContextDeadline", func(t *testing.T) { testContextDeadline(t, db) })
+}
+
+// tableSeq keeps table names unique within a run
+var tableSeq atomic.Int64
+
+// createTable creates a table with the given column definitions and drops it
+// when the test ends
+func createTable(t *testing.T, db *sql.DB, columns string) string {
+	t.Helper()
+
+	name := fmt.Sprintf("conformance_%d_%d", time.Now().UnixNano(), tableSeq.Add(1))
+	if _, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", name, columns)); err != nil {
+		t.Fatalf("creating table: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec("DROP TABLE IF EXISTS " + name); err != nil {
+			t.Errorf("dropping table %s: %v", name, err)
+		}
+	})
+	return name
+}
+
+// count returns the number of rows in table
+func count(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatalf("counting rows: %v", err)
+	}
+	return n
+}
+
+// testNulls checks that NULL reads back as invalid sql.Null* values for
+// every storage class, both when inserted literally and as a nil argument
+func testNulls(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, i INTEGER, r REAL, s TEXT, d DATETIME")
+
+	if _, err := db.Exec("INSERT INTO " + table + " (id, i, r, s, d) VALUES (1, NULL, NULL, NULL, NULL)"); err != nil {
+		t.Fatalf("inserting literal NULLs: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO "+table+" (id, i, r, s, d) VALUES (2, ?, ?, ?, ?)", nil, nil, nil, nil); err != nil {
+		t.Fatalf("inserting nil arguments: %v", err)
+	}
+
+	rows, err := db.Query("SELECT i, r, s, d FROM " + table + " ORDER BY id")
+	if err != nil {
+		t.Fatalf("querying: %v", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+		var (
+			i sql.NullInt64
+			r sql.NullFloat64
+			s sql.NullString
+			d sql.NullTime
+		)
+		if err := rows.Scan(&i, &r, &s, &d); err != nil {
+			t.Fatalf("row %d: scanning: %v", n, err)
+		}
+		if i.Valid || r.Valid || s.Valid || d.Valid {
+			t.Errorf("row %d: got %+v %+v %+v %+v, want all NULL", n, i, r, s, d)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("iterating: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d rows, want 2", n)
+	}
+}
+
+// testTypes checks that values of each supported type read back unchanged
+func testTypes(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, i INTEGER, r REAL, s TEXT, d DATETIME")
+
+	when := time.Date(2024, 2, 29, 13, 14, 15, 0, time.UTC)
+	cases := []struct {
+		i int64
+		r float64
+		s string
+	}{
+		{0, 0, ""},
+		{-42, -1.5, "plain"},
+		// Without strict_numbers integers are read back as float64, which
+		// database/sql only scans into int64 while they print without exponent
+		{999999, math.Pi, "unicode: héllo, 世界, 🚀"},
+		{-999999, 1e-300, "quotes ' and \" and \\ and \n newlines"},
+	}
+
+	for n, c := range cases {
+		if _, err := db.Exec("INSERT INTO "+table+" (id, i, r, s, d) VALUES (?, ?, ?, ?, ?)", n+1, c.i, c.r, c.s, when); err != nil {
+			t.Fatalf("case %d: inserting: %v", n, err)
+		}
+	}
+
+	for n, c := range cases {
+		var (
+			i int64
+			r float64
+			s string
+			d time.Time
+		)
+		err := db.QueryRow("SELECT i, r, s, d FROM "+table+" WHERE id = ?", n+1).Scan(&i, &r, &s, &d)
+		if err != nil {
+			t.Fatalf("case %d: querying: %v", n, err)
+		}
+		if i != c.i {
+			t.Errorf("case %d: integer: got %d, want %d", n, i, c.i)
+		}
+		if r != c.r {
+			t.Errorf("case %d: real: got %v, want %v", n, r, c.r)
+		}
+		if s != c.s {
+			t.Errorf("case %d: text: got %q, want %q", n, s, c.s)
+		}
+		if !d.Equal(when) {
+			t.Errorf("case %d: datetime: got %v, want %v", n, d, when)
+		}
+	}
+}
+
+// testNoRows checks that a query without rows reports sql.ErrNoRows
+func testNoRows(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, s TEXT")
+
+	var s string
+	err := db.QueryRow("SELECT s FROM "+table+" WHERE id = ?", 1).Scan(&s)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("got %v, want sql.ErrNoRows", err)
+	}
+}
+
+// testExecResult checks LastInsertId and RowsAffected
+func testExecResult(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY AUTOINCREMENT, s TEXT")
+
+	for want := int64(1); want <= 3; want++ {
+		res, err := db.Exec("INSERT INTO "+table+" (s) VALUES (?)", "row")
+		if err != nil {
+			t.Fatalf("inserting: %v", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			t.Fatalf("LastInsertId: %v", err)
+		}
+		if id != want {
+			t.Errorf("LastInsertId: got %d, want %d", id, want)
+		}
+	}
+
+	res, err := db.Exec("UPDATE "+table+" SET s = ? WHERE id >= ?", "updated", 2)
+	if err != nil {
+		t.Fatalf("updating: %v", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		t.Fatalf("RowsAffected: %v", err)
+	}
+	if affected != 2 {
+		t.Errorf("RowsAffected: got %d, want 2", affected)
+	}
+}
+
+// testPrepared checks that a prepared statement can be run repeatedly with
+// different arguments
+func testPrepared(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, s TEXT")
+
+	insert, err := db.Prepare("INSERT INTO " + table + " (id, s) VALUES (?, ?)")
+	if err != nil {
+		t.Fatalf("preparing insert: %v", err)
+	}
+	defer insert.Close()
+
+	for id := 1; id <= 3; id++ {
+		if _, err := insert.Exec(id, fmt.Sprint("row ", id)); err != nil {
+			t.Fatalf("inserting %d: %v", id, err)
+		}
+	}
+
+	query, err := db.Prepare("SELECT s FROM " + table + " WHERE id = ?")
+	if err != nil {
+		t.Fatalf("preparing query: %v", err)
+	}
+	defer query.Close()
+
+	for id := 1; id <= 3; id++ {
+		var s string
+		if err := query.QueryRow(id).Scan(&s); err != nil {
+			t.Fatalf("querying %d: %v", id, err)
+		}
+		if want := fmt.Sprint("row ", id); s != want {
+			t.Errorf("row %d: got %q, want %q", id, s, want)
+		}
+	}
+}
+
+// testTxCommit checks that statements run in a committed transaction are
+// applied
+func testTxCommit(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, s TEXT")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("beginning: %v", err)
+	}
+	for id := 1; id <= 2; id++ {
+		if _, err := tx.Exec("INSERT INTO "+table+" (id, s) VALUES (?, ?)", id, "tx"); err != nil {
+			tx.Rollback()
+			t.Fatalf("inserting in tx: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing: %v", err)
+	}
+
+	if n := count(t, db, table); n != 2 {
+		t.Fatalf("got %d rows after commit, want 2", n)
+	}
+	if err := tx.Rollback(); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("rollback after commit: got %v, want sql.ErrTxDone", err)
+	}
+}
+
+// testTxRollback checks the documented transaction semantics: rqlite has no
+// interactive transactions, so statements run in a transaction are applied
+// as they execute and Rollback succeeds without undoing them
+func testTxRollback(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, s TEXT")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("beginning: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO "+table+" (id, s) VALUES (?, ?)", 1, "tx"); err != nil {
+		tx.Rollback()
+		t.Fatalf("inserting in tx: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rolling back: %v", err)
+	}
+
+	if n := count(t, db, table); n != 1 {
+		t.Fatalf("got %d rows after rollback, want 1 (rollback is a no-op)", n)
+	}
+	if err := tx.Commit(); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("commit after rollback: got %v, want sql.ErrTxDone", err)
+	}
+}
+
+// testContextCanceled checks that statements given a canceled context fail
+// with context.Canceled and leave the handle usable
+func testContextCanceled(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, s TEXT")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO "+table+" (id, s) VALUES (?, ?)", 1, "canceled"); !errors.Is(err, context.Canceled) {
+		t.Errorf("exec: got %v, want context.Canceled", err)
+	}
+	if _, err := db.QueryContext(ctx, "SELECT s FROM "+table); !errors.Is(err, context.Canceled) {
+		t.Errorf("query: got %v, want context.Canceled", err)
+	}
+	if _, err := db.BeginTx(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("begin: got %v, want context.Canceled", err)
+	}
+
+	if n := count(t, db, table); n != 0 {
+		t.Errorf("got %d rows, want the canceled insert not applied", n)
+	}
+}
+
+// testContextDeadline checks that statements given an expired deadline fail
+// with context.DeadlineExceeded
+func testContextDeadline(t *testing.T, db *sql.DB) {
+	table := createTable(t, db, "id INTEGER PRIMARY KEY, s TEXT")
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO "+table+" (id, s) VALUES (?, ?)", 1, "expired"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("exec: got %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := db.QueryContext(ctx, "SELECT s FROM "+table); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("query: got %v, want context.DeadlineExceeded", err)
+	}
+}
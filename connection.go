@@ -5,28 +5,64 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/rqlite/gorqlite"
+	"github.com/zhenruyan/rsqlite/internal/transport"
 )
 
-// Conn implements the database/sql/driver.Conn interface
+// Conn implements the database/sql/driver.Conn interface. database/sql
+// runs one statement on a connection at a time, but a DDLBatch flush, the
+// pool's IsValid and the Connector's stats and invalidation may reach it
+// from other goroutines meanwhile: the clients, cfg, closed and the
+// cluster manager are read under mu, and changed under its write lock, and
+// the pinned node and staleness are atomic.
 type Conn struct {
-	cfg            *Config
-	client         *gorqlite.Connection
+	cfg    *Config
+	client *apiClient
+	// readClient is the follower's client reads go to when
+	// Config.ReadWriteSplit is set, nil to read through client
+	readClient     *apiClient
+	httpClient     *http.Client
 	mu             sync.RWMutex
 	closed         bool
 	clusterManager *ClusterManager
+	connector      *Connector
+	cfgGeneration  uint64
+	createdAt      time.Time
+	stale          atomic.Bool
+	node           atomic.Value
+	// idempotencyLocal tracks the dedup table of a connection opened without a Connector
+	idempotencyLocal idempotencyState
+	// lastWrite is the raft index of the connection's last write, see
+	// Config.ReadYourWrites
+	lastWrite atomic.Uint64
+	// streams are the streamed Rows still open, closed with the connection
+	streams openRows
 }
 
 // NewConn creates a new connection
 func NewConn(cfg *Config) (*Conn, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return newConn(context.Background(), cfg, newClusterManagerForConfig(cfg))
+}
+
+// newConn creates a new connection using the given cluster manager
+func newConn(ctx context.Context, cfg *Config, clusterManager *ClusterManager) (*Conn, error) {
 	conn := &Conn{
 		cfg:            cfg,
-		clusterManager: NewClusterManager(cfg.Nodes),
+		httpClient:     newHTTPClient(cfg, cfg.Timeout),
+		clusterManager: clusterManager,
+		createdAt:      time.Now(),
 	}
 
-	err := conn.connect()
+	err := retryPolicyFor(cfg).Do(ctx, func() error { return conn.connect(ctx) }, retryableError, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -35,52 +71,100 @@ func NewConn(cfg *Config) (*Conn, error) {
 }
 
 // connect establishes connection to rqlite cluster
-func (c *Conn) connect() error {
+func (c *Conn) connect(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	return c.connectLocked(ctx)
+}
+
+// connectLocked establishes connection to rqlite cluster; c.mu must be held
+func (c *Conn) connectLocked(ctx context.Context) error {
 	if c.closed {
 		return errors.New("connection is closed")
 	}
 
-	// Discover leader first
-	ctx := context.Background()
-	err := c.clusterManager.DiscoverLeader(ctx)
+	if c.cfg.DisableDiscovery {
+		return c.connectToAnyNode(ctx)
+	}
+
+	// Discover leader first; the connection attempt as a whole is retried
+	err := c.clusterManager.discoverLeaderOnce(ctx)
 	if err != nil {
 		// If discovery fails, try connecting to original nodes
-		return c.connectToAnyNode()
+		return c.connectToAnyNode(ctx)
+	}
+
+	if c.cfg.PreferFollowers && !c.cfg.ReadWriteSplit {
+		for _, node := range c.clusterManager.Followers() {
+			if client, err := c.createClient(ctx, node); err == nil {
+				c.setClient(client)
+				return nil
+			}
+		}
+	}
+
+	if c.cfg.ReadPreference == "nearest" {
+		c.clusterManager.CheckHealth(ctx)
 	}
 
-	// Try to connect to the leader
-	leader := c.clusterManager.SelectBestNode(c.cfg.ConsistencyLevel)
+	// Try to connect to the leader, or the node the read preference picks.
+	// Split connections keep to the leader and read from a follower.
+	level := c.cfg.readConsistency()
+	if c.cfg.ReadWriteSplit {
+		level = "strong"
+	}
+	leader := c.clusterManager.SelectBestNode(level)
 	if leader != "" {
-		client, err := c.createClient(leader)
+		client, err := c.createClient(ctx, leader)
 		if err == nil {
-			c.client = client
+			c.setClient(client)
+			c.connectReader(ctx)
 			return nil
 		}
 	}
 
 	// Fallback to connecting to any available node
-	return c.connectToAnyNode()
+	return c.connectToAnyNode(ctx)
+}
+
+// connectReader connects the reads of a split connection to a follower,
+// see Config.ReadWriteSplit. Without a reachable follower reads stay on the
+// leader. c.mu must be held.
+func (c *Conn) connectReader(ctx context.Context) {
+	if !c.cfg.ReadWriteSplit {
+		return
+	}
+
+	node := c.clusterManager.selectFollower()
+	if node == "" || transport.NormalizeNode(node) == c.client.node {
+		return
+	}
+	if client, err := c.createClient(ctx, node); err == nil {
+		c.readClient = client
+	}
 }
 
 // connectToAnyNode tries to connect to any available node
-func (c *Conn) connectToAnyNode() error {
-	nodes := c.clusterManager.GetAllNodes()
+func (c *Conn) connectToAnyNode(ctx context.Context) error {
+	var nodes []string
+	if !c.cfg.DisableDiscovery {
+		nodes = c.clusterManager.GetAllNodes()
+	}
 	if len(nodes) == 0 {
 		nodes = c.cfg.Nodes
 	}
+	nodes = c.clusterManager.quarantinedLast(nodes)
 
 	var lastErr error
 	for _, node := range nodes {
-		client, err := c.createClient(node)
+		client, err := c.createClient(ctx, node)
 		if err != nil {
 			lastErr = err
 			continue
 		}
 
-		c.client = client
+		c.setClient(client)
 		return nil
 	}
 
@@ -91,48 +175,117 @@ func (c *Conn) connectToAnyNode() error {
 	return errors.New("no nodes available")
 }
 
-// createClient creates a new rqlite client for the given node
-func (c *Conn) createClient(node string) (*gorqlite.Connection, error) {
-	client, err := gorqlite.Open(node)
-	if err != nil {
-		return nil, err
+// newClient creates a rqlite client for the given node using the current configuration
+func (c *Conn) newClient(node string) *apiClient {
+	client := newAPIClientForConfig(node, c.httpClient, c.cfg)
+	if c.clusterManager != nil {
+		client.sample = c.clusterManager.recordSample
 	}
+	client.warm = c.warmCache()
+	return client
+}
 
-	// Set authentication if provided
-	// Note: gorqlite handles authentication differently
-	// This would need to be implemented based on the actual gorqlite API
-
-	// Set consistency level
-	switch c.cfg.ConsistencyLevel {
-	case "strong":
-		client.SetConsistencyLevel(gorqlite.ConsistencyLevelStrong)
-	case "weak":
-		client.SetConsistencyLevel(gorqlite.ConsistencyLevelWeak)
-	case "none":
-		client.SetConsistencyLevel(gorqlite.ConsistencyLevelNone)
+// warmCache returns the statements warmed on the connection's connector, nil
+// for a connection opened without one
+func (c *Conn) warmCache() *warmCache {
+	if c.connector == nil {
+		return nil
 	}
+	return &c.connector.warm
+}
 
-	// Test the connection
-	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+// createClient creates a new rqlite client for the given node and tests it
+func (c *Conn) createClient(ctx context.Context, node string) (*apiClient, error) {
+	client := c.newClient(node)
+
+	// Test the connection, which also records the server version
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
 	defer cancel()
 
-	_, err = client.QueryOneContext(ctx, "SELECT 1")
+	start := time.Now()
+	_, err := client.query(ctx, c.cfg.readConsistency(), "SELECT 1", nil)
+	c.clusterManager.observe(ctx, ControlConnect, node, start, err)
 	if err != nil {
-		client.Close()
+		if nodeUnreachable(err) {
+			c.clusterManager.markDown(node, err)
+		}
 		return nil, err
 	}
 
 	return client, nil
 }
 
-// reconnect attempts to reconnect to the cluster
-func (c *Conn) reconnect() error {
+// reconnect attempts to reconnect to the cluster; c.mu must be held. It
+// isn't cut short when ctx is cancelled, which would leave the pooled
+// connection without a client, but keeps ctx's values for the hooks.
+func (c *Conn) reconnect(ctx context.Context) error {
+	c.setClient(nil)
+
+	return c.connectLocked(context.WithoutCancel(ctx))
+}
+
+// syncConfig picks up configuration changes published by the connector.
+// Changes to the node list or timeout cause a reconnect; other changes
+// rebuild the client for the current node.
+func (c *Conn) syncConfig(ctx context.Context) error {
+	if c.connector == nil {
+		return nil
+	}
+
+	cfg, generation := c.connector.current()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.cfgGeneration || c.closed {
+		return nil
+	}
+
+	nodesChanged := !equalStrings(c.cfg.Nodes, cfg.Nodes) || c.cfg.ReadWriteSplit != cfg.ReadWriteSplit
+	timeoutChanged := c.cfg.Timeout != cfg.Timeout || c.cfg.DialTimeout != cfg.DialTimeout || c.cfg.TLSConfig != cfg.TLSConfig
+
+	c.cfg = cfg
+	c.cfgGeneration = generation
+
+	c.clusterManager = c.connector.sharedClusterManager()
+	if timeoutChanged {
+		c.httpClient = newHTTPClient(cfg, cfg.Timeout)
+	}
+	if nodesChanged || timeoutChanged {
+		return c.reconnect(ctx)
+	}
+
 	if c.client != nil {
-		c.client.Close()
-		c.client = nil
+		c.setClient(c.newClient(c.client.node))
+	}
+	if c.readClient != nil {
+		c.readClient = c.newClient(c.readClient.node)
 	}
+	return nil
+}
 
-	return c.connect()
+// equalStrings reports whether two string slices hold the same elements in order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// readLevel returns the consistency level used for queries. Strong reads are
+// served through the leader's linearizable read path instead of the raft log
+// when the server supports it, unless raft reads are forced.
+func (c *Conn) readLevel(client *apiClient) string {
+	level := c.cfg.readConsistency()
+	if level == "strong" && !c.cfg.RaftReads && client.supportsLinearizable() {
+		return "linearizable"
+	}
+	return level
 }
 
 // Prepare implements the database/sql/driver.Conn interface
@@ -155,7 +308,8 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, e
 	}, nil
 }
 
-// Close implements the database/sql/driver.Conn interface
+// Close implements the database/sql/driver.Conn interface. Streamed Rows
+// still open are closed, adding the rows they read to the stats.
 func (c *Conn) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -165,14 +319,72 @@ func (c *Conn) Close() error {
 	}
 
 	c.closed = true
-	if c.client != nil {
-		c.client.Close()
-		c.client = nil
+	c.streams.closeAll()
+	c.setClient(nil)
+
+	if c.connector != nil {
+		c.connector.untrack(c)
+	}
+
+	return nil
+}
+
+// IsValid implements the database/sql/driver.Validator interface, so the
+// pool discards a connection instead of handing it out again once it is
+// closed, a failed reconnect left it without a node, the cluster moved its
+// leadership away from the node the connection is pinned to, the node is
+// quarantined after failing, or, with Config.StaleAfter set, the node
+// hasn't answered for that long. The checks are local: IsValid sends no
+// request.
+func (c *Conn) IsValid() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed || c.client == nil || c.stale.Load() {
+		return false
 	}
+	if c.clusterManager.isDown(c.client.node) {
+		return false
+	}
+	return c.cfg.StaleAfter <= 0 || c.client.answeredWithin(c.cfg.StaleAfter)
+}
 
+// ResetSession implements the database/sql/driver.SessionResetter
+// interface. database/sql calls it before reusing a pooled connection, so
+// connections that became invalid while idle, e.g. stale ones, are
+// discarded rather than returning errors to callers.
+func (c *Conn) ResetSession(ctx context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
 	return nil
 }
 
+// markStale flags the connection for removal from the pool
+func (c *Conn) markStale() {
+	c.stale.Store(true)
+}
+
+// setClient replaces the active client, dropping the read client with the
+// last one; c.mu must be held
+func (c *Conn) setClient(client *apiClient) {
+	c.client = client
+	if client == nil {
+		c.readClient = nil
+		c.node.Store("")
+	} else {
+		c.node.Store(client.node)
+		c.stale.Store(false)
+	}
+}
+
+// currentNode returns the node the connection currently talks to, or "" if none.
+// It does not take c.mu so it is safe to call while the connection reconnects.
+func (c *Conn) currentNode() string {
+	node, _ := c.node.Load().(string)
+	return node
+}
+
 // Begin implements the database/sql/driver.Conn interface
 func (c *Conn) Begin() (driver.Tx, error) {
 	return c.BeginTx(context.Background(), driver.TxOptions{})
@@ -186,99 +398,385 @@ func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 }
 
 // ExecContext implements the database/sql/driver.ExecerContext interface
-func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	c.mu.RLock()
-	client := c.client
-	c.mu.RUnlock()
+func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Result, err error) {
+	defer recoverPanic(ctx, c.cfg.Hooks, query, &err)
 
-	if client == nil {
-		return nil, errors.New("connection is closed")
+	if err := c.syncConfig(ctx); err != nil {
+		return nil, err
 	}
 
-	// Convert named values to interface slice
-	values := make([]interface{}, len(args))
-	for i, arg := range args {
-		values[i] = arg.Value
+	if c.cfg.ReadOnly {
+		return nil, ErrReadOnly
 	}
 
-	// Retry logic for leader changes
-	for attempts := 0; attempts < 3; attempts++ {
-		result, err := client.WriteOneParameterized(gorqlite.ParameterizedStatement{
-			Query:     query,
-			Arguments: values,
-		})
-		if err != nil {
-			// If it's a leader change error, try to reconnect
-			if attempts < 2 {
-				c.mu.Lock()
-				reconnectErr := c.reconnect()
-				client = c.client
-				c.mu.Unlock()
-				if reconnectErr != nil {
-					return nil, reconnectErr
-				}
-				continue
-			}
+	original := query
+	query = rewriteDatabases(query, c.cfg.Databases)
+
+	if err := checkParamsOnly(ctx, c.cfg, c.warmCache(), query); err != nil {
+		return nil, err
+	}
+
+	if batch := ddlBatchFromContext(ctx); batch != nil && isIndexDDL(query) {
+		return batch.add(c, query, args), nil
+	}
+
+	if c.connector != nil && c.connector.throttle != nil {
+		if err := c.connector.throttle.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	query = c.annotate(query)
+
+	runCtx, cancel, adaptiveErr := c.adaptiveTimeout(ctx, query)
+	defer cancel()
+
+	start := time.Now()
+	values := c.bindArgs(args)
+	var result *StatementResult
+	var key string
+	if c.cfg.Idempotency != nil {
+		if key, err = idempotencyKey(ctx); err != nil {
 			return nil, err
 		}
+		result, err = c.runIdempotent(runCtx, key, query, values)
+	} else {
+		result, err = c.runStatement(runCtx, true, query, values)
+	}
+	err = adaptiveErr(err)
+	c.observe(ctx, start, true, query, result, err)
+	if err != nil {
+		return c.handOver(ctx, FailedWrite{Query: original, Args: values, IdempotencyKey: key, Err: err})
+	}
 
-		return &Result{
-			lastInsertID: result.LastInsertID,
-			rowsAffected: result.RowsAffected,
-		}, nil
+	if c.connector != nil && c.connector.replica != nil {
+		c.connector.replica.noteWrite()
 	}
+	c.noteWrite(result)
 
-	return nil, errors.New("max retry attempts exceeded")
+	c.adviseForeignKeys(ctx, query)
+
+	if result.queued {
+		return &Result{unknown: &ResultUnknownError{Reason: "queued writes report no counts"}}, nil
+	}
+	return &Result{
+		lastInsertID: result.LastInsertID,
+		rowsAffected: result.RowsAffected,
+	}, nil
 }
 
 // QueryContext implements the database/sql/driver.QueryerContext interface
-func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Rows, err error) {
+	defer recoverPanic(ctx, c.cfg.Hooks, query, &err)
+
+	if err := c.syncConfig(ctx); err != nil {
+		return nil, err
+	}
+
+	query = rewriteDatabases(query, c.cfg.Databases)
+
+	if err := checkParamsOnly(ctx, c.cfg, c.warmCache(), query); err != nil {
+		return nil, err
+	}
+
+	query = applyInteractiveLimit(query, c.cfg.InteractiveLimit)
+	query = applyMaxRowsLimit(query, c.cfg.MaxRows)
+
+	if c.connector != nil && c.connector.replica != nil {
+		if rows, ok := c.connector.replica.query(ctx, query, args); ok {
+			return rows, nil
+		}
+	}
+
+	query = c.annotate(query)
+
+	if c.streamRows() {
+		return c.queryStream(ctx, query, args)
+	}
+
+	var budget *memoryBudget
+	if c.connector != nil {
+		budget = c.connector.memoryBudget()
+	}
+	if budget != nil {
+		if err := budget.admit(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	runCtx, cancel, adaptiveErr := c.adaptiveTimeout(ctx, query)
+	defer cancel()
+
+	start := time.Now()
+	result, err := c.runStatement(runCtx, false, query, c.bindArgs(args))
+	err = adaptiveErr(err)
+	c.observe(ctx, start, false, query, result, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.cfg.MaxRows > 0 && len(result.Values) > c.cfg.MaxRows {
+		return nil, &MaxRowsError{Limit: c.cfg.MaxRows}
+	}
+
+	columns := result.Columns
+	if c.cfg.DedupColumns {
+		columns = dedupColumns(columns)
+	}
+
+	var release func()
+	if budget != nil {
+		release = budget.charge(int64(result.bytesReceived))
+	}
+
+	return &Rows{
+		result:     result,
+		release:    release,
+		columns:    columns,
+		pos:        -1,
+		strict:     c.cfg.StrictNumbers,
+		timeFormat: c.cfg.TimeFormat,
+		timeUTC:    c.cfg.TimeUTC,
+		closed:     false,
+		ctx:        ctx,
+		hooks:      c.cfg.Hooks,
+		query:      query,
+	}, nil
+}
+
+// streamRows reports whether query results are decoded incrementally
+func (c *Conn) streamRows() bool {
+	if !c.cfg.StreamRows {
+		return false
+	}
+	switch c.cfg.Codec.(type) {
+	case nil, JSONCodec, *JSONCodec:
+		return true
+	}
+	return false
+}
+
+// queryStream runs a query whose rows are decoded as Rows.Next reads them.
+// The statement's timeout keeps running until the rows are closed.
+func (c *Conn) queryStream(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	runCtx, cancel, adaptiveErr := c.adaptiveTimeout(ctx, query)
+
+	start := time.Now()
+	result, stream, err := c.runQueryStream(runCtx, query, c.bindArgs(args))
+	err = adaptiveErr(err)
+	c.observe(ctx, start, false, query, result, err)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if stream == nil {
+		cancel()
+	} else {
+		stream.cancel = cancel
+	}
+
+	columns := result.Columns
+	if c.cfg.DedupColumns {
+		columns = dedupColumns(columns)
+	}
+
+	rows := &Rows{
+		result:     result,
+		stream:     stream,
+		columns:    columns,
+		pos:        -1,
+		maxRows:    c.cfg.MaxRows,
+		strict:     c.cfg.StrictNumbers,
+		timeFormat: c.cfg.TimeFormat,
+		timeUTC:    c.cfg.TimeUTC,
+		ctx:        ctx,
+		hooks:      c.cfg.Hooks,
+		query:      query,
+	}
+	if c.connector != nil {
+		rows.metrics = &c.connector.metrics
+		rows.metricsKey = QueryEvent{Label: LabelFromContext(ctx), Fingerprint: c.warmCache().fingerprint(query)}.key()
+	}
+	c.streams.add(rows)
+	return rows, nil
+}
+
+// runStatement sends a statement to the current node, reconnecting on failure.
+// Writes are retried and queued following their delivery semantics.
+func (c *Conn) runStatement(ctx context.Context, write bool, query string, values []interface{}) (*StatementResult, error) {
+	var delivery Delivery
+	if write {
+		var err error
+		if delivery, err = c.delivery(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var result *StatementResult
+	err := c.withRetry(ctx, !write, delivery == AtMostOnce, func(client *apiClient) error {
+		var err error
+		switch {
+		case write && client.queue:
+			statements := []Statement{{Query: query, Args: values}}
+			result, err = c.writeClient(client).executeQueued(ctx, statements, delivery == AtLeastOnce)
+		case write:
+			result, err = c.execute(ctx, c.writeClient(client), query, values)
+		default:
+			client = c.ownWritesClient(ctx, client)
+			result, err = client.query(ctx, c.readLevel(client), query, values)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// runQueryStream sends a query to the current node, reconnecting on failure,
+// and returns once the response header is decoded. Failures while reading
+// the rows are reported by Rows.Next and not retried.
+func (c *Conn) runQueryStream(ctx context.Context, query string, values []interface{}) (*StatementResult, *rowStream, error) {
+	var result *StatementResult
+	var stream *rowStream
+	err := c.withRetry(ctx, true, false, func(client *apiClient) error {
+		var err error
+		client = c.ownWritesClient(ctx, client)
+		result, stream, err = client.queryStream(ctx, c.readLevel(client), query, values)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, stream, nil
+}
+
+// withRetry runs op against the current node following the retry policy;
+// reads of a split connection run against its follower. With atMostOnce,
+// failures after the request may have reached the server are not retried.
+func (c *Conn) withRetry(ctx context.Context, read, atMostOnce bool, op func(client *apiClient) error) error {
 	c.mu.RLock()
-	client := c.client
+	client := c.clientFor(read)
+	clusterManager := c.clusterManager
 	c.mu.RUnlock()
 
 	if client == nil {
-		return nil, errors.New("connection is closed")
-	}
-
-	// Convert named values to interface slice
-	values := make([]interface{}, len(args))
-	for i, arg := range args {
-		values[i] = arg.Value
+		return errors.New("connection is closed")
 	}
 
-	// Retry logic for leader changes
-	for attempts := 0; attempts < 3; attempts++ {
-		result, err := client.QueryOneParameterized(gorqlite.ParameterizedStatement{
-			Query:     query,
-			Arguments: values,
-		})
-		if err != nil {
-			// If it's a leader change error, try to reconnect
-			if attempts < 2 {
-				c.mu.Lock()
-				reconnectErr := c.reconnect()
-				client = c.client
-				c.mu.Unlock()
-				if reconnectErr != nil {
-					return nil, reconnectErr
-				}
-				continue
+	// Nodes that can't be reached are skipped when reconnecting. Writes may
+	// have been sent to the leader rather than the connection's node.
+	run := func() error {
+		err := op(client)
+		var notLeader *NotLeaderError
+		if errors.As(err, &notLeader) && ctx.Err() == nil {
+			// Follow the redirect instead of rediscovering the cluster
+			client = c.followLeader(notLeader)
+			err = op(client)
+		}
+		if nodeUnreachable(err) && ctx.Err() == nil {
+			node := client.node
+			if leader := clusterManager.GetLeader(); !sentTo(err, node) && sentTo(err, leader) {
+				node = leader
 			}
-			return nil, err
+			clusterManager.markDown(node, err)
 		}
+		return err
+	}
+
+	retryable := func(err error) bool {
+		return retryableError(err) && (!atMostOnce || !maybeDelivered(err))
+	}
+
+	// The failure may be a leader change, so reconnect before retrying
+	reconnect := func() error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		err := c.reconnect(ctx)
+		client = c.clientFor(read)
+		return err
+	}
+
+	return retryPolicyFor(c.cfg).Do(ctx, run, retryable, reconnect)
+}
+
+// followLeader returns the client for the leader a follower redirected a
+// statement to, and records the leader. A connection whose client talks to
+// the follower switches to the leader for its next statements.
+func (c *Conn) followLeader(redirect *NotLeaderError) *apiClient {
+	c.clusterManager.noteLeader(redirect.Leader)
+
+	client := c.newClient(redirect.Leader)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil && c.client.node == redirect.Node && !c.closed {
+		c.setClient(client)
+	}
+	return client
+}
+
+// clientFor returns the client a read or write is sent with: the follower's
+// for reads below strong consistency on a split connection, otherwise the
+// connection's client; c.mu must be held
+func (c *Conn) clientFor(read bool) *apiClient {
+	if !read || c.readClient == nil {
+		return c.client
+	}
+	if level := c.cfg.readConsistency(); level == "strong" || level == "linearizable" {
+		return c.client
+	}
+	return c.readClient
+}
+
+// writeClient returns the client Exec is sent with: the leader's when the
+// write consistency is strong or linearizable and client talks to another
+// node, so the write isn't forwarded
+func (c *Conn) writeClient(client *apiClient) *apiClient {
+	level := c.cfg.writeConsistency()
+	if level != "strong" && level != "linearizable" || c.cfg.DisableDiscovery {
+		return client
+	}
+
+	node := c.clusterManager.SelectBestNode(level)
+	if node == "" || transport.NormalizeNode(node) == client.node {
+		return client
+	}
+	return c.newClient(node)
+}
+
+// annotate prefixes the statement with an application name comment when enabled
+func (c *Conn) annotate(query string) string {
+	return annotateQuery(c.cfg, query)
+}
 
-		return &Rows{
-			result: &result,
-			closed: false,
-		}, nil
+// annotateQuery prefixes the statement with the application name comment of cfg when enabled
+func annotateQuery(cfg *Config, query string) string {
+	if !cfg.AppNameComment || cfg.AppName == "" {
+		return query
 	}
 
-	return nil, errors.New("max retry attempts exceeded")
+	name := strings.ReplaceAll(cfg.AppName, "*/", "* /")
+	return "/* app=" + name + " */ " + query
+}
+
+// namedValuesToInterfaces converts named values to an interface slice
+func namedValuesToInterfaces(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
 }
 
 // Ping implements the database/sql/driver.Pinger interface
-func (c *Conn) Ping(ctx context.Context) error {
+func (c *Conn) Ping(ctx context.Context) (err error) {
+	defer recoverPanic(ctx, c.cfg.Hooks, "", &err)
+
+	if err := c.syncConfig(ctx); err != nil {
+		return err
+	}
+
 	c.mu.RLock()
 	client := c.client
 	c.mu.RUnlock()
@@ -287,21 +785,23 @@ func (c *Conn) Ping(ctx context.Context) error {
 		return errors.New("connection is closed")
 	}
 
-	_, err := client.QueryOneContext(ctx, "SELECT 1")
-	if err != nil {
-		// Try to reconnect
+	if _, err := client.query(ctx, c.cfg.readConsistency(), "SELECT 1", nil); err != nil {
+		// Try to reconnect; the deferred unlock keeps a recovered panic from
+		// leaving the connection locked
 		c.mu.Lock()
-		reconnectErr := c.reconnect()
-		c.mu.Unlock()
-		if reconnectErr != nil {
-			return reconnectErr
-		}
-		return nil
+		defer c.mu.Unlock()
+		return c.reconnect(ctx)
 	}
 
 	return nil
 }
 
+// WaitForIndex blocks until the given node has applied at least the given raft index.
+// It can be reached through (*sql.Conn).Raw for read-after-write coordination.
+func (c *Conn) WaitForIndex(ctx context.Context, node string, index uint64) error {
+	return c.clusterManager.WaitForIndex(ctx, node, index)
+}
+
 // Tx implements the database/sql/driver.Tx interface
 type Tx struct {
 	conn *Conn
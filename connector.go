@@ -0,0 +1,222 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// Connector implements the database/sql/driver.Connector interface.
+// Its configuration can be swapped at runtime with UpdateConfig; connections
+// created by the connector pick up the new configuration on their next request.
+// Connections share one ClusterManager, so a leader change observed by any of
+// them invalidates the connections still pinned to the old leader.
+type Connector struct {
+	mu             sync.RWMutex
+	cfg            *Config
+	generation     uint64
+	clusterManager *ClusterManager
+
+	connsMu sync.Mutex
+	conns   map[*Conn]struct{}
+
+	metrics connectorMetrics
+	// latency feeds adaptive timeouts
+	latency latencyTracker
+
+	// replica is the local snapshot cache, nil unless configured
+	replica *replicaCache
+	// canary probes replication latency, nil unless configured
+	canary *canary
+	// throttle paces writes by the leader's backlog, nil unless configured
+	throttle *throttle
+	// idempotency tracks the dedup table of idempotent writes
+	idempotency idempotencyState
+	// memory caps the result memory of open Rows, nil without a limit
+	memory *memoryBudget
+	// warm holds the statements precomputed by Warm
+	warm warmCache
+
+	// ctx scopes the background work of the connector, such as the canary
+	// and backup schedules; Close cancels it
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewConnector creates a connector for the given configuration
+func NewConnector(cfg *Config) (*Connector, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &Connector{
+		cfg:   cfg.clone(),
+		conns: make(map[*Conn]struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.clusterManager = c.newClusterManager(c.cfg)
+	c.memory = newMemoryBudget(c.cfg)
+
+	if c.cfg.ReplicaCache != nil {
+		c.replica = newReplicaCache(c.ctx, *c.cfg.ReplicaCache, c.Backup)
+	}
+	if c.cfg.Canary != nil {
+		c.canary = newCanary(c.ctx, *c.cfg.Canary, c)
+	}
+	if c.cfg.Throttle != nil {
+		c.throttle = newThrottle(c.ctx, *c.cfg.Throttle, c)
+	}
+
+	return c, nil
+}
+
+// Close stops the connector's background work, such as replica cache
+// refreshes, the canary, the write throttle and backup schedules, and waits
+// for it to end; sql.DB.Close calls it. Connections already handed out keep
+// working. Closing a connector twice is harmless.
+func (c *Connector) Close() error {
+	c.cancel()
+	c.warm.clear()
+	if c.canary != nil {
+		c.canary.close()
+	}
+	if c.throttle != nil {
+		c.throttle.close()
+	}
+	if c.replica != nil {
+		return c.replica.close()
+	}
+	return nil
+}
+
+// Connect implements the database/sql/driver.Connector interface
+func (c *Connector) Connect(ctx context.Context) (_ driver.Conn, err error) {
+	cfg, generation := c.current()
+	defer recoverPanic(ctx, cfg.Hooks, "", &err)
+
+	conn, err := newConn(ctx, cfg, c.sharedClusterManager())
+	if err != nil {
+		return nil, err
+	}
+
+	conn.connector = c
+	conn.cfgGeneration = generation
+	c.track(conn)
+	return conn, nil
+}
+
+// Driver implements the database/sql/driver.Connector interface
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// Config returns a copy of the current configuration
+func (c *Connector) Config() *Config {
+	cfg, _ := c.current()
+	return cfg.clone()
+}
+
+// UpdateConfig applies fn to a copy of the current configuration and, if the
+// result is valid, publishes it to all connections for their next request.
+// Use it to rotate credentials, change the node list or the default consistency
+// level without recreating the sql.DB.
+func (c *Connector) UpdateConfig(fn func(cfg *Config)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg := c.cfg.clone()
+	fn(cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if !equalStrings(c.cfg.Nodes, cfg.Nodes) || c.cfg.AppName != cfg.AppName ||
+		c.cfg.Username != cfg.Username || c.cfg.Password != cfg.Password ||
+		c.cfg.TLSConfig != cfg.TLSConfig || c.cfg.ReadPreference != cfg.ReadPreference ||
+		c.cfg.DefaultScheme != cfg.DefaultScheme || c.cfg.APIPortOffset != cfg.APIPortOffset ||
+		c.cfg.DialTimeout != cfg.DialTimeout || c.cfg.MaxQuarantine != cfg.MaxQuarantine {
+		c.clusterManager = c.newClusterManager(cfg)
+	}
+
+	// Results charged to the old budget release it when closed
+	if c.cfg.MaxResultMemory != cfg.MaxResultMemory || c.cfg.ResultMemoryFailFast != cfg.ResultMemoryFailFast {
+		c.memory = newMemoryBudget(cfg)
+	}
+
+	c.cfg = cfg
+	c.generation++
+	return nil
+}
+
+// setReadOnly sets Config.ReadOnly and returns the previous value. Only that
+// field changes, so configuration updates made in between are kept.
+func (c *Connector) setReadOnly(readOnly bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.cfg.ReadOnly
+	if prev == readOnly {
+		return prev
+	}
+
+	cfg := c.cfg.clone()
+	cfg.ReadOnly = readOnly
+	c.cfg = cfg
+	c.generation++
+	return prev
+}
+
+// newClusterManager creates a cluster manager that invalidates stale connections on leader change
+func (c *Connector) newClusterManager(cfg *Config) *ClusterManager {
+	cm := newClusterManagerForConfig(cfg)
+	cm.observer = c.observeControl
+	cm.OnLeaderChange(func(oldLeader, newLeader string) {
+		c.invalidateNode(oldLeader)
+	})
+	return cm
+}
+
+// sharedClusterManager returns the cluster manager shared by the connector's connections
+func (c *Connector) sharedClusterManager() *ClusterManager {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clusterManager
+}
+
+// invalidateNode marks every connection pinned to node as stale so the pool discards it
+func (c *Connector) invalidateNode(node string) {
+	c.connsMu.Lock()
+	defer c.connsMu.Unlock()
+
+	node = transport.NormalizeNode(node)
+	for conn := range c.conns {
+		if transport.NormalizeNode(conn.currentNode()) == node {
+			conn.markStale()
+		}
+	}
+}
+
+// track registers a connection created by the connector
+func (c *Connector) track(conn *Conn) {
+	c.connsMu.Lock()
+	c.conns[conn] = struct{}{}
+	c.connsMu.Unlock()
+}
+
+// untrack removes a closed connection from the connector
+func (c *Connector) untrack(conn *Conn) {
+	c.connsMu.Lock()
+	delete(c.conns, conn)
+	c.connsMu.Unlock()
+}
+
+// current returns the current configuration and its generation.
+// The returned configuration must not be modified.
+func (c *Connector) current() (*Config, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg, c.generation
+}
@@ -0,0 +1,208 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TableChecksum summarizes the content of a table on one node
+type TableChecksum struct {
+	Rows int64
+	// Hash is a checksum of the rows and their rowids computed by the node
+	Hash string
+	// Error is set when the table couldn't be checksummed on the node
+	Error string
+}
+
+// NodeChecksums holds the table checksums read from one node
+type NodeChecksums struct {
+	Node   string
+	Leader bool
+	Tables map[string]TableChecksum
+	// Error is set when the node couldn't be checked at all
+	Error string
+}
+
+// ConsistencyReport is the result of Connector.CheckConsistency
+type ConsistencyReport struct {
+	Nodes []NodeChecksums
+	// Divergent maps every table whose content differs from the leader's to
+	// the nodes that disagree
+	Divergent map[string][]string
+}
+
+// Consistent reports whether every checked node matches the leader
+func (r *ConsistencyReport) Consistent() bool {
+	if len(r.Divergent) > 0 {
+		return false
+	}
+	for _, node := range r.Nodes {
+		if node.Error != "" {
+			return false
+		}
+		for _, table := range node.Tables {
+			if table.Error != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CheckConsistency reads the given tables, or every table when none are
+// given, from each reachable node at none consistency, so every node answers
+// from its own copy, and compares row counts and content hashes with the
+// leader's. Divergence points at follower corruption or severe replication
+// lag; nodes still applying recent writes may briefly differ. The checksums
+// are computed by the nodes, which read every row of the checked tables.
+func (c *Connector) CheckConsistency(ctx context.Context, tables ...string) (*ConsistencyReport, error) {
+	nodes, err := c.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _ := c.current()
+	httpClient := newHTTPClient(cfg, cfg.Timeout)
+
+	report := &ConsistencyReport{Divergent: make(map[string][]string)}
+	reference := -1
+	for _, node := range nodes {
+		if !node.Reachable || node.APIAddr == "" {
+			continue
+		}
+
+		checksums := NodeChecksums{Node: node.APIAddr, Leader: node.Leader}
+		client := newAPIClientForConfig(node.APIAddr, httpClient, cfg)
+		if checksums.Tables, err = tableChecksums(ctx, client, tables); err != nil {
+			checksums.Error = err.Error()
+		} else if node.Leader || reference < 0 {
+			reference = len(report.Nodes)
+		}
+		report.Nodes = append(report.Nodes, checksums)
+	}
+
+	if reference < 0 {
+		return report, errors.New("no node could be checked")
+	}
+
+	expected := report.Nodes[reference].Tables
+	for i, node := range report.Nodes {
+		if i == reference || node.Error != "" {
+			continue
+		}
+
+		names := make(map[string]bool)
+		for name := range expected {
+			names[name] = true
+		}
+		for name := range node.Tables {
+			names[name] = true
+		}
+		for name := range names {
+			want, inReference := expected[name]
+			got, inNode := node.Tables[name]
+			if want.Error != "" || got.Error != "" {
+				continue
+			}
+			if inReference != inNode || want != got {
+				report.Divergent[name] = append(report.Divergent[name], node.Node)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// tableChecksums computes the checksums of tables, or of every table, on one
+// node. A table that can't be checksummed has its Error set and doesn't stop
+// the others.
+func tableChecksums(ctx context.Context, client *apiClient, tables []string) (map[string]TableChecksum, error) {
+	result, err := client.query(ctx, "none", "SELECT m.name, p.name, m.sql LIKE '%WITHOUT ROWID%' FROM sqlite_master AS m "+
+		"JOIN pragma_table_info(m.name) AS p WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' ORDER BY m.name, p.cid", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string][]string)
+	withoutRowid := make(map[string]bool)
+	var names []string
+	for _, row := range result.Values {
+		table, _ := row[0].(string)
+		column, _ := row[1].(string)
+		if _, ok := columns[table]; !ok {
+			names = append(names, table)
+		}
+		columns[table] = append(columns[table], column)
+		if flag, err := toInt64(row[2]); err == nil && flag != 0 {
+			withoutRowid[table] = true
+		}
+	}
+	if len(tables) == 0 {
+		tables = names
+	}
+
+	checksums := make(map[string]TableChecksum, len(tables))
+	for _, table := range tables {
+		cols, ok := columns[table]
+		if !ok {
+			// Missing tables are left out, so they diverge from the nodes that have them
+			continue
+		}
+
+		result, err := client.query(ctx, "none", checksumQuery(table, cols, withoutRowid[table]), nil)
+		if err == nil && (len(result.Values) != 1 || len(result.Values[0]) != 2) {
+			err = errors.New("unexpected checksum result")
+		}
+		var rows, sum int64
+		if err == nil {
+			if rows, err = toInt64(result.Values[0][0]); err == nil {
+				sum, err = toInt64(result.Values[0][1])
+			}
+		}
+		if err != nil {
+			checksums[table] = TableChecksum{Error: fmt.Sprintf("checksum of %s: %v", table, err)}
+			continue
+		}
+		checksums[table] = TableChecksum{Rows: rows, Hash: fmt.Sprintf("%016x", sum)}
+	}
+	return checksums, nil
+}
+
+// checksumWeights are the prime weights of the count, first and last
+// position of each hex digit in a row's signature
+var checksumWeights = [16][3]int{
+	{3, 5, 7}, {11, 13, 17}, {19, 23, 29}, {31, 37, 41},
+	{43, 47, 53}, {59, 61, 67}, {71, 73, 79}, {83, 89, 97},
+	{101, 103, 107}, {109, 113, 127}, {131, 137, 139}, {149, 151, 157},
+	{163, 167, 173}, {179, 181, 191}, {193, 197, 199}, {211, 223, 227},
+}
+
+// checksumQuery returns the query computing the row count and content
+// checksum of a table on the server, so the rows aren't transferred. SQLite
+// has no hash function, so every row, with its rowid unless the table is
+// WITHOUT ROWID, is encoded as hex and summarized by the weighted count, first
+// and last position of each digit; the table's checksum is the sum of its
+// rows'. Unlike a cryptographic hash it can miss an edit that only reorders
+// the middle of a value.
+func checksumQuery(table string, columns []string, withoutRowid bool) string {
+	var values []string
+	if !withoutRowid {
+		values = append(values, "quote(rowid)")
+	}
+	for _, column := range columns {
+		values = append(values, "quote("+quoteIdent(column)+")")
+	}
+
+	const digits = "0123456789ABCDEF"
+	signature := []string{"length(h)"}
+	for i, w := range checksumWeights {
+		d, others := digits[i:i+1], digits[:i]+digits[i+1:]
+		signature = append(signature, fmt.Sprintf("%d * (length(h) - length(replace(h, '%s', ''))) + %d * instr(h, '%s') + %d * length(rtrim(h, '%s'))",
+			w[0], d, w[1], d, w[2], others))
+	}
+
+	return "SELECT count(*), coalesce(sum((" + strings.Join(signature, " + ") + ") % 2147483647), 0) " +
+		"FROM (SELECT hex(" + strings.Join(values, " || ',' || ") + ") AS h FROM " + quoteIdent(table) + ")"
+}
@@ -0,0 +1,149 @@
+package rsqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checksumNode is a test node answering checksum queries from a table of
+// results, by table name
+type checksumNode struct {
+	server *httptest.Server
+	// checksums holds the results row of each table, "" for a failing query
+	checksums map[string]string
+}
+
+func TestCheckConsistency(t *testing.T) {
+	tables := `{"results": [{"columns": ["name", "name", "without_rowid"], "types": ["text", "text", "integer"], "values": [
+		["a", "id", 0], ["a", "name", 0], ["b", "id", 0], ["w", "k", 1], ["w", "v", 1]]}]}`
+
+	var nodes []*checksumNode
+	handler := func(node *checksumNode) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/status":
+				http.NotFound(w, r)
+				return
+			case "/nodes":
+				fmt.Fprintf(w, `{"nodes": [
+					{"id": "n1", "api_addr": %q, "leader": true, "reachable": true, "voter": true},
+					{"id": "n2", "api_addr": %q, "leader": false, "reachable": true, "voter": true},
+					{"id": "n3", "api_addr": %q, "leader": false, "reachable": true, "voter": true}]}`,
+					nodes[0].server.URL, nodes[1].server.URL, nodes[2].server.URL)
+				return
+			}
+			if r.URL.Query().Get("level") != "none" {
+				t.Errorf("checksum read at level %q, want none", r.URL.Query().Get("level"))
+			}
+
+			body, _ := io.ReadAll(r.Body)
+			var statements [][]interface{}
+			json.Unmarshal(body, &statements)
+			query, _ := statements[0][0].(string)
+			switch {
+			case strings.Contains(query, "sqlite_master"):
+				w.Write([]byte(tables))
+				return
+			case query == "SELECT 1":
+				w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+				return
+			}
+
+			if strings.Contains(query, "SELECT *") || !strings.HasPrefix(query, "SELECT count(*), ") {
+				t.Errorf("checksum query %q doesn't aggregate on the server", query)
+			}
+			table := query[strings.LastIndex(query, " FROM ")+len(` FROM "`) : len(query)-len(`")`)]
+			if strings.Contains(query, "rowid") != (table != "w") {
+				t.Errorf("checksum query of %s: %q", table, query)
+			}
+			result := node.checksums[table]
+			if result == "" {
+				w.Write([]byte(`{"results": [{"error": "no such function: hex"}]}`))
+				return
+			}
+			fmt.Fprintf(w, `{"results": [{"columns": ["count(*)", "sum"], "types": ["integer", "integer"], "values": [[%s]]}]}`, result)
+		}
+	}
+	for _, checksums := range []map[string]string{
+		{"a": "3, 255", "b": "0, 0", "w": "1, 16"},
+		// The follower lost a row of a and can't checksum b
+		{"a": "2, 200", "w": "1, 16"},
+		{"a": "3, 255", "b": "0, 0", "w": "1, 16"},
+	} {
+		node := &checksumNode{checksums: checksums}
+		node.server = httptest.NewServer(handler(node))
+		defer node.server.Close()
+		nodes = append(nodes, node)
+	}
+
+	cfg, err := ParseDSN(nodes[0].server.URL + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+
+	report, err := connector.CheckConsistency(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Consistent() {
+		t.Error("report with a divergent table consistent")
+	}
+	if want := map[string][]string{"a": {nodes[1].server.URL}}; !reflect.DeepEqual(report.Divergent, want) {
+		t.Errorf("divergent tables %v, want %v", report.Divergent, want)
+	}
+	if len(report.Nodes) != 3 {
+		t.Fatalf("%d nodes checked, want 3", len(report.Nodes))
+	}
+
+	leader := report.Nodes[0]
+	if !leader.Leader || leader.Error != "" || leader.Tables["a"] != (TableChecksum{Rows: 3, Hash: "00000000000000ff"}) {
+		t.Errorf("leader checksums %+v", leader)
+	}
+	follower := report.Nodes[1]
+	if follower.Error != "" {
+		t.Errorf("failing table failed the whole node: %s", follower.Error)
+	}
+	if follower.Tables["b"].Error == "" || follower.Tables["w"] != leader.Tables["w"] {
+		t.Errorf("follower checksums %+v", follower.Tables)
+	}
+
+	// Restricted to the tables the nodes agree on the report is clean
+	report, err = connector.CheckConsistency(context.Background(), "w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent() || len(report.Nodes[1].Tables) != 1 {
+		t.Errorf("report of w: %+v", report)
+	}
+}
+
+func TestChecksumQuery(t *testing.T) {
+	query := checksumQuery(`we"ird`, []string{"id", "na me"}, false)
+	for _, want := range []string{
+		`SELECT count(*), coalesce(sum((length(h) + `,
+		`% 2147483647), 0) FROM (SELECT hex(quote(rowid) || ',' || quote("id") || ',' || quote("na me")) AS h FROM "we""ird")`,
+		`3 * (length(h) - length(replace(h, '0', ''))) + 5 * instr(h, '0') + 7 * length(rtrim(h, '123456789ABCDEF'))`,
+		`211 * (length(h) - length(replace(h, 'F', ''))) + 223 * instr(h, 'F') + 227 * length(rtrim(h, '0123456789ABCDE'))`,
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("checksum query %q lacks %q", query, want)
+		}
+	}
+
+	query = checksumQuery("w", []string{"k"}, true)
+	if !strings.Contains(query, `SELECT hex(quote("k")) AS h FROM "w"`) {
+		t.Errorf("checksum query of a WITHOUT ROWID table %q", query)
+	}
+}
@@ -0,0 +1,36 @@
+package rsqlite
+
+import (
+	"context"
+)
+
+// labelKey is the context key for statement labels
+type labelKey struct{}
+
+// WithLabel returns a context that names the statements run with it, e.g.
+// "get_user_by_id". Hooks, metrics and slow-query logs use the label instead
+// of the raw SQL text, which may contain volatile literals.
+func WithLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, labelKey{}, label)
+}
+
+// LabelFromContext returns the statement label attached by WithLabel, or ""
+func LabelFromContext(ctx context.Context) string {
+	label, _ := ctx.Value(labelKey{}).(string)
+	return label
+}
+
+// shardKey is the context key for explicit shard selection
+type shardKey struct{}
+
+// WithShard returns a context that sends statements run through a Router to
+// the named shard, bypassing table and Route based routing
+func WithShard(ctx context.Context, shard string) context.Context {
+	return context.WithValue(ctx, shardKey{}, shard)
+}
+
+// ShardFromContext returns the shard selected by WithShard, or ""
+func ShardFromContext(ctx context.Context) string {
+	shard, _ := ctx.Value(shardKey{}).(string)
+	return shard
+}
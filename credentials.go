@@ -0,0 +1,106 @@
+package rsqlite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Credentials authenticate a request: a username and password sent with
+// HTTP Basic Auth, or a bearer token for gateways in front of rqlite
+type Credentials struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// CredentialProvider supplies the credentials of every request, so secrets
+// can come from the environment, files or a vault client, and rotated
+// credentials are used without reopening the *sql.DB
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialProviderFunc adapts a function to the CredentialProvider interface
+type CredentialProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials implements the CredentialProvider interface
+func (f CredentialProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// EnvCredentials reads the username and password from environment
+// variables on every request
+func EnvCredentials(usernameVar, passwordVar string) CredentialProvider {
+	return CredentialProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{
+			Username: os.Getenv(usernameVar),
+			Password: os.Getenv(passwordVar),
+		}, nil
+	})
+}
+
+// FileCredentials reads the username and password from files, such as
+// mounted Kubernetes secrets, on every request. Surrounding whitespace is
+// trimmed.
+func FileCredentials(usernameFile, passwordFile string) CredentialProvider {
+	return CredentialProviderFunc(func(ctx context.Context) (Credentials, error) {
+		username, err := os.ReadFile(usernameFile)
+		if err != nil {
+			return Credentials{}, err
+		}
+		password, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{
+			Username: strings.TrimSpace(string(username)),
+			Password: strings.TrimSpace(string(password)),
+		}, nil
+	})
+}
+
+// CredentialError is returned when the credential provider fails
+type CredentialError struct {
+	Err error
+}
+
+// Error implements the error interface
+func (e *CredentialError) Error() string {
+	return fmt.Sprintf("getting credentials: %v", e.Err)
+}
+
+// Unwrap returns the provider's error
+func (e *CredentialError) Unwrap() error {
+	return e.Err
+}
+
+// credentialTransport authenticates every request with the provider's
+// current credentials, replacing static ones
+type credentialTransport struct {
+	base     http.RoundTripper
+	provider CredentialProvider
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	creds, err := t.provider.Credentials(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &CredentialError{Err: err}
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	switch {
+	case creds.Token != "":
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+	case creds.Username != "":
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	return t.base.RoundTrip(req)
+}
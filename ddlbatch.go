@@ -0,0 +1,175 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ddlBatchKey is the context key for DDL batches
+type ddlBatchKey struct{}
+
+// DDLBatch collects the CREATE INDEX and DROP INDEX statements executed with
+// its context, so an ORM migration emitting many small index statements is
+// applied in one atomic request instead of leaving a partial schema behind
+// when one of them fails.
+type DDLBatch struct {
+	mu         sync.Mutex
+	statements []Statement
+	// acks receive the counts of the statements when the batch is flushed
+	acks []*writeAck
+	conn *Conn
+}
+
+// DDLBatchResult reports the outcome of a flushed DDL batch
+type DDLBatchResult struct {
+	// Statements are the statements sent, in order
+	Statements []string
+	// Errors maps the index of each failed statement to its error.
+	// The batch is atomic, so nothing was applied when it is not empty.
+	Errors map[int]string
+}
+
+// Err returns an error describing the failed statements, or nil
+func (r *DDLBatchResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	indexes := make([]int, 0, len(r.Errors))
+	for i := range r.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	errs := make([]error, 0, len(indexes))
+	for _, i := range indexes {
+		errs = append(errs, fmt.Errorf("%s: %s", r.Statements[i], r.Errors[i]))
+	}
+	return fmt.Errorf("DDL batch rolled back: %w", errors.Join(errs...))
+}
+
+// WithDDLBatch returns a context whose index statements are queued in the
+// returned batch instead of being executed; they succeed immediately with a
+// result whose counts fail with a *ResultUnknownError until Flush applies
+// them, e.g.
+//
+//	ctx, batch := rsqlite.WithDDLBatch(ctx)
+//	db.WithContext(ctx).AutoMigrate(&User{})
+//	result, err := batch.Flush(ctx)
+func WithDDLBatch(ctx context.Context) (context.Context, *DDLBatch) {
+	batch := &DDLBatch{}
+	return context.WithValue(ctx, ddlBatchKey{}, batch), batch
+}
+
+// ddlBatchFromContext returns the batch attached by WithDDLBatch, or nil
+func ddlBatchFromContext(ctx context.Context) *DDLBatch {
+	batch, _ := ctx.Value(ddlBatchKey{}).(*DDLBatch)
+	return batch
+}
+
+// isIndexDDL reports whether a statement creates or drops an index
+func isIndexDDL(query string) bool {
+	fp := Fingerprint(query)
+	return strings.HasPrefix(fp, "create index ") ||
+		strings.HasPrefix(fp, "create unique index ") ||
+		strings.HasPrefix(fp, "drop index ")
+}
+
+// add queues a statement executed on conn and returns its result
+func (b *DDLBatch) add(conn *Conn, query string, args []driver.NamedValue) *Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ack := &writeAck{pending: &ResultUnknownError{Reason: "statement queued in an unflushed DDL batch"}}
+	b.statements = append(b.statements, Statement{Query: query, Args: namedValuesToInterfaces(args)})
+	b.acks = append(b.acks, ack)
+	if b.conn == nil {
+		b.conn = conn
+	}
+	return &Result{ack: ack}
+}
+
+// Len returns the number of queued statements
+func (b *DDLBatch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.statements)
+}
+
+// Flush sends the queued statements in a single atomic request and empties
+// the batch. The returned error is non-nil when the request failed or any
+// statement was rejected; the result lists what was sent either way.
+func (b *DDLBatch) Flush(ctx context.Context) (*DDLBatchResult, error) {
+	b.mu.Lock()
+	statements, acks, conn := b.statements, b.acks, b.conn
+	b.statements, b.acks, b.conn = nil, nil, nil
+	b.mu.Unlock()
+
+	result := &DDLBatchResult{
+		Statements: make([]string, len(statements)),
+		Errors:     make(map[int]string),
+	}
+	for i, stmt := range statements {
+		result.Statements[i] = stmt.Query
+	}
+
+	if len(statements) == 0 {
+		return result, nil
+	}
+
+	results, err := conn.executeBatch(ctx, statements)
+	if err != nil {
+		for _, ack := range acks {
+			ack.resolve(0, 0, err)
+		}
+		return result, err
+	}
+
+	for i, res := range results {
+		if res.Error != "" && i < len(statements) {
+			result.Errors[i] = res.Error
+		}
+	}
+
+	// The batch is atomic, so a rejected statement fails them all
+	batchErr := result.Err()
+	for i, ack := range acks {
+		switch {
+		case batchErr != nil:
+			ack.resolve(0, 0, batchErr)
+		case i < len(results):
+			ack.resolve(results[i].LastInsertID, results[i].RowsAffected, nil)
+		default:
+			ack.resolve(0, 0, &ResultUnknownError{Reason: "no result returned for the statement"})
+		}
+	}
+
+	return result, batchErr
+}
+
+// executeBatch runs statements atomically on the connection's node, or on a
+// fresh connection when this one has been closed by the pool meanwhile
+func (c *Conn) executeBatch(ctx context.Context, statements []Statement) ([]StatementResult, error) {
+	c.mu.RLock()
+	client, cfg, cm := c.client, c.cfg, c.clusterManager
+	c.mu.RUnlock()
+
+	if client == nil {
+		conn, err := newConn(ctx, cfg, cm)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		conn.mu.RLock()
+		client = conn.client
+		conn.mu.RUnlock()
+	}
+
+	return client.executeBatch(ctx, statements, true)
+}
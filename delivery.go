@@ -0,0 +1,80 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Delivery selects what the driver does with a write whose outcome is
+// unknown, e.g. after a timeout or a connection reset once the request was
+// sent: the leader may or may not have applied it.
+type Delivery string
+
+const (
+	// DeliveryDefault keeps the driver's historical behavior: failed writes
+	// are retried like AtLeastOnce, and queued writes return once queued.
+	DeliveryDefault Delivery = ""
+	// AtLeastOnce retries writes after ambiguous failures, so a write may be
+	// applied twice unless Config.Idempotency deduplicates the retries.
+	// Queued writes wait until the queue holding them is persisted, since
+	// the leader can lose queued writes it hasn't persisted yet.
+	AtLeastOnce Delivery = "at_least_once"
+	// AtMostOnce retries a write only when it certainly didn't reach the
+	// server, e.g. the connection was refused; other failures are returned,
+	// so a write may be lost but is never applied twice. Idempotent writes
+	// are still retried, as their keys prevent duplicates.
+	AtMostOnce Delivery = "at_most_once"
+)
+
+// validDeliveries are the accepted delivery semantics
+var validDeliveries = map[Delivery]bool{
+	DeliveryDefault: true,
+	AtLeastOnce:     true,
+	AtMostOnce:      true,
+}
+
+// deliveryKey is the context key for per-statement delivery semantics
+type deliveryKey struct{}
+
+// WithDelivery returns a context whose writes use the given delivery
+// semantics instead of Config.Delivery
+func WithDelivery(ctx context.Context, delivery Delivery) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, delivery)
+}
+
+// DeliveryFromContext returns the delivery semantics attached by
+// WithDelivery, or DeliveryDefault
+func DeliveryFromContext(ctx context.Context) Delivery {
+	delivery, _ := ctx.Value(deliveryKey{}).(Delivery)
+	return delivery
+}
+
+// delivery returns the delivery semantics of a write run with ctx
+func (c *Conn) delivery(ctx context.Context) (Delivery, error) {
+	delivery := DeliveryFromContext(ctx)
+	if delivery == DeliveryDefault {
+		delivery = c.cfg.Delivery
+	}
+	if !validDeliveries[delivery] {
+		return "", fmt.Errorf("unknown delivery %q: use at_least_once or at_most_once", delivery)
+	}
+	return delivery, nil
+}
+
+// maybeDelivered reports whether a failed request may have reached the
+// server. Only failures to connect or to authenticate before sending, and
+// requests a follower redirected instead of running, are known not to have.
+func maybeDelivered(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	var notLeader *NotLeaderError
+	if errors.As(err, &notLeader) {
+		return false
+	}
+	var credErr *CredentialError
+	return !errors.As(err, &credErr)
+}
@@ -0,0 +1,198 @@
+// Package devcluster starts a local rqlite cluster for tests and example
+// programs, so they run without setting up a cluster by hand:
+//
+//	func TestApp(t *testing.T) {
+//		dsn := devcluster.ForTest(t, devcluster.Options{Nodes: 3})
+//		db, err := sql.Open("rqlite", dsn)
+//		...
+//	}
+//
+// Nodes run the rqlited binary given by Options.Binary or the RQLITED
+// environment variable, found in PATH, or downloaded from the rqlite releases
+// with Options.Download and checked against Options.SHA256. With
+// Options.Docker they run in containers of the rqlite/rqlite image instead.
+package devcluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DefaultVersion is the rqlite release downloaded when Options.Version is empty
+const DefaultVersion = "v8.36.0"
+
+// DefaultImage is the Docker image run when Options.Image is empty
+const DefaultImage = "rqlite/rqlite"
+
+// ErrUnavailable is returned by Start when neither an rqlited binary nor, with
+// Options.Docker, a docker command is available
+var ErrUnavailable = errors.New("devcluster: no rqlited binary found; set RQLITED, add rqlited to PATH, or enable Options.Download or Options.Docker")
+
+// Options configures the started cluster
+type Options struct {
+	// Nodes is the number of nodes, 1 when zero. Use 3 for a cluster that
+	// survives the loss of a node.
+	Nodes int
+	// Binary is the path of rqlited. When empty the RQLITED environment
+	// variable and PATH are searched.
+	Binary string
+	// Download fetches rqlited from the rqlite releases into the user cache
+	// directory when no binary is found. It requires SHA256.
+	Download bool
+	// Version is the release downloaded, DefaultVersion when empty
+	Version string
+	// SHA256 is the hex SHA-256 of the release archive of Version for the
+	// current platform, as published with the rqlite release. A download
+	// that doesn't match is discarded rather than run.
+	SHA256 string
+	// Docker runs the nodes in containers instead of local processes
+	Docker bool
+	// Image is the Docker image, DefaultImage when empty
+	Image string
+	// Dir holds the data directories of local nodes. A temporary directory,
+	// removed by Close, is used when empty.
+	Dir string
+	// Output receives the output of local nodes; discarded when nil
+	Output io.Writer
+	// StartTimeout bounds the wait for the cluster to elect a leader;
+	// 30s when zero
+	StartTimeout time.Duration
+}
+
+// node is a running rqlite node
+type node interface {
+	stop() error
+}
+
+// Cluster is a running local cluster
+type Cluster struct {
+	addrs []string
+	nodes []node
+	// cleanup runs after the nodes are stopped, e.g. removing a temporary
+	// directory or Docker network
+	cleanup []func() error
+}
+
+// Start launches the nodes and returns once every node is ready and the
+// cluster has a leader. Close the cluster to stop them.
+func Start(ctx context.Context, opts Options) (*Cluster, error) {
+	if opts.Nodes == 0 {
+		opts.Nodes = 1
+	}
+	if opts.Nodes < 0 {
+		return nil, fmt.Errorf("devcluster: invalid node count %d", opts.Nodes)
+	}
+	if opts.StartTimeout == 0 {
+		opts.StartTimeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.StartTimeout)
+	defer cancel()
+
+	if opts.Docker {
+		return startDocker(ctx, opts)
+	}
+	return startLocal(ctx, opts)
+}
+
+// ForTest starts a cluster stopped when t finishes and returns its DSN. The
+// RQLITE_DSN environment variable, when set, is returned instead so the same
+// tests run against an existing cluster. The test is skipped when no rqlited
+// binary is available.
+func ForTest(t testing.TB, opts Options) string {
+	t.Helper()
+
+	if dsn := os.Getenv("RQLITE_DSN"); dsn != "" {
+		return dsn
+	}
+
+	c, err := Start(context.Background(), opts)
+	if errors.Is(err, ErrUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			t.Errorf("stopping dev cluster: %v", err)
+		}
+	})
+	return c.DSN()
+}
+
+// DSN returns the DSN listing every node of the cluster
+func (c *Cluster) DSN() string {
+	return "rqlite://" + strings.Join(c.addrs, ",")
+}
+
+// Addrs returns the HTTP API address of each node
+func (c *Cluster) Addrs() []string {
+	return append([]string(nil), c.addrs...)
+}
+
+// Close stops the nodes and removes what Start created
+func (c *Cluster) Close() error {
+	var errs []error
+	// Stop the nodes in reverse start order, the bootstrapping node last
+	for i := len(c.nodes) - 1; i >= 0; i-- {
+		if err := c.nodes[i].stop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, cleanup := range c.cleanup {
+		if err := cleanup(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.nodes, c.cleanup = nil, nil
+	return errors.Join(errs...)
+}
+
+// waitReady polls the node's readiness endpoint, which succeeds once the
+// node knows the leader, until it succeeds or ctx is done
+func waitReady(ctx context.Context, addr string) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr+"/readyz", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("readyz returned %s", resp.Status)
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("devcluster: node %s not ready: %w (last error: %v)", addr, ctx.Err(), lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+// freePort returns a local TCP port that was free when checked
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
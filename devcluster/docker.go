@@ -0,0 +1,109 @@
+package devcluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// container is a node running in a Docker container
+type container struct {
+	name string
+}
+
+// startDocker runs the nodes in containers on a dedicated network, so they
+// reach each other by container name while clients use the published ports
+func startDocker(ctx context.Context, opts Options) (_ *Cluster, err error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	image := opts.Image
+	if image == "" {
+		image = DefaultImage
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	prefix := "rsqlite-devcluster-" + hex.EncodeToString(suffix)
+
+	c := &Cluster{}
+	defer func() {
+		if err != nil {
+			c.Close()
+		}
+	}()
+
+	if _, err := docker(ctx, "network", "create", prefix); err != nil {
+		return nil, err
+	}
+	c.cleanup = append(c.cleanup, func() error {
+		_, err := docker(context.Background(), "network", "rm", prefix)
+		return err
+	})
+
+	var joinAddr string
+	for i := 1; i <= opts.Nodes; i++ {
+		port, err := freePort()
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%s-n%d", prefix, i)
+		httpAddr := fmt.Sprintf("127.0.0.1:%d", port)
+
+		// The advertised HTTP address is the published port, so leader
+		// discovery returns addresses reachable from the host
+		args := []string{
+			"run", "-d", "--rm",
+			"--name", name,
+			"--network", prefix,
+			"-p", httpAddr + ":4001",
+			image,
+			"-node-id", fmt.Sprintf("n%d", i),
+			"-http-addr", "0.0.0.0:4001",
+			"-http-adv-addr", httpAddr,
+			"-raft-addr", "0.0.0.0:4002",
+			"-raft-adv-addr", name + ":4002",
+		}
+		if joinAddr != "" {
+			args = append(args, "-join", joinAddr)
+		}
+
+		if _, err := docker(ctx, args...); err != nil {
+			return nil, err
+		}
+		c.nodes = append(c.nodes, &container{name: name})
+		c.addrs = append(c.addrs, httpAddr)
+
+		if err := waitReady(ctx, httpAddr); err != nil {
+			return nil, err
+		}
+		if joinAddr == "" {
+			joinAddr = name + ":4002"
+		}
+	}
+	return c, nil
+}
+
+// stop removes the container
+func (c *container) stop() error {
+	_, err := docker(context.Background(), "rm", "-f", c.name)
+	return err
+}
+
+// docker runs a docker command and returns its output
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("devcluster: docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,129 @@
+package devcluster
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// releaseURL is the address of the release archive of a version for the
+// current platform
+func releaseURL(version string) string {
+	return fmt.Sprintf("https://github.com/rqlite/rqlite/releases/download/%s/rqlite-%s-%s-%s.tar.gz",
+		version, version, runtime.GOOS, runtime.GOARCH)
+}
+
+// download returns the cached rqlited of version, fetching it from the
+// rqlite releases on first use. The release archive must have the SHA-256
+// digest sum, hex encoded; the binary is cached with the digest it was
+// verified against and only reused for the same digest.
+func download(ctx context.Context, version, sum string) (string, error) {
+	if version == "" {
+		version = DefaultVersion
+	}
+	want, err := hex.DecodeString(strings.TrimSpace(sum))
+	if err != nil || len(want) != sha256.Size {
+		return "", fmt.Errorf("devcluster: Options.Download needs Options.SHA256, the hex SHA-256 of %s", releaseURL(version))
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("devcluster: %w", err)
+	}
+	dir := filepath.Join(cacheDir, "rsqlite", "devcluster", version)
+	binary := filepath.Join(dir, "rqlited")
+	verified := binary + ".sha256"
+	if cached, err := os.ReadFile(verified); err == nil && string(cached) == hex.EncodeToString(want) {
+		if _, err := os.Stat(binary); err == nil {
+			return binary, nil
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("devcluster: %w", err)
+	}
+
+	url := releaseURL(version)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("devcluster: downloading %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("devcluster: downloading %s: %s", url, resp.Status)
+	}
+
+	// Extract next to the final path and rename, so a concurrent or
+	// interrupted download never leaves a partial binary behind
+	tmp, err := os.CreateTemp(dir, "rqlited-*")
+	if err != nil {
+		return "", fmt.Errorf("devcluster: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	archive := io.TeeReader(resp.Body, hash)
+	err = extractRqlited(archive, tmp)
+	if err == nil {
+		// Hash the rest of the archive too
+		_, err = io.Copy(io.Discard, archive)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("devcluster: extracting %s: %w", url, err)
+	}
+	if got := hash.Sum(nil); !bytes.Equal(got, want) {
+		return "", fmt.Errorf("devcluster: %s has SHA-256 %x, want %x; not running it", url, got, want)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", fmt.Errorf("devcluster: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), binary); err != nil {
+		return "", fmt.Errorf("devcluster: %w", err)
+	}
+	if err := os.WriteFile(verified, []byte(hex.EncodeToString(want)), 0o644); err != nil {
+		return "", fmt.Errorf("devcluster: %w", err)
+	}
+	return binary, nil
+}
+
+// extractRqlited copies the rqlited binary of a release archive to w
+func extractRqlited(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return errors.New("archive contains no rqlited binary")
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == "rqlited" {
+			_, err := io.Copy(w, tr)
+			return err
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package devcluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// process is a node running as a local rqlited process
+type process struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+// startLocal runs the nodes as local processes. The first node bootstraps
+// the cluster and the others join it one at a time.
+func startLocal(ctx context.Context, opts Options) (_ *Cluster, err error) {
+	binary, err := findBinary(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cluster{}
+	defer func() {
+		if err != nil {
+			c.Close()
+		}
+	}()
+
+	dir := opts.Dir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "rsqlite-devcluster-"); err != nil {
+			return nil, err
+		}
+		c.cleanup = append(c.cleanup, func() error { return os.RemoveAll(dir) })
+	}
+
+	var joinAddr string
+	for i := 1; i <= opts.Nodes; i++ {
+		httpPort, err := freePort()
+		if err != nil {
+			return nil, err
+		}
+		raftPort, err := freePort()
+		if err != nil {
+			return nil, err
+		}
+		httpAddr := fmt.Sprintf("127.0.0.1:%d", httpPort)
+		raftAddr := fmt.Sprintf("127.0.0.1:%d", raftPort)
+
+		args := []string{
+			"-node-id", fmt.Sprintf("n%d", i),
+			"-http-addr", httpAddr,
+			"-raft-addr", raftAddr,
+		}
+		if joinAddr != "" {
+			args = append(args, "-join", joinAddr)
+		}
+		args = append(args, filepath.Join(dir, fmt.Sprintf("n%d", i)))
+
+		p, err := startProcess(binary, args, opts)
+		if err != nil {
+			return nil, err
+		}
+		c.nodes = append(c.nodes, p)
+		c.addrs = append(c.addrs, httpAddr)
+
+		if err := p.waitReady(ctx, httpAddr); err != nil {
+			return nil, err
+		}
+		if joinAddr == "" {
+			joinAddr = raftAddr
+		}
+	}
+	return c, nil
+}
+
+// findBinary returns the rqlited binary to run, downloading it with
+// Options.Download when none is found
+func findBinary(ctx context.Context, opts Options) (string, error) {
+	if opts.Binary != "" {
+		return opts.Binary, nil
+	}
+	if binary := os.Getenv("RQLITED"); binary != "" {
+		return binary, nil
+	}
+	if binary, err := exec.LookPath("rqlited"); err == nil {
+		return binary, nil
+	}
+	if !opts.Download {
+		return "", ErrUnavailable
+	}
+	return download(ctx, opts.Version, opts.SHA256)
+}
+
+// startProcess starts rqlited with args
+func startProcess(binary string, args []string, opts Options) (*process, error) {
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = opts.Output
+	cmd.Stderr = opts.Output
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("devcluster: starting rqlited: %w", err)
+	}
+
+	p := &process{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// waitReady waits until the node is ready, failing early when it exits
+func (p *process) waitReady(ctx context.Context, addr string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := waitReady(ctx, addr)
+	select {
+	case <-p.done:
+		return fmt.Errorf("devcluster: rqlited exited: %v", p.err)
+	default:
+		return err
+	}
+}
+
+// stop interrupts the process, killing it when it doesn't exit in time
+func (p *process) stop() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+
+	if err := p.cmd.Process.Signal(os.Interrupt); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		p.cmd.Process.Kill()
+	}
+	select {
+	case <-p.done:
+	case <-time.After(10 * time.Second):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+	return nil
+}
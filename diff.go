@@ -0,0 +1,344 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DiffOptions configures Connector.Diff
+type DiffOptions struct {
+	// DriverName is the database/sql driver that opens SQLite files,
+	// e.g. "sqlite3" from github.com/mattn/go-sqlite3
+	DriverName string
+	// Dir holds the temporary snapshot; os.TempDir() is used when empty
+	Dir string
+	// Tables restricts the data comparison to these tables; every table is compared when empty
+	Tables []string
+	// SchemaOnly skips the data comparison
+	SchemaOnly bool
+}
+
+// SchemaChange describes a schema object that differs between the cluster and the local file
+type SchemaChange struct {
+	// Type is the sqlite_master type: table, index, view or trigger
+	Type string
+	Name string
+	// Local and Remote hold the CREATE statements, empty when the object is missing on that side
+	Local  string
+	Remote string
+}
+
+// TableDiff lists the rowids of rows that differ in a table
+type TableDiff struct {
+	Table string
+	// Added rows exist only in the cluster, Removed rows only in the local file
+	Added   []int64
+	Removed []int64
+	// Changed rows exist on both sides with different values
+	Changed []int64
+}
+
+// SnapshotDiff is the difference between a cluster snapshot and a local SQLite file
+type SnapshotDiff struct {
+	Schema []SchemaChange
+	// Tables holds the tables whose data differs
+	Tables []TableDiff
+	// Skipped maps tables whose data was not compared to the reason
+	Skipped map[string]string
+}
+
+// Empty reports whether no difference was found
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Schema) == 0 && len(d.Tables) == 0
+}
+
+// Diff pulls a consistent snapshot of the cluster through the backup API and
+// compares it with the local SQLite file at localPath. Schema objects are
+// compared by their CREATE statements and table data row by row, keyed by
+// rowid, which is enough to verify a migration or to apply the changes to a
+// local copy incrementally.
+func (c *Connector) Diff(ctx context.Context, localPath string, opts DiffOptions) (*SnapshotDiff, error) {
+	if opts.DriverName == "" {
+		return nil, errors.New("diff needs a local SQLite driver name")
+	}
+
+	// Opening a missing file would silently create an empty database
+	if _, err := os.Stat(localPath); err != nil {
+		return nil, err
+	}
+
+	path, err := snapshotToFile(ctx, opts.Dir, "rsqlite-diff-*.db", c.Backup)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+
+	remote, err := sql.Open(opts.DriverName, path)
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+
+	local, err := sql.Open(opts.DriverName, localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer local.Close()
+
+	return diffDatabases(ctx, local, remote, opts)
+}
+
+// schemaObject is a row of sqlite_master
+type schemaObject struct {
+	typ  string
+	name string
+	sql  string
+}
+
+// diffDatabases compares the schema and data of two SQLite databases
+func diffDatabases(ctx context.Context, local, remote *sql.DB, opts DiffOptions) (*SnapshotDiff, error) {
+	localSchema, err := readSchema(ctx, local)
+	if err != nil {
+		return nil, fmt.Errorf("reading local schema: %w", err)
+	}
+
+	remoteSchema, err := readSchema(ctx, remote)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot schema: %w", err)
+	}
+
+	diff := &SnapshotDiff{Skipped: make(map[string]string)}
+
+	keys := make([]string, 0, len(localSchema)+len(remoteSchema))
+	for key := range localSchema {
+		keys = append(keys, key)
+	}
+	for key := range remoteSchema {
+		if _, ok := localSchema[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		l, inLocal := localSchema[key]
+		r, inRemote := remoteSchema[key]
+		if inLocal && inRemote && normalizeSQL(l.sql) == normalizeSQL(r.sql) {
+			continue
+		}
+
+		change := SchemaChange{Local: l.sql, Remote: r.sql}
+		if inLocal {
+			change.Type, change.Name = l.typ, l.name
+		} else {
+			change.Type, change.Name = r.typ, r.name
+		}
+		diff.Schema = append(diff.Schema, change)
+	}
+
+	if opts.SchemaOnly {
+		return diff, nil
+	}
+
+	tables := opts.Tables
+	if len(tables) == 0 {
+		for _, key := range keys {
+			if obj, ok := remoteSchema[key]; ok && obj.typ == "table" {
+				tables = append(tables, obj.name)
+			} else if obj, ok := localSchema[key]; ok && obj.typ == "table" {
+				tables = append(tables, obj.name)
+			}
+		}
+	}
+
+	for _, table := range tables {
+		key := "table " + strings.ToLower(table)
+		l, inLocal := localSchema[key]
+		r, inRemote := remoteSchema[key]
+
+		switch {
+		case !inLocal && !inRemote:
+			diff.Skipped[table] = "no such table"
+			continue
+		case !inLocal:
+			diff.Skipped[table] = "missing in local file"
+			continue
+		case !inRemote:
+			diff.Skipped[table] = "missing in cluster"
+			continue
+		case normalizeSQL(l.sql) != normalizeSQL(r.sql):
+			diff.Skipped[table] = "schema differs"
+			continue
+		}
+
+		tableDiff, err := diffTable(ctx, local, remote, r.name)
+		if err != nil {
+			diff.Skipped[table] = err.Error()
+			continue
+		}
+		if len(tableDiff.Added)+len(tableDiff.Removed)+len(tableDiff.Changed) > 0 {
+			diff.Tables = append(diff.Tables, *tableDiff)
+		}
+	}
+
+	return diff, nil
+}
+
+// readSchema reads the user objects of sqlite_master keyed by type and lowercased name
+func readSchema(ctx context.Context, db *sql.DB) (map[string]schemaObject, error) {
+	rows, err := db.QueryContext(ctx, "SELECT type, name, sql FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schema := make(map[string]schemaObject)
+	for rows.Next() {
+		var obj schemaObject
+		var createSQL sql.NullString
+		if err := rows.Scan(&obj.typ, &obj.name, &createSQL); err != nil {
+			return nil, err
+		}
+		obj.sql = createSQL.String
+		schema[obj.typ+" "+strings.ToLower(obj.name)] = obj
+	}
+
+	return schema, rows.Err()
+}
+
+// normalizeSQL collapses whitespace so formatting differences don't count as changes
+func normalizeSQL(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// quoteIdent quotes an SQLite identifier
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// diffTable compares the rows of a table on both sides with a merge join on rowid.
+// WITHOUT ROWID tables have no rowid and are reported as an error.
+func diffTable(ctx context.Context, local, remote *sql.DB, table string) (*TableDiff, error) {
+	query := "SELECT rowid, * FROM " + quoteIdent(table) + " ORDER BY rowid"
+
+	l, err := newRowCursor(ctx, local, query)
+	if err != nil {
+		return nil, err
+	}
+	defer l.close()
+
+	r, err := newRowCursor(ctx, remote, query)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	diff := &TableDiff{Table: table}
+	l.next()
+	r.next()
+	for l.ok || r.ok {
+		switch {
+		case !r.ok || (l.ok && l.id < r.id):
+			diff.Removed = append(diff.Removed, l.id)
+			l.next()
+		case !l.ok || r.id < l.id:
+			diff.Added = append(diff.Added, r.id)
+			r.next()
+		default:
+			if !equalRows(l.values, r.values) {
+				diff.Changed = append(diff.Changed, l.id)
+			}
+			l.next()
+			r.next()
+		}
+	}
+
+	if err := errors.Join(l.err, r.err); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// equalRows reports whether two rows hold the same values
+func equalRows(a, b []driver.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if valueRank(a[i]) != valueRank(b[i]) || compareValues(a[i], b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rowCursor walks the rows of a "SELECT rowid, *" query
+type rowCursor struct {
+	rows   *sql.Rows
+	ptrs   []interface{}
+	id     int64
+	values []driver.Value
+	ok     bool
+	err    error
+}
+
+// newRowCursor runs the query and prepares the cursor
+func newRowCursor(ctx context.Context, db *sql.DB, query string) (*rowCursor, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+
+	return &rowCursor{rows: rows, ptrs: make([]interface{}, len(columns))}, nil
+}
+
+// next advances the cursor; ok is false at the end or on error
+func (rc *rowCursor) next() {
+	rc.ok = false
+	if rc.err != nil || !rc.rows.Next() {
+		if rc.err == nil {
+			rc.err = rc.rows.Err()
+		}
+		return
+	}
+
+	raw := make([]interface{}, len(rc.ptrs))
+	for i := range raw {
+		rc.ptrs[i] = &raw[i]
+	}
+	if err := rc.rows.Scan(rc.ptrs...); err != nil {
+		rc.err = err
+		return
+	}
+
+	id, ok := convertValue(raw[0]).(int64)
+	if !ok {
+		rc.err = fmt.Errorf("unexpected rowid %v", raw[0])
+		return
+	}
+
+	rc.id = id
+	rc.values = make([]driver.Value, len(raw)-1)
+	for i, v := range raw[1:] {
+		rc.values[i] = convertValue(v)
+	}
+	rc.ok = true
+}
+
+// close releases the cursor's rows
+func (rc *rowCursor) close() {
+	rc.rows.Close()
+}
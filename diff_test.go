@@ -0,0 +1,256 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func init() {
+	sql.Register("rsqlite-diff-test", diffTestDriver{})
+}
+
+// diffTestDB is an in-memory database answering the queries of diffDatabases
+// and snapshotRowCounts
+type diffTestDB struct {
+	// schema holds sqlite_master rows of type, name and sql
+	schema [][]driver.Value
+	// tables holds the rows of each table by lowercased name, rowid first
+	tables map[string][][]driver.Value
+	// failSchema fails the sqlite_master query
+	failSchema bool
+}
+
+// diffTestDatabases maps the contents of a database file to the database it stands for
+var diffTestDatabases = map[string]*diffTestDB{}
+
+// diffTestDriver stands in for a local SQLite driver, opening the in-memory
+// database named by the file contents
+type diffTestDriver struct{}
+
+func (diffTestDriver) Open(name string) (driver.Conn, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	db, ok := diffTestDatabases[string(data)]
+	if !ok {
+		return nil, errors.New("file is not a database")
+	}
+	return &diffTestConn{db: db}, nil
+}
+
+type diffTestConn struct {
+	db *diffTestDB
+}
+
+func (c *diffTestConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *diffTestConn) Close() error {
+	return nil
+}
+
+func (c *diffTestConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *diffTestConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.Contains(query, "sqlite_master") {
+		if c.db.failSchema {
+			return nil, errors.New("database disk image is malformed")
+		}
+		return &diffTestRows{columns: []string{"type", "name", "sql"}, values: c.db.schema}, nil
+	}
+
+	table, count := strings.CutPrefix(query, "SELECT COUNT(*) FROM ")
+	if !count {
+		table = strings.TrimPrefix(query, "SELECT rowid, * FROM ")
+		table = strings.TrimSuffix(table, " ORDER BY rowid")
+	}
+	rows, ok := c.db.tables[strings.ToLower(strings.Trim(table, `"`))]
+	if !ok {
+		return nil, errors.New("no such table: " + table)
+	}
+	if count {
+		return &diffTestRows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{int64(len(rows))}}}, nil
+	}
+	return &diffTestRows{columns: []string{"rowid", "v"}, values: rows}, nil
+}
+
+type diffTestRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *diffTestRows) Columns() []string {
+	return r.columns
+}
+
+func (r *diffTestRows) Close() error {
+	return nil
+}
+
+func (r *diffTestRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// writeDiffTestFile writes a local database file standing for db
+func writeDiffTestFile(t *testing.T, name string, db *diffTestDB) string {
+	t.Helper()
+	diffTestDatabases[name] = db
+	t.Cleanup(func() { delete(diffTestDatabases, name) })
+
+	path := filepath.Join(t.TempDir(), name+".db")
+	if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiff(t *testing.T) {
+	local := writeDiffTestFile(t, "diff-local", &diffTestDB{
+		schema: [][]driver.Value{
+			{"table", "users", "CREATE TABLE users (id INTEGER PRIMARY KEY, v)"},
+			{"table", "posts", "CREATE TABLE posts (id, v)"},
+			{"table", "tags", "CREATE TABLE tags (id, v)"},
+			{"table", "broken", "CREATE TABLE broken (v)"},
+			{"view", "recent", "CREATE VIEW recent AS SELECT * FROM posts"},
+		},
+		tables: map[string][][]driver.Value{
+			"users":  {{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(5), nil}},
+			"posts":  {{int64(1), "x"}},
+			"tags":   {{int64(1), "t"}},
+			"broken": {{"not a rowid", "v"}},
+		},
+	})
+	diffTestDatabases["diff-remote"] = &diffTestDB{
+		schema: [][]driver.Value{
+			// Formatting differences don't count
+			{"table", "USERS", "CREATE TABLE users  (id INTEGER PRIMARY KEY,\n\tv)"},
+			{"table", "posts", "CREATE TABLE posts (id, v, extra)"},
+			{"table", "tags", "CREATE TABLE tags (id, v)"},
+			{"table", "broken", "CREATE TABLE broken (v)"},
+			{"index", "idx_tags", "CREATE INDEX idx_tags ON tags (v)"},
+		},
+		tables: map[string][][]driver.Value{
+			"users":  {{int64(2), "b"}, {int64(3), "changed"}, {int64(4), "d"}, {int64(5), nil}},
+			"posts":  {{int64(1), "y"}},
+			"tags":   {{int64(1), "t"}},
+			"broken": {{int64(1), "v"}},
+		},
+	}
+	defer delete(diffTestDatabases, "diff-remote")
+
+	connector := newBackupConnector(t, "diff-remote")
+	diff, err := connector.Diff(context.Background(), local, DiffOptions{DriverName: "rsqlite-diff-test", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSchema := []SchemaChange{
+		{Type: "index", Name: "idx_tags", Remote: "CREATE INDEX idx_tags ON tags (v)"},
+		{Type: "table", Name: "posts", Local: "CREATE TABLE posts (id, v)", Remote: "CREATE TABLE posts (id, v, extra)"},
+		{Type: "view", Name: "recent", Local: "CREATE VIEW recent AS SELECT * FROM posts"},
+	}
+	if !reflect.DeepEqual(diff.Schema, wantSchema) {
+		t.Errorf("schema changes\n%+v\nwant\n%+v", diff.Schema, wantSchema)
+	}
+
+	// The merge join finds the rows on one side only and the changed ones
+	wantTables := []TableDiff{{Table: "USERS", Added: []int64{4}, Removed: []int64{1}, Changed: []int64{3}}}
+	if !reflect.DeepEqual(diff.Tables, wantTables) {
+		t.Errorf("table diffs %+v, want %+v", diff.Tables, wantTables)
+	}
+	if diff.Empty() {
+		t.Error("diff with changes empty")
+	}
+
+	if reason := diff.Skipped["posts"]; reason != "schema differs" {
+		t.Errorf("posts skipped as %q", reason)
+	}
+	if reason := diff.Skipped["broken"]; !strings.Contains(reason, "unexpected rowid") {
+		t.Errorf("table with a bad rowid skipped as %q", reason)
+	}
+	if len(diff.Skipped) != 2 {
+		t.Errorf("skipped %v", diff.Skipped)
+	}
+
+	// Restricted and schema only comparisons
+	diff, err = connector.Diff(context.Background(), local, DiffOptions{DriverName: "rsqlite-diff-test", Tables: []string{"tags", "missing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Tables) != 0 || diff.Skipped["missing"] != "no such table" || len(diff.Skipped) != 1 {
+		t.Errorf("restricted diff %+v", diff)
+	}
+	diff, err = connector.Diff(context.Background(), local, DiffOptions{DriverName: "rsqlite-diff-test", SchemaOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Schema) != 3 || len(diff.Tables) != 0 || len(diff.Skipped) != 0 {
+		t.Errorf("schema only diff %+v", diff)
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	dir := t.TempDir()
+	diffTestDatabases["diff-errors-remote"] = &diffTestDB{}
+	defer delete(diffTestDatabases, "diff-errors-remote")
+	connector := newBackupConnector(t, "diff-errors-remote")
+	ctx := context.Background()
+	opts := DiffOptions{DriverName: "rsqlite-diff-test", Dir: dir}
+
+	empty := writeDiffTestFile(t, "diff-errors-empty", &diffTestDB{})
+	if _, err := connector.Diff(ctx, empty, DiffOptions{}); err == nil {
+		t.Error("diff without a driver name succeeded")
+	}
+	if _, err := connector.Diff(ctx, filepath.Join(dir, "missing.db"), opts); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("diff of a missing file = %v", err)
+	}
+
+	malformed := writeDiffTestFile(t, "diff-errors-malformed", &diffTestDB{failSchema: true})
+	if _, err := connector.Diff(ctx, malformed, opts); err == nil || !strings.Contains(err.Error(), "reading local schema: database disk image is malformed") {
+		t.Errorf("diff of a malformed local file = %v", err)
+	}
+	diffTestDatabases["diff-errors-remote"].failSchema = true
+	if _, err := connector.Diff(ctx, empty, opts); err == nil || !strings.Contains(err.Error(), "reading snapshot schema") {
+		t.Errorf("diff of a malformed snapshot = %v", err)
+	}
+
+	// A failing backup leaves no snapshot behind
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "backup failed", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	cfg, err := ParseDSN(server.URL + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer failing.Close()
+	if _, err := failing.Diff(ctx, empty, opts); err == nil {
+		t.Error("diff with a failing backup succeeded")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left in the snapshot dir", len(entries))
+	}
+}
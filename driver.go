@@ -1,36 +1,294 @@
 package rsqlite
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
 )
 
 // Driver implements the database/sql/driver.Driver interface
 type Driver struct{}
 
-// Open returns a new connection to the database
+// Open returns a new connection to the database. DSNs naming a local
+// SQLite file are opened by the driver set with SetLocalFallback.
 func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	local, err := openLocalConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if local != nil {
+		return local.Connect(context.Background())
+	}
+
 	return Open(dsn)
 }
 
+// OpenConnector implements the database/sql/driver.DriverContext interface.
+// The DSN is parsed and validated once, so sql.Open reports a bad DSN
+// immediately and every pooled connection shares one Connector. DSNs naming
+// a local SQLite file get a connector of the driver set with SetLocalFallback.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	local, err := openLocalConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if local != nil {
+		return local, nil
+	}
+
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConnector(cfg)
+}
+
 // Config holds the configuration for the rqlite connection
 type Config struct {
-	Nodes            []string
+	Nodes []string
+	// Username and Password are sent with HTTP Basic Auth. In a DSN they
+	// precede the "@" before the node list, separated by the first ":";
+	// percent-encode reserved characters, e.g. "user:p%40ss%3Aw%2Frd@host:4001"
+	// for the password "p@ss:w/rd".
 	Username         string
 	Password         string
 	Timeout          time.Duration
 	ConsistencyLevel string
+	// CredentialProvider, if set, supplies the credentials of every request
+	// instead of Username and Password, so rotated secrets are picked up
+	// without reopening the database
+	CredentialProvider CredentialProvider
+	// RaftReads forces strong reads through the raft log even when the
+	// server supports linearizable reads from the leader
+	RaftReads bool
+	// StrictNumbers returns numeric results as their exact decimal text
+	// instead of converting them to float64
+	StrictNumbers bool
+	// DedupColumns renames duplicate result column names to name_1, name_2, ...
+	// so map-based scanning helpers see every column
+	DedupColumns bool
+	// MaxRequestBytes rejects statements whose encoded request body is larger,
+	// returning a *RequestTooLargeError; 0 means no limit
+	MaxRequestBytes int64
+	// SlowQueryThreshold logs statements taking longer than this, annotated
+	// with their request size and row count; 0 disables slow-query logging
+	SlowQueryThreshold time.Duration
+	// Logger receives slow-query logs; log.Default() is used when nil
+	Logger *log.Logger
+	// Hooks receives per-statement events, e.g. for metrics
+	Hooks *Hooks
+	// InteractiveLimit appends LIMIT n to SELECT statements lacking one,
+	// protecting shared clusters from ad-hoc query UIs; 0 disables it
+	InteractiveLimit int
+	// Codec encodes statements and decodes responses; JSONCodec is used when nil
+	Codec Codec
+	// RequireScheme rejects nodes without an explicit http:// or https:// scheme
+	RequireScheme bool
+	// DefaultScheme is prefixed to nodes without a scheme, "http" or "https"
+	DefaultScheme string
+	// AppName identifies the application in the User-Agent and
+	// X-Application-Name headers of every request
+	AppName string
+	// AppNameComment also prefixes every statement with a /* app=AppName */ comment
+	AppNameComment bool
+	// ReplicaCache serves cacheable queries from a periodically refreshed
+	// local snapshot; only used by connections created through a Connector
+	ReplicaCache *ReplicaCacheConfig
+	// ParamsOnly rejects statements containing inline string literals with an
+	// *InlineLiteralError, pushing callers toward parameterized queries
+	ParamsOnly bool
+	// ParamsOnlyAllow lists statement fingerprints or labels exempt from ParamsOnly
+	ParamsOnlyAllow []string
+	// PreferFollowers connects to a follower when one is reachable, keeping
+	// read traffic away from the leader
+	PreferFollowers bool
+	// ReadOnly rejects writes with ErrReadOnly
+	ReadOnly bool
+	// Databases maps logical database names to table prefixes, emulating
+	// ATTACHed databases on rqlite's single database: with {"analytics":
+	// "analytics_"}, analytics.events refers to the table analytics_events
+	Databases map[string]string
+	// BackupCompression compresses backup transfers, e.g. GzipCompression{};
+	// uncompressed when nil
+	BackupCompression Compression
+	// TLSConfig configures TLS for https nodes, e.g. a private CA pool or
+	// client certificates; the system roots are used when nil
+	TLSConfig *tls.Config
+	// Canary periodically measures write and replication latency with a
+	// synthetic write; only used by connections created through a Connector
+	Canary *CanaryConfig
+	// AdaptiveTimeout bounds each statement by a timeout derived from the
+	// latencies observed for it, so fast statements fail fast while naturally
+	// slow reports keep their headroom; only used by connections created
+	// through a Connector
+	AdaptiveTimeout *AdaptiveTimeoutConfig
+	// MaxRetries is the number of times a failed statement is retried after
+	// reconnecting, default 2; 0 disables retries
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, default 100ms,
+	// doubled for every further one and varied by up to 20%; 0 retries
+	// immediately
+	RetryBackoff time.Duration
+	// RetryMaxElapsed stops retrying once this much time has passed since the
+	// first attempt; 0 means no limit
+	RetryMaxElapsed time.Duration
+	// DisableDiscovery skips leader discovery through /nodes and /status and
+	// sends requests to the configured nodes in order, e.g. for a load
+	// balancer endpoint that forwards to the cluster
+	DisableDiscovery bool
+	// StreamRows decodes query results row by row as they are read instead
+	// of decoding the whole response first, bounding memory for large or wide
+	// result sets. Requires the JSON codec; Rows must be closed, and
+	// QueryEvent.Rows and BytesReceived are zero for streamed queries. Stats
+	// counts the rows read once Rows, or its statement or connection, is closed.
+	StreamRows bool
+	// ReadPreference chooses the node connections use for weak and none
+	// reads: "leader" (default), "follower", "round_robin" over the healthy
+	// followers, one per new connection, "random" or "nearest" by
+	// round-trip time and error rate, see ClusterManager.Scores. Without a
+	// healthy follower connections use the leader. Only none reads are
+	// answered by the chosen node itself; rqlite forwards writes and weak
+	// reads to the leader.
+	ReadPreference string
+	// Queue sends Exec statements through rqlite's queued write endpoint,
+	// which batches them on the leader for much higher throughput. Exec
+	// returns once a write is queued, before it is durable; rqlite reports
+	// no counts for queued writes, so LastInsertId and RowsAffected fail
+	// with a *ResultUnknownError. Connector.FlushQueue waits until the
+	// queued writes are persisted.
+	Queue bool
+	// APIPortOffset is added to the port of raft addresses reported by leader
+	// discovery that the /nodes listing doesn't map to an API address, e.g.
+	// -1 for the default raft port 4002 and API port 4001
+	APIPortOffset int
+	// Idempotency, if set, sends every Exec with a client-generated key
+	// recorded in a dedup table, so retries after ambiguous failures don't
+	// apply a write twice. Each Exec then runs as a transaction of the
+	// statement and the key record. Not compatible with Queue.
+	Idempotency *IdempotencyConfig
+	// Delivery selects whether writes whose outcome is unknown are retried,
+	// AtLeastOnce, or returned as errors, AtMostOnce; WithDelivery overrides
+	// it per statement. See the Delivery constants.
+	Delivery Delivery
+	// DialTimeout bounds establishing the TCP and TLS connection to a node,
+	// so unreachable nodes fail fast; 0 leaves it to the request timeouts
+	DialTimeout time.Duration
+	// QueryTimeout and ExecTimeout replace Timeout for each query and write
+	// request, e.g. a long QueryTimeout for slow analytical reads; 0 uses
+	// Timeout
+	QueryTimeout time.Duration
+	ExecTimeout  time.Duration
+	// MaxRows aborts queries returning more rows with *MaxRowsError; SELECT
+	// statements without a LIMIT clause are capped at MaxRows+1 rows, so
+	// the server never sends more. 0 disables the guard.
+	MaxRows int
+	// MaxStatementStats caps the statements Stats.ByStatement and adaptive
+	// timeouts keep state for, evicting the least recently run, so pools
+	// running many distinct statements don't grow without bound. 0 uses
+	// 1000; negative disables the cap.
+	MaxStatementStats int
+	// MaxResultMemory is a soft cap on the response bytes of query results
+	// held by a Connector's open Rows. Once reached, new queries wait until
+	// Rows are closed, or fail with *MemoryLimitError when
+	// ResultMemoryFailFast is set. Streamed rows aren't counted; 0 means no
+	// limit.
+	MaxResultMemory      int64
+	ResultMemoryFailFast bool
+	// TimeFormat selects how time.Time arguments are stored, see the
+	// TimeFormat constants; date and datetime columns are read back in the
+	// same format. Default TimeFormatRFC3339.
+	TimeFormat TimeFormat
+	// TimeUTC converts time.Time arguments to UTC before storing them and
+	// returns date and datetime columns in UTC, so values round-trip
+	// consistently whatever the zone of the writer
+	TimeUTC bool
+	// ReadConsistency and WriteConsistency override ConsistencyLevel for
+	// queries and for Exec, e.g. cheap weak reads with strong writes; ""
+	// uses ConsistencyLevel. Queries are sent at ReadConsistency, which also
+	// picks the node connections are pinned to. Exec at strong or
+	// linearizable WriteConsistency goes straight to the leader instead of
+	// being forwarded by the connection's node.
+	ReadConsistency  string
+	WriteConsistency string
+	// ReturningInsertID appends RETURNING rowid to INSERT and REPLACE
+	// statements sent to servers supporting it and takes LastInsertId from
+	// the returned row, so upserts report the row they updated. Idempotent
+	// writes already record their insert id and queued writes have none.
+	ReturningInsertID bool
+	// MaxQuarantine caps how long a node that keeps failing is skipped by
+	// node selection and reconnects. A failed node is skipped for 5s, twice
+	// as long each time it fails again when re-tried, and rehabilitated by
+	// its first successful request or health check. 0 means 5 minutes.
+	MaxQuarantine time.Duration
+	// LastResort takes over writes that failed after every retry, e.g. a
+	// SpillFile persisting them for replay, instead of returning their
+	// error; nil returns the error. Writes the server rejected, e.g. for a constraint, and writes
+	// whose context was cancelled are never handed over.
+	LastResort LastResort
+	// ReadWriteSplit gives each connection two clients: writes and strong
+	// reads go to the leader, weak and none reads to a follower picked by
+	// ReadPreference, in turn over the healthy followers when that is the
+	// leader. Without a reachable follower reads stay on the leader.
+	ReadWriteSplit bool
+	// Throttle slows writes while the leader falls behind applying them,
+	// between a minimum and a maximum rate; only used by connections
+	// created through a Connector
+	Throttle *ThrottleConfig
+	// ReadYourWrites makes the reads of a connection see its own writes:
+	// writes report their raft index, and none and auto reads wait briefly
+	// for a node that hasn't applied the connection's last write, then go
+	// to the leader
+	ReadYourWrites bool
+	// Clock replaces the system clock for the expiry of discovery and
+	// health caches and quarantines, and for retry backoff, e.g. with a
+	// fake clock in tests; nil uses the time package
+	Clock Clock
+	// Rand replaces the randomness of the follower and random read
+	// preferences and of retry jitter, e.g. with a seeded source in tests;
+	// nil uses math/rand/v2
+	Rand Rand
+	// Retry replaces MaxRetries, RetryBackoff and RetryMaxElapsed with a
+	// policy setting the backoff multiplier and jitter too. It applies to
+	// statements, connection attempts and leader discovery.
+	Retry *RetryPolicy
+	// StaleAfter makes the pool discard a connection whose node hasn't
+	// answered any of its requests for longer, whether the connection sat
+	// idle or its requests failed, so the next statement starts on a fresh
+	// connection; 0 keeps connections regardless
+	StaleAfter time.Duration
 }
 
-// ParseDSN parses the data source name
-func ParseDSN(dsn string) (*Config, error) {
-	cfg := &Config{
+// defaultConfig returns the configuration ParseDSN and NewConfig start from
+func defaultConfig() *Config {
+	return &Config{
 		Timeout:          30 * time.Second,
 		ConsistencyLevel: "weak",
+		DefaultScheme:    "http",
+		MaxRetries:       2,
+		RetryBackoff:     100 * time.Millisecond,
 	}
+}
+
+// ParseDSN parses the data source name, or the DSN registered under it with
+// RegisterDSN
+func ParseDSN(dsn string) (*Config, error) {
+	return parseDSN(resolveDSN(dsn))
+}
+
+// parseDSN parses a data source name that isn't an alias
+func parseDSN(dsn string) (*Config, error) {
+	cfg := defaultConfig()
 
 	// DSN format: rqlite://[username:password@]host1:port1,host2:port2/[?consistency=strong&timeout=30s]
 	// But we register as sqlite, so DSN might be: sqlite://host1:port1,host2:port2/[?consistency=strong&timeout=30s]
@@ -43,51 +301,353 @@ func ParseDSN(dsn string) (*Config, error) {
 	dsn = strings.TrimPrefix(dsn, "sqlite://")
 	dsn = strings.TrimPrefix(dsn, "rqlite://")
 
-	// Parse authentication if present
-	if strings.Contains(dsn, "@") {
-		parts := strings.Split(dsn, "@")
-		if len(parts) != 2 {
-			return nil, errors.New("invalid dsn format")
-		}
+	if looksLikeFilePath(dsn) {
+		return nil, fmt.Errorf("dsn %q looks like a local SQLite file; rsqlite connects to rqlite nodes, e.g. \"localhost:4001\", or opens local files with the driver set by SetLocalFallback", dsn)
+	}
 
-		authPart := parts[0]
-		dsn = parts[1]
+	// Parse authentication if present. Credentials are percent-decoded.
+	if userinfo, rest, ok := transport.SplitUserinfo(dsn); ok {
+		dsn = rest
 
-		if strings.Contains(authPart, ":") {
-			authParts := strings.Split(authPart, ":")
-			cfg.Username = authParts[0]
-			cfg.Password = authParts[1]
-		} else {
-			cfg.Username = authPart
+		var err error
+		if cfg.Username, cfg.Password, err = transport.ParseCredentials(userinfo); err != nil {
+			return nil, err
 		}
 	}
 
-	// Parse parameters if present
-	if strings.Contains(dsn, "?") {
-		parts := strings.Split(dsn, "?")
-		if len(parts) != 2 {
-			return nil, errors.New("invalid dsn format")
+	// Parse parameters if present. The node list ends at the first "?";
+	// values may contain "?" and "=" and are decoded like a URL query.
+	if hosts, rawQuery, ok := strings.Cut(dsn, "?"); ok {
+		dsn = hosts
+
+		params, err := transport.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, err
 		}
 
-		dsn = parts[0]
-		params := parts[1]
+		// In strict mode every problem with a parameter is an error
+		strict := false
+		var problems []error
+		invalid := func(key, value string, err error) {
+			problems = append(problems, fmt.Errorf("dsn parameter %s=%q: %w", key, value, err))
+		}
+		for _, param := range params {
+			if param.Key == "strict" {
+				strict, _ = strconv.ParseBool(param.Value)
+			}
+		}
 
-		for _, param := range strings.Split(params, "&") {
-			kv := strings.Split(param, "=")
-			if len(kv) != 2 {
+		for _, param := range params {
+			if !param.HasValue {
+				problems = append(problems, fmt.Errorf("malformed dsn parameter %q: use key=value", param.Key))
 				continue
 			}
 
-			key, value := kv[0], kv[1]
+			key, value := param.Key, param.Value
 			switch key {
 			case "consistency":
 				cfg.ConsistencyLevel = value
+				if !validConsistencyLevels[value] {
+					invalid(key, value, errors.New("use none, weak, strong, linearizable or auto"))
+				}
+			case "read_consistency", "write_consistency":
+				if key == "read_consistency" {
+					cfg.ReadConsistency = value
+				} else {
+					cfg.WriteConsistency = value
+				}
+				if !validConsistencyLevels[value] {
+					invalid(key, value, errors.New("use none, weak, strong, linearizable or auto"))
+				}
 			case "timeout":
 				if timeout, err := time.ParseDuration(value); err == nil {
 					cfg.Timeout = timeout
+				} else {
+					invalid(key, value, err)
+				}
+			case "dial_timeout":
+				if timeout, err := time.ParseDuration(value); err == nil {
+					cfg.DialTimeout = timeout
+				} else {
+					invalid(key, value, err)
+				}
+			case "query_timeout":
+				if timeout, err := time.ParseDuration(value); err == nil {
+					cfg.QueryTimeout = timeout
+				} else {
+					invalid(key, value, err)
+				}
+			case "exec_timeout":
+				if timeout, err := time.ParseDuration(value); err == nil {
+					cfg.ExecTimeout = timeout
+				} else {
+					invalid(key, value, err)
+				}
+			case "raft_reads":
+				if raftReads, err := strconv.ParseBool(value); err == nil {
+					cfg.RaftReads = raftReads
+				} else {
+					invalid(key, value, err)
+				}
+			case "strict_numbers":
+				if strictNumbers, err := strconv.ParseBool(value); err == nil {
+					cfg.StrictNumbers = strictNumbers
+				} else {
+					invalid(key, value, err)
+				}
+			case "dedup_columns":
+				if dedupColumns, err := strconv.ParseBool(value); err == nil {
+					cfg.DedupColumns = dedupColumns
+				} else {
+					invalid(key, value, err)
+				}
+			case "max_request_size":
+				if size, err := parseSize(value); err == nil {
+					cfg.MaxRequestBytes = size
+				} else {
+					invalid(key, value, err)
+				}
+			case "slow_query":
+				if threshold, err := time.ParseDuration(value); err == nil {
+					cfg.SlowQueryThreshold = threshold
+				} else {
+					invalid(key, value, err)
+				}
+			case "returning_insert_id":
+				if returning, err := strconv.ParseBool(value); err == nil {
+					cfg.ReturningInsertID = returning
+				} else {
+					invalid(key, value, err)
+				}
+			case "max_quarantine":
+				if max, err := time.ParseDuration(value); err == nil {
+					cfg.MaxQuarantine = max
+				} else {
+					invalid(key, value, err)
+				}
+			case "read_write_split":
+				if split, err := strconv.ParseBool(value); err == nil {
+					cfg.ReadWriteSplit = split
+				} else {
+					invalid(key, value, err)
+				}
+			case "read_your_writes":
+				if ryw, err := strconv.ParseBool(value); err == nil {
+					cfg.ReadYourWrites = ryw
+				} else {
+					invalid(key, value, err)
+				}
+			case "stale_after":
+				if staleAfter, err := time.ParseDuration(value); err == nil {
+					cfg.StaleAfter = staleAfter
+				} else {
+					invalid(key, value, err)
+				}
+			case "time_format":
+				cfg.TimeFormat = TimeFormat(strings.ToLower(value))
+				if !validTimeFormats[cfg.TimeFormat] {
+					invalid(key, value, errors.New("use rfc3339, datetime, unix or unix_milli"))
+				}
+			case "time_utc":
+				if utc, err := strconv.ParseBool(value); err == nil {
+					cfg.TimeUTC = utc
+				} else {
+					invalid(key, value, err)
+				}
+			case "max_result_memory":
+				if size, err := parseSize(value); err == nil {
+					cfg.MaxResultMemory = size
+				} else {
+					invalid(key, value, err)
+				}
+			case "result_memory_fail_fast":
+				if failFast, err := strconv.ParseBool(value); err == nil {
+					cfg.ResultMemoryFailFast = failFast
+				} else {
+					invalid(key, value, err)
+				}
+			case "max_statement_stats":
+				if maxStatements, err := strconv.Atoi(value); err == nil {
+					cfg.MaxStatementStats = maxStatements
+				} else {
+					invalid(key, value, err)
+				}
+			case "max_rows":
+				if maxRows, err := strconv.Atoi(value); err == nil {
+					cfg.MaxRows = maxRows
+				} else {
+					invalid(key, value, err)
+				}
+			case "interactive_limit":
+				if limit, err := strconv.Atoi(value); err == nil {
+					cfg.InteractiveLimit = limit
+				} else {
+					invalid(key, value, err)
+				}
+			case "require_scheme":
+				if requireScheme, err := strconv.ParseBool(value); err == nil {
+					cfg.RequireScheme = requireScheme
+				} else {
+					invalid(key, value, err)
+				}
+			case "default_scheme":
+				cfg.DefaultScheme = strings.ToLower(value)
+				if cfg.DefaultScheme != "http" && cfg.DefaultScheme != "https" {
+					invalid(key, value, errors.New("use http or https"))
+				}
+			case "app_name":
+				cfg.AppName = value
+			case "app_name_comment":
+				if appNameComment, err := strconv.ParseBool(value); err == nil {
+					cfg.AppNameComment = appNameComment
+				} else {
+					invalid(key, value, err)
+				}
+			case "params_only":
+				if paramsOnly, err := strconv.ParseBool(value); err == nil {
+					cfg.ParamsOnly = paramsOnly
+				} else {
+					invalid(key, value, err)
+				}
+			case "prefer_followers":
+				if preferFollowers, err := strconv.ParseBool(value); err == nil {
+					cfg.PreferFollowers = preferFollowers
+				} else {
+					invalid(key, value, err)
 				}
+			case "read_only":
+				if readOnly, err := strconv.ParseBool(value); err == nil {
+					cfg.ReadOnly = readOnly
+				} else {
+					invalid(key, value, err)
+				}
+			case "backup_compression":
+				if compression, err := lookupCompression(value); err == nil {
+					cfg.BackupCompression = compression
+				} else {
+					invalid(key, value, err)
+				}
+			case "tls":
+				if enabled, err := strconv.ParseBool(value); err != nil {
+					invalid(key, value, err)
+				} else if enabled {
+					cfg.DefaultScheme = "https"
+					if cfg.TLSConfig == nil {
+						cfg.TLSConfig = &tls.Config{}
+					}
+				}
+			case "tls_ca":
+				pool, err := transport.LoadCAFile(value)
+				if err != nil {
+					return nil, err
+				}
+				if cfg.TLSConfig == nil {
+					cfg.TLSConfig = &tls.Config{}
+				}
+				cfg.TLSConfig.RootCAs = pool
+			case "tls_insecure":
+				if insecure, err := strconv.ParseBool(value); err != nil {
+					invalid(key, value, err)
+				} else if insecure {
+					if cfg.TLSConfig == nil {
+						cfg.TLSConfig = &tls.Config{}
+					}
+					cfg.TLSConfig.InsecureSkipVerify = true
+				}
+			case "databases":
+				cfg.Databases = make(map[string]string)
+				for _, name := range strings.Split(value, ",") {
+					if name = strings.TrimSpace(name); name != "" {
+						cfg.Databases[name] = name + "_"
+					}
+				}
+			case "delivery":
+				cfg.Delivery = Delivery(strings.ToLower(value))
+				if !validDeliveries[cfg.Delivery] {
+					invalid(key, value, errors.New("use at_least_once or at_most_once"))
+				}
+			case "idempotency":
+				if idempotent, err := strconv.ParseBool(value); err == nil {
+					if idempotent {
+						cfg.Idempotency = &IdempotencyConfig{}
+					} else {
+						cfg.Idempotency = nil
+					}
+				} else {
+					invalid(key, value, err)
+				}
+			case "api_port_offset":
+				if offset, err := strconv.Atoi(value); err == nil {
+					cfg.APIPortOffset = offset
+				} else {
+					invalid(key, value, err)
+				}
+			case "queue":
+				if queue, err := strconv.ParseBool(value); err == nil {
+					cfg.Queue = queue
+				} else {
+					invalid(key, value, err)
+				}
+			case "read_preference":
+				cfg.ReadPreference = strings.ToLower(value)
+				if !validReadPreferences[cfg.ReadPreference] {
+					invalid(key, value, errors.New("use leader, follower, round_robin, random or nearest"))
+				}
+			case "stream_rows":
+				if streamRows, err := strconv.ParseBool(value); err == nil {
+					cfg.StreamRows = streamRows
+				} else {
+					invalid(key, value, err)
+				}
+			case "discovery":
+				switch strings.ToLower(value) {
+				case "on", "true", "1":
+					cfg.DisableDiscovery = false
+				case "off", "false", "0":
+					cfg.DisableDiscovery = true
+				default:
+					invalid(key, value, errors.New("use on or off"))
+				}
+			case "max_retries":
+				if retries, err := strconv.Atoi(value); err == nil {
+					cfg.MaxRetries = retries
+				} else {
+					invalid(key, value, err)
+				}
+			case "retry_backoff":
+				if backoff, err := time.ParseDuration(value); err == nil {
+					cfg.RetryBackoff = backoff
+				} else {
+					invalid(key, value, err)
+				}
+			case "retry_max_elapsed":
+				if maxElapsed, err := time.ParseDuration(value); err == nil {
+					cfg.RetryMaxElapsed = maxElapsed
+				} else {
+					invalid(key, value, err)
+				}
+			case "adaptive_timeout":
+				if adaptive, err := strconv.ParseBool(value); err == nil {
+					if adaptive {
+						cfg.AdaptiveTimeout = &AdaptiveTimeoutConfig{}
+					} else {
+						cfg.AdaptiveTimeout = nil
+					}
+				} else {
+					invalid(key, value, err)
+				}
+			case "strict":
+				if _, err := strconv.ParseBool(value); err != nil {
+					invalid(key, value, err)
+				}
+			default:
+				invalid(key, value, errors.New("unknown parameter"))
 			}
 		}
+
+		if strict && len(problems) > 0 {
+			return nil, errors.Join(problems...)
+		}
 	}
 
 	// Parse nodes
@@ -98,13 +658,21 @@ func ParseDSN(dsn string) (*Config, error) {
 	nodes := strings.Split(dsn, ",")
 	for _, node := range nodes {
 		node = strings.TrimSpace(node)
-		if node != "" {
-			// Add http:// prefix if not present
-			if !strings.HasPrefix(node, "http://") && !strings.HasPrefix(node, "https://") {
-				node = "http://" + node
+		if node == "" {
+			continue
+		}
+
+		if !transport.HasScheme(node) {
+			if cfg.RequireScheme {
+				return nil, fmt.Errorf("node %q has no scheme: use http:// or https://", node)
 			}
-			cfg.Nodes = append(cfg.Nodes, node)
+			scheme := cfg.DefaultScheme
+			if scheme == "" {
+				scheme = "http"
+			}
+			node = scheme + "://" + node
 		}
+		cfg.Nodes = append(cfg.Nodes, transport.NormalizeNode(node))
 	}
 
 	if len(cfg.Nodes) == 0 {
@@ -114,6 +682,73 @@ func ParseDSN(dsn string) (*Config, error) {
 	return cfg, nil
 }
 
+// looksLikeFilePath reports whether a DSN names a local SQLite database,
+// such as "./app.db", "file:test.db?cache=shared" or ":memory:", which would
+// otherwise be mistaken for a host name
+func looksLikeFilePath(dsn string) bool {
+	if strings.HasPrefix(dsn, "file:") || strings.HasPrefix(dsn, ":memory:") {
+		return true
+	}
+
+	for _, prefix := range []string{"./", "../", "/", "~/", ".\\", "..\\"} {
+		if strings.HasPrefix(dsn, prefix) {
+			return true
+		}
+	}
+
+	// Windows drive paths such as C:\data\app.db
+	if len(dsn) >= 3 && dsn[1] == ':' && (dsn[2] == '\\' || dsn[2] == '/') {
+		return true
+	}
+
+	path := dsn
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	if strings.ContainsAny(path, ":@,") {
+		return false
+	}
+	for _, ext := range []string{".db", ".sqlite", ".sqlite3", ".db3"} {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSize parses a byte size such as "1048576", "512KB" or "4MB"
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("size cannot be negative")
+	}
+
+	return n * multiplier, nil
+}
+
 // Open creates a new connection
 func Open(dsn string) (driver.Conn, error) {
 	cfg, err := ParseDSN(dsn)
@@ -124,7 +759,45 @@ func Open(dsn string) (driver.Conn, error) {
 	return NewConn(cfg)
 }
 
+// registered holds the names the driver is registered under
+var (
+	registerMu sync.Mutex
+	registered = map[string]bool{}
+)
+
+// Register registers the driver under an additional name, e.g. "sqlite" for
+// ORMs that select their dialect by driver name. Only "rqlite" is registered
+// on import, so the package can be used alongside SQLite drivers such as
+// mattn/go-sqlite3 or modernc.org/sqlite. Registering a name twice is a
+// no-op; a name taken by another driver is reported as an error instead of
+// the panic of sql.Register.
+func Register(name string) error {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+
+	if registered[name] {
+		return nil
+	}
+	for _, driverName := range sql.Drivers() {
+		if driverName == name {
+			return fmt.Errorf("driver name %q is already registered by another driver", name)
+		}
+	}
+
+	sql.Register(name, &Driver{})
+	registered[name] = true
+	return nil
+}
+
+// isRegistered reports whether the driver is registered under name
+func isRegistered(name string) bool {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	return registered[name]
+}
+
 func init() {
-	sql.Register("sqlite", &Driver{})
-	sql.Register("rqlite", &Driver{})
+	if err := Register("rqlite"); err != nil {
+		panic(err)
+	}
 }
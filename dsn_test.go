@@ -0,0 +1,150 @@
+package rsqlite
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestParseDSNForms(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		username string
+		password string
+		nodes    []string
+		appName  string
+		level    string
+	}{
+		{
+			name:  "legacy comma-separated hosts",
+			dsn:   "localhost:4001,localhost:4002, localhost:4003",
+			nodes: []string{"http://localhost:4001", "http://localhost:4002", "http://localhost:4003"},
+		},
+		{
+			name:  "legacy hosts with parameters",
+			dsn:   "h1:4001,h2:4001?consistency=strong",
+			nodes: []string{"http://h1:4001", "http://h2:4001"},
+			level: "strong",
+		},
+		{
+			name:     "percent-encoded password",
+			dsn:      "user:p%40ss@h:4001",
+			username: "user",
+			password: "p@ss",
+			nodes:    []string{"http://h:4001"},
+		},
+		{
+			name:     "raw @ in password",
+			dsn:      "user:p@ss@h:4001",
+			username: "user",
+			password: "p@ss",
+			nodes:    []string{"http://h:4001"},
+		},
+		{
+			name:     "percent-encoded username",
+			dsn:      "rqlite://us%3Aer:pw@h:4001",
+			username: "us:er",
+			password: "pw",
+			nodes:    []string{"http://h:4001"},
+		},
+		{
+			name:  "IPv6 literals",
+			dsn:   "[::1]:4001,[fd00::2]:4001",
+			nodes: []string{"http://[::1]:4001", "http://[fd00::2]:4001"},
+		},
+		{
+			name:  "sqlite scheme with trailing slash",
+			dsn:   "sqlite://h:4001/?consistency=strong",
+			nodes: []string{"http://h:4001"},
+			level: "strong",
+		},
+		{
+			name:  "mixed node schemes",
+			dsn:   "https://a,b",
+			nodes: []string{"https://a", "http://b"},
+		},
+		{
+			name:  "node base path",
+			dsn:   "http://[::1]:4001/base,h2",
+			nodes: []string{"http://[::1]:4001/base", "http://h2"},
+		},
+		{
+			name:    "@ and ? in a parameter value",
+			dsn:     "rqlite://h:4001?app_name=a@b?c=d",
+			nodes:   []string{"http://h:4001"},
+			appName: "a@b?c=d",
+		},
+		{
+			name:     "= in a parameter value after credentials",
+			dsn:      "u:pw@h:4001?app_name=x%3Dy=z",
+			username: "u",
+			password: "pw",
+			nodes:    []string{"http://h:4001"},
+			appName:  "x=y=z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseDSN(tt.dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Username != tt.username || cfg.Password != tt.password {
+				t.Errorf("credentials %q:%q, want %q:%q", cfg.Username, cfg.Password, tt.username, tt.password)
+			}
+			if !equalStrings(cfg.Nodes, tt.nodes) {
+				t.Errorf("nodes %q, want %q", cfg.Nodes, tt.nodes)
+			}
+			if cfg.AppName != tt.appName {
+				t.Errorf("app name %q, want %q", cfg.AppName, tt.appName)
+			}
+			level := tt.level
+			if level == "" {
+				level = "weak"
+			}
+			if cfg.ConsistencyLevel != level {
+				t.Errorf("consistency %q, want %q", cfg.ConsistencyLevel, level)
+			}
+		})
+	}
+}
+
+func TestParseDSNErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		// escape is set when the error must wrap a url.EscapeError
+		escape bool
+	}{
+		{name: "empty", dsn: ""},
+		{name: "no nodes", dsn: "rqlite://?consistency=strong"},
+		{name: "local file", dsn: "file:test.db"},
+		{name: "bad password escape", dsn: "u:%zz@h:4001", escape: true},
+		{name: "bad username escape", dsn: "u%zz:pw@h:4001", escape: true},
+		{name: "bad parameter escape", dsn: "h:4001?app_name=%zz", escape: true},
+		{name: "strict unknown parameter", dsn: "h:4001?strict=true&bogus=1"},
+		{name: "strict malformed parameter", dsn: "h:4001?strict=true&consistency"},
+		{name: "strict invalid value", dsn: "h:4001?timeout=soon&strict=true"},
+		{name: "required scheme", dsn: "h:4001?require_scheme=true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDSN(tt.dsn)
+			if err == nil {
+				t.Fatalf("ParseDSN(%q) succeeded", tt.dsn)
+			}
+			var escapeErr url.EscapeError
+			if tt.escape && !errors.As(err, &escapeErr) {
+				t.Errorf("error %v doesn't wrap the decoding error", err)
+			}
+		})
+	}
+
+	// Without strict mode unknown parameters are ignored
+	if _, err := ParseDSN("h:4001?bogus=1"); err != nil {
+		t.Errorf("lenient parse failed: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package rsqlite
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DumpSQL writes the database into w as SQL text, in the layout of the sqlite3
+// shell's .dump command, for code review or disaster recovery runbooks. Servers
+// with SQL backups produce the dump themselves. For older servers it is
+// generated from queries table by table, so it is not a point-in-time snapshot
+// when writes happen concurrently.
+func (c *Connector) DumpSQL(ctx context.Context, w io.Writer) error {
+	err := c.backup(ctx, "sql", w)
+	if !errors.Is(err, errSQLDumpUnsupported) {
+		return err
+	}
+
+	return c.generateDump(ctx, w)
+}
+
+// generateDump builds a SQL dump client-side from strong reads
+func (c *Connector) generateDump(ctx context.Context, w io.Writer) error {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	schema, err := client.query(ctx, "strong",
+		"SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY type = 'table' DESC, rowid", nil)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "PRAGMA foreign_keys=OFF;")
+	fmt.Fprintln(out, "BEGIN TRANSACTION;")
+
+	for _, row := range schema.Values {
+		if len(row) < 3 {
+			continue
+		}
+		typ, _ := row[0].(string)
+		name, _ := row[1].(string)
+		createSQL, _ := row[2].(string)
+
+		if strings.HasPrefix(name, "sqlite_stat") {
+			continue
+		}
+
+		if name == "sqlite_sequence" {
+			fmt.Fprintln(out, "DELETE FROM sqlite_sequence;")
+		} else {
+			fmt.Fprintf(out, "%s;\n", createSQL)
+		}
+
+		if typ == "table" {
+			if err := dumpTable(ctx, client, out, name); err != nil {
+				return fmt.Errorf("dumping table %q: %w", name, err)
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "COMMIT;")
+	return out.Flush()
+}
+
+// dumpTable writes an INSERT statement for every row of a table
+func dumpTable(ctx context.Context, client *apiClient, out *bufio.Writer, table string) error {
+	result, err := client.query(ctx, "strong", "SELECT * FROM "+quoteIdent(table), nil)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range result.Values {
+		fmt.Fprintf(out, "INSERT INTO %s VALUES(%s);\n", quoteIdent(table), rowLiterals(row, result.Types))
+	}
+
+	return nil
+}
+
+// sqlLiteral formats a result value as an SQLite literal. Blob columns come
+// back base64 encoded and are written as X'..' literals. Infinities are
+// written as out-of-range literals, which SQLite reads back as infinities,
+// and NaN, which SQLite stores as NULL, as NULL.
+func sqlLiteral(value interface{}, declType string) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case json.Number:
+		return v.String()
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NULL"
+		case math.IsInf(v, 1):
+			return "9e999"
+		case math.IsInf(v, -1):
+			return "-9e999"
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case string:
+		if strings.Contains(strings.ToLower(declType), "blob") {
+			if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+				return "X'" + hex.EncodeToString(b) + "'"
+			}
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+	}
+}
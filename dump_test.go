@@ -0,0 +1,58 @@
+package rsqlite
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// parseFloatLiteral reads back a numeric literal written by sqlLiteral the
+// way SQLite does: out-of-range literals become infinities
+func parseFloatLiteral(t *testing.T, literal string) (float64, bool) {
+	t.Helper()
+
+	if literal == "NULL" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(literal, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		t.Fatalf("literal %q: %v", literal, err)
+	}
+	return v, true
+}
+
+func TestSQLLiteralFloatRoundTrip(t *testing.T) {
+	tests := []struct {
+		value   float64
+		literal string
+	}{
+		{3, "3.0"},
+		{0.1, "0.1"},
+		{-2.5, "-2.5"},
+		{1e20, "1e+20"},
+		{math.MaxFloat64, "1.7976931348623157e+308"},
+		{math.SmallestNonzeroFloat64, "5e-324"},
+		{math.Inf(1), "9e999"},
+		{math.Inf(-1), "-9e999"},
+	}
+	for _, tt := range tests {
+		literal := sqlLiteral(tt.value, "REAL")
+		if literal != tt.literal {
+			t.Errorf("sqlLiteral(%v) = %q, want %q", tt.value, literal, tt.literal)
+		}
+		got, ok := parseFloatLiteral(t, literal)
+		if !ok || got != tt.value {
+			t.Errorf("%v read back as %v", tt.value, got)
+		}
+	}
+
+	// SQLite stores NaN as NULL
+	if literal := sqlLiteral(math.NaN(), "REAL"); literal != "NULL" {
+		t.Errorf("sqlLiteral(NaN) = %q, want NULL", literal)
+	}
+
+	if got := rowLiterals([]interface{}{int64(1), math.Inf(1), math.NaN(), "it's"}, nil); got != "1,9e999,NULL,'it''s'" {
+		t.Errorf("row literals %s", got)
+	}
+}
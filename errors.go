@@ -0,0 +1,119 @@
+package rsqlite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// ErrReadOnly is returned for writes on a read-only connection
+var ErrReadOnly = errors.New("connection is read-only")
+
+// RequestTooLargeError is returned when a request body exceeds the configured
+// maximum size, or the server rejects it as too large
+type RequestTooLargeError struct {
+	// Size is the measured size of the request body in bytes
+	Size int
+	// Limit is the configured maximum, or 0 if the server rejected the request
+	Limit int64
+}
+
+// Error implements the error interface
+func (e *RequestTooLargeError) Error() string {
+	if e.Limit > 0 {
+		return fmt.Sprintf("request body of %d bytes exceeds limit of %d bytes", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("request body of %d bytes rejected by server as too large", e.Size)
+}
+
+// PanicError is returned in place of a panic raised while running a
+// statement or reading its rows, e.g. by an unexpected response shape
+type PanicError struct {
+	// Query is the statement that was running, "" while connecting
+	Query string
+	// Value is the value the panic was raised with
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	if e.Query == "" {
+		return fmt.Sprintf("recovered panic: %v", e.Value)
+	}
+	return fmt.Sprintf("recovered panic running %q: %v", e.Query, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// MaxRowsError is returned when a query's result set exceeds Config.MaxRows
+type MaxRowsError struct {
+	// Limit is the configured maximum number of rows
+	Limit int
+}
+
+// Error implements the error interface
+func (e *MaxRowsError) Error() string {
+	return fmt.Sprintf("query returned more than %d rows, the max_rows limit", e.Limit)
+}
+
+// MemoryLimitError is returned in fail-fast mode when the result memory held
+// by open Rows reached Config.MaxResultMemory
+type MemoryLimitError struct {
+	// Limit is the configured cap in bytes
+	Limit int64
+	// InUse is the result memory held when the query was rejected
+	InUse int64
+}
+
+// Error implements the error interface
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("result memory limit reached: %d of %d bytes held by open rows", e.InUse, e.Limit)
+}
+
+// InlineLiteralError is returned in parameter-only mode for statements
+// containing inline string literals instead of placeholders
+type InlineLiteralError struct {
+	// Fingerprint identifies the rejected statement; add it to
+	// Config.ParamsOnlyAllow to exempt the statement
+	Fingerprint string
+}
+
+// Error implements the error interface
+func (e *InlineLiteralError) Error() string {
+	return fmt.Sprintf("statement contains inline string literals, use parameters instead: %s", e.Fingerprint)
+}
+
+// NotLeaderError is returned when a follower redirected a statement to the
+// leader and the statement failed there too; the first redirect is followed
+type NotLeaderError = transport.NotLeaderError
+
+// ResultUnknownError is returned by Result.RowsAffected and
+// Result.LastInsertId when the write was acknowledged before it was applied,
+// so its counts aren't known
+type ResultUnknownError struct {
+	// Reason says why the counts are unknown
+	Reason string
+}
+
+// Error implements the error interface
+func (e *ResultUnknownError) Error() string {
+	return "write result unknown: " + e.Reason
+}
+
+// statementError is an error the server reported for a statement it
+// received, e.g. a constraint violation, as opposed to a failed request
+type statementError struct {
+	msg string
+}
+
+// Error implements the error interface
+func (e *statementError) Error() string {
+	return e.msg
+}
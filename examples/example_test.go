@@ -1,4 +1,4 @@
-package main
+package examples
 
 import (
 	"context"
@@ -118,15 +118,3 @@ func TestClusterFailover(t *testing.T) {
 		time.Sleep(time.Second)
 	}
 }
-
-func TestXorm(t *testing.T) {
-	runXormTest()
-}
-
-func TestBun(t *testing.T) {
-	runBunTest()
-}
-
-func TestGorm(t *testing.T) {
-	runGormTest()
-}
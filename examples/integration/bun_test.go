@@ -0,0 +1,216 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/extra/bundebug"
+)
+
+// BunUser is the Bun user model
+type BunUser struct {
+	bun.BaseModel `bun:"table:bun_users,alias:u"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Name      string    `bun:"name,notnull"`
+	Email     string    `bun:"email,unique,notnull"`
+	Age       int       `bun:"age,default:0"`
+	Posts     []BunPost `bun:"rel:has-many,join:id=user_id"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp"`
+}
+
+// BunPost is the Bun post model
+type BunPost struct {
+	bun.BaseModel `bun:"table:bun_posts,alias:p"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Title     string    `bun:"title,notnull"`
+	Content   string    `bun:"content"`
+	UserID    int64     `bun:"user_id,notnull"`
+	User      *BunUser  `bun:"rel:belongs-to,join:user_id=id"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp"`
+}
+
+// openBun connects Bun to the test cluster and recreates the model tables.
+// Set BUNDEBUG=1 to log the queries.
+func openBun(t *testing.T) (context.Context, *bun.DB) {
+	t.Helper()
+
+	sqldb, err := sql.Open("sqlite", testDSN(t))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	db.AddQueryHook(bundebug.NewQueryHook(bundebug.FromEnv("BUNDEBUG")))
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	models := []interface{}{(*BunPost)(nil), (*BunUser)(nil)}
+	for _, model := range models {
+		if _, err := db.NewDropTable().Model(model).IfExists().Exec(ctx); err != nil {
+			t.Fatalf("drop table: %v", err)
+		}
+	}
+	for i := len(models) - 1; i >= 0; i-- {
+		if _, err := db.NewCreateTable().Model(models[i]).Exec(ctx); err != nil {
+			t.Fatalf("create table: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, model := range models {
+			db.NewDropTable().Model(model).IfExists().Exec(ctx)
+		}
+	})
+	return ctx, db
+}
+
+func TestBunCRUD(t *testing.T) {
+	ctx, db := openBun(t)
+
+	user := &BunUser{Name: "Alice", Email: "alice@example.com", Age: 25}
+	result, err := db.NewInsert().Model(user).Exec(ctx)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		t.Errorf("insert: %d rows affected, %v", affected, err)
+	}
+	if user.ID == 0 {
+		t.Fatal("insert: no id assigned")
+	}
+
+	found := &BunUser{}
+	if err := db.NewSelect().Model(found).Where("id = ?", user.ID).Scan(ctx); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if found.Name != user.Name || found.Email != user.Email || found.Age != 25 {
+		t.Errorf("select: got %+v, want %+v", found, user)
+	}
+
+	found.Age = 26
+	if _, err := db.NewUpdate().Model(found).WherePK().Exec(ctx); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := db.NewSelect().Model(found).WherePK().Scan(ctx); err != nil {
+		t.Fatalf("select after update: %v", err)
+	}
+	if found.Age != 26 {
+		t.Errorf("update: got age %d, want 26", found.Age)
+	}
+
+	if _, err := db.NewDelete().Model(found).WherePK().Exec(ctx); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	count, err := db.NewSelect().Model((*BunUser)(nil)).Count(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("got %d users after delete, want 0", count)
+	}
+}
+
+func TestBunRelations(t *testing.T) {
+	ctx, db := openBun(t)
+
+	user := &BunUser{Name: "Bob", Email: "bob@example.com", Age: 30}
+	if _, err := db.NewInsert().Model(user).Exec(ctx); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	posts := []*BunPost{
+		{Title: "Getting started with Go", Content: "An introduction", UserID: user.ID},
+		{Title: "Using rqlite", Content: "A guide", UserID: user.ID},
+	}
+	if _, err := db.NewInsert().Model(&posts).Exec(ctx); err != nil {
+		t.Fatalf("insert posts: %v", err)
+	}
+
+	withPosts := &BunUser{}
+	err := db.NewSelect().Model(withPosts).Relation("Posts").Where("u.id = ?", user.ID).Scan(ctx)
+	if err != nil {
+		t.Fatalf("has-many relation: %v", err)
+	}
+	if len(withPosts.Posts) != 2 {
+		t.Errorf("has-many relation: got %d posts, want 2", len(withPosts.Posts))
+	}
+
+	var withUser []BunPost
+	err = db.NewSelect().Model(&withUser).Relation("User").Where("p.user_id = ?", user.ID).Scan(ctx)
+	if err != nil {
+		t.Fatalf("belongs-to relation: %v", err)
+	}
+	if len(withUser) != 2 || withUser[0].User == nil || withUser[0].User.Name != user.Name {
+		t.Errorf("belongs-to relation: got %+v, want 2 posts by %s", withUser, user.Name)
+	}
+}
+
+func TestBunTransaction(t *testing.T) {
+	ctx, db := openBun(t)
+
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		user := &BunUser{Name: "Carol", Email: "carol@example.com", Age: 28}
+		if _, err := tx.NewInsert().Model(user).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(&BunPost{Title: "Written in a transaction", UserID: user.ID}).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+
+	count, err := db.NewSelect().Model((*BunPost)(nil)).Count(ctx)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("got %d posts after commit, want 1", count)
+	}
+}
+
+func TestBunBatch(t *testing.T) {
+	ctx, db := openBun(t)
+
+	users := []*BunUser{
+		{Name: "User 1", Email: "user1@example.com", Age: 20},
+		{Name: "User 2", Email: "user2@example.com", Age: 21},
+		{Name: "User 3", Email: "user3@example.com", Age: 22},
+		{Name: "User 4", Email: "user4@example.com", Age: 23},
+		{Name: "User 5", Email: "user5@example.com", Age: 30},
+	}
+	if _, err := db.NewInsert().Model(&users).Exec(ctx); err != nil {
+		t.Fatalf("batch insert: %v", err)
+	}
+
+	result, err := db.NewUpdate().Model((*BunUser)(nil)).Set("age = age + 1").Where("age < ?", 25).Exec(ctx)
+	if err != nil {
+		t.Fatalf("batch update: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 4 {
+		t.Errorf("batch update: %d rows affected, %v; want 4", affected, err)
+	}
+
+	var young []BunUser
+	if err := db.NewSelect().Model(&young).Where("age BETWEEN ? AND ?", 21, 24).Scan(ctx); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if len(young) != 4 {
+		t.Errorf("select: got %d users aged 21 to 24, want 4", len(young))
+	}
+
+	var avgAge float64
+	if err := db.NewSelect().Model((*BunUser)(nil)).ColumnExpr("AVG(age)").Scan(ctx, &avgAge); err != nil {
+		t.Fatalf("avg: %v", err)
+	}
+	if avgAge != 24 {
+		t.Errorf("avg: got %v, want 24", avgAge)
+	}
+}
@@ -0,0 +1,10 @@
+// Package integration checks the ORM frameworks the driver supports (GORM,
+// XORM and Bun) against a live cluster. The tests are behind the integration
+// build tag, so a plain go test skips them:
+//
+//	RQLITE_DSN=localhost:4001 go test -tags integration ./integration
+//
+// Without RQLITE_DSN each test starts a local cluster with devcluster, and
+// is skipped when no rqlited binary is available. The tests drop and recreate
+// their tables, so don't point them at a cluster holding data you need.
+package integration
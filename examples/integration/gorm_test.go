@@ -0,0 +1,214 @@
+//go:build integration
+
+package integration
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// GormUser is the GORM user model
+type GormUser struct {
+	ID        uint       `gorm:"primarykey"`
+	Name      string     `gorm:"not null;size:100"`
+	Email     string     `gorm:"uniqueIndex;size:100"`
+	Age       int        `gorm:"default:0"`
+	Posts     []GormPost `gorm:"foreignKey:UserID"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// GormPost is the GORM post model
+type GormPost struct {
+	ID        uint     `gorm:"primarykey"`
+	Title     string   `gorm:"not null;size:200"`
+	Content   string   `gorm:"type:text"`
+	UserID    uint     `gorm:"not null"`
+	User      GormUser `gorm:"foreignKey:UserID"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// openGorm connects GORM to the test cluster and recreates the model tables
+func openGorm(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite", DSN: testDSN(t)}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.Migrator().DropTable(&GormPost{}, &GormUser{}); err != nil {
+		t.Fatalf("drop tables: %v", err)
+	}
+	if err := db.AutoMigrate(&GormUser{}, &GormPost{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	t.Cleanup(func() { db.Migrator().DropTable(&GormPost{}, &GormUser{}) })
+	return db
+}
+
+func TestGormCRUD(t *testing.T) {
+	db := openGorm(t)
+
+	user := GormUser{Name: "Alice", Email: "alice@example.com", Age: 25}
+	result := db.Create(&user)
+	if result.Error != nil {
+		t.Fatalf("create: %v", result.Error)
+	}
+	if user.ID == 0 || result.RowsAffected != 1 {
+		t.Fatalf("create: got id %d and %d rows affected, want a new id and 1", user.ID, result.RowsAffected)
+	}
+
+	var found GormUser
+	if err := db.First(&found, user.ID).Error; err != nil {
+		t.Fatalf("first: %v", err)
+	}
+	if found.Name != user.Name || found.Email != user.Email || found.Age != 25 {
+		t.Errorf("first: got %+v, want %+v", found, user)
+	}
+	if found.CreatedAt.IsZero() {
+		t.Error("first: CreatedAt not round-tripped")
+	}
+
+	if err := db.Model(&found).Update("Age", 26).Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := db.First(&found, user.ID).Error; err != nil {
+		t.Fatalf("first after update: %v", err)
+	}
+	if found.Age != 26 {
+		t.Errorf("update: got age %d, want 26", found.Age)
+	}
+
+	// Soft delete hides the row from normal queries only
+	if err := db.Delete(&found).Error; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := db.First(&GormUser{}, user.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("first after delete: got %v, want ErrRecordNotFound", err)
+	}
+	var deleted GormUser
+	if err := db.Unscoped().First(&deleted, user.ID).Error; err != nil {
+		t.Fatalf("unscoped first: %v", err)
+	}
+	if !deleted.DeletedAt.Valid {
+		t.Error("unscoped first: DeletedAt not set")
+	}
+}
+
+func TestGormAssociations(t *testing.T) {
+	db := openGorm(t)
+
+	user := GormUser{Name: "Bob", Email: "bob@example.com", Age: 30}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	posts := []GormPost{
+		{Title: "Getting started with Go", Content: "An introduction", UserID: user.ID},
+		{Title: "Using rqlite", Content: "A guide", UserID: user.ID},
+	}
+	if err := db.Create(&posts).Error; err != nil {
+		t.Fatalf("create posts: %v", err)
+	}
+
+	var withPosts GormUser
+	if err := db.Preload("Posts").First(&withPosts, user.ID).Error; err != nil {
+		t.Fatalf("preload: %v", err)
+	}
+	if len(withPosts.Posts) != 2 {
+		t.Errorf("preload: got %d posts, want 2", len(withPosts.Posts))
+	}
+
+	var post GormPost
+	if err := db.Joins("User").First(&post, posts[0].ID).Error; err != nil {
+		t.Fatalf("joins: %v", err)
+	}
+	if post.User.Name != user.Name {
+		t.Errorf("joins: got author %q, want %q", post.User.Name, user.Name)
+	}
+}
+
+func TestGormTransaction(t *testing.T) {
+	db := openGorm(t)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		user := GormUser{Name: "Carol", Email: "carol@example.com", Age: 28}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&GormPost{Title: "Written in a transaction", UserID: user.ID}).Error
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+
+	var count int64
+	if err := db.Model(&GormPost{}).Count(&count).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("got %d posts after commit, want 1", count)
+	}
+}
+
+func TestGormBatch(t *testing.T) {
+	db := openGorm(t)
+
+	users := []GormUser{
+		{Name: "User 1", Email: "user1@example.com", Age: 20},
+		{Name: "User 2", Email: "user2@example.com", Age: 21},
+		{Name: "User 3", Email: "user3@example.com", Age: 22},
+		{Name: "User 4", Email: "user4@example.com", Age: 23},
+		{Name: "User 5", Email: "user5@example.com", Age: 30},
+	}
+	if err := db.CreateInBatches(&users, 3).Error; err != nil {
+		t.Fatalf("create in batches: %v", err)
+	}
+	for i, user := range users {
+		if user.ID == 0 {
+			t.Errorf("user %d: no id assigned", i)
+		}
+	}
+
+	result := db.Model(&GormUser{}).Where("age < ?", 25).Update("age", gorm.Expr("age + ?", 1))
+	if result.Error != nil {
+		t.Fatalf("batch update: %v", result.Error)
+	}
+	if result.RowsAffected != 4 {
+		t.Errorf("batch update: got %d rows affected, want 4", result.RowsAffected)
+	}
+
+	var young []GormUser
+	if err := db.Where("age BETWEEN ? AND ?", 21, 24).Find(&young).Error; err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(young) != 4 {
+		t.Errorf("find: got %d users aged 21 to 24, want 4", len(young))
+	}
+
+	var count int64
+	if err := db.Model(&GormUser{}).Count(&count).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	var avgAge float64
+	if err := db.Model(&GormUser{}).Select("AVG(age)").Row().Scan(&avgAge); err != nil {
+		t.Fatalf("avg: %v", err)
+	}
+	if count != 5 || avgAge != 24 {
+		t.Errorf("got %d users with average age %v, want 5 and 24", count, avgAge)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build integration
+
+package integration
+
+import (
+	"testing"
+
+	"github.com/zhenruyan/rsqlite"
+	"github.com/zhenruyan/rsqlite/devcluster"
+)
+
+// The ORMs pick their SQLite dialect by the "sqlite" driver name
+func init() {
+	if err := rsqlite.Register("sqlite"); err != nil {
+		panic(err)
+	}
+}
+
+// testDSN returns the DSN of the cluster the test runs against
+func testDSN(t *testing.T) string {
+	t.Helper()
+	return devcluster.ForTest(t, devcluster.Options{})
+}
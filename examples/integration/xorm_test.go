@@ -0,0 +1,210 @@
+//go:build integration
+
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"xorm.io/xorm"
+)
+
+// XormUser is the XORM user model
+type XormUser struct {
+	Id        int64     `xorm:"pk autoincr 'id'"`
+	Name      string    `xorm:"varchar(100) notnull 'name'"`
+	Email     string    `xorm:"varchar(100) unique notnull 'email'"`
+	Age       int       `xorm:"default 0 'age'"`
+	CreatedAt time.Time `xorm:"created 'created_at'"`
+	UpdatedAt time.Time `xorm:"updated 'updated_at'"`
+}
+
+// XormPost is the XORM post model
+type XormPost struct {
+	Id        int64     `xorm:"pk autoincr 'id'"`
+	Title     string    `xorm:"varchar(200) notnull 'title'"`
+	Content   string    `xorm:"text 'content'"`
+	UserId    int64     `xorm:"notnull 'user_id'"`
+	CreatedAt time.Time `xorm:"created 'created_at'"`
+	UpdatedAt time.Time `xorm:"updated 'updated_at'"`
+}
+
+// TableName implements xorm's TableName interface
+func (XormUser) TableName() string {
+	return "xorm_users"
+}
+
+// TableName implements xorm's TableName interface
+func (XormPost) TableName() string {
+	return "xorm_posts"
+}
+
+// openXorm connects XORM to the test cluster and recreates the model tables
+func openXorm(t *testing.T) *xorm.Engine {
+	t.Helper()
+
+	engine, err := xorm.NewEngine("sqlite", testDSN(t))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	if err := engine.DropTables(new(XormPost), new(XormUser)); err != nil {
+		t.Fatalf("drop tables: %v", err)
+	}
+	if err := engine.Sync(new(XormUser), new(XormPost)); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	t.Cleanup(func() { engine.DropTables(new(XormPost), new(XormUser)) })
+	return engine
+}
+
+func TestXormCRUD(t *testing.T) {
+	engine := openXorm(t)
+
+	user := &XormUser{Name: "Alice", Email: "alice@example.com", Age: 25}
+	affected, err := engine.Insert(user)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if affected != 1 || user.Id == 0 {
+		t.Fatalf("insert: got id %d and %d rows affected, want a new id and 1", user.Id, affected)
+	}
+
+	found := &XormUser{}
+	has, err := engine.ID(user.Id).Get(found)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !has || found.Name != user.Name || found.Email != user.Email || found.Age != 25 {
+		t.Errorf("get: got %+v (found %v), want %+v", found, has, user)
+	}
+
+	found.Age = 26
+	if affected, err := engine.ID(found.Id).Update(found); err != nil || affected != 1 {
+		t.Fatalf("update: %d rows affected, %v", affected, err)
+	}
+	if _, err := engine.ID(user.Id).Get(found); err != nil {
+		t.Fatalf("get after update: %v", err)
+	}
+	if found.Age != 26 {
+		t.Errorf("update: got age %d, want 26", found.Age)
+	}
+
+	if affected, err := engine.ID(found.Id).Delete(&XormUser{}); err != nil || affected != 1 {
+		t.Fatalf("delete: %d rows affected, %v", affected, err)
+	}
+	if has, err := engine.ID(user.Id).Get(&XormUser{}); err != nil || has {
+		t.Errorf("get after delete: found %v, %v", has, err)
+	}
+}
+
+func TestXormJoin(t *testing.T) {
+	engine := openXorm(t)
+
+	user := &XormUser{Name: "Bob", Email: "bob@example.com", Age: 30}
+	if _, err := engine.Insert(user); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	posts := []XormPost{
+		{Title: "Getting started with Go", Content: "An introduction", UserId: user.Id},
+		{Title: "Using rqlite", Content: "A guide", UserId: user.Id},
+	}
+	if affected, err := engine.Insert(&posts); err != nil || affected != 2 {
+		t.Fatalf("insert posts: %d rows affected, %v", affected, err)
+	}
+
+	type userWithPostCount struct {
+		XormUser  `xorm:"extends"`
+		PostCount int `xorm:"post_count"`
+	}
+	var counts []userWithPostCount
+	err := engine.Table("xorm_users").
+		Select("xorm_users.*, COUNT(xorm_posts.id) AS post_count").
+		Join("LEFT", "xorm_posts", "xorm_users.id = xorm_posts.user_id").
+		Where("xorm_users.id = ?", user.Id).
+		GroupBy("xorm_users.id").
+		Find(&counts)
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if len(counts) != 1 || counts[0].Name != user.Name || counts[0].PostCount != 2 {
+		t.Errorf("join: got %+v, want %s with 2 posts", counts, user.Name)
+	}
+
+	var userPosts []XormPost
+	if err := engine.Where("user_id = ?", user.Id).Find(&userPosts); err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(userPosts) != 2 {
+		t.Errorf("find: got %d posts, want 2", len(userPosts))
+	}
+}
+
+func TestXormSession(t *testing.T) {
+	engine := openXorm(t)
+
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	user := &XormUser{Name: "Carol", Email: "carol@example.com", Age: 28}
+	if _, err := session.Insert(user); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	if _, err := session.Insert(&XormPost{Title: "Written in a transaction", UserId: user.Id}); err != nil {
+		t.Fatalf("insert post: %v", err)
+	}
+	if err := session.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	count, err := engine.Count(&XormPost{})
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("got %d posts after commit, want 1", count)
+	}
+}
+
+func TestXormBatch(t *testing.T) {
+	engine := openXorm(t)
+
+	users := []XormUser{
+		{Name: "User 1", Email: "user1@example.com", Age: 20},
+		{Name: "User 2", Email: "user2@example.com", Age: 21},
+		{Name: "User 3", Email: "user3@example.com", Age: 22},
+		{Name: "User 4", Email: "user4@example.com", Age: 23},
+		{Name: "User 5", Email: "user5@example.com", Age: 30},
+	}
+	if affected, err := engine.Insert(&users); err != nil || affected != 5 {
+		t.Fatalf("batch insert: %d rows affected, %v", affected, err)
+	}
+
+	affected, err := engine.Where("age < ?", 25).Incr("age").Update(&XormUser{})
+	if err != nil {
+		t.Fatalf("batch update: %v", err)
+	}
+	if affected != 4 {
+		t.Errorf("batch update: got %d rows affected, want 4", affected)
+	}
+
+	var young []XormUser
+	if err := engine.Where("age BETWEEN ? AND ?", 21, 24).Find(&young); err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(young) != 4 {
+		t.Errorf("find: got %d users aged 21 to 24, want 4", len(young))
+	}
+
+	total, err := engine.SumInt(&XormUser{}, "age")
+	if err != nil {
+		t.Fatalf("sum: %v", err)
+	}
+	if total != 120 {
+		t.Errorf("sum: got %d, want 120", total)
+	}
+}
@@ -0,0 +1,10 @@
+package examples
+
+import "github.com/zhenruyan/rsqlite"
+
+// The examples open the driver as "sqlite", the name ORMs pick their dialect by
+func init() {
+	if err := rsqlite.Register("sqlite"); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,89 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// localFallback is the driver local file DSNs are delegated to, "" to reject them
+var (
+	localFallbackMu sync.RWMutex
+	localFallback   string
+)
+
+// SetLocalFallback makes DSNs naming a local SQLite file, such as
+// "file:test.db" or "/tmp/app.db", open through the database/sql driver
+// registered as driverName, e.g. "sqlite" of modernc.org/sqlite, instead of
+// failing. The same binary can then run against local SQLite in development
+// and rqlite in production without code changes. An empty name restores the
+// default of rejecting such DSNs.
+func SetLocalFallback(driverName string) error {
+	if driverName != "" && isRegistered(driverName) {
+		return fmt.Errorf("local fallback driver %q is registered by rsqlite", driverName)
+	}
+
+	localFallbackMu.Lock()
+	defer localFallbackMu.Unlock()
+	localFallback = driverName
+	return nil
+}
+
+// localDriver returns the fallback driver and the DSN to open it with when
+// dsn names a local SQLite file and a fallback is set, or a nil driver
+func localDriver(dsn string) (driver.Driver, string, error) {
+	localFallbackMu.RLock()
+	name := localFallback
+	localFallbackMu.RUnlock()
+
+	if name == "" {
+		return nil, "", nil
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(resolveDSN(dsn), "sqlite://"), "rqlite://")
+	if !looksLikeFilePath(path) {
+		return nil, "", nil
+	}
+
+	// database/sql only hands out drivers through a handle
+	db, err := sql.Open(name, path)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening %q with local fallback driver %q: %w", path, name, err)
+	}
+	defer db.Close()
+
+	return db.Driver(), path, nil
+}
+
+// openLocalConnector opens a connector of the fallback driver for dsn, or
+// returns nil if dsn isn't delegated
+func openLocalConnector(dsn string) (driver.Connector, error) {
+	drv, path, err := localDriver(dsn)
+	if drv == nil || err != nil {
+		return nil, err
+	}
+
+	if dc, ok := drv.(driver.DriverContext); ok {
+		return dc.OpenConnector(path)
+	}
+	return localConnector{driver: drv, dsn: path}, nil
+}
+
+// localConnector opens connections of a fallback driver without DriverContext
+type localConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+// Connect implements the database/sql/driver.Connector interface
+func (l localConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return l.driver.Open(l.dsn)
+}
+
+// Driver implements the database/sql/driver.Connector interface
+func (l localConnector) Driver() driver.Driver {
+	return l.driver
+}
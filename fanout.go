@@ -0,0 +1,274 @@
+package rsqlite
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FanOutOptions controls how FanOutQuery merges shard results
+type FanOutOptions struct {
+	// OrderBy lists result columns to sort the merged rows by. Prefix a column
+	// with "-" for descending order. Each shard sorts its rows the same way,
+	// so the pushed-down limit keeps the right rows.
+	OrderBy []string
+	// Limit caps the merged result. It is also sent to each shard, with the
+	// ORDER BY, unless the query has a LIMIT of its own; 0 means no limit.
+	Limit int
+}
+
+// FanOutResult holds the merged rows of a FanOutQuery
+type FanOutResult struct {
+	Columns []string
+	Rows    [][]driver.Value
+}
+
+// FanOutQuery runs the same SELECT on every shard concurrently and merges the
+// results, sorting them by opts.OrderBy and truncating them to opts.Limit.
+// With OrderBy set, each shard runs the query wrapped in a SELECT applying
+// that order and the limit, so every shard returns its own top rows. Other
+// statements returning rows, such as a DELETE ... RETURNING, are sent as
+// they are and only their merged rows are sorted and truncated.
+func (r *Router) FanOutQuery(ctx context.Context, query string, opts FanOutOptions, args ...interface{}) (*FanOutResult, error) {
+	if statementKeyword(Fingerprint(query)) == "select" {
+		if len(opts.OrderBy) > 0 {
+			query = orderedShardQuery(query, opts.OrderBy, opts.Limit)
+		} else {
+			query = applyInteractiveLimit(query, opts.Limit)
+		}
+	}
+
+	shards := r.ShardNames()
+	results := make([]*FanOutResult, len(shards))
+	errs := make([]error, len(shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard string) {
+			defer wg.Done()
+			results[i], errs[i] = r.queryShard(ctx, shard, query, args)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("shard %q: %w", shard, errs[i])
+			}
+		}(i, shard)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	merged := &FanOutResult{}
+	for i, result := range results {
+		if merged.Columns == nil {
+			merged.Columns = result.Columns
+		} else if len(result.Columns) != len(merged.Columns) {
+			return nil, fmt.Errorf("shard %q returned %d columns, expected %d", shards[i], len(result.Columns), len(merged.Columns))
+		}
+		merged.Rows = append(merged.Rows, result.Rows...)
+	}
+
+	if len(opts.OrderBy) > 0 {
+		if err := sortRows(merged, opts.OrderBy); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Limit > 0 && len(merged.Rows) > opts.Limit {
+		merged.Rows = merged.Rows[:opts.Limit]
+	}
+
+	return merged, nil
+}
+
+// orderedShardQuery wraps a query so a shard sorts its rows by orderBy,
+// "-" prefixed columns descending, and returns at most limit of them
+func orderedShardQuery(query string, orderBy []string, limit int) string {
+	var b strings.Builder
+	// Newlines keep the clauses out of any trailing line comment
+	b.WriteString("SELECT * FROM (\n")
+	b.WriteString(strings.TrimRight(strings.TrimSpace(query), ";"))
+	b.WriteString("\n) ORDER BY ")
+	for i, col := range orderBy {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		desc := strings.HasPrefix(col, "-")
+		b.WriteString(`"` + strings.ReplaceAll(strings.TrimPrefix(col, "-"), `"`, `""`) + `"`)
+		if desc {
+			b.WriteString(" DESC")
+		}
+	}
+	if limit > 0 {
+		b.WriteString(" LIMIT " + strconv.Itoa(limit))
+	}
+	return b.String()
+}
+
+// queryShard runs a query on a single shard through its pool and reads all
+// its rows
+func (r *Router) queryShard(ctx context.Context, shard, query string, args []interface{}) (*FanOutResult, error) {
+	rows, err := r.pools[shard].QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FanOutResult{Columns: columns}
+	for rows.Next() {
+		dest := make([]driver.Value, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range dest {
+			ptrs[i] = &dest[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, dest)
+	}
+
+	return result, rows.Err()
+}
+
+// sortRows sorts merged rows by the given columns, "-" prefixed for descending
+func sortRows(result *FanOutResult, orderBy []string) error {
+	type key struct {
+		index int
+		desc  bool
+	}
+
+	keys := make([]key, 0, len(orderBy))
+	for _, col := range orderBy {
+		desc := strings.HasPrefix(col, "-")
+		col = strings.TrimPrefix(col, "-")
+
+		index := -1
+		for i, name := range result.Columns {
+			if strings.EqualFold(name, col) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("order by column %q not in result", col)
+		}
+		keys = append(keys, key{index: index, desc: desc})
+	}
+
+	sort.SliceStable(result.Rows, func(i, j int) bool {
+		for _, k := range keys {
+			c := compareValues(result.Rows[i][k.index], result.Rows[j][k.index])
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	return nil
+}
+
+// compareValues orders driver values the way SQLite does:
+// NULL < numbers < text < blobs
+func compareValues(a, b driver.Value) int {
+	ra, rb := valueRank(a), valueRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case int64, float64, bool:
+		return compareNumbers(av, b)
+	case string:
+		return strings.Compare(av, b.(string))
+	case time.Time:
+		return av.Compare(b.(time.Time))
+	case []byte:
+		return bytes.Compare(av, b.([]byte))
+	}
+	return 0
+}
+
+// valueRank returns the SQLite storage class order of a driver value
+func valueRank(v driver.Value) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64, float64, bool:
+		return 1
+	case string:
+		return 2
+	case time.Time:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// compareNumbers orders numeric driver values exactly: integers beyond 2^53
+// aren't rounded through float64
+func compareNumbers(a, b driver.Value) int {
+	ai, aInt := toInt(a)
+	bi, bInt := toInt(b)
+	switch {
+	case aInt && bInt:
+		return cmp.Compare(ai, bi)
+	case aInt:
+		return compareIntFloat(ai, b.(float64))
+	case bInt:
+		return -compareIntFloat(bi, a.(float64))
+	}
+	return cmp.Compare(a.(float64), b.(float64))
+}
+
+// toInt returns an integer or boolean driver value as int64
+func toInt(v driver.Value) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// compareIntFloat compares an integer with a float without rounding the
+// integer
+func compareIntFloat(i int64, f float64) int {
+	switch {
+	case math.IsNaN(f):
+		// As cmp.Compare, NaN sorts first
+		return 1
+	case f >= math.MaxInt64:
+		return -1
+	case f < math.MinInt64:
+		return 1
+	}
+	whole := math.Trunc(f)
+	if c := cmp.Compare(i, int64(whole)); c != 0 {
+		return c
+	}
+	return cmp.Compare(0, f-whole)
+}
@@ -0,0 +1,180 @@
+package rsqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fanOutShard is a test server answering for one shard
+type fanOutShard struct {
+	server *httptest.Server
+	// connects counts the probes of new connections
+	connects atomic.Int32
+	mu       sync.Mutex
+	queries  []string
+}
+
+// newFanOutShard serves rows, given as JSON arrays, to every query that
+// isn't a connection probe
+func newFanOutShard(t *testing.T, rows string) *fanOutShard {
+	t.Helper()
+
+	shard := &fanOutShard{}
+	shard.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		json.Unmarshal(body, &statements)
+		query := ""
+		if len(statements) > 0 {
+			query, _ = statements[0][0].(string)
+		}
+
+		if query == "SELECT 1" {
+			shard.connects.Add(1)
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+			return
+		}
+		shard.mu.Lock()
+		shard.queries = append(shard.queries, query)
+		shard.mu.Unlock()
+		fmt.Fprintf(w, `{"results": [{"columns": ["id", "name"], "types": ["integer", "text"], "values": %s}]}`, rows)
+	}))
+	t.Cleanup(shard.server.Close)
+	return shard
+}
+
+// config returns the configuration of a shard
+func (s *fanOutShard) config(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(s.server.URL, "http://") + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestFanOutQueryPushesDownOrderAndLimit(t *testing.T) {
+	a := newFanOutShard(t, `[[9007199254740993, "a1"], [5, "a2"]]`)
+	b := newFanOutShard(t, `[[9007199254740992, "b1"], [7, "b2"]]`)
+
+	router, err := NewRouter(RouterConfig{Shards: map[string]*Config{"a": a.config(t), "b": b.config(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		result, err := router.FanOutQuery(ctx, "SELECT id, name FROM users;", FanOutOptions{OrderBy: []string{"-id"}, Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, row := range result.Rows {
+			names = append(names, row[1].(string))
+		}
+		// 2^53+1 and 2^53 are equal as float64
+		if want := []string{"a1", "b1", "b2"}; !equalStrings(names, want) {
+			t.Fatalf("merged rows %v, want %v", names, want)
+		}
+	}
+
+	want := "SELECT * FROM (\nSELECT id, name FROM users\n) ORDER BY \"id\" DESC LIMIT 3"
+	for _, shard := range []*fanOutShard{a, b} {
+		shard.mu.Lock()
+		if len(shard.queries) == 0 || shard.queries[0] != want {
+			t.Errorf("shard ran %q, want %q", shard.queries, want)
+		}
+		shard.mu.Unlock()
+
+		// The shard's pool is reused across fan-outs
+		if n := shard.connects.Load(); n != 1 {
+			t.Errorf("shard opened %d connections, want 1", n)
+		}
+	}
+}
+
+func TestFanOutQueryLimitWithoutOrder(t *testing.T) {
+	a := newFanOutShard(t, `[[1, "a1"]]`)
+	router, err := NewRouter(RouterConfig{Shards: map[string]*Config{"a": a.config(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	if _, err := router.FanOutQuery(context.Background(), "SELECT id, name FROM users", FanOutOptions{Limit: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT id, name FROM users\nLIMIT 5"; len(a.queries) != 1 || a.queries[0] != want {
+		t.Errorf("shard ran %q, want %q", a.queries, want)
+	}
+}
+
+func TestFanOutQueryLeavesWritesAlone(t *testing.T) {
+	a := newFanOutShard(t, `[[1, "a1"], [3, "a3"]]`)
+	b := newFanOutShard(t, `[[2, "b2"]]`)
+	router, err := NewRouter(RouterConfig{Shards: map[string]*Config{"a": a.config(t), "b": b.config(t)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	query := "WITH old AS (SELECT id FROM users WHERE seen < ?) DELETE FROM users WHERE id IN old RETURNING id, name"
+	result, err := router.FanOutQuery(context.Background(), query, FanOutOptions{OrderBy: []string{"-id"}, Limit: 2}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, row := range result.Rows {
+		names = append(names, row[1].(string))
+	}
+	if want := []string{"a3", "b2"}; !equalStrings(names, want) {
+		t.Errorf("merged rows %v, want %v", names, want)
+	}
+	for _, shard := range []*fanOutShard{a, b} {
+		if len(shard.queries) != 1 || shard.queries[0] != query {
+			t.Errorf("shard ran %q, want the statement unchanged", shard.queries)
+		}
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want int
+	}{
+		{int64(1<<53 + 1), int64(1 << 53), 1},
+		{int64(math.MaxInt64), int64(math.MaxInt64 - 1), 1},
+		{int64(3), 3.5, -1},
+		{3.5, int64(3), 1},
+		{int64(1<<53 + 1), float64(1 << 53), 1},
+		{int64(math.MaxInt64), math.Inf(1), -1},
+		{int64(2), 2.0, 0},
+		{true, int64(1), 0},
+		{nil, int64(0), -1},
+		{int64(5), "5", -1},
+		{"a", "b", -1},
+	}
+	for _, tt := range tests {
+		got := compareValues(tt.a, tt.b)
+		if got > 0 {
+			got = 1
+		} else if got < 0 {
+			got = -1
+		}
+		if got != tt.want {
+			t.Errorf("compareValues(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
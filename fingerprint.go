@@ -0,0 +1,188 @@
+package rsqlite
+
+import (
+	"regexp"
+	"strings"
+)
+
+// placeholderList matches a parenthesized list of two or more placeholders
+var placeholderList = regexp.MustCompile(`\(\?(?:, \?)+\)`)
+
+// Fingerprint normalizes a SQL statement so that executions differing only in
+// literal values share one key: string, numeric and blob literals become ?,
+// comments are dropped, whitespace is collapsed, text is lowercased and lists
+// of placeholders such as IN (?, ?, ?) become (?+). Quoted identifiers are kept.
+func Fingerprint(query string) string {
+	return fingerprint(query)
+}
+
+// fingerprint computes the fingerprint of a statement
+func fingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	// emit appends a token, separating tokens by a single space except
+	// around dots, after opening parens and before commas and closing parens
+	var last byte
+	emit := func(tok string) {
+		if b.Len() > 0 {
+			first := tok[0]
+			if last != '(' && last != '.' && first != ',' && first != ')' && first != '.' {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(tok)
+		last = tok[len(tok)-1]
+	}
+
+	for i := 0; i < len(query); {
+		ch := query[i]
+
+		switch {
+		case isSpace(ch):
+			i++
+
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			// Line comment
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+
+		case ch == '/' && i+1 < len(query) && query[i+1] == '*':
+			// Block comment
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+
+		case ch == '\'':
+			i = skipQuoted(query, i, '\'')
+			emit("?")
+
+		case (ch == 'x' || ch == 'X') && i+1 < len(query) && query[i+1] == '\'' && !precededByIdent(query, i):
+			// Blob literal
+			i = skipQuoted(query, i+1, '\'')
+			emit("?")
+
+		case ch == '"' || ch == '`' || ch == '[':
+			// Quoted identifier, kept verbatim
+			closing := ch
+			if ch == '[' {
+				closing = ']'
+			}
+			start := i
+			i = skipQuoted(query, i, closing)
+			emit(query[start:i])
+
+		case isDigit(ch) && !precededByIdent(query, i),
+			ch == '.' && i+1 < len(query) && isDigit(query[i+1]) && !precededByIdent(query, i):
+			i = skipNumber(query, i)
+			emit("?")
+
+		case isIdentByte(ch):
+			start := i
+			for i < len(query) && isIdentByte(query[i]) {
+				i++
+			}
+			emit(strings.ToLower(query[start:i]))
+
+		case isOperatorByte(ch):
+			// Multi-character operators such as >=, <> and || form one token
+			start := i
+			for i < len(query) && isOperatorByte(query[i]) && !startsComment(query, i) {
+				i++
+			}
+			if i == start {
+				i++
+			}
+			emit(query[start:i])
+
+		default:
+			// Parens, commas, dots, semicolons and placeholders
+			emit(string(ch))
+			i++
+		}
+	}
+
+	return placeholderList.ReplaceAllString(b.String(), "(?+)")
+}
+
+// startsComment reports whether a comment starts at i
+func startsComment(query string, i int) bool {
+	return i+1 < len(query) && ((query[i] == '-' && query[i+1] == '-') || (query[i] == '/' && query[i+1] == '*'))
+}
+
+// skipQuoted returns the index just past the quoted section starting at i.
+// A doubled closing character is treated as an escaped one.
+func skipQuoted(query string, i int, closing byte) int {
+	i++
+	for i < len(query) {
+		if query[i] == closing {
+			if i+1 < len(query) && query[i+1] == closing && closing != ']' {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+// skipNumber returns the index just past the numeric literal starting at i
+func skipNumber(query string, i int) int {
+	if query[i] == '0' && i+1 < len(query) && (query[i+1] == 'x' || query[i+1] == 'X') {
+		i += 2
+		for i < len(query) && isHexDigit(query[i]) {
+			i++
+		}
+		return i
+	}
+
+	for i < len(query) && (isDigit(query[i]) || query[i] == '.') {
+		i++
+	}
+
+	// Exponent
+	if i < len(query) && (query[i] == 'e' || query[i] == 'E') {
+		j := i + 1
+		if j < len(query) && (query[j] == '+' || query[j] == '-') {
+			j++
+		}
+		if j < len(query) && isDigit(query[j]) {
+			i = j
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+		}
+	}
+
+	return i
+}
+
+// precededByIdent reports whether the byte before i belongs to an identifier
+func precededByIdent(query string, i int) bool {
+	return i > 0 && isIdentByte(query[i-1])
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f'
+}
+
+func isOperatorByte(ch byte) bool {
+	return strings.IndexByte("<>=!|&+-*/%~^", ch) >= 0
+}
+
+func isIdentByte(ch byte) bool {
+	return ch == '_' || ch == '$' || isDigit(ch) || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch >= 0x80
+}
@@ -0,0 +1,76 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE id = 42", "select * from users where id = ?"},
+		{"select *  from users\n where id=7 -- trailing comment", "select * from users where id = ?"},
+		{"SELECT name FROM t WHERE name = 'it''s' AND x = X'ff' /* note */", "select name from t where name = ? and x = ?"},
+		{`SELECT "Mixed"."Col" FROM [T] WHERE id IN (?, ?, ?)`, `select "Mixed"."Col" from [T] where id in (?+)`},
+		{"SELECT a1, t2.b FROM t2 WHERE c >= -1.5e3 OR d <> .5", "select a1, t2.b from t2 where c >= - ? or d <> ?"},
+		{"INSERT INTO t VALUES (1, 'a'), (2, 'b')", "insert into t values (?+), (?+)"},
+	}
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStatsGroupByFingerprint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/db/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"results": [{"columns": ["id"], "types": ["integer"], "values": [[1], [2], [3]]}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, run := range []struct {
+		ctx   context.Context
+		query string
+	}{
+		{ctx, "SELECT id FROM users WHERE id = 1"},
+		{ctx, "select id from users where id = 2"},
+		{WithLabel(ctx, "user-by-id"), "SELECT id FROM users WHERE id = 3"},
+	} {
+		rows, err := db.QueryContext(run.ctx, run.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+
+	byStatement := connector.Stats().ByStatement
+	if stats := byStatement["select id from users where id = ?"]; stats.Count != 2 || stats.Rows != 6 {
+		t.Errorf("fingerprint stats %+v, want 2 executions of 3 rows", stats)
+	}
+	// A label takes precedence over the fingerprint
+	if stats := byStatement["user-by-id"]; stats.Count != 1 {
+		t.Errorf("labeled stats %+v, want 1 execution", stats)
+	}
+}
@@ -1,5 +1,3 @@
 module github.com/zhenruyan/rsqlite
 
-go 1.21
-
-require github.com/rqlite/gorqlite v0.0.0-20230708021416-2acd02b70b79
+go 1.22
@@ -0,0 +1,162 @@
+package rsqlite
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// QueryEvent describes a single statement sent to rqlite
+type QueryEvent struct {
+	// Query is the SQL text of the statement
+	Query string
+	// Label is the statement name attached with WithLabel, or ""
+	Label string
+	// Fingerprint is the normalized form of Query, see Fingerprint
+	Fingerprint string
+	// Write is true for Exec and false for Query
+	Write bool
+	// Node is the node that answered, or "" if the statement failed
+	Node string
+	// Duration is the time spent including retries
+	Duration time.Duration
+	// BytesSent is the size of the request body
+	BytesSent int
+	// BytesReceived is the size of the response body
+	BytesReceived int
+	// Rows is the number of rows returned by a query
+	Rows int
+	// RowsAffected is the number of rows changed by a write
+	RowsAffected int64
+	// Err is the error returned to the caller, if any
+	Err error
+}
+
+// ControlKind classifies requests the driver sends on its own behalf rather
+// than for a statement
+type ControlKind string
+
+const (
+	// ControlDiscovery is a /status request finding the leader and its peers
+	// on servers whose /nodes listing doesn't name the leader
+	ControlDiscovery ControlKind = "discovery"
+	// ControlNodes is a /nodes request listing the cluster members, used to
+	// find the leader and its peers
+	ControlNodes ControlKind = "nodes"
+	// ControlHealth is a health probe of a node
+	ControlHealth ControlKind = "health"
+	// ControlStatus is a /status request reading a node's raft progress, e.g.
+	// its applied index or the leader's backlog for write throttling
+	ControlStatus ControlKind = "status"
+	// ControlConnect is the probe checking a node when a connection is
+	// established or re-established
+	ControlConnect ControlKind = "connect"
+)
+
+// ControlEvent describes a request the driver sent on its own behalf, such
+// as leader discovery. These requests run on cold paths and after failures,
+// so they often explain latency spikes that statements alone don't.
+type ControlEvent struct {
+	// Kind classifies the request
+	Kind ControlKind
+	// Node is the node the request was sent to
+	Node string
+	// Duration is the time the request took
+	Duration time.Duration
+	// Err is the error of the request, if any
+	Err error
+}
+
+// key returns the name statements are aggregated under: the label if set,
+// otherwise the fingerprint
+func (e QueryEvent) key() string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return e.Fingerprint
+}
+
+// Hooks receives driver events. All fields are optional.
+type Hooks struct {
+	// AfterQuery is called after every statement
+	AfterQuery func(ctx context.Context, event QueryEvent)
+	// AfterControl is called after every request the driver sends on its
+	// own behalf, such as leader discovery and health probes
+	AfterControl func(ctx context.Context, event ControlEvent)
+	// Advisory is called with warnings about the application's use of the
+	// cluster, such as foreign keys declared on a server that ignores them
+	Advisory func(ctx context.Context, message string)
+	// Canary is called with the result of every canary run, see Config.Canary
+	Canary func(ctx context.Context, result CanaryResult)
+	// Panic is called when a panic while running a statement or reading its
+	// rows is recovered; the caller gets err instead of the panic
+	Panic func(ctx context.Context, err *PanicError)
+}
+
+// recoverPanic turns a panic into a PanicError stored in *errp and reported
+// to the Panic hook, so one bad response can't take down the application.
+// It must be deferred directly.
+func recoverPanic(ctx context.Context, hooks *Hooks, query string, errp *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	err := &PanicError{Query: query, Value: v, Stack: debug.Stack()}
+	*errp = err
+	if hooks != nil && hooks.Panic != nil {
+		hooks.Panic(ctx, err)
+	}
+}
+
+// observeControl reports a finished control request to hooks and metrics
+func (c *Connector) observeControl(ctx context.Context, event ControlEvent) {
+	c.metrics.recordControl(event)
+
+	cfg, _ := c.current()
+	if cfg.Hooks != nil && cfg.Hooks.AfterControl != nil {
+		cfg.Hooks.AfterControl(ctx, event)
+	}
+}
+
+// observe reports a finished statement to hooks, metrics and the slow-query log
+func (c *Conn) observe(ctx context.Context, start time.Time, write bool, query string, result *StatementResult, err error) {
+	event := QueryEvent{
+		Query:       query,
+		Label:       LabelFromContext(ctx),
+		Fingerprint: c.warmCache().fingerprint(query),
+		Write:       write,
+		Duration:    time.Since(start),
+		Err:         err,
+	}
+	if result != nil {
+		event.Node = result.node
+		event.BytesSent = result.bytesSent
+		event.BytesReceived = result.bytesReceived
+		event.Rows = len(result.Values)
+		event.RowsAffected = result.RowsAffected
+	}
+
+	if c.connector != nil {
+		c.connector.metrics.record(event, c.cfg.maxStatementStats())
+		if c.cfg.AdaptiveTimeout != nil && err == nil {
+			window := c.cfg.AdaptiveTimeout.withDefaults(c.cfg.Timeout).Window
+			c.connector.latency.record(event.key(), event.Duration, window, c.cfg.maxStatementStats())
+		}
+	}
+
+	if c.cfg.Hooks != nil && c.cfg.Hooks.AfterQuery != nil {
+		c.cfg.Hooks.AfterQuery(ctx, event)
+	}
+
+	if c.cfg.SlowQueryThreshold > 0 && event.Duration >= c.cfg.SlowQueryThreshold {
+		logger := c.cfg.Logger
+		if logger == nil {
+			logger = log.Default()
+		}
+		name := event.key()
+		logger.Printf("rsqlite: slow query (%s) on %s: %q sent=%dB received=%dB rows=%d affected=%d",
+			event.Duration, event.Node, name, event.BytesSent, event.BytesReceived, event.Rows, event.RowsAffected)
+	}
+}
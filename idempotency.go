@@ -0,0 +1,219 @@
+package rsqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdempotencyConfig makes writes safe to retry after ambiguous failures,
+// such as a timeout after the leader applied the write. Every Exec is sent
+// together with a client-generated key, recorded in a dedup table in the
+// same transaction; a retry of a write that was applied finds its key and
+// returns the recorded result instead of applying the write again.
+type IdempotencyConfig struct {
+	// Table records the keys of applied writes, default "rsqlite_idempotency".
+	// It is created when missing and must not be used by the application.
+	Table string
+	// Retention is how long keys are kept, default 24h
+	Retention time.Duration
+}
+
+// idempotencyPruneInterval is how often expired keys are deleted
+const idempotencyPruneInterval = time.Hour
+
+// validate checks the idempotency configuration
+func (cfg *IdempotencyConfig) validate() error {
+	if cfg.Retention < 0 {
+		return errors.New("idempotency retention cannot be negative")
+	}
+	return nil
+}
+
+// withDefaults fills unset fields
+func (cfg IdempotencyConfig) withDefaults() IdempotencyConfig {
+	if cfg.Table == "" {
+		cfg.Table = "rsqlite_idempotency"
+	}
+	if cfg.Retention == 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	return cfg
+}
+
+// idempotencyState tracks the dedup table of a connector
+type idempotencyState struct {
+	mu        sync.Mutex
+	created   bool
+	lastPrune time.Time
+}
+
+// ensureTable creates the dedup table once
+func (s *idempotencyState) ensureTable(ctx context.Context, client *apiClient, table string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.created {
+		return nil
+	}
+
+	create := "CREATE TABLE IF NOT EXISTS " + quoteIdent(table) +
+		" (key TEXT PRIMARY KEY, last_insert_id INTEGER, rows_affected INTEGER, created_at INTEGER NOT NULL)"
+	results, err := client.executeBatch(ctx, []Statement{{Query: create}}, false)
+	if err != nil {
+		return fmt.Errorf("creating idempotency table: %w", err)
+	}
+	if results[0].Error != "" {
+		return fmt.Errorf("creating idempotency table: %s", results[0].Error)
+	}
+
+	s.created = true
+	return nil
+}
+
+// pruneDue reports whether expired keys should be deleted with the next write
+func (s *idempotencyState) pruneDue(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPrune) < idempotencyPruneInterval {
+		return false
+	}
+	s.lastPrune = now
+	return true
+}
+
+// newIdempotencyKey returns a random key identifying one write
+func newIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// idempotency returns the dedup table state shared by the connector's connections
+func (c *Conn) idempotency() *idempotencyState {
+	if c.connector != nil {
+		return &c.connector.idempotency
+	}
+	return &c.idempotencyLocal
+}
+
+// idempotencyKeyKey is the context key for caller-chosen idempotency keys
+type idempotencyKeyKey struct{}
+
+// WithIdempotencyKey returns a context whose write is sent with key instead
+// of a generated one when Config.Idempotency is set, so repeating the write
+// later, e.g. replaying it from a SpillFile, doesn't apply it twice. Each
+// write needs its own key.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the key attached by WithIdempotencyKey, or ""
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey{}).(string)
+	return key
+}
+
+// idempotencyKey returns the key of a write run with ctx: the one attached
+// by WithIdempotencyKey, or a new one
+func idempotencyKey(ctx context.Context) (string, error) {
+	if key := IdempotencyKeyFromContext(ctx); key != "" {
+		return key, nil
+	}
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return "", fmt.Errorf("generating idempotency key: %w", err)
+	}
+	return key, nil
+}
+
+// runIdempotent runs a write with an idempotency key, retrying it following
+// the retry policy. Every attempt sends the same key, so a write that was
+// applied by an attempt whose response was lost is not applied again.
+func (c *Conn) runIdempotent(ctx context.Context, key, query string, values []interface{}) (*StatementResult, error) {
+	cfg := c.cfg.Idempotency.withDefaults()
+	table := quoteIdent(cfg.Table)
+	state := c.idempotency()
+
+	var result *StatementResult
+	err := c.withRetry(ctx, false, false, func(client *apiClient) error {
+		if err := state.ensureTable(ctx, client, cfg.Table); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		statements := []Statement{
+			{Query: query, Args: values},
+			// changes() and last_insert_rowid() still describe the write
+			{
+				Query: "INSERT INTO " + table + " (key, last_insert_id, rows_affected, created_at) VALUES (?, last_insert_rowid(), changes(), ?)",
+				Args:  []interface{}{key, now.Unix()},
+			},
+		}
+		if state.pruneDue(now) {
+			statements = append(statements, Statement{
+				Query: "DELETE FROM " + table + " WHERE created_at < ?",
+				Args:  []interface{}{now.Add(-cfg.Retention).Unix()},
+			})
+		}
+
+		results, err := c.writeClient(client).executeBatch(ctx, statements, true)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range results {
+			if r.Error == "" {
+				continue
+			}
+			if !strings.Contains(r.Error, "UNIQUE constraint failed: "+cfg.Table+".key") {
+				return &statementError{msg: r.Error}
+			}
+
+			// An earlier attempt was applied; the transaction rolled back
+			result, err = recordedResult(ctx, client, table, key)
+			return err
+		}
+
+		result = &results[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// recordedResult reads the result recorded for an applied write
+func recordedResult(ctx context.Context, client *apiClient, table, key string) (*StatementResult, error) {
+	recorded, err := client.query(ctx, "strong", "SELECT last_insert_id, rows_affected FROM "+table+" WHERE key = ?", []interface{}{key})
+	if err != nil {
+		return nil, fmt.Errorf("reading idempotency record: %w", err)
+	}
+	if len(recorded.Values) == 0 || len(recorded.Values[0]) < 2 {
+		return nil, errors.New("idempotency record not found")
+	}
+
+	lastInsertID, err := toInt64(recorded.Values[0][0])
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := toInt64(recorded.Values[0][1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatementResult{
+		LastInsertID: lastInsertID,
+		RowsAffected: rowsAffected,
+		node:         client.node,
+	}, nil
+}
@@ -0,0 +1,175 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// dedupNode is a test node keeping an idempotency table in memory
+type dedupNode struct {
+	mu sync.Mutex
+	// rows counts the applied user writes
+	rows int64
+	// keys maps recorded keys to their last insert id
+	keys    map[string]int64
+	creates int
+	prunes  int
+	// loseResponses answers that many applied writes with a gateway timeout
+	loseResponses int
+}
+
+func (n *dedupNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/status" || r.URL.Path == "/nodes" {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var statements [][]interface{}
+	json.Unmarshal(body, &statements)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	query, _ := statements[0][0].(string)
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS "):
+		n.creates++
+		w.Write([]byte(`{"results": [{}]}`))
+		return
+	case strings.HasPrefix(query, "SELECT last_insert_id"):
+		id, ok := n.keys[statements[0][1].(string)]
+		if !ok {
+			w.Write([]byte(`{"results": [{"columns": ["last_insert_id", "rows_affected"], "types": ["integer", "integer"]}]}`))
+			return
+		}
+		fmt.Fprintf(w, `{"results": [{"columns": ["last_insert_id", "rows_affected"], "types": ["integer", "integer"], "values": [[%d, 1]]}]}`, id)
+		return
+	case !strings.HasPrefix(query, "INSERT INTO users"):
+		w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+		return
+	}
+
+	if !r.URL.Query().Has("transaction") || len(statements) < 2 {
+		http.Error(w, fmt.Sprintf("write sent without its key: %s", body), http.StatusBadRequest)
+		return
+	}
+	if value, _ := statements[0][1].(string); value == "dup" {
+		w.Write([]byte(`{"results": [{"error": "UNIQUE constraint failed: users.v"}]}`))
+		return
+	}
+
+	// The transaction rolls back when the key was recorded
+	key := statements[1][1].(string)
+	if _, ok := n.keys[key]; ok {
+		w.Write([]byte(`{"results": [{"last_insert_id": 99, "rows_affected": 1}, {"error": "UNIQUE constraint failed: rsqlite_idempotency.key"}]}`))
+		return
+	}
+	n.rows++
+	n.keys[key] = n.rows
+	if len(statements) > 2 && strings.HasPrefix(statements[2][0].(string), "DELETE FROM ") {
+		n.prunes++
+	}
+
+	if n.loseResponses > 0 {
+		n.loseResponses--
+		http.Error(w, "upstream timed out", http.StatusGatewayTimeout)
+		return
+	}
+	fmt.Fprintf(w, `{"results": [{"last_insert_id": %d, "rows_affected": 1}, {"last_insert_id": %d, "rows_affected": 1}]}`, n.rows, n.rows)
+}
+
+func newDedupDB(t *testing.T) (*dedupNode, *sql.DB) {
+	t.Helper()
+
+	node := &dedupNode{keys: make(map[string]int64)}
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false&idempotency=true&retry_backoff=1ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() { db.Close() })
+	return node, db
+}
+
+func TestIdempotentWrites(t *testing.T) {
+	node, db := newDedupDB(t)
+
+	for i := int64(1); i <= 2; i++ {
+		result, err := db.Exec("INSERT INTO users (v) VALUES (?)", "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, _ := result.LastInsertId(); id != i {
+			t.Errorf("write %d: last insert id %d", i, id)
+		}
+	}
+	if node.rows != 2 || len(node.keys) != 2 {
+		t.Errorf("%d rows written with %d keys, want a new key per write", node.rows, len(node.keys))
+	}
+	// The table is created once and expired keys pruned with the first write
+	if node.creates != 1 || node.prunes != 1 {
+		t.Errorf("table created %d times, pruned %d times", node.creates, node.prunes)
+	}
+
+	// A write rejected by the application's own constraint fails
+	if _, err := db.Exec("INSERT INTO users (v) VALUES (?)", "dup"); err == nil || !strings.Contains(err.Error(), "UNIQUE constraint failed: users.v") {
+		t.Errorf("write violating a user constraint = %v", err)
+	}
+}
+
+func TestIdempotentWriteDuplicateKey(t *testing.T) {
+	node, db := newDedupDB(t)
+	ctx := WithIdempotencyKey(context.Background(), "replayed")
+
+	first, err := db.ExecContext(ctx, "INSERT INTO users (v) VALUES (?)", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The write is applied once, the repeat returns the recorded result
+	second, err := db.ExecContext(ctx, "INSERT INTO users (v) VALUES (?)", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.rows != 1 {
+		t.Errorf("%d rows written for one key", node.rows)
+	}
+	firstID, _ := first.LastInsertId()
+	secondID, _ := second.LastInsertId()
+	if affected, _ := second.RowsAffected(); firstID != 1 || secondID != firstID || affected != 1 {
+		t.Errorf("repeated write reported id %d and %d rows, want the recorded id %d", secondID, affected, firstID)
+	}
+}
+
+func TestIdempotentWriteLostResponse(t *testing.T) {
+	node, db := newDedupDB(t)
+	node.rows = 41
+	node.loseResponses = 1
+
+	// The retry conflicts on the recorded key and reads its result back
+	result, err := db.Exec("INSERT INTO users (v) VALUES (?)", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.rows != 42 || len(node.keys) != 1 {
+		t.Errorf("%d rows written, want the write applied once", node.rows-41)
+	}
+	if id, _ := result.LastInsertId(); id != 42 {
+		t.Errorf("last insert id %d, want the recorded 42 rather than the rolled back attempt", id)
+	}
+}
@@ -0,0 +1,192 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeStatus represents the status of a node
+type NodeStatus struct {
+	// ID is the raft node ID
+	ID string `json:"id"`
+	// Addr is the raft address
+	Addr string `json:"addr"`
+	// APIAddr is the HTTP API address
+	APIAddr   string `json:"api_addr"`
+	Leader    bool   `json:"leader"`
+	Reachable bool   `json:"reachable"`
+	// Voter is false for read-only nodes
+	Voter   bool   `json:"voter"`
+	Version string `json:"version"`
+	// Latency is how long the node took to answer the node that was asked
+	Latency time.Duration `json:"latency"`
+	// Error explains why the node is unreachable
+	Error string `json:"error,omitempty"`
+	// AppliedIndex is the raft index the node has applied, 0 if unknown
+	AppliedIndex uint64 `json:"applied_index"`
+	// Lag is how many raft entries the node is behind the leader
+	Lag uint64 `json:"lag"`
+}
+
+// RaftStatus is the raft progress a node reports in /status
+type RaftStatus struct {
+	// Node is the API address of the reporting node
+	Node         string `json:"-"`
+	AppliedIndex uint64 `json:"applied_index"`
+	CommitIndex  uint64 `json:"commit_index"`
+	// FSMPending is the number of committed entries queued for the database
+	FSMPending uint64 `json:"fsm_pending"`
+}
+
+// Get fetches an API endpoint such as "/status" of node and returns the body
+// of a 200 response
+func Get(ctx context.Context, client *http.Client, header Header, node, endpoint string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", NodeURL(node, endpoint), nil)
+	if err != nil {
+		return nil, err
+	}
+	header.Apply(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		name, _, _ := strings.Cut(strings.TrimPrefix(endpoint, "/"), "?")
+		return nil, fmt.Errorf("%s request failed: %d", name, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// nodePayload is a node entry of the /nodes response
+type nodePayload struct {
+	ID        string  `json:"id"`
+	APIAddr   string  `json:"api_addr"`
+	Addr      string  `json:"addr"`
+	Voter     bool    `json:"voter"`
+	Reachable bool    `json:"reachable"`
+	Leader    bool    `json:"leader"`
+	Version   string  `json:"version"`
+	Time      float64 `json:"time"`
+	Error     string  `json:"error"`
+}
+
+// ParseNodes decodes a /nodes response. Both the map keyed by node ID of
+// older servers and the {"nodes": [...]} form of ?ver=2 are accepted.
+func ParseNodes(body []byte) ([]NodeStatus, error) {
+	var payloads []nodePayload
+
+	var list struct {
+		Nodes []nodePayload `json:"nodes"`
+	}
+	if err := json.Unmarshal(body, &list); err == nil && list.Nodes != nil {
+		payloads = list.Nodes
+	} else {
+		var byID map[string]nodePayload
+		if err := json.Unmarshal(body, &byID); err != nil {
+			return nil, fmt.Errorf("invalid /nodes response: %w", err)
+		}
+		for id, payload := range byID {
+			if payload.ID == "" {
+				payload.ID = id
+			}
+			payloads = append(payloads, payload)
+		}
+	}
+
+	nodes := make([]NodeStatus, 0, len(payloads))
+	for _, p := range payloads {
+		nodes = append(nodes, NodeStatus{
+			ID:        p.ID,
+			Addr:      p.Addr,
+			APIAddr:   p.APIAddr,
+			Leader:    p.Leader,
+			Reachable: p.Reachable,
+			Voter:     p.Voter,
+			Version:   p.Version,
+			Latency:   time.Duration(p.Time * float64(time.Second)),
+			Error:     p.Error,
+		})
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	return nodes, nil
+}
+
+// QueryNodes fetches the cluster members, including non-voters, from the
+// /nodes endpoint of node
+func QueryNodes(ctx context.Context, client *http.Client, header Header, node string) ([]NodeStatus, error) {
+	body, err := Get(ctx, client, header, node, "/nodes?nonvoters&ver=2")
+	if err != nil {
+		return nil, err
+	}
+	return ParseNodes(body)
+}
+
+// QueryCluster returns the raft addresses of the leader and the peers the
+// /status endpoint of node reports, for servers without /nodes?ver=2
+func QueryCluster(ctx context.Context, client *http.Client, header Header, node string) (string, []string, error) {
+	body, err := Get(ctx, client, header, node, "/status")
+	if err != nil {
+		return "", nil, err
+	}
+
+	var status map[string]interface{}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return "", nil, err
+	}
+
+	// Extract cluster info from status
+	cluster, ok := status["cluster"].(map[string]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("invalid cluster info in status")
+	}
+
+	leader, _ := cluster["leader"].(string)
+	if leader == "" {
+		return "", nil, fmt.Errorf("no leader found")
+	}
+
+	// Extract peers
+	var peers []string
+	if peerList, ok := cluster["peers"].([]interface{}); ok {
+		for _, peer := range peerList {
+			if peerStr, ok := peer.(string); ok {
+				peers = append(peers, peerStr)
+			}
+		}
+	}
+
+	return leader, peers, nil
+}
+
+// QueryRaftStatus reads the raft progress of node from its /status endpoint
+func QueryRaftStatus(ctx context.Context, client *http.Client, header Header, node string) (*RaftStatus, error) {
+	body, err := Get(ctx, client, header, node, "/status")
+	if err != nil {
+		return nil, err
+	}
+
+	var status struct {
+		Store struct {
+			Raft RaftStatus `json:"raft"`
+		} `json:"store"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+
+	status.Store.Raft.Node = NormalizeNode(node)
+	return &status.Store.Raft, nil
+}
@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SplitUserinfo splits the credentials off a DSN without scheme. They end
+// at the last "@" before the first "?", so passwords may contain "@".
+// Otherwise an "@" after the "?" ends them when the text between contains
+// no "=", which marks parameters: "user:pa?ss@host" has credentials,
+// "host?app_name=a@b" has none. Passwords containing both "?" and "=" must
+// be percent-encoded.
+func SplitUserinfo(dsn string) (userinfo, rest string, ok bool) {
+	hosts, _, _ := strings.Cut(dsn, "?")
+	if at := strings.LastIndexByte(hosts, '@'); at >= 0 {
+		return dsn[:at], dsn[at+1:], true
+	}
+
+	q := len(hosts)
+	for at := strings.IndexByte(dsn, '@'); at >= 0; {
+		if !strings.Contains(dsn[q:at], "=") {
+			rest := dsn[at+1:]
+			if nodes, _, _ := strings.Cut(rest, "?"); !strings.ContainsAny(nodes, "@=&") {
+				return dsn[:at], rest, true
+			}
+		}
+
+		next := strings.IndexByte(dsn[at+1:], '@')
+		if next < 0 {
+			break
+		}
+		at += next + 1
+	}
+	return "", dsn, false
+}
+
+// ParseCredentials percent-decodes the username and password of userinfo
+func ParseCredentials(userinfo string) (username, password string, err error) {
+	rawUsername, rawPassword, hasPassword := strings.Cut(userinfo, ":")
+	if username, err = url.PathUnescape(rawUsername); err != nil {
+		return "", "", fmt.Errorf("invalid username in dsn: %w", err)
+	}
+	if hasPassword {
+		if password, err = url.PathUnescape(rawPassword); err != nil {
+			return "", "", fmt.Errorf("invalid percent-encoding in dsn password: %w", err)
+		}
+	}
+	return username, password, nil
+}
+
+// Param is a parameter of a DSN query
+type Param struct {
+	Key      string
+	Value    string
+	HasValue bool
+}
+
+// ParseQuery decodes the parameters of a DSN like a URL query, splitting
+// each at its first "=", but keeps their order, which matters for
+// parameters that override each other such as tls and default_scheme
+func ParseQuery(rawQuery string) ([]Param, error) {
+	var params []Param
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+
+		rawKey, rawValue, hasValue := strings.Cut(part, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percent-encoding in dsn parameter %q: %w", part, err)
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percent-encoding in dsn parameter %q: %w", part, err)
+		}
+		params = append(params, Param{Key: key, Value: value, HasValue: hasValue})
+	}
+	return params, nil
+}
+
+// LoadCAFile reads a PEM bundle of CA certificates
+func LoadCAFile(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading TLS CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("TLS CA bundle contains no PEM certificates: " + path)
+	}
+	return pool, nil
+}
+
+// transports holds one pooled transport per TLS configuration and dial timeout
+var transports sync.Map
+
+// transportKey identifies the settings of a shared transport
+type transportKey struct {
+	tlsConfig   *tls.Config
+	dialTimeout time.Duration
+}
+
+// For returns the shared transport for a TLS configuration and dial
+// timeout, so clients with the same settings reuse pooled TLS sessions.
+// http.DefaultTransport is used when tlsConfig is nil and dialTimeout is 0.
+func For(tlsConfig *tls.Config, dialTimeout time.Duration) http.RoundTripper {
+	if tlsConfig == nil && dialTimeout == 0 {
+		return http.DefaultTransport
+	}
+
+	key := transportKey{tlsConfig: tlsConfig, dialTimeout: dialTimeout}
+	if transport, ok := transports.Load(key); ok {
+		return transport.(http.RoundTripper)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if dialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = dialTimeout
+	}
+	actual, _ := transports.LoadOrStore(key, transport)
+	return actual.(http.RoundTripper)
+}
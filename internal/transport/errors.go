@@ -0,0 +1,42 @@
+package transport
+
+import "fmt"
+
+// NotLeaderError is returned when a follower redirected a statement to the
+// leader and the statement failed there too; the first redirect is followed
+type NotLeaderError struct {
+	// Node is the node that redirected the statement
+	Node string
+	// Leader is the node it was redirected to
+	Leader string
+}
+
+// Error implements the error interface
+func (e *NotLeaderError) Error() string {
+	return fmt.Sprintf("%s is not the leader, redirected to %s", e.Node, e.Leader)
+}
+
+// RequestError is an error the server reported for a whole request rather
+// than for one of its statements, e.g. the loss of leadership while the
+// request was applied
+type RequestError struct {
+	Msg string
+}
+
+// Error implements the error interface
+func (e *RequestError) Error() string {
+	return e.Msg
+}
+
+// StatusError is returned when the server answered a request with an
+// unexpected HTTP status
+type StatusError struct {
+	Path string
+	Code int
+	Body string
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s request failed: %d: %s", e.Path, e.Code, e.Body)
+}
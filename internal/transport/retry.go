@@ -0,0 +1,243 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultRetryMultiplier is the backoff multiplier of a RetryPolicy that
+// leaves it unset
+const DefaultRetryMultiplier = 2
+
+// RetryPolicy controls how failed statements, connection attempts and
+// leader discovery are retried: the first retry waits InitialInterval, every
+// further one Multiplier times longer, each wait randomly shortened or
+// lengthened by up to Jitter of it, so clients that failed together don't
+// retry in lockstep after a failover.
+type RetryPolicy struct {
+	// MaxRetries is the number of attempts after the first one; 0 disables
+	// retries
+	MaxRetries int
+	// InitialInterval is the wait before the first retry; 0 retries at once
+	InitialInterval time.Duration
+	// Multiplier scales the wait after each retry, at least 1, default 2
+	Multiplier float64
+	// Jitter is the fraction of each wait it is varied by, between 0 and 1
+	Jitter float64
+	// MaxElapsed stops retrying once this much time has passed since the
+	// first attempt; 0 means no limit
+	MaxElapsed time.Duration
+}
+
+// Validate checks the retry policy
+func (p *RetryPolicy) Validate() error {
+	var errs []error
+	if p.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("retry policy max retries cannot be negative, got %d", p.MaxRetries))
+	}
+	if p.InitialInterval < 0 || p.MaxElapsed < 0 {
+		errs = append(errs, errors.New("retry policy initial interval and max elapsed time cannot be negative"))
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		errs = append(errs, fmt.Errorf("retry policy multiplier must be at least 1, got %g", p.Multiplier))
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		errs = append(errs, fmt.Errorf("retry policy jitter must be between 0 and 1, got %g", p.Jitter))
+	}
+	return errors.Join(errs...)
+}
+
+// Clock tells the time and starts timers, so tests can drive discovery
+// caching, quarantines and retry backoff without sleeping
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a timer firing once d has passed
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer started by a Clock
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, see time.Timer.Stop
+	Stop() bool
+}
+
+// Rand is the randomness of node selection and retry jitter. A seeded
+// *rand.Rand of math/rand/v2 implements it, but must be guarded by a lock
+// as Rand must be safe for concurrent use.
+type Rand interface {
+	// IntN returns a random number in [0, n)
+	IntN(n int) int
+	// Int64N returns a random number in [0, n)
+	Int64N(n int64) int64
+}
+
+// SystemClock is the Clock of the time package
+type SystemClock struct{}
+
+// Now returns the current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer starts a time.Timer
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+// systemTimer is a time.Timer
+type systemTimer struct {
+	timer *time.Timer
+}
+
+// C returns the timer's channel
+func (t systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// Stop stops the timer
+func (t systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// SystemRand is the shared source of the math/rand/v2 package
+type SystemRand struct{}
+
+// IntN returns rand.IntN(n)
+func (SystemRand) IntN(n int) int {
+	return rand.IntN(n)
+}
+
+// Int64N returns rand.Int64N(n)
+func (SystemRand) Int64N(n int64) int64 {
+	return rand.Int64N(n)
+}
+
+// Retry is a RetryPolicy ready to run
+type Retry struct {
+	// MaxRetries is the number of attempts after the first one
+	MaxRetries int
+	// Backoff is the wait before the first retry, multiplied by Multiplier
+	// for every further one
+	Backoff    time.Duration
+	Multiplier float64
+	// Jitter is the fraction of each wait it is varied by
+	Jitter float64
+	// MaxElapsed stops retrying once this much time has passed; 0 means no limit
+	MaxElapsed time.Duration
+	// Clock measures the elapsed time and times the backoff, and Rand
+	// draws the jitter
+	Clock Clock
+	Rand  Rand
+}
+
+// NewRetry returns the runner of policy, defaulting its multiplier
+func NewRetry(policy RetryPolicy, clock Clock, rand Rand) Retry {
+	if policy.Multiplier == 0 {
+		policy.Multiplier = DefaultRetryMultiplier
+	}
+	return Retry{
+		MaxRetries: policy.MaxRetries,
+		Backoff:    policy.InitialInterval,
+		Multiplier: policy.Multiplier,
+		Jitter:     policy.Jitter,
+		MaxElapsed: policy.MaxElapsed,
+		Clock:      clock,
+		Rand:       rand,
+	}
+}
+
+// Wait returns the jittered wait for delay
+func (p Retry) Wait(delay time.Duration) time.Duration {
+	spread := int64(float64(delay) * p.Jitter)
+	if spread <= 0 || p.Rand == nil {
+		return delay
+	}
+	return delay + time.Duration(p.Rand.Int64N(2*spread+1)-spread)
+}
+
+// Next returns the delay following delay, capped so it can't overflow
+func (p Retry) Next(delay time.Duration) time.Duration {
+	next := float64(delay) * p.Multiplier
+	if next >= math.MaxInt64/2 {
+		return math.MaxInt64 / 2
+	}
+	return time.Duration(next)
+}
+
+// Do runs op until it succeeds, fails with an error retryable rejects, or
+// the policy is exhausted, and returns op's last error. Before each retry it
+// waits the backoff and calls reset, if any, whose error ends the retries.
+// Once ctx is done no further reset or attempt starts.
+func (p Retry) Do(ctx context.Context, op func() error, retryable func(error) bool, reset func() error) error {
+	clock := p.Clock
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	start := clock.Now()
+	delay := p.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= p.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		wait := p.Wait(delay)
+		if p.MaxElapsed > 0 && clock.Now().Sub(start)+wait > p.MaxElapsed {
+			return err
+		}
+
+		if wait > 0 {
+			timer := clock.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C():
+			}
+			delay = p.Next(delay)
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+		if reset == nil {
+			continue
+		}
+		if resetErr := reset(); resetErr != nil {
+			return resetErr
+		}
+	}
+}
+
+// Retryable reports whether a request that failed with err may succeed
+// when sent again: the request didn't reach the node or its connection
+// broke, a follower redirected it, or the cluster was briefly unavailable,
+// e.g. without a leader during an election. Errors the statement itself
+// caused, such as a constraint violation, and requests that would fail the
+// same way on every node, such as oversized ones, aren't.
+func Retryable(err error) bool {
+	var notLeader *NotLeaderError
+	var status *StatusError
+	var reqErr *RequestError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &notLeader):
+		return true
+	case errors.As(err, &status):
+		return status.Code == http.StatusServiceUnavailable || status.Code == http.StatusBadGateway || status.Code == http.StatusGatewayTimeout
+	case errors.As(err, &reqErr):
+		return strings.Contains(strings.ToLower(reqErr.Msg), "leader")
+	}
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,150 @@
+// Package transport is the rqlite HTTP protocol shared by the driver and the
+// api package: node addressing and leader redirects, request headers and
+// authentication, the statement encoding, leader discovery through /nodes
+// and /status, and the retry engine.
+package transport
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NormalizeNode adds the http:// prefix to a node address if no scheme is present,
+// lowercases the scheme and strips trailing slashes. A base path such as
+// https://gw.example.com/rqlite is kept, so API endpoints are issued under the prefix.
+func NormalizeNode(node string) string {
+	node = strings.TrimRight(node, "/")
+
+	scheme := "http://"
+	if HasScheme(node) {
+		i := strings.Index(node, "://") + len("://")
+		scheme, node = strings.ToLower(node[:i]), node[i:]
+	}
+
+	host, path := node, ""
+	if i := strings.IndexByte(node, '/'); i >= 0 {
+		host, path = node[:i], node[i:]
+	}
+
+	return scheme + NormalizeHost(host) + path
+}
+
+// NormalizeHost brackets bare IPv6 literals such as "fd00::2", which can't
+// carry a port, and rewrites IPv6 addresses in their canonical form so the
+// same node always compares equal
+func NormalizeHost(host string) string {
+	if strings.HasPrefix(host, "[") {
+		end := strings.IndexByte(host, ']')
+		if end < 0 {
+			return host
+		}
+		if ip := net.ParseIP(host[1:end]); ip != nil && ip.To4() == nil {
+			return "[" + ip.String() + "]" + host[end+1:]
+		}
+		return host
+	}
+
+	if strings.Count(host, ":") > 1 {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			return "[" + ip.String() + "]"
+		}
+	}
+	return host
+}
+
+// HasScheme reports whether a node address starts with http:// or https://,
+// in any case
+func HasScheme(node string) bool {
+	node = strings.ToLower(node)
+	return strings.HasPrefix(node, "http://") || strings.HasPrefix(node, "https://")
+}
+
+// NodeHost returns the host and port of a node address, without scheme and path
+func NodeHost(node string) string {
+	if i := strings.Index(node, "://"); i >= 0 {
+		node = node[i+len("://"):]
+	}
+	if i := strings.IndexByte(node, '/'); i >= 0 {
+		node = node[:i]
+	}
+	return NormalizeHost(node)
+}
+
+// NodeURL returns the URL of an API endpoint such as "/status" on the given node
+func NodeURL(node, endpoint string) string {
+	return NormalizeNode(node) + endpoint
+}
+
+// NodeBasePath returns the base path of a normalized node, "" when it has none
+func NodeBasePath(node string) string {
+	rest := node
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+len("://"):]
+	}
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		return rest[i:]
+	}
+	return ""
+}
+
+// RedirectedTo returns the node a follower redirected a request for path
+// on node to, or "". The Location is resolved against the request URL and
+// its path up to the API path kept as the leader's base path; a Location
+// that doesn't end in the API path keeps node's base path.
+func RedirectedTo(resp *http.Response, node, path string) string {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return ""
+	}
+
+	location, err := resp.Location()
+	if err != nil || location.Host == "" {
+		return ""
+	}
+
+	base, ok := strings.CutSuffix(location.Path, path)
+	if !ok {
+		base = NodeBasePath(node)
+	}
+	return NormalizeNode(location.Scheme + "://" + location.Host + base)
+}
+
+// Header holds what identifies and authenticates every request sent to rqlite
+type Header struct {
+	// AppName identifies the application so server-side logs can
+	// attribute load
+	AppName string
+	// Username and Password are sent with HTTP Basic Auth when Username is set
+	Username string
+	Password string
+}
+
+// Apply sets the headers on req
+func (h Header) Apply(req *http.Request) {
+	userAgent := "rsqlite"
+	if h.AppName != "" {
+		req.Header.Set("X-Application-Name", h.AppName)
+		userAgent += " (" + h.AppName + ")"
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+}
+
+// CheckRedirect follows redirects of GET requests like the default policy
+// but hands redirected POSTs back to the caller: Go would resend them as
+// GETs without their body, and the caller follows leader redirects itself
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if via[0].Method == http.MethodPost {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package transport
+
+import "encoding/json"
+
+// Statement is a single parameterized SQL statement
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// EncodeStatements encodes statements into the JSON body of /db/query and
+// /db/execute requests: each statement is an array holding the query
+// followed by its positional arguments
+func EncodeStatements(statements []Statement) ([]byte, error) {
+	encoded := make([][]interface{}, 0, len(statements))
+	for _, stmt := range statements {
+		statement := make([]interface{}, 0, len(stmt.Args)+1)
+		statement = append(statement, stmt.Query)
+		statement = append(statement, stmt.Args...)
+		encoded = append(encoded, statement)
+	}
+
+	return json.Marshal(encoded)
+}
@@ -0,0 +1,76 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FailedWrite describes a write that failed after every retry, see
+// Config.LastResort
+type FailedWrite struct {
+	// Query is the statement as passed to ExecContext
+	Query string
+	// Args are the bound arguments
+	Args []interface{}
+	// IdempotencyKey is the key the write was sent with when
+	// Config.Idempotency is set, or ""; see WithIdempotencyKey
+	IdempotencyKey string
+	// Label is the statement name attached with WithLabel, or ""
+	Label string
+	// MaybeApplied reports whether the last attempt may have reached the
+	// leader, so replaying the write could apply it twice
+	MaybeApplied bool
+	// Err is the error of the last attempt
+	Err error
+	// FailedAt is when the driver gave up
+	FailedAt time.Time
+}
+
+// LastResort takes over writes the driver gave up on, e.g. to append them to
+// a spill file or a dead-letter queue, for pipelines that can't drop data.
+// HandleFailedWrite is called before ExecContext returns; when it returns
+// nil the caller gets a Result with unknown counts instead of the error.
+type LastResort interface {
+	HandleFailedWrite(ctx context.Context, write FailedWrite) error
+}
+
+// LastResortFunc adapts a function, e.g. a dead-letter callback, to LastResort
+type LastResortFunc func(ctx context.Context, write FailedWrite) error
+
+// HandleFailedWrite calls f
+func (f LastResortFunc) HandleFailedWrite(ctx context.Context, write FailedWrite) error {
+	return f(ctx, write)
+}
+
+// handOver passes a write that failed permanently to Config.LastResort and
+// returns what ExecContext returns. Writes the server rejected or that would
+// be rejected again, e.g. for their size, writes the caller cancelled and
+// writes replayed by a SpillFile keep their error.
+func (c *Conn) handOver(ctx context.Context, write FailedWrite) (driver.Result, error) {
+	if c.cfg.LastResort == nil || !lastResortApplies(ctx, write.Err) {
+		return nil, write.Err
+	}
+
+	write.Label = LabelFromContext(ctx)
+	write.MaybeApplied = maybeDelivered(write.Err)
+	write.FailedAt = time.Now()
+	// The caller's deadline may be what ended the retries
+	if err := c.cfg.LastResort.HandleFailedWrite(context.WithoutCancel(ctx), write); err != nil {
+		return nil, fmt.Errorf("%w; last-resort handler failed: %v", write.Err, err)
+	}
+	return &Result{unknown: &ResultUnknownError{Reason: "write handed to the last-resort handler"}}, nil
+}
+
+// lastResortApplies reports whether a failed write goes to the last-resort
+// handler
+func lastResortApplies(ctx context.Context, err error) bool {
+	var stmtErr *statementError
+	var tooLarge *RequestTooLargeError
+	if errors.As(err, &stmtErr) || errors.As(err, &tooLarge) || replaying(ctx) {
+		return false
+	}
+	return !errors.Is(ctx.Err(), context.Canceled)
+}
@@ -2,13 +2,17 @@ package rsqlite
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/rqlite/gorqlite"
+	"github.com/zhenruyan/rsqlite/internal/transport"
 )
 
 // LeaderInfo holds information about the current leader
@@ -18,11 +22,10 @@ type LeaderInfo struct {
 }
 
 // NodeStatus represents the status of a node
-type NodeStatus struct {
-	Addr      string `json:"addr"`
-	Leader    bool   `json:"leader"`
-	Reachable bool   `json:"reachable"`
-}
+type NodeStatus = transport.NodeStatus
+
+// waitForIndexInterval is how often WaitForIndex polls a node's applied index
+const waitForIndexInterval = 50 * time.Millisecond
 
 // ClusterManager manages cluster discovery and leader selection
 type ClusterManager struct {
@@ -33,90 +36,310 @@ type ClusterManager struct {
 	lastUpdate     time.Time
 	updateInterval time.Duration
 	client         *http.Client
+	listeners      []func(oldLeader, newLeader string)
+	// header identifies and authenticates control requests
+	header         transport.Header
+	readPreference string
+	// nextFollower is the turn of the round_robin read preference
+	nextFollower atomic.Uint64
+	// discovering is closed when the discovery in flight ends, nil if none is
+	discovering chan struct{}
+	// defaultScheme is given to discovered nodes that match no configured node
+	defaultScheme string
+	// apiPortOffset maps raft ports to API ports for discovered nodes that
+	// /nodes doesn't list, see Config.APIPortOffset
+	apiPortOffset int
+
+	healthMu  sync.Mutex
+	healthTTL time.Duration
+	health    map[string]healthEntry
+	// downTTL is how long a failed health check or request first keeps a
+	// node out of node selection; repeated failures double it up to
+	// maxQuarantine
+	downTTL       time.Duration
+	maxQuarantine time.Duration
+	// scores are the moving averages of each node's round-trips and errors
+	scores map[string]*nodeStats
+	// applied caches the raft index each node last reported applied, see
+	// Config.ReadYourWrites
+	applied map[string]uint64
+
+	// observer is told about every control request, nil if unobserved
+	observer func(ctx context.Context, event ControlEvent)
+
+	// clock and rand drive expiry and random node selection, see SetClock
+	// and SetRand
+	clock Clock
+	rand  Rand
+	// retry is the retry policy of discovery, none without a configuration
+	retry transport.Retry
+}
+
+// healthEntry is a cached health check result
+type healthEntry struct {
+	err       error
+	checkedAt time.Time
+	// failures counts the consecutive failures, and until ends the
+	// quarantine of a failed node
+	failures int
+	until    time.Time
+}
+
+// validReadPreferences lists the node choices for reads below strong consistency
+var validReadPreferences = map[string]bool{
+	"":            true,
+	"leader":      true,
+	"follower":    true,
+	"round_robin": true,
+	"random":      true,
+	"nearest":     true,
 }
 
+// defaultHealthTTL is how long health check results are reused by default
+const defaultHealthTTL = 2 * time.Second
+
+// defaultDownTTL is how long a node that failed is skipped by node selection
+const defaultDownTTL = 5 * time.Second
+
 // NewClusterManager creates a new cluster manager
 func NewClusterManager(nodes []string) *ClusterManager {
 	return &ClusterManager{
 		nodes:          nodes,
 		updateInterval: 30 * time.Second,
 		client:         &http.Client{Timeout: 10 * time.Second},
+		healthTTL:      defaultHealthTTL,
+		downTTL:        defaultDownTTL,
+		clock:          transport.SystemClock{},
+		rand:           transport.SystemRand{},
 	}
 }
 
-// DiscoverLeader discovers the current leader and peers
-func (cm *ClusterManager) DiscoverLeader(ctx context.Context) error {
+// newClusterManagerForConfig creates a cluster manager that applies the
+// request settings of the given configuration
+func newClusterManagerForConfig(cfg *Config) *ClusterManager {
+	cm := NewClusterManager(cfg.Nodes)
+	cm.client = newHTTPClient(cfg, cm.client.Timeout)
+	cm.header = transport.Header{AppName: cfg.AppName, Username: cfg.Username, Password: cfg.Password}
+	cm.readPreference = cfg.ReadPreference
+	cm.defaultScheme = cfg.DefaultScheme
+	cm.apiPortOffset = cfg.APIPortOffset
+	cm.maxQuarantine = cfg.MaxQuarantine
+	cm.SetClock(cfg.Clock)
+	cm.SetRand(cfg.Rand)
+	cm.retry = retryPolicyFor(cfg)
+	return cm
+}
+
+// SetReadPreference sets which node SelectBestNode picks for weak and none
+// reads: "leader" (the default), "follower", "round_robin", "random" or
+// "nearest"
+func (cm *ClusterManager) SetReadPreference(preference string) error {
+	if !validReadPreferences[preference] {
+		return fmt.Errorf("unknown read preference %q: use leader, follower, round_robin, random or nearest", preference)
+	}
+
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
+	cm.readPreference = preference
+	return nil
+}
 
-	// If we recently updated, skip
-	if time.Since(cm.lastUpdate) < cm.updateInterval {
-		return nil
+// DiscoverLeader discovers the current leader and peers, retrying under the
+// retry policy of the configuration when no node answers. The lock is not
+// held during the status requests, so GetLeader and SelectBestNode keep
+// answering from the previous discovery; concurrent callers wait for the
+// discovery in flight instead of starting their own. Cancelling ctx stops
+// waiting and querying further nodes.
+func (cm *ClusterManager) DiscoverLeader(ctx context.Context) error {
+	policy := cm.retry
+	policy.Clock, policy.Rand = cm.clock, cm.rand
+	return policy.Do(ctx, func() error { return cm.discoverLeaderOnce(ctx) }, retryableError, nil)
+}
+
+// discoverLeaderOnce asks each node for the leader once
+func (cm *ClusterManager) discoverLeaderOnce(ctx context.Context) error {
+	for {
+		cm.mu.Lock()
+		// If we recently updated, skip
+		if cm.clock.Now().Sub(cm.lastUpdate) < cm.updateInterval {
+			cm.mu.Unlock()
+			return nil
+		}
+
+		inFlight := cm.discovering
+		if inFlight == nil {
+			cm.discovering = make(chan struct{})
+			cm.mu.Unlock()
+			break
+		}
+		cm.mu.Unlock()
+
+		// Check again once the other discovery is done; if it failed, this
+		// caller tries itself
+		select {
+		case <-inFlight:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
+	defer func() {
+		cm.mu.Lock()
+		close(cm.discovering)
+		cm.discovering = nil
+		cm.mu.Unlock()
+	}()
+
 	var lastErr error
 	for _, node := range cm.nodes {
-		leader, peers, err := cm.queryNodeStatus(ctx, node)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		leader, peers, err := cm.discoverFromNodes(ctx, node)
+		if err != nil && ctx.Err() == nil {
+			// Servers without /nodes?ver=2 still report the cluster in /status
+			leader, peers, err = cm.discoverFromStatus(ctx, node)
+		}
 		if err != nil {
 			lastErr = err
 			continue
 		}
 
+		cm.mu.Lock()
+		oldLeader := cm.leader
 		cm.leader = leader
 		cm.peers = peers
-		cm.lastUpdate = time.Now()
+		cm.lastUpdate = cm.clock.Now()
+		listeners := cm.listeners
+		cm.mu.Unlock()
+
+		if oldLeader != "" && oldLeader != leader {
+			for _, fn := range listeners {
+				fn(oldLeader, leader)
+			}
+		}
 		return nil
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return fmt.Errorf("failed to discover leader from any node: %w", lastErr)
 }
 
-// queryNodeStatus queries a node for its status
-func (cm *ClusterManager) queryNodeStatus(ctx context.Context, node string) (string, []string, error) {
-	statusURL := fmt.Sprintf("%s/status", node)
+// noteLeader records the leader a follower redirected a statement to,
+// notifying the leader change listeners, without rediscovering the cluster
+func (cm *ClusterManager) noteLeader(leader string) {
+	cm.mu.Lock()
+	oldLeader := cm.leader
+	if transport.NormalizeNode(oldLeader) == transport.NormalizeNode(leader) {
+		cm.mu.Unlock()
+		return
+	}
+	cm.leader = leader
+	listeners := cm.listeners
+	cm.mu.Unlock()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", statusURL, nil)
-	if err != nil {
-		return "", nil, err
+	if oldLeader != "" {
+		for _, fn := range listeners {
+			fn(oldLeader, leader)
+		}
+	}
+}
+
+// observe reports a finished control request to the observer
+func (cm *ClusterManager) observe(ctx context.Context, kind ControlKind, node string, start time.Time, err error) {
+	if cm.observer != nil {
+		cm.observer(ctx, ControlEvent{Kind: kind, Node: node, Duration: time.Since(start), Err: err})
 	}
+}
 
-	resp, err := cm.client.Do(req)
+// discoverFromNodes returns the API addresses of the leader and the
+// reachable peers listed by the /nodes endpoint of node
+func (cm *ClusterManager) discoverFromNodes(ctx context.Context, node string) (string, []string, error) {
+	nodes, err := cm.queryNodes(ctx, node)
 	if err != nil {
 		return "", nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", nil, fmt.Errorf("status request failed: %d", resp.StatusCode)
+	var leader string
+	var peers []string
+	for _, n := range nodes {
+		addr := n.APIAddr
+		if addr == "" {
+			addr = shiftPort(n.Addr, cm.apiPortOffset)
+		}
+		addr = cm.resolveNode(addr)
+
+		switch {
+		case n.Leader:
+			leader = addr
+		case n.Reachable && addr != "":
+			peers = append(peers, addr)
+		}
+	}
+
+	if leader == "" {
+		return "", nil, errors.New("no leader in nodes listing")
 	}
+	return leader, peers, nil
+}
 
-	var status map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+// discoverFromStatus returns the API addresses of the leader and peers
+// reported by the /status endpoint of node
+func (cm *ClusterManager) discoverFromStatus(ctx context.Context, node string) (string, []string, error) {
+	leader, peers, err := cm.queryNodeStatus(ctx, node)
+	if err != nil {
 		return "", nil, err
 	}
 
-	// Extract cluster info from status
-	cluster, ok := status["cluster"].(map[string]interface{})
-	if !ok {
-		return "", nil, fmt.Errorf("invalid cluster info in status")
+	// Status reports raft addresses; map them to API addresses
+	addrs := cm.apiAddresses(ctx, node, append([]string{leader}, peers...))
+	resolved := make([]string, len(peers))
+	for i, peer := range addrs[1:] {
+		resolved[i] = cm.resolveNode(peer)
 	}
+	return cm.resolveNode(addrs[0]), resolved, nil
+}
 
-	leader, _ := cluster["leader"].(string)
-	if leader == "" {
-		return "", nil, fmt.Errorf("no leader found")
+// queryNodeStatus queries a node for its status
+func (cm *ClusterManager) queryNodeStatus(ctx context.Context, node string) (_ string, _ []string, err error) {
+	start := time.Now()
+	defer func() { cm.observe(ctx, ControlDiscovery, node, start, err) }()
+
+	return transport.QueryCluster(ctx, cm.client, cm.header, node)
+}
+
+// resolveNode turns a node address reported by the cluster, which usually
+// has no scheme, into one the driver can reach. An address whose host
+// matches a configured node takes that node's scheme and base path, so
+// clusters mixing TLS and plain nodes are reached the way they were
+// configured; others get the default scheme.
+func (cm *ClusterManager) resolveNode(addr string) string {
+	if addr == "" || transport.HasScheme(addr) {
+		return addr
 	}
 
-	// Extract peers
-	var peers []string
-	if peerList, ok := cluster["peers"].([]interface{}); ok {
-		for _, peer := range peerList {
-			if peerStr, ok := peer.(string); ok {
-				peers = append(peers, peerStr)
-			}
+	host := transport.NodeHost(addr)
+	for _, node := range cm.nodes {
+		if transport.NodeHost(node) == host {
+			return transport.NormalizeNode(node)
 		}
 	}
 
-	return leader, peers, nil
+	scheme := cm.defaultScheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return transport.NormalizeNode(scheme + "://" + addr)
+}
+
+// OnLeaderChange registers fn to be called whenever discovery observes a new leader
+func (cm *ClusterManager) OnLeaderChange(fn func(oldLeader, newLeader string)) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.listeners = append(cm.listeners, fn)
 }
 
 // GetLeader returns the current leader
@@ -154,53 +377,336 @@ func (cm *ClusterManager) GetAllNodes() []string {
 	return result
 }
 
-// SelectBestNode selects the best node to connect to based on consistency level
+// SelectBestNode selects the best node to connect to based on consistency
+// level. Strong and linearizable reads need the leader; weaker reads follow
+// the read preference. Nodes quarantined after a failed health check or
+// request, see Quarantined, are skipped in favor of the fastest healthy peer
+// or configured node, ranked by the round-trips and error rates of requests
+// and health checks, see Scores; "nearest" picks the best ranked node, so it
+// needs requests or CheckHealth to have run.
 func (cm *ClusterManager) SelectBestNode(consistencyLevel string) string {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
-	// For strong consistency, always use leader
-	if consistencyLevel == "strong" {
-		if cm.leader != "" {
-			return cm.leader
+	strong := consistencyLevel == "strong" || consistencyLevel == "linearizable"
+	if !strong {
+		if node := cm.preferredNodeLocked(); node != "" {
+			return node
 		}
 	}
 
-	// For weak/none consistency, we can use any node
-	// Prefer leader if available, otherwise use any peer
+	// Otherwise the leader, then the first peer or configured node not
+	// recently seen down. rqlite forwards requests to the leader, so while
+	// the leader can't be reached any other node serves even strong reads.
+	candidates := make([]string, 0, 1+len(cm.peers)+len(cm.nodes))
 	if cm.leader != "" {
-		return cm.leader
+		candidates = append(candidates, cm.leader)
 	}
+	candidates = append(candidates, cm.peers...)
+	candidates = append(candidates, cm.nodes...)
 
-	if len(cm.peers) > 0 {
-		return cm.peers[0]
+	if up := cm.healthyLocked(candidates); len(up) > 0 {
+		if cm.leader != "" && up[0] == cm.leader {
+			return up[0]
+		}
+		cm.healthMu.Lock()
+		defer cm.healthMu.Unlock()
+		return cm.fastestLocked(up)
 	}
 
-	// Fallback to original nodes
-	if len(cm.nodes) > 0 {
-		return cm.nodes[0]
+	// Every known node is down; keep to the same order
+	if len(candidates) > 0 {
+		return candidates[0]
 	}
+	return ""
+}
+
+// preferredNodeLocked picks a node according to the read preference, or ""
+// to fall back to the leader; cm.mu must be held
+func (cm *ClusterManager) preferredNodeLocked() string {
+	switch cm.readPreference {
+	case "follower":
+		if followers := cm.healthyLocked(cm.followersLocked()); len(followers) > 0 {
+			return followers[cm.rand.IntN(len(followers))]
+		}
+	case "round_robin":
+		return cm.nextFollowerLocked()
+	case "random":
+		nodes := cm.followersLocked()
+		if cm.leader != "" {
+			nodes = append(nodes, cm.leader)
+		}
+		if nodes = cm.healthyLocked(nodes); len(nodes) > 0 {
+			return nodes[cm.rand.IntN(len(nodes))]
+		}
+	case "nearest":
+		nodes := cm.followersLocked()
+		if cm.leader != "" {
+			nodes = append(nodes, cm.leader)
+		}
+
+		nodes = cm.healthyLocked(nodes)
 
+		cm.healthMu.Lock()
+		defer cm.healthMu.Unlock()
+		// Nodes never answering have an infinite score
+		if nearest := cm.fastestLocked(nodes); !math.IsInf(cm.scoreLocked(nearest), 1) {
+			return nearest
+		}
+	}
 	return ""
 }
 
-// IsLeaderHealthy checks if the current leader is healthy
+// healthyLocked drops the quarantined nodes
+func (cm *ClusterManager) healthyLocked(nodes []string) []string {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+
+	healthy := nodes[:0:0]
+	for _, node := range nodes {
+		if cm.downLocked(node) {
+			continue
+		}
+		healthy = append(healthy, node)
+	}
+	return healthy
+}
+
+// nextFollowerLocked returns the next healthy follower in turn, or "" if
+// none is healthy; cm.mu must be held
+func (cm *ClusterManager) nextFollowerLocked() string {
+	followers := cm.healthyLocked(cm.followersLocked())
+	if len(followers) == 0 {
+		return ""
+	}
+	turn := cm.nextFollower.Add(1) - 1
+	return followers[turn%uint64(len(followers))]
+}
+
+// selectFollower returns the follower the reads of a connection splitting
+// reads from writes go to: the one the read preference picks, or the next
+// healthy follower in turn when the preference is the leader. It returns
+// "" when no healthy follower is known.
+func (cm *ClusterManager) selectFollower() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	var node string
+	if cm.readPreference == "" || cm.readPreference == "leader" {
+		node = cm.nextFollowerLocked()
+	} else {
+		node = cm.preferredNodeLocked()
+	}
+	if node == "" || cm.leader != "" && transport.NormalizeNode(node) == transport.NormalizeNode(cm.leader) {
+		return ""
+	}
+	return node
+}
+
+// Followers returns the configured and discovered nodes other than the
+// current leader
+func (cm *ClusterManager) Followers() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.followersLocked()
+}
+
+// downLocked reports whether the node is quarantined after its last health
+// check or request failed; cm.healthMu must be held
+func (cm *ClusterManager) downLocked(node string) bool {
+	entry, ok := cm.health[transport.NormalizeNode(node)]
+	return ok && entry.err != nil && cm.clock.Now().Before(entry.until)
+}
+
+// isDown reports whether node is quarantined after failing
+func (cm *ClusterManager) isDown(node string) bool {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+	return cm.downLocked(node)
+}
+
+// markDown records that a request to the node failed to reach it, so node
+// selection skips it until its quarantine ends or a health check succeeds
+func (cm *ClusterManager) markDown(node string, err error) {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+	cm.failLocked(transport.NormalizeNode(node), err)
+}
+
+// nodeUnreachable reports whether err shows that a request didn't reach its
+// node or got no answer, as opposed to an error returned by the node
+func nodeUnreachable(err error) bool {
+	var urlErr *url.Error
+	var credErr *CredentialError
+	return errors.As(err, &urlErr) && !errors.As(err, &credErr)
+}
+
+// sentTo reports whether err is from a request sent to node
+func sentTo(err error, node string) bool {
+	var urlErr *url.Error
+	return node != "" && errors.As(err, &urlErr) && strings.HasPrefix(urlErr.URL, transport.NormalizeNode(node)+"/")
+}
+
+// followersLocked returns the configured nodes and the peers found by
+// discovery other than the leader, normalized and without duplicates, so a
+// single seed node still reaches every follower; cm.mu must be held
+func (cm *ClusterManager) followersLocked() []string {
+	leader := transport.NormalizeNode(cm.leader)
+	seen := map[string]bool{leader: true}
+	var followers []string
+	for _, nodes := range [][]string{cm.nodes, cm.peers} {
+		for _, node := range nodes {
+			node = transport.NormalizeNode(node)
+			if !seen[node] {
+				seen[node] = true
+				followers = append(followers, node)
+			}
+		}
+	}
+
+	return followers
+}
+
+// IsLeaderHealthy checks if the current leader is healthy.
+// Results are cached for the health TTL, see SetHealthTTL.
 func (cm *ClusterManager) IsLeaderHealthy(ctx context.Context) bool {
 	leader := cm.GetLeader()
 	if leader == "" {
 		return false
 	}
 
-	// Try to connect to leader
-	client, err := gorqlite.Open(leader)
+	return cm.checkNode(ctx, leader) == nil
+}
+
+// SetHealthTTL sets how long health check results are reused; 0 disables caching
+func (cm *ClusterManager) SetHealthTTL(ttl time.Duration) {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+	cm.healthTTL = ttl
+}
+
+// CheckHealth checks the configured nodes and the discovered leader
+// concurrently and returns the error of each node, nil for healthy ones.
+// Results are cached for the health TTL.
+func (cm *ClusterManager) CheckHealth(ctx context.Context) map[string]error {
+	cm.mu.RLock()
+	nodes := append([]string{}, cm.nodes...)
+	if cm.leader != "" {
+		nodes = append(nodes, cm.leader)
+	}
+	cm.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	results := make(map[string]error)
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		node = transport.NormalizeNode(node)
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			err := cm.checkNode(ctx, node)
+
+			resultsMu.Lock()
+			results[node] = err
+			resultsMu.Unlock()
+		}(node)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// checkNode runs SELECT 1 on a node, reusing a recent result when available
+func (cm *ClusterManager) checkNode(ctx context.Context, node string) error {
+	node = transport.NormalizeNode(node)
+
+	cm.healthMu.Lock()
+	ttl := cm.healthTTL
+	if entry, ok := cm.health[node]; ok && cm.clock.Now().Sub(entry.checkedAt) < ttl {
+		cm.healthMu.Unlock()
+		return entry.err
+	}
+	cm.healthMu.Unlock()
+
+	client := newAPIClient(node, cm.client, nil)
+	client.header = cm.header
+	start := time.Now()
+	_, err := client.query(ctx, "none", "SELECT 1", nil)
+	latency := time.Since(start)
+	cm.observe(ctx, ControlHealth, node, start, err)
+
+	// A cancelled caller says nothing about the node's health
+	if ctx.Err() != nil {
+		return err
+	}
+	cm.recordSample(node, latency, err)
+
+	cm.healthMu.Lock()
 	if err != nil {
-		return false
+		cm.failLocked(node, err)
+	} else {
+		if cm.health == nil {
+			cm.health = make(map[string]healthEntry)
+		}
+		cm.health[node] = healthEntry{checkedAt: cm.clock.Now()}
+	}
+	cm.healthMu.Unlock()
+
+	return err
+}
+
+// RaftStatus is the raft progress a node reports in /status
+type RaftStatus = transport.RaftStatus
+
+// AppliedIndex returns the raft index the given node has applied to its database
+func (cm *ClusterManager) AppliedIndex(ctx context.Context, node string) (uint64, error) {
+	status, err := cm.RaftStatus(ctx, node)
+	if err != nil {
+		return 0, err
 	}
-	defer client.Close()
+	return status.AppliedIndex, nil
+}
 
-	// Simple health check
-	_, err = client.QueryOneContext(ctx, "SELECT 1")
-	return err == nil
+// RaftStatus reads the raft progress of the given node
+func (cm *ClusterManager) RaftStatus(ctx context.Context, node string) (_ *RaftStatus, err error) {
+	start := time.Now()
+	defer func() { cm.observe(ctx, ControlStatus, node, start, err) }()
+
+	status, err := transport.QueryRaftStatus(ctx, cm.client, cm.header, node)
+	if err != nil {
+		return nil, err
+	}
+
+	cm.noteApplied(node, status.AppliedIndex)
+	return status, nil
+}
+
+// WaitForIndex blocks until the given node has applied at least the given raft index,
+// or the context is done
+func (cm *ClusterManager) WaitForIndex(ctx context.Context, node string, index uint64) error {
+	for {
+		applied, err := cm.AppliedIndex(ctx, node)
+		if err == nil && applied >= index {
+			return nil
+		}
+
+		timer := cm.clock.NewTimer(waitForIndexInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err != nil {
+				return fmt.Errorf("waiting for index %d on %s: %w (last error: %v)", index, node, ctx.Err(), err)
+			}
+			return fmt.Errorf("waiting for index %d on %s: %w (applied %d)", index, node, ctx.Err(), applied)
+		case <-timer.C():
+		}
+	}
 }
 
 // ForceRefresh forces a refresh of cluster information
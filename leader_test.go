@@ -0,0 +1,495 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// newTestClusterManager returns a cluster manager that has discovered leader
+// and peers, without any network access
+func newTestClusterManager(nodes []string, leader string, peers ...string) *ClusterManager {
+	cm := NewClusterManager(nodes)
+	cm.leader = leader
+	cm.peers = peers
+	cm.lastUpdate = time.Now()
+	return cm
+}
+
+// fakeClock is a Clock that only moves when advanced
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer is a timer of a fakeClock
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	c     chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.fireLocked()
+	return t
+}
+
+// Advance moves the clock forward and fires the timers that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fireLocked()
+}
+
+// Waiting returns the number of timers that haven't fired
+func (c *fakeClock) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (c *fakeClock) fireLocked() {
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestSelectBestNodeSkipsDownNodes(t *testing.T) {
+	const (
+		n1 = "http://n1:4001"
+		n2 = "http://n2:4001"
+		n3 = "http://n3:4001"
+	)
+	errDown := errors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		leader string
+		peers  []string
+		down   []string
+		want   string
+	}{
+		{"all up", n1, []string{n2, n3}, nil, n1},
+		{"leader down", n1, []string{n2, n3}, []string{n1}, n2},
+		{"leader and first peer down", n1, []string{n2, n3}, []string{n1, n2}, n3},
+		{"all down", n1, []string{n2, n3}, []string{n1, n2, n3}, n1},
+		{"no leader", "", nil, nil, n1},
+		{"no leader, first node down", "", nil, []string{n1}, n2},
+		{"no leader, all down", "", nil, []string{n1, n2, n3}, n1},
+	}
+
+	for _, level := range []string{"none", "weak", "strong", "linearizable", "auto"} {
+		for _, tt := range tests {
+			t.Run(level+"/"+tt.name, func(t *testing.T) {
+				cm := newTestClusterManager([]string{n1, n2, n3}, tt.leader, tt.peers...)
+				for _, node := range tt.down {
+					cm.markDown(node, errDown)
+				}
+
+				// Repeated selections agree, so fallback is deterministic
+				for i := 0; i < 3; i++ {
+					if got := cm.SelectBestNode(level); got != tt.want {
+						t.Fatalf("SelectBestNode(%q) = %q, want %q", level, got, tt.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSelectBestNodeDownExpires(t *testing.T) {
+	const leader, peer = "http://n1:4001", "http://n2:4001"
+
+	clock := newFakeClock()
+	cm := newTestClusterManager([]string{leader, peer}, leader, peer)
+	cm.SetClock(clock)
+	cm.lastUpdate = clock.Now()
+	cm.markDown(leader, errors.New("timeout"))
+
+	if got := cm.SelectBestNode("strong"); got != peer {
+		t.Fatalf("got %q while the leader is down, want %q", got, peer)
+	}
+
+	clock.Advance(cm.downTTL)
+	if got := cm.SelectBestNode("strong"); got != leader {
+		t.Fatalf("got %q after the down TTL, want the leader %q", got, leader)
+	}
+}
+
+func TestSelectBestNodeRecoveredByHealthCheck(t *testing.T) {
+	const leader, peer = "http://n1:4001", "http://n2:4001"
+
+	cm := newTestClusterManager([]string{leader, peer}, leader, peer)
+	cm.markDown(leader, errors.New("connection refused"))
+
+	// A successful health check replaces the failure
+	cm.healthMu.Lock()
+	cm.health[leader] = healthEntry{checkedAt: time.Now()}
+	cm.healthMu.Unlock()
+
+	if got := cm.SelectBestNode("weak"); got != leader {
+		t.Fatalf("got %q, want the recovered leader %q", got, leader)
+	}
+}
+
+func TestSelectBestNodeFollowerPreferenceSkipsDown(t *testing.T) {
+	const (
+		n1 = "http://n1:4001"
+		n2 = "http://n2:4001"
+		n3 = "http://n3:4001"
+	)
+
+	cm := newTestClusterManager([]string{n1, n2, n3}, n1, n2, n3)
+	cm.readPreference = "follower"
+	cm.markDown(n2, errors.New("connection refused"))
+
+	for i := 0; i < 10; i++ {
+		if got := cm.SelectBestNode("none"); got != n3 {
+			t.Fatalf("got %q, want the only reachable follower %q", got, n3)
+		}
+	}
+
+	// Strong reads ignore the read preference
+	if got := cm.SelectBestNode("strong"); got != n1 {
+		t.Fatalf("strong read got %q, want the leader %q", got, n1)
+	}
+}
+
+func TestSelectBestNodePrefersFastHealthyNodes(t *testing.T) {
+	const (
+		n1 = "http://n1:4001"
+		n2 = "http://n2:4001"
+		n3 = "http://n3:4001"
+	)
+	errFailed := errors.New("503 Service Unavailable")
+
+	cm := newTestClusterManager([]string{n1, n2, n3}, n1, n2, n3)
+	cm.recordSample(n2, 20*time.Millisecond, nil)
+	cm.recordSample(n3, 5*time.Millisecond, nil)
+
+	if got := cm.SelectBestNode("strong"); got != n1 {
+		t.Fatalf("got %q, want the healthy leader %q", got, n1)
+	}
+
+	// While the leader is down, the fastest peer takes over
+	cm.markDown(n1, errors.New("connection refused"))
+	if got := cm.SelectBestNode("strong"); got != n3 {
+		t.Fatalf("got %q with the leader down, want the fastest peer %q", got, n3)
+	}
+
+	// Errors demote the fast peer below the slow one
+	for i := 0; i < 5; i++ {
+		cm.recordSample(n3, 5*time.Millisecond, errFailed)
+	}
+	if got := cm.SelectBestNode("strong"); got != n2 {
+		t.Fatalf("got %q, want the reliable peer %q", got, n2)
+	}
+
+	scores := cm.Scores()
+	if len(scores) != 2 || scores[0].Node != n2 || scores[1].Node != n3 {
+		t.Fatalf("unexpected ranking: %+v", scores)
+	}
+	if scores[1].ErrorRate <= 0.5 || scores[1].Samples != 6 {
+		t.Errorf("unexpected failing node score: %+v", scores[1])
+	}
+}
+
+func TestSelectBestNodeNearestUsesScores(t *testing.T) {
+	const (
+		n1 = "http://n1:4001"
+		n2 = "http://n2:4001"
+		n3 = "http://n3:4001"
+	)
+
+	cm := newTestClusterManager([]string{n1, n2, n3}, n1, n2, n3)
+	cm.readPreference = "nearest"
+
+	// Without samples reads stay on the leader
+	if got := cm.SelectBestNode("none"); got != n1 {
+		t.Fatalf("got %q without samples, want the leader %q", got, n1)
+	}
+
+	cm.recordSample(n1, 20*time.Millisecond, nil)
+	cm.recordSample(n2, 2*time.Millisecond, nil)
+	cm.recordSample(n3, 10*time.Millisecond, nil)
+	if got := cm.SelectBestNode("none"); got != n2 {
+		t.Fatalf("got %q, want the nearest node %q", got, n2)
+	}
+
+	cm.markDown(n2, errors.New("connection refused"))
+	if got := cm.SelectBestNode("none"); got != n3 {
+		t.Fatalf("got %q with the nearest node down, want %q", got, n3)
+	}
+}
+
+func TestSelectBestNodeRoundRobin(t *testing.T) {
+	const (
+		n1 = "http://n1:4001"
+		n2 = "http://n2:4001"
+		n3 = "http://n3:4001"
+	)
+
+	cm := newTestClusterManager([]string{n1, n2, n3}, n1, n2, n3)
+	cm.readPreference = "round_robin"
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, cm.SelectBestNode("weak"))
+	}
+	if want := []string{n2, n3, n2, n3}; !equalStrings(got, want) {
+		t.Fatalf("got %v, want the followers in turn %v", got, want)
+	}
+
+	// Strong reads stay on the leader
+	if got := cm.SelectBestNode("strong"); got != n1 {
+		t.Errorf("got %q for a strong read, want the leader %q", got, n1)
+	}
+
+	cm.markDown(n2, errors.New("connection refused"))
+	cm.markDown(n3, errors.New("connection refused"))
+	if got := cm.SelectBestNode("weak"); got != n1 {
+		t.Errorf("got %q with every follower down, want the leader %q", got, n1)
+	}
+}
+
+func TestQuarantineBacksOff(t *testing.T) {
+	const leader, peer = "http://n1:4001", "http://n2:4001"
+	errDown := errors.New("connection refused")
+
+	clock := newFakeClock()
+	cm := newTestClusterManager([]string{leader, peer}, leader, peer)
+	cm.SetClock(clock)
+	cm.lastUpdate = clock.Now()
+	cm.downTTL = 20 * time.Second
+	cm.SetMaxQuarantine(50 * time.Second)
+
+	quarantine := func() time.Duration {
+		t.Helper()
+		nodes := cm.Quarantined()
+		if len(nodes) != 1 || nodes[0].Node != leader {
+			t.Fatalf("quarantined: got %+v, want the leader only", nodes)
+		}
+		return nodes[0].Until.Sub(clock.Now())
+	}
+
+	cm.markDown(leader, errDown)
+	first := quarantine()
+	if first != cm.downTTL {
+		t.Fatalf("first quarantine %s, want %s", first, cm.downTTL)
+	}
+
+	// Failures of requests in flight don't extend the quarantine
+	clock.Advance(time.Second)
+	cm.markDown(leader, errDown)
+	if got := quarantine(); got != first-time.Second {
+		t.Fatalf("quarantine extended to %s during the quarantine", got)
+	}
+
+	// A failed re-probe doubles it, up to the maximum
+	clock.Advance(first)
+	cm.markDown(leader, errDown)
+	if got := quarantine(); got != 2*cm.downTTL {
+		t.Fatalf("second quarantine %s, want %s", got, 2*cm.downTTL)
+	}
+	if got := cm.SelectBestNode("strong"); got != peer {
+		t.Fatalf("got %q, want %q while the leader is quarantined", got, peer)
+	}
+	if got := cm.quarantinedLast([]string{leader, peer}); got[0] != peer || got[1] != leader {
+		t.Fatalf("connection order %v, want the quarantined leader last", got)
+	}
+
+	clock.Advance(2 * cm.downTTL)
+	cm.markDown(leader, errDown)
+	if got := quarantine(); got != 50*time.Second {
+		t.Fatalf("third quarantine %s, want the 50s maximum", got)
+	}
+
+	// A successful request rehabilitates the node
+	cm.recordSample(leader, time.Millisecond, nil)
+	if nodes := cm.Quarantined(); len(nodes) != 0 {
+		t.Fatalf("quarantined after a success: %+v", nodes)
+	}
+	if got := cm.SelectBestNode("strong"); got != leader {
+		t.Fatalf("got %q, want the rehabilitated leader %q", got, leader)
+	}
+}
+
+func TestRetryBackoffUsesClock(t *testing.T) {
+	clock := newFakeClock()
+	policy := transport.Retry{MaxRetries: 3, Backoff: time.Minute, Multiplier: 2, Clock: clock}
+
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- policy.Do(context.Background(), func() error {
+			attempts++
+			return errors.New("unavailable")
+		}, func(error) bool { return true }, func() error { return nil })
+	}()
+
+	// Each retry waits for the clock: 1m, then 2m, then 4m
+	for _, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		for clock.Waiting() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(backoff - time.Second)
+		if clock.Waiting() != 1 {
+			t.Fatalf("retry ran before its %s backoff", backoff)
+		}
+		clock.Advance(time.Second)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil || attempts != 4 {
+			t.Fatalf("got %v after %d attempts, want the error after 4", err, attempts)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retries didn't finish")
+	}
+}
+
+func TestRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transport", &url.Error{Op: "Post", URL: "http://n1:4001/db/execute", Err: io.EOF}, true},
+		{"redirect", &NotLeaderError{Node: "http://n2:4001", Leader: "http://n1:4001"}, true},
+		{"no leader", &transport.StatusError{Path: "/db/execute", Code: http.StatusServiceUnavailable, Body: "leader not found"}, true},
+		{"leadership lost", &transport.RequestError{Msg: "leadership lost while committing log"}, true},
+		{"constraint", &statementError{msg: "UNIQUE constraint failed: t.id"}, false},
+		{"bad request", &transport.StatusError{Path: "/db/execute", Code: http.StatusBadRequest}, false},
+		{"too large", &RequestTooLargeError{Size: 10, Limit: 5}, false},
+		{"credentials", &url.Error{Op: "Post", URL: "http://n1:4001/db/execute", Err: &CredentialError{Err: errors.New("expired")}}, false},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableError(tt.err); got != tt.want {
+				t.Errorf("retryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// fixedRand always draws the same fraction of its range
+type fixedRand float64
+
+func (r fixedRand) IntN(n int) int {
+	return int(float64(r) * float64(n-1))
+}
+
+func (r fixedRand) Int64N(n int64) int64 {
+	return int64(float64(r) * float64(n-1))
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Retry = &RetryPolicy{MaxRetries: 3, InitialInterval: time.Second, Multiplier: 3, Jitter: 0.5}
+	if err := cfg.Retry.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		draw fixedRand
+		want []time.Duration
+	}{
+		{0, []time.Duration{500 * time.Millisecond, 1500 * time.Millisecond, 4500 * time.Millisecond}},
+		{0.5, []time.Duration{time.Second, 3 * time.Second, 9 * time.Second}},
+		{1, []time.Duration{1500 * time.Millisecond, 4500 * time.Millisecond, 13500 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		cfg.Rand = tt.draw
+		policy := retryPolicyFor(cfg)
+		delay := policy.Backoff
+		for i, want := range tt.want {
+			if got := policy.Wait(delay); got != want {
+				t.Errorf("draw %g, retry %d: waited %s, want %s", tt.draw, i+1, got, want)
+			}
+			delay = policy.Next(delay)
+		}
+	}
+
+	cfg.Retry.Jitter = 1.5
+	if err := cfg.Retry.Validate(); err == nil {
+		t.Error("jitter above 1 accepted")
+	}
+}
+
+func TestSelectBestNodeRoundRobinOverDiscoveredPeers(t *testing.T) {
+	const (
+		n1 = "http://n1:4001"
+		n2 = "http://n2:4001"
+		n3 = "http://n3:4001"
+		n4 = "http://n4:4001"
+	)
+
+	// A single seed that discovered the rest of the cluster
+	cm := newTestClusterManager([]string{n1}, n1, n2, n3, n4)
+	cm.readPreference = "round_robin"
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, cm.SelectBestNode("weak"))
+	}
+	if want := []string{n2, n3, n4, n2, n3, n4}; !equalStrings(got, want) {
+		t.Fatalf("got %v, want the discovered followers in turn %v", got, want)
+	}
+
+	// Connections splitting reads rotate over them too
+	got = got[:0]
+	cm.readPreference = "leader"
+	for i := 0; i < 3; i++ {
+		got = append(got, cm.selectFollower())
+	}
+	if want := []string{n2, n3, n4}; !equalStrings(got, want) {
+		t.Errorf("read clients on %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package rsqlite
+
+import (
+	"strconv"
+	"strings"
+)
+
+// applyInteractiveLimit appends "LIMIT n" to SELECT statements that have no
+// top-level LIMIT clause. Other statements are returned unchanged.
+func applyInteractiveLimit(query string, limit int) string {
+	if limit <= 0 {
+		return query
+	}
+
+	fp := Fingerprint(query)
+	if statementKeyword(fp) != "select" {
+		return query
+	}
+	if hasTopLevelLimit(fp) {
+		return query
+	}
+
+	trimmed := strings.TrimRight(strings.TrimSpace(query), ";")
+	// A newline keeps the clause out of any trailing line comment
+	return trimmed + "\nLIMIT " + strconv.Itoa(limit)
+}
+
+// applyMaxRowsLimit caps SELECT statements that have no top-level LIMIT
+// clause at one row more than maxRows, enough to detect an oversized result
+func applyMaxRowsLimit(query string, maxRows int) string {
+	if maxRows <= 0 {
+		return query
+	}
+	return applyInteractiveLimit(query, maxRows+1)
+}
+
+// statementKeyword returns the first keyword of the statement a fingerprint
+// runs, looking past the common table expressions of a WITH clause, so that
+// "with x as (...) delete from t returning *" is a DELETE
+func statementKeyword(fp string) string {
+	tokens := strings.Fields(fp)
+	if len(tokens) == 0 {
+		return ""
+	}
+	if tokens[0] != "with" {
+		return tokens[0]
+	}
+
+	depth := 0
+	for _, tok := range tokens[1:] {
+		if depth == 0 {
+			switch tok {
+			case "select", "values", "insert", "replace", "update", "delete":
+				return tok
+			}
+		}
+		depth += strings.Count(tok, "(") - strings.Count(tok, ")")
+	}
+	return ""
+}
+
+// hasTopLevelLimit reports whether a fingerprinted statement has a LIMIT
+// clause outside of parentheses
+func hasTopLevelLimit(fp string) bool {
+	depth := 0
+	for _, tok := range strings.Fields(fp) {
+		depth += strings.Count(tok, "(") - strings.Count(tok, ")")
+		if depth == 0 && tok == "limit" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package rsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestApplyInteractiveLimit(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM t", "SELECT * FROM t\nLIMIT 10"},
+		{"SELECT * FROM t; ", "SELECT * FROM t\nLIMIT 10"},
+		{"SELECT * FROM t -- all rows", "SELECT * FROM t -- all rows\nLIMIT 10"},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", "WITH x AS (SELECT 1) SELECT * FROM x\nLIMIT 10"},
+		{"SELECT * FROM t LIMIT 5", "SELECT * FROM t LIMIT 5"},
+		{"select * from t limit 5 offset 10", "select * from t limit 5 offset 10"},
+		{"SELECT * FROM (SELECT * FROM t LIMIT 5)", "SELECT * FROM (SELECT * FROM t LIMIT 5)\nLIMIT 10"},
+		{"SELECT 'LIMIT 5' FROM t", "SELECT 'LIMIT 5' FROM t\nLIMIT 10"},
+		{"INSERT INTO t VALUES (1)", "INSERT INTO t VALUES (1)"},
+		{"UPDATE t SET x = 1", "UPDATE t SET x = 1"},
+		{"WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT i FROM n", "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT i FROM n\nLIMIT 10"},
+		{"WITH old AS (SELECT id FROM t WHERE x < 0) DELETE FROM t WHERE id IN old RETURNING id", "WITH old AS (SELECT id FROM t WHERE x < 0) DELETE FROM t WHERE id IN old RETURNING id"},
+		{"WITH a AS (SELECT 1), b AS MATERIALIZED (SELECT 2) INSERT INTO t SELECT * FROM a RETURNING *", "WITH a AS (SELECT 1), b AS MATERIALIZED (SELECT 2) INSERT INTO t SELECT * FROM a RETURNING *"},
+		{"WITH v AS (SELECT 1 AS x) UPDATE t SET x = (SELECT x FROM v) RETURNING x", "WITH v AS (SELECT 1 AS x) UPDATE t SET x = (SELECT x FROM v) RETURNING x"},
+	}
+	for _, tt := range tests {
+		if got := applyInteractiveLimit(tt.query, 10); got != tt.want {
+			t.Errorf("applyInteractiveLimit(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	if got := applyInteractiveLimit("SELECT * FROM t", 0); got != "SELECT * FROM t" {
+		t.Errorf("disabled limit rewrote the query to %q", got)
+	}
+
+	cte := "WITH old AS (SELECT id FROM t) DELETE FROM t WHERE id IN old RETURNING id"
+	if got := applyMaxRowsLimit(cte, 10); got != cte {
+		t.Errorf("applyMaxRowsLimit(%q) = %q", cte, got)
+	}
+	if got, want := applyMaxRowsLimit("WITH x AS (SELECT 1) SELECT * FROM x", 10), "WITH x AS (SELECT 1) SELECT * FROM x\nLIMIT 11"; got != want {
+		t.Errorf("applyMaxRowsLimit of a CTE select = %q, want %q", got, want)
+	}
+}
+
+func TestInteractiveLimitSentToServer(t *testing.T) {
+	// The server records every query that isn't a connection probe
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/db/") {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		json.Unmarshal(body, &statements)
+		if query, _ := statements[0][0].(string); query != "SELECT 1" {
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"results": [{"columns": ["id", "name"], "types": ["integer", "text"], "values": [[1, "a"]]}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.InteractiveLimit = 100
+
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	for _, query := range []string{"SELECT id, name FROM users", "SELECT id, name FROM users LIMIT 1"} {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"SELECT id, name FROM users\nLIMIT 100", "SELECT id, name FROM users LIMIT 1"}
+	if !equalStrings(queries, want) {
+		t.Errorf("server ran %q, want %q", queries, want)
+	}
+}
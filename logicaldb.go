@@ -0,0 +1,123 @@
+package rsqlite
+
+import (
+	"strings"
+)
+
+// rewriteDatabases maps "db.table" references of the logical databases in
+// prefixes to the prefixed table "<prefix>table", leaving string literals,
+// comments and other qualifiers alone. Qualifiers are matched case-insensitively,
+// so table aliases must not share a name with a logical database.
+func rewriteDatabases(query string, prefixes map[string]string) string {
+	if len(prefixes) == 0 || !strings.Contains(query, ".") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+
+	i := 0
+	for i < len(query) {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			end := skipQuoted(query, i, '\'')
+			b.WriteString(query[i:end])
+			i = end
+		case startsComment(query, i):
+			end := len(query)
+			if ch == '-' {
+				if n := strings.IndexByte(query[i:], '\n'); n >= 0 {
+					end = i + n
+				}
+			} else if n := strings.Index(query[i+2:], "*/"); n >= 0 {
+				end = i + 2 + n + 2
+			}
+			b.WriteString(query[i:end])
+			i = end
+		case ch == '"' || ch == '`' || ch == '[' || isIdentStart(ch):
+			nameEnd := skipIdent(query, i)
+			qualified := i == 0 || query[i-1] != '.'
+			if qualified && nameEnd+1 < len(query) && query[nameEnd] == '.' {
+				if prefix, ok := lookupDatabase(prefixes, unquoteIdent(query[i:nameEnd])); ok {
+					tableStart := nameEnd + 1
+					tableEnd := skipIdent(query, tableStart)
+					if tableEnd > tableStart {
+						b.WriteString(prefixIdent(query[tableStart:tableEnd], prefix))
+						i = tableEnd
+						continue
+					}
+				}
+			}
+			b.WriteString(query[i:nameEnd])
+			i = nameEnd
+		case isDigit(ch):
+			end := skipNumber(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		default:
+			b.WriteByte(ch)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// lookupDatabase returns the table prefix of a logical database
+func lookupDatabase(prefixes map[string]string, name string) (string, bool) {
+	if prefix, ok := prefixes[name]; ok {
+		return prefix, true
+	}
+	for db, prefix := range prefixes {
+		if strings.EqualFold(db, name) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// skipIdent returns the index just past the identifier starting at i,
+// or i when there is none
+func skipIdent(query string, i int) int {
+	if i >= len(query) {
+		return i
+	}
+
+	switch query[i] {
+	case '"':
+		return skipQuoted(query, i, '"')
+	case '`':
+		return skipQuoted(query, i, '`')
+	case '[':
+		return skipQuoted(query, i, ']')
+	}
+
+	if !isIdentStart(query[i]) {
+		return i
+	}
+	for i < len(query) && isIdentByte(query[i]) {
+		i++
+	}
+	return i
+}
+
+// isIdentStart reports whether ch can start an unquoted identifier
+func isIdentStart(ch byte) bool {
+	return isIdentByte(ch) && !isDigit(ch)
+}
+
+// prefixIdent prefixes an identifier, keeping its quoting style
+func prefixIdent(ident, prefix string) string {
+	if len(ident) >= 2 {
+		switch ident[0] {
+		case '"':
+			return `"` + strings.ReplaceAll(prefix, `"`, `""`) + ident[1:]
+		case '`':
+			return "`" + prefix + ident[1:]
+		case '[':
+			return "[" + prefix + ident[1:]
+		}
+	}
+	return prefix + ident
+}
@@ -0,0 +1,91 @@
+package rsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRewriteDatabases(t *testing.T) {
+	prefixes := map[string]string{"app": "app_", "Logs": "logs_"}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"SELECT * FROM app.users JOIN logs.events e ON e.user_id = app.users.id",
+			"SELECT * FROM app_users JOIN logs_events e ON e.user_id = app_users.id",
+		},
+		{
+			`SELECT * FROM "app"."users" WHERE name = 'app.users' -- app.x`,
+			`SELECT * FROM "app_users" WHERE name = 'app.users' -- app.x`,
+		},
+		{
+			"SELECT * FROM [app].[users], `app`.`t2` /* app.c */",
+			"SELECT * FROM [app_users], `app_t2` /* app.c */",
+		},
+		{
+			"SELECT main.t.x, other.t FROM other.t WHERE x = 1.5",
+			"SELECT main.t.x, other.t FROM other.t WHERE x = 1.5",
+		},
+		{"SELECT * FROM APP.users", "SELECT * FROM app_users"},
+	}
+	for _, tt := range tests {
+		if got := rewriteDatabases(tt.query, prefixes); got != tt.want {
+			t.Errorf("rewriteDatabases(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestLogicalDatabasesSentToServer(t *testing.T) {
+	// The server records every query that isn't a connection probe
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/db/") {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		json.Unmarshal(body, &statements)
+		if query, _ := statements[0][0].(string); query != "SELECT 1" {
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"results": [{"columns": ["id", "name"], "types": ["integer", "text"], "values": [[1, "a"]]}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://") + "?databases=app,logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, name FROM app.users WHERE id IN (SELECT user_id FROM logs.events)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"SELECT id, name FROM app_users WHERE id IN (SELECT user_id FROM logs_events)"}
+	if !equalStrings(queries, want) {
+		t.Errorf("server ran %q, want %q", queries, want)
+	}
+}
@@ -0,0 +1,50 @@
+package rsqlite
+
+import (
+	"container/list"
+)
+
+// defaultMaxStatementStats is the number of statements tracked when
+// Config.MaxStatementStats is unset
+const defaultMaxStatementStats = 1000
+
+// keyLRU orders keys by last use, so per-statement state can be capped by
+// evicting the least recently used statement. It is not safe for concurrent
+// use; callers hold the lock of the state it orders.
+type keyLRU struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+// touch marks key as the most recently used. When more than max keys are
+// tracked it removes the least recently used one and returns it.
+func (l *keyLRU) touch(key string, max int) (evicted string, ok bool) {
+	if l.order == nil {
+		l.order = list.New()
+		l.elements = make(map[string]*list.Element)
+	}
+
+	if e, found := l.elements[key]; found {
+		l.order.MoveToFront(e)
+		return "", false
+	}
+	l.elements[key] = l.order.PushFront(key)
+
+	if max <= 0 || l.order.Len() <= max {
+		return "", false
+	}
+	oldest := l.order.Back()
+	l.order.Remove(oldest)
+	evicted = oldest.Value.(string)
+	delete(l.elements, evicted)
+	return evicted, true
+}
+
+// maxStatementStats returns the number of statements per-statement state is
+// kept for
+func (cfg *Config) maxStatementStats() int {
+	if cfg.MaxStatementStats == 0 {
+		return defaultMaxStatementStats
+	}
+	return cfg.MaxStatementStats
+}
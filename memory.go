@@ -0,0 +1,88 @@
+package rsqlite
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryBudget is the soft cap on result memory of a Connector, see
+// Config.MaxResultMemory. A query is admitted while the memory in use is
+// below the limit, so the limit is exceeded by at most the results of the
+// queries admitted concurrently.
+type memoryBudget struct {
+	limit    int64
+	failFast bool
+
+	mu   sync.Mutex
+	used int64
+	// freed is closed and replaced whenever memory is released
+	freed chan struct{}
+}
+
+// newMemoryBudget returns the budget of the configuration, or nil without a limit
+func newMemoryBudget(cfg *Config) *memoryBudget {
+	if cfg.MaxResultMemory <= 0 {
+		return nil
+	}
+	return &memoryBudget{
+		limit:    cfg.MaxResultMemory,
+		failFast: cfg.ResultMemoryFailFast,
+		freed:    make(chan struct{}),
+	}
+}
+
+// memoryBudget returns the result memory budget of the connector, nil without a limit
+func (c *Connector) memoryBudget() *memoryBudget {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.memory
+}
+
+// admit waits until the memory in use is below the limit, or fails with a
+// *MemoryLimitError in fail-fast mode
+func (b *memoryBudget) admit(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		used, freed := b.used, b.freed
+		b.mu.Unlock()
+
+		if used < b.limit {
+			return nil
+		}
+		if b.failFast {
+			return &MemoryLimitError{Limit: b.limit, InUse: used}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+// charge adds the memory held by a result and returns the function that
+// releases it
+func (b *memoryBudget) charge(n int64) func() {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			b.used -= n
+			close(b.freed)
+			b.freed = make(chan struct{})
+			b.mu.Unlock()
+		})
+	}
+}
+
+// inUse returns the result memory currently held
+func (b *memoryBudget) inUse() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
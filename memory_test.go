@@ -0,0 +1,119 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudgetAdmit(t *testing.T) {
+	if newMemoryBudget(&Config{}) != nil {
+		t.Error("budget without a limit")
+	}
+
+	budget := newMemoryBudget(&Config{MaxResultMemory: 100})
+	ctx := context.Background()
+	if err := budget.admit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A query is admitted below the limit even if its result exceeds it
+	release := budget.charge(60)
+	if err := budget.admit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	releaseOther := budget.charge(60)
+	if used := budget.inUse(); used != 120 {
+		t.Errorf("%d bytes in use, want 120", used)
+	}
+
+	// At the limit queries wait until memory is released
+	admitted := make(chan error, 1)
+	go func() { admitted <- budget.admit(ctx) }()
+	select {
+	case err := <-admitted:
+		t.Fatalf("query admitted over the limit: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	// Releasing twice doesn't free memory still held
+	release()
+	if err := <-admitted; err != nil {
+		t.Fatal(err)
+	}
+	if used := budget.inUse(); used != 60 {
+		t.Errorf("%d bytes in use after release, want 60", used)
+	}
+
+	// A waiting query gives up with its context
+	budget.charge(40)
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := budget.admit(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("admit with an expired context = %v", err)
+	}
+	releaseOther()
+}
+
+func TestMemoryBudgetFailFast(t *testing.T) {
+	budget := newMemoryBudget(&Config{MaxResultMemory: 100, ResultMemoryFailFast: true})
+	release := budget.charge(150)
+
+	var limitErr *MemoryLimitError
+	if err := budget.admit(context.Background()); !errors.As(err, &limitErr) || limitErr.Limit != 100 || limitErr.InUse != 150 {
+		t.Fatalf("admit over the limit = %v", err)
+	}
+
+	release()
+	if err := budget.admit(context.Background()); err != nil {
+		t.Errorf("admit after release = %v", err)
+	}
+}
+
+func TestResultMemoryLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"columns": ["v"], "types": ["text"], "values": [["` +
+			"0123456789012345678901234567890123456789" + `"]]}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false&max_result_memory=50&result_memory_fail_fast=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	// Open rows hold their response until closed
+	rows, err := db.Query("SELECT v FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used := connector.Stats().ResultMemory; used < 50 {
+		t.Errorf("%d bytes of result memory in use with open rows", used)
+	}
+
+	var limitErr *MemoryLimitError
+	if _, err := db.Query("SELECT v FROM t"); !errors.As(err, &limitErr) {
+		t.Errorf("query over the limit = %v", err)
+	}
+
+	rows.Close()
+	if used := connector.Stats().ResultMemory; used != 0 {
+		t.Errorf("%d bytes of result memory in use after close", used)
+	}
+	rows, err = db.Query("SELECT v FROM t")
+	if err != nil {
+		t.Fatalf("query after close = %v", err)
+	}
+	rows.Close()
+}
@@ -0,0 +1,684 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// TableSchema describes a table and its indexes
+type TableSchema struct {
+	Name    string
+	Columns []ColumnSchema
+	Indexes []IndexSchema
+	// SQL is the CREATE TABLE statement when the schema was parsed from SQL
+	SQL string
+}
+
+// ColumnSchema describes a table column
+type ColumnSchema struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey bool
+	Unique     bool
+	// Default is the DEFAULT expression as written, empty for none
+	Default string
+	// definition is the column definition as written in the parsed SQL
+	definition string
+}
+
+// IndexSchema describes an index
+type IndexSchema struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	// SQL is the CREATE INDEX statement when the schema was parsed from SQL
+	SQL string
+}
+
+// MigrationPlan holds the statements a migration would run
+type MigrationPlan struct {
+	// Statements are the DDL statements to execute, in order
+	Statements []string
+	// Warnings describe differences the plan can't apply with ALTER TABLE,
+	// such as changed column types, which need a table rebuild
+	Warnings []string
+}
+
+// Introspect reads the tables and indexes of the cluster's database
+func (c *Connector) Introspect(ctx context.Context) ([]TableSchema, error) {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.query(ctx, "strong",
+		"SELECT sql FROM sqlite_master WHERE type IN ('table', 'index') AND sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type = 'table' DESC, rowid", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0, len(result.Values))
+	for _, row := range result.Values {
+		if len(row) > 0 {
+			if s, ok := row[0].(string); ok {
+				statements = append(statements, s)
+			}
+		}
+	}
+
+	return SchemaFromSQL(strings.Join(statements, ";\n"))
+}
+
+// PlanMigration compares the target schema with the cluster's database and
+// returns the CREATE TABLE, ALTER TABLE ADD COLUMN and CREATE INDEX statements
+// that would bring it up to date, without running them. Like ORM auto
+// migrations, it never drops tables or columns.
+func (c *Connector) PlanMigration(ctx context.Context, target ...TableSchema) (*MigrationPlan, error) {
+	current, err := c.Introspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return planMigration(current, target), nil
+}
+
+// planMigration computes the statements turning current into target
+func planMigration(current, target []TableSchema) *MigrationPlan {
+	existing := make(map[string]TableSchema, len(current))
+	for _, table := range current {
+		existing[strings.ToLower(table.Name)] = table
+	}
+
+	plan := &MigrationPlan{}
+	for _, table := range target {
+		have, ok := existing[strings.ToLower(table.Name)]
+		if !ok {
+			plan.Statements = append(plan.Statements, table.createSQL())
+			for _, index := range table.Indexes {
+				plan.Statements = append(plan.Statements, index.createSQL(table.Name))
+			}
+			continue
+		}
+
+		columns := make(map[string]ColumnSchema, len(have.Columns))
+		for _, column := range have.Columns {
+			columns[strings.ToLower(column.Name)] = column
+		}
+
+		for _, column := range table.Columns {
+			old, ok := columns[strings.ToLower(column.Name)]
+			if !ok {
+				if column.PrimaryKey || column.Unique || (column.NotNull && column.Default == "") {
+					plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+						"table %q: column %q can't be added with ALTER TABLE: PRIMARY KEY, UNIQUE or NOT NULL without DEFAULT", table.Name, column.Name))
+					continue
+				}
+				if !constantDefault(column.Default) {
+					plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+						"table %q: column %q can't be added with ALTER TABLE: DEFAULT %s isn't a constant", table.Name, column.Name, column.Default))
+					continue
+				}
+				plan.Statements = append(plan.Statements,
+					"ALTER TABLE "+quoteIdent(table.Name)+" ADD COLUMN "+column.definitionSQL())
+				continue
+			}
+
+			if !strings.EqualFold(old.Type, column.Type) {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+					"table %q: column %q type changes from %q to %q and needs a table rebuild", table.Name, column.Name, old.Type, column.Type))
+			}
+		}
+
+		indexes := make(map[string]IndexSchema, len(have.Indexes))
+		for _, index := range have.Indexes {
+			indexes[strings.ToLower(index.Name)] = index
+		}
+
+		for _, index := range table.Indexes {
+			old, ok := indexes[strings.ToLower(index.Name)]
+			if ok && old.equal(index) {
+				continue
+			}
+			if ok {
+				plan.Statements = append(plan.Statements, "DROP INDEX "+quoteIdent(index.Name))
+			}
+			plan.Statements = append(plan.Statements, index.createSQL(table.Name))
+		}
+	}
+
+	return plan
+}
+
+// constantDefault reports whether a DEFAULT expression is a constant, which
+// ALTER TABLE ADD COLUMN requires: not CURRENT_TIMESTAMP and friends, nor an
+// expression in parentheses
+func constantDefault(expr string) bool {
+	switch {
+	case expr == "":
+		return true
+	case isKeyword(expr, "null", "true", "false"):
+		return true
+	case expr[0] == '\'':
+		return true
+	case len(expr) > 1 && (expr[0] == 'x' || expr[0] == 'X') && expr[1] == '\'':
+		return true
+	}
+
+	number := strings.TrimLeft(expr, "+-")
+	if len(number) > 2 && strings.EqualFold(number[:2], "0x") {
+		_, err := strconv.ParseUint(number[2:], 16, 64)
+		return err == nil
+	}
+	if number == "" || !(number[0] == '.' || (number[0] >= '0' && number[0] <= '9')) {
+		return false
+	}
+	_, err := strconv.ParseFloat(number, 64)
+	return err == nil
+}
+
+// createSQL returns the CREATE TABLE statement of the table
+func (t TableSchema) createSQL() string {
+	if t.SQL != "" {
+		return t.SQL
+	}
+
+	defs := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		defs[i] = column.definitionSQL()
+	}
+	return "CREATE TABLE " + quoteIdent(t.Name) + " (" + strings.Join(defs, ", ") + ")"
+}
+
+// definitionSQL returns the column definition used in CREATE and ALTER TABLE
+func (c ColumnSchema) definitionSQL() string {
+	if c.definition != "" {
+		return c.definition
+	}
+
+	def := quoteIdent(c.Name)
+	if c.Type != "" {
+		def += " " + c.Type
+	}
+	if c.PrimaryKey {
+		def += " PRIMARY KEY"
+	}
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	if c.Unique {
+		def += " UNIQUE"
+	}
+	if c.Default != "" {
+		def += " DEFAULT " + c.Default
+	}
+	return def
+}
+
+// createSQL returns the CREATE INDEX statement of the index
+func (i IndexSchema) createSQL(table string) string {
+	if i.SQL != "" {
+		return i.SQL
+	}
+
+	columns := make([]string, len(i.Columns))
+	for n, column := range i.Columns {
+		columns[n] = quoteIdent(column)
+	}
+
+	create := "CREATE INDEX "
+	if i.Unique {
+		create = "CREATE UNIQUE INDEX "
+	}
+	return create + quoteIdent(i.Name) + " ON " + quoteIdent(table) + " (" + strings.Join(columns, ", ") + ")"
+}
+
+// equal reports whether two indexes cover the same columns the same way
+func (i IndexSchema) equal(other IndexSchema) bool {
+	if i.Unique != other.Unique || len(i.Columns) != len(other.Columns) {
+		return false
+	}
+	for n := range i.Columns {
+		if !strings.EqualFold(i.Columns[n], other.Columns[n]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SchemaFromSQL parses CREATE TABLE and CREATE INDEX statements into table
+// schemas. Other statements are ignored. It understands the common column
+// constraints, not the full SQLite grammar.
+func SchemaFromSQL(ddl string) ([]TableSchema, error) {
+	var tables []TableSchema
+	byName := make(map[string]int)
+
+	for _, statement := range splitTopLevel(ddl, ';') {
+		statement = strings.TrimSpace(statement)
+		tokens := ddlTokens(statement)
+		if len(tokens) < 3 || !strings.EqualFold(tokens[0], "create") {
+			continue
+		}
+
+		table, index, err := parseCreate(statement, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case table != nil:
+			byName[strings.ToLower(table.Name)] = len(tables)
+			tables = append(tables, *table)
+		case index != nil:
+			n, ok := byName[strings.ToLower(index.table)]
+			if !ok {
+				return nil, fmt.Errorf("index %q is on unknown table %q", index.Name, index.table)
+			}
+			tables[n].Indexes = append(tables[n].Indexes, index.IndexSchema)
+		}
+	}
+
+	return tables, nil
+}
+
+// parsedIndex is an index together with the table it belongs to
+type parsedIndex struct {
+	IndexSchema
+	table string
+}
+
+// parseCreate parses a CREATE TABLE or CREATE INDEX statement
+func parseCreate(statement string, tokens []string) (*TableSchema, *parsedIndex, error) {
+	i := 1
+	for i < len(tokens) && isKeyword(tokens[i], "temp", "temporary", "unique") {
+		i++
+	}
+	if i >= len(tokens) {
+		return nil, nil, nil
+	}
+
+	kind := strings.ToLower(tokens[i])
+	unique := isKeyword(tokens[i-1], "unique")
+	i++
+	for i < len(tokens) && isKeyword(tokens[i], "if", "not", "exists") {
+		i++
+	}
+	if i >= len(tokens) {
+		return nil, nil, fmt.Errorf("incomplete statement: %s", statement)
+	}
+	name := unquoteIdent(tokens[i])
+	i++
+
+	switch kind {
+	case "table":
+		if i >= len(tokens) || !strings.HasPrefix(tokens[i], "(") {
+			return nil, nil, fmt.Errorf("table %q: unsupported CREATE TABLE form", name)
+		}
+		table := &TableSchema{Name: name, SQL: statement}
+		for _, def := range splitTopLevel(strings.TrimSuffix(tokens[i][1:], ")"), ',') {
+			defTokens := ddlTokens(def)
+			if len(defTokens) == 0 || isKeyword(defTokens[0], "constraint", "primary", "unique", "check", "foreign") {
+				continue
+			}
+			table.Columns = append(table.Columns, parseColumn(strings.TrimSpace(def), defTokens))
+		}
+		return table, nil, nil
+
+	case "index":
+		if i+1 >= len(tokens) || !isKeyword(tokens[i], "on") {
+			return nil, nil, fmt.Errorf("index %q: missing ON clause", name)
+		}
+		index := &parsedIndex{
+			IndexSchema: IndexSchema{Name: name, Unique: unique, SQL: statement},
+			table:       unquoteIdent(tokens[i+1]),
+		}
+		if i+2 < len(tokens) {
+			for _, column := range splitTopLevel(strings.TrimSuffix(strings.TrimPrefix(tokens[i+2], "("), ")"), ',') {
+				if words := ddlTokens(column); len(words) > 0 {
+					index.Columns = append(index.Columns, unquoteIdent(words[0]))
+				}
+			}
+		}
+		return nil, index, nil
+	}
+
+	return nil, nil, nil
+}
+
+// parseColumn parses a column definition
+func parseColumn(def string, tokens []string) ColumnSchema {
+	column := ColumnSchema{Name: unquoteIdent(tokens[0]), definition: def}
+
+	i := 1
+	var typeWords []string
+	for i < len(tokens) && !isKeyword(tokens[i], "constraint", "primary", "not", "null", "unique",
+		"check", "default", "collate", "references", "generated", "as") {
+		typeWords = append(typeWords, tokens[i])
+		i++
+	}
+	column.Type = strings.ReplaceAll(strings.Join(typeWords, " "), " (", "(")
+
+	for ; i < len(tokens); i++ {
+		switch strings.ToLower(tokens[i]) {
+		case "primary":
+			column.PrimaryKey = true
+		case "not":
+			if i+1 < len(tokens) && isKeyword(tokens[i+1], "null") {
+				column.NotNull = true
+				i++
+			}
+		case "unique":
+			column.Unique = true
+		case "default":
+			if i+1 < len(tokens) {
+				column.Default = tokens[i+1]
+				i++
+			}
+		}
+	}
+
+	return column
+}
+
+// ddlTokens splits a statement into words. Quoted identifiers, strings and
+// parenthesized groups are kept whole, so "users(a, b)" is split into "users"
+// and "(a, b)".
+func ddlTokens(s string) []string {
+	var tokens []string
+	i := 0
+	for i < len(s) {
+		ch := s[i]
+		switch {
+		case isSpace(ch):
+			i++
+			continue
+		case ch == ',' || ch == ';':
+			tokens = append(tokens, s[i:i+1])
+			i++
+			continue
+		}
+
+		start := i
+	word:
+		for i < len(s) && !isSpace(s[i]) && s[i] != ',' && s[i] != ';' {
+			switch s[i] {
+			case '\'':
+				i = skipQuoted(s, i, '\'')
+			case '"':
+				i = skipQuoted(s, i, '"')
+			case '`':
+				i = skipQuoted(s, i, '`')
+			case '[':
+				i = skipQuoted(s, i, ']')
+			case '(':
+				if i > start {
+					break word
+				}
+				i = skipParens(s, i)
+				break word
+			default:
+				i++
+			}
+		}
+		tokens = append(tokens, s[start:i])
+	}
+	return tokens
+}
+
+// skipParens returns the index just past the parenthesized group starting at i
+func skipParens(s string, i int) int {
+	depth := 0
+	for i < len(s) {
+		switch s[i] {
+		case '(':
+			depth++
+			i++
+		case ')':
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		case '\'':
+			i = skipQuoted(s, i, '\'')
+		case '"':
+			i = skipQuoted(s, i, '"')
+		case '`':
+			i = skipQuoted(s, i, '`')
+		case '[':
+			i = skipQuoted(s, i, ']')
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// splitTopLevel splits s on sep outside quotes and parentheses
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	start, i := 0, 0
+	for i < len(s) {
+		switch s[i] {
+		case sep:
+			parts = append(parts, s[start:i])
+			i++
+			start = i
+		case '(':
+			i = skipParens(s, i)
+		case '\'':
+			i = skipQuoted(s, i, '\'')
+		case '"':
+			i = skipQuoted(s, i, '"')
+		case '`':
+			i = skipQuoted(s, i, '`')
+		case '[':
+			i = skipQuoted(s, i, ']')
+		default:
+			i++
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// isKeyword reports whether token is one of the keywords, ignoring case
+func isKeyword(token string, keywords ...string) bool {
+	for _, keyword := range keywords {
+		if strings.EqualFold(token, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// unquoteIdent strips identifier quotes and a schema prefix
+func unquoteIdent(name string) string {
+	if i := strings.IndexByte(name, '('); i > 0 {
+		name = name[:i]
+	}
+	// The schema prefix ends at the last dot outside quotes
+	for i := 0; i < len(name); {
+		switch name[i] {
+		case '"', '`', '\'':
+			i = skipQuoted(name, i, name[i])
+		case '[':
+			i = skipQuoted(name, i, ']')
+		case '.':
+			name = name[i+1:]
+			i = 0
+		default:
+			i++
+		}
+	}
+	if len(name) >= 2 {
+		switch {
+		case name[0] == '"' && name[len(name)-1] == '"':
+			return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+		case name[0] == '`' && name[len(name)-1] == '`':
+			return strings.ReplaceAll(name[1:len(name)-1], "``", "`")
+		case name[0] == '[' && name[len(name)-1] == ']':
+			return name[1 : len(name)-1]
+		case name[0] == '\'' && name[len(name)-1] == '\'':
+			return strings.ReplaceAll(name[1:len(name)-1], "''", "'")
+		}
+	}
+	return name
+}
+
+// SchemaFromStruct derives a table schema from the exported fields of a
+// struct. Column names come from the `db` tag, or the snake_cased field name;
+// "-" skips a field. Tag options after the name: pk, notnull, unique, index.
+// A field named ID becomes the INTEGER PRIMARY KEY when no pk is tagged. The
+// fields of embedded structs without a tagged name, such as gorm.Model, are
+// columns of the table.
+func SchemaFromStruct(table string, model interface{}) (TableSchema, error) {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return TableSchema{}, errors.New("model must be a struct or a pointer to a struct")
+	}
+
+	schema := TableSchema{Name: table}
+	hasPK := false
+	idColumn := -1
+
+	for _, field := range structFields(t, nil) {
+		tag := field.Tag.Get("db")
+		options := strings.Split(tag, ",")
+		name := options[0]
+		if name == "" {
+			name = snakeCase(field.Name)
+		}
+
+		column := ColumnSchema{Name: name, Type: sqliteType(field.Type)}
+		index := false
+		for _, option := range options[1:] {
+			switch option {
+			case "pk":
+				column.PrimaryKey = true
+				hasPK = true
+			case "notnull":
+				column.NotNull = true
+			case "unique":
+				column.Unique = true
+			case "index":
+				index = true
+			}
+		}
+
+		if field.Name == "ID" {
+			idColumn = len(schema.Columns)
+		}
+		schema.Columns = append(schema.Columns, column)
+
+		if index {
+			schema.Indexes = append(schema.Indexes, IndexSchema{
+				Name:    "idx_" + table + "_" + name,
+				Columns: []string{name},
+			})
+		}
+	}
+
+	if !hasPK && idColumn >= 0 {
+		schema.Columns[idColumn].PrimaryKey = true
+	}
+
+	sort.SliceStable(schema.Columns, func(i, j int) bool {
+		return schema.Columns[i].PrimaryKey && !schema.Columns[j].PrimaryKey
+	})
+
+	return schema, nil
+}
+
+// structFields returns the exported fields of a struct type, replacing
+// embedded structs without a tagged name by their own fields. Fields tagged
+// "-" are left out; visiting holds the embedded types being expanded, to stop
+// on recursive embedding.
+func structFields(t reflect.Type, visiting []reflect.Type) []reflect.StructField {
+	for _, v := range visiting {
+		if v == t {
+			return nil
+		}
+	}
+	visiting = append(visiting, t)
+
+	var fields []reflect.StructField
+	for n := 0; n < t.NumField(); n++ {
+		field := t.Field(n)
+		tag := field.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if embedded.Kind() == reflect.Struct && embedded != reflect.TypeOf(time.Time{}) && name == "" {
+				// The exported fields of an unexported embedded struct are promoted too
+				fields = append(fields, structFields(embedded, visiting)...)
+				continue
+			}
+		}
+
+		if field.IsExported() {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// sqliteType maps a Go type to an SQLite column type
+func sqliteType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return "DATETIME"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.String:
+		return "TEXT"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BLOB"
+		}
+	}
+	return "TEXT"
+}
+
+// snakeCase converts a Go field name such as UserID to user_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
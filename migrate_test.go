@@ -0,0 +1,275 @@
+package rsqlite
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchemaFromSQL(t *testing.T) {
+	tables, err := SchemaFromSQL(`
+		CREATE TABLE IF NOT EXISTS "users" (
+			id INTEGER PRIMARY KEY,
+			name VARCHAR (64) NOT NULL DEFAULT 'it''s',
+			email TEXT UNIQUE,
+			score REAL DEFAULT -1.5,
+			created_at DATETIME DEFAULT (datetime('now')),
+			CONSTRAINT name_check CHECK (length(name) > 0)
+		);
+		CREATE UNIQUE INDEX idx_users_email ON users (email);
+		CREATE INDEX "idx_users_name_score" ON "users"(name COLLATE NOCASE, score DESC);
+		INSERT INTO users (name) VALUES ('ignored');
+		CREATE TABLE main.[tags] (id, label TEXT);
+		CREATE TABLE "main"."v1.2" (x)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 3 {
+		t.Fatalf("parsed %d tables, want 3", len(tables))
+	}
+
+	users := tables[0]
+	wantColumns := []ColumnSchema{
+		{Name: "id", Type: "INTEGER", PrimaryKey: true},
+		{Name: "name", Type: "VARCHAR(64)", NotNull: true, Default: "'it''s'"},
+		{Name: "email", Type: "TEXT", Unique: true},
+		{Name: "score", Type: "REAL", Default: "-1.5"},
+		{Name: "created_at", Type: "DATETIME", Default: "(datetime('now'))"},
+	}
+	if users.Name != "users" || len(users.Columns) != len(wantColumns) {
+		t.Fatalf("users table %+v", users)
+	}
+	for i, want := range wantColumns {
+		got := users.Columns[i]
+		got.definition = ""
+		if got != want {
+			t.Errorf("column %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	wantIndexes := []IndexSchema{
+		{Name: "idx_users_email", Columns: []string{"email"}, Unique: true},
+		{Name: "idx_users_name_score", Columns: []string{"name", "score"}},
+	}
+	if len(users.Indexes) != len(wantIndexes) {
+		t.Fatalf("users indexes %+v", users.Indexes)
+	}
+	for i, want := range wantIndexes {
+		if got := users.Indexes[i]; !got.equal(want) || got.Name != want.Name || got.SQL == "" {
+			t.Errorf("index %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	tags := tables[1]
+	if tags.Name != "tags" || len(tags.Columns) != 2 || tags.Columns[0].Type != "" || tags.Columns[1].Type != "TEXT" {
+		t.Errorf("tags table %+v", tags)
+	}
+	if name := tables[2].Name; name != "v1.2" {
+		t.Errorf("table name %q, want v1.2", name)
+	}
+
+	for _, ddl := range []string{
+		"CREATE INDEX idx ON missing (a)",
+		"CREATE INDEX idx",
+		"CREATE TABLE t AS SELECT 1",
+	} {
+		if _, err := SchemaFromSQL(ddl); err == nil {
+			t.Errorf("SchemaFromSQL(%q) succeeded", ddl)
+		}
+	}
+}
+
+func TestPlanMigration(t *testing.T) {
+	current, err := SchemaFromSQL(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER);
+		CREATE INDEX idx_users_name ON users (name);
+		CREATE INDEX idx_users_age ON users (age)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		statements []string
+		warnings   int
+	}{
+		{
+			name:   "unchanged",
+			target: "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER); CREATE INDEX idx_users_name ON users (name)",
+		},
+		{
+			name:   "new table with index",
+			target: "CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT); CREATE INDEX idx_posts_title ON posts (title)",
+			statements: []string{
+				"CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT)",
+				"CREATE INDEX idx_posts_title ON posts (title)",
+			},
+		},
+		{
+			name: "added columns",
+			target: "CREATE TABLE USERS (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, email TEXT, " +
+				"active BOOLEAN NOT NULL DEFAULT TRUE, rank INTEGER DEFAULT -1, note TEXT DEFAULT 'none', avatar BLOB DEFAULT x'00')",
+			statements: []string{
+				`ALTER TABLE "USERS" ADD COLUMN email TEXT`,
+				`ALTER TABLE "USERS" ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE`,
+				`ALTER TABLE "USERS" ADD COLUMN rank INTEGER DEFAULT -1`,
+				`ALTER TABLE "USERS" ADD COLUMN note TEXT DEFAULT 'none'`,
+				`ALTER TABLE "USERS" ADD COLUMN avatar BLOB DEFAULT x'00'`,
+			},
+		},
+		{
+			name: "columns ALTER TABLE can't add",
+			target: "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, " +
+				"code TEXT UNIQUE, owner INTEGER NOT NULL, created_at DATETIME DEFAULT CURRENT_TIMESTAMP, " +
+				"updated_at DATETIME DEFAULT (datetime('now')))",
+			warnings: 4,
+		},
+		{
+			name:     "changed type",
+			target:   "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age REAL)",
+			warnings: 1,
+		},
+		{
+			name:   "changed index",
+			target: "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER); CREATE UNIQUE INDEX idx_users_name ON users (name)",
+			statements: []string{
+				`DROP INDEX "idx_users_name"`,
+				"CREATE UNIQUE INDEX idx_users_name ON users (name)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		target, err := SchemaFromSQL(tt.target)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		plan := planMigration(current, target)
+		if !equalStrings(plan.Statements, tt.statements) {
+			t.Errorf("%s: statements %q, want %q", tt.name, plan.Statements, tt.statements)
+		}
+		if len(plan.Warnings) != tt.warnings {
+			t.Errorf("%s: warnings %q, want %d", tt.name, plan.Warnings, tt.warnings)
+		}
+	}
+}
+
+func TestConstantDefault(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"NULL", true},
+		{"false", true},
+		{"0", true},
+		{"-1.5", true},
+		{"+2e3", true},
+		{".5", true},
+		{"0x1F", true},
+		{"'CURRENT_TIMESTAMP'", true},
+		{"X'00ff'", true},
+		{"CURRENT_TIMESTAMP", false},
+		{"current_date", false},
+		{"(1)", false},
+		{"(datetime('now'))", false},
+		{"inf", false},
+		{"0xZZ", false},
+	}
+	for _, tt := range tests {
+		if got := constantDefault(tt.expr); got != tt.want {
+			t.Errorf("constantDefault(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+// testModel mirrors gorm.Model
+type testModel struct {
+	ID        uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `db:"deleted_at,index"`
+}
+
+// audit is an unexported embedded struct whose fields are promoted
+type audit struct {
+	CreatedBy string
+	secret    string
+}
+
+// recursive embeds a pointer to itself
+type recursive struct {
+	*recursive
+	Name string
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	type address struct {
+		Street string
+	}
+	type user struct {
+		testModel
+		*audit
+		UserID   int64     `db:"user_id,notnull"`
+		Email    string    `db:",unique"`
+		Avatar   []byte    `db:"avatar"`
+		Score    *float64  `db:"score,index"`
+		Home     address   `db:"home"`
+		Ignored  string    `db:"-"`
+		Birthday time.Time `db:"birthday"`
+		internal int
+	}
+
+	schema, err := SchemaFromStruct("users", &user{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ColumnSchema{
+		{Name: "id", Type: "INTEGER", PrimaryKey: true},
+		{Name: "created_at", Type: "DATETIME"},
+		{Name: "updated_at", Type: "DATETIME"},
+		{Name: "deleted_at", Type: "DATETIME"},
+		{Name: "created_by", Type: "TEXT"},
+		{Name: "user_id", Type: "INTEGER", NotNull: true},
+		{Name: "email", Type: "TEXT", Unique: true},
+		{Name: "avatar", Type: "BLOB"},
+		{Name: "score", Type: "REAL"},
+		{Name: "home", Type: "TEXT"},
+		{Name: "birthday", Type: "DATETIME"},
+	}
+	if !reflect.DeepEqual(schema.Columns, want) {
+		t.Errorf("columns\n%+v\nwant\n%+v", schema.Columns, want)
+	}
+	wantIndexes := []IndexSchema{
+		{Name: "idx_users_deleted_at", Columns: []string{"deleted_at"}},
+		{Name: "idx_users_score", Columns: []string{"score"}},
+	}
+	if !reflect.DeepEqual(schema.Indexes, wantIndexes) {
+		t.Errorf("indexes %+v, want %+v", schema.Indexes, wantIndexes)
+	}
+
+	// A tagged pk wins over the ID field
+	type keyed struct {
+		ID   int
+		Code string `db:"code,pk"`
+	}
+	schema, err = SchemaFromStruct("keyed", keyed{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Columns[0].Name != "code" || !schema.Columns[0].PrimaryKey || schema.Columns[1].PrimaryKey {
+		t.Errorf("keyed columns %+v", schema.Columns)
+	}
+
+	schema, err = SchemaFromStruct("recursive", recursive{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Columns) != 1 || schema.Columns[0].Name != "name" {
+		t.Errorf("recursive columns %+v", schema.Columns)
+	}
+
+	if _, err := SchemaFromStruct("bad", 42); err == nil {
+		t.Error("schema derived from an int")
+	}
+}
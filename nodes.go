@@ -0,0 +1,138 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// Nodes returns the status of every cluster member, including non-voters, as
+// reported by the /nodes endpoint of the first configured node that answers.
+// The replication lag of each reachable node is measured against the
+// leader's applied raft index.
+func (cm *ClusterManager) Nodes(ctx context.Context) ([]NodeStatus, error) {
+	var lastErr error
+	for _, node := range cm.nodes {
+		nodes, err := cm.queryNodes(ctx, node)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for i := range nodes {
+			nodes[i].APIAddr = cm.resolveNode(nodes[i].APIAddr)
+		}
+		cm.fillLag(ctx, nodes)
+		return nodes, nil
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to query nodes from any node: %w", lastErr)
+	}
+	return nil, errors.New("no nodes available")
+}
+
+// queryNodes fetches and parses /nodes from a single node
+func (cm *ClusterManager) queryNodes(ctx context.Context, node string) (_ []NodeStatus, err error) {
+	start := time.Now()
+	defer func() { cm.observe(ctx, ControlNodes, node, start, err) }()
+
+	return transport.QueryNodes(ctx, cm.client, cm.header, node)
+}
+
+// apiAddresses maps discovered raft addresses, such as "10.0.0.2:4002", to
+// the HTTP API addresses clients dial. Addresses with a scheme or matching a
+// configured node are kept; the others are looked up in the /nodes listing
+// of node, and those it doesn't list are shifted by the API port offset.
+func (cm *ClusterManager) apiAddresses(ctx context.Context, node string, addrs []string) []string {
+	var apiAddrs map[string]string
+	mapped := make([]string, len(addrs))
+	for i, addr := range addrs {
+		if addr == "" || transport.HasScheme(addr) || cm.configuredHost(addr) {
+			mapped[i] = addr
+			continue
+		}
+
+		if apiAddrs == nil {
+			apiAddrs = make(map[string]string)
+			if nodes, err := cm.queryNodes(ctx, node); err == nil {
+				for _, n := range nodes {
+					if n.Addr != "" && n.APIAddr != "" {
+						apiAddrs[n.Addr] = n.APIAddr
+					}
+				}
+			}
+		}
+
+		if apiAddr, ok := apiAddrs[addr]; ok {
+			mapped[i] = apiAddr
+			continue
+		}
+		mapped[i] = shiftPort(addr, cm.apiPortOffset)
+	}
+	return mapped
+}
+
+// configuredHost reports whether addr has the host and port of a configured node
+func (cm *ClusterManager) configuredHost(addr string) bool {
+	host := transport.NodeHost(addr)
+	for _, node := range cm.nodes {
+		if transport.NodeHost(node) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// shiftPort adds offset to the port of a host:port address
+func shiftPort(addr string, offset int) string {
+	if offset == 0 {
+		return addr
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return addr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(n+offset))
+}
+
+// fillLag sets the applied index and lag of reachable nodes. Nodes whose
+// index can't be read keep a zero AppliedIndex and Lag.
+func (cm *ClusterManager) fillLag(ctx context.Context, nodes []NodeStatus) {
+	var leaderIndex uint64
+	for i := range nodes {
+		if !nodes[i].Reachable || nodes[i].APIAddr == "" {
+			continue
+		}
+
+		index, err := cm.AppliedIndex(ctx, nodes[i].APIAddr)
+		if err != nil {
+			continue
+		}
+		nodes[i].AppliedIndex = index
+		if nodes[i].Leader {
+			leaderIndex = index
+		}
+	}
+
+	for i := range nodes {
+		if nodes[i].AppliedIndex > 0 && leaderIndex > nodes[i].AppliedIndex {
+			nodes[i].Lag = leaderIndex - nodes[i].AppliedIndex
+		}
+	}
+}
+
+// Nodes returns the status of every cluster member, see ClusterManager.Nodes
+func (c *Connector) Nodes(ctx context.Context) ([]NodeStatus, error) {
+	return c.sharedClusterManager().Nodes(ctx)
+}
@@ -0,0 +1,587 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// loadNodesFixture reads a /nodes fixture, substituting the API addresses
+func loadNodesFixture(t *testing.T, name string, addrs ...string) []byte {
+	t.Helper()
+
+	body, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := string(body)
+	for i, addr := range addrs {
+		fixture = strings.ReplaceAll(fixture, fmt.Sprintf("{{node%d}}", i+1), addr)
+	}
+	return []byte(fixture)
+}
+
+func TestParseNodes(t *testing.T) {
+	for _, fixture := range []string{"nodes_v1.json", "nodes_v2.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			nodes, err := transport.ParseNodes(loadNodesFixture(t, fixture, "http://n1:4001", "http://n2:4001", "http://n3:4001"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(nodes) != 3 {
+				t.Fatalf("got %d nodes, want 3", len(nodes))
+			}
+
+			leader := nodes[0]
+			if leader.ID != "1" || !leader.Leader || !leader.Reachable || !leader.Voter {
+				t.Errorf("unexpected leader status: %+v", leader)
+			}
+			if leader.APIAddr != "http://n1:4001" || leader.Addr != "10.0.0.1:4002" {
+				t.Errorf("unexpected leader addresses: %+v", leader)
+			}
+			if leader.Version != "v8.30.2" || leader.Latency != 213*time.Microsecond {
+				t.Errorf("unexpected leader version or latency: %+v", leader)
+			}
+
+			down := nodes[2]
+			if down.ID != "3" || down.Reachable || down.Voter || down.Error == "" {
+				t.Errorf("unexpected unreachable node status: %+v", down)
+			}
+		})
+	}
+}
+
+func TestParseNodesInvalid(t *testing.T) {
+	if _, err := transport.ParseNodes([]byte("not json")); err == nil {
+		t.Fatal("expected an error for an invalid payload")
+	}
+}
+
+func TestClusterManagerNodes(t *testing.T) {
+	statusServer := func(index int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/status" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintf(w, `{"store": {"raft": {"applied_index": %d}}}`, index)
+		}))
+	}
+
+	node1 := statusServer(120)
+	defer node1.Close()
+	node2 := statusServer(100)
+	defer node2.Close()
+
+	fixture := loadNodesFixture(t, "nodes_v1.json", node1.URL, node2.URL, "http://127.0.0.1:1")
+	entry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nodes" {
+			http.NotFound(w, r)
+			return
+		}
+		if _, ok := r.URL.Query()["nonvoters"]; !ok {
+			t.Errorf("nodes request without nonvoters: %s", r.URL)
+		}
+		w.Write(fixture)
+	}))
+	defer entry.Close()
+
+	cm := NewClusterManager([]string{"http://127.0.0.1:1", entry.URL})
+	nodes, err := cm.Nodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 3 {
+		t.Fatalf("got %d nodes, want 3", len(nodes))
+	}
+	if nodes[0].AppliedIndex != 120 || nodes[0].Lag != 0 {
+		t.Errorf("leader: got index %d lag %d, want 120 and 0", nodes[0].AppliedIndex, nodes[0].Lag)
+	}
+	if nodes[1].AppliedIndex != 100 || nodes[1].Lag != 20 {
+		t.Errorf("follower: got index %d lag %d, want 100 and 20", nodes[1].AppliedIndex, nodes[1].Lag)
+	}
+	if nodes[2].AppliedIndex != 0 || nodes[2].Lag != 0 {
+		t.Errorf("unreachable node: got index %d lag %d, want 0 and 0", nodes[2].AppliedIndex, nodes[2].Lag)
+	}
+}
+
+func TestDiscoverLeaderFromNodes(t *testing.T) {
+	fixture := loadNodesFixture(t, "nodes_v2.json", "http://n1:4001", "http://n2:4001", "http://n3:4001")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nodes" {
+			t.Errorf("unexpected discovery request: %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("ver") != "2" {
+			t.Errorf("nodes request without ver=2: %s", r.URL)
+		}
+		w.Write(fixture)
+	}))
+	defer server.Close()
+
+	cm := NewClusterManager([]string{server.URL})
+	if err := cm.DiscoverLeader(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cm.GetLeader(); got != "http://n1:4001" {
+		t.Errorf("leader = %q, want http://n1:4001", got)
+	}
+	// The unreachable node is left out
+	if got := cm.GetPeers(); len(got) != 1 || got[0] != "http://n2:4001" {
+		t.Errorf("peers = %v, want [http://n2:4001]", got)
+	}
+}
+
+func TestFollowerPreferenceUsesDiscoveredPeers(t *testing.T) {
+	const (
+		n2 = "http://n2:4001"
+		n3 = "http://n3:4001"
+	)
+	var seed *httptest.Server
+	seed = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"nodes": [
+			{"id": "1", "api_addr": %q, "leader": true, "reachable": true, "voter": true},
+			{"id": "2", "api_addr": %q, "reachable": true, "voter": true},
+			{"id": "3", "api_addr": %q, "reachable": true, "voter": true}
+		]}`, seed.URL, n2, n3)
+	}))
+	defer seed.Close()
+
+	// The DSN names only the seed, as most do
+	cm := NewClusterManager([]string{seed.URL})
+	if err := cm.SetReadPreference("follower"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.DiscoverLeader(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cm.Followers(); !equalStrings(got, []string{n2, n3}) {
+		t.Errorf("followers = %v, want the discovered peers [%s %s]", got, n2, n3)
+	}
+	for i := 0; i < 10; i++ {
+		if got := cm.SelectBestNode("none"); got != n2 && got != n3 {
+			t.Fatalf("read went to %q, want a follower", got)
+		}
+	}
+}
+
+func TestDiscoverLeaderFallsBackToStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"cluster": {"leader": "n1:4001", "peers": ["n2:4001"]}}`))
+	}))
+	defer server.Close()
+
+	cm := NewClusterManager([]string{server.URL})
+	if err := cm.DiscoverLeader(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cm.GetLeader(); got != "http://n1:4001" {
+		t.Errorf("leader = %q, want http://n1:4001", got)
+	}
+	if got := cm.GetPeers(); len(got) != 1 || got[0] != "http://n2:4001" {
+		t.Errorf("peers = %v, want [http://n2:4001]", got)
+	}
+}
+
+func TestExecFollowsLeaderRedirect(t *testing.T) {
+	var leaderExecs, discoveries atomic.Int32
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/execute" {
+			leaderExecs.Add(1)
+		}
+		w.Write([]byte(`{"results": [{"rows_affected": 1}]}`))
+	}))
+	defer leader.Close()
+
+	// The follower still believes it leads, as right after an election
+	var follower *httptest.Server
+	follower = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nodes":
+			discoveries.Add(1)
+			fmt.Fprintf(w, `{"nodes": [{"id": "n2", "api_addr": %q, "leader": true, "reachable": true, "voter": true}]}`, follower.URL)
+		case "/db/execute":
+			http.Redirect(w, r, leader.URL+r.URL.RequestURI(), http.StatusMovedPermanently)
+		default:
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+		}
+	}))
+	defer follower.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(follower.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NewConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := conn.ExecContext(ctx, "INSERT INTO t VALUES (1)", nil); err != nil {
+			t.Fatalf("exec %d: %v", i, err)
+		}
+	}
+
+	if n := leaderExecs.Load(); n != 2 {
+		t.Errorf("leader ran %d writes, want 2", n)
+	}
+	if got := conn.currentNode(); got != leader.URL {
+		t.Errorf("connection node = %q, want the leader %q", got, leader.URL)
+	}
+	if got := conn.clusterManager.GetLeader(); got != leader.URL {
+		t.Errorf("recorded leader = %q, want %q", got, leader.URL)
+	}
+	if n := discoveries.Load(); n > 1 {
+		t.Errorf("cluster rediscovered %d times, want the redirect followed", n)
+	}
+}
+
+func TestReconnectSurvivesCancellation(t *testing.T) {
+	var failing atomic.Bool
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nodes":
+			fmt.Fprintf(w, `{"nodes": [{"id": "n1", "api_addr": %q, "leader": true, "reachable": true, "voter": true}]}`, server.URL)
+		case "/db/execute":
+			if failing.Load() {
+				// Drop the connection, as a crashing node does
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.Write([]byte(`{"results": [{"rows_affected": 1}]}`))
+		default:
+			// Reconnects outlast the callers' deadlines
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+		}
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://") + "?max_retries=3&retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := OpenDB(cfg)
+	defer db.Close()
+
+	failing.Store(true)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+			defer cancel()
+			if _, err := db.ExecContext(ctx, "INSERT INTO t VALUES (1)"); err == nil {
+				t.Error("write succeeded while the node drops every write")
+			}
+		}()
+	}
+	wg.Wait()
+	failing.Store(false)
+
+	// The pooled connections were reconnected although their callers gave up
+	for i := 0; i < 8; i++ {
+		if _, err := db.ExecContext(context.Background(), "INSERT INTO t VALUES (1)"); err != nil {
+			t.Fatalf("write %d after recovery: %v", i, err)
+		}
+	}
+}
+
+func TestConcurrentPoolUsage(t *testing.T) {
+	// Leadership moves among three nodes; followers redirect writes
+	var leader atomic.Int32
+	var servers [3]*httptest.Server
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := servers[leader.Load()]
+			switch r.URL.Path {
+			case "/nodes":
+				var nodes []string
+				for j, s := range servers {
+					nodes = append(nodes, fmt.Sprintf(`{"id": "n%d", "api_addr": %q, "leader": %v, "reachable": true, "voter": true}`, j, s.URL, s == current))
+				}
+				fmt.Fprintf(w, `{"nodes": [%s]}`, strings.Join(nodes, ","))
+			case "/status":
+				w.Write([]byte(`{"store": {"raft": {"applied_index": 100, "commit_index": 100}}}`))
+			case "/db/execute":
+				if servers[i] != current {
+					http.Redirect(w, r, current.URL+r.URL.RequestURI(), http.StatusMovedPermanently)
+					return
+				}
+				w.Write([]byte(`{"results": [{"rows_affected": 1}], "raft_index": 50}`))
+			default:
+				w.Write([]byte(`{"results": [{"columns": ["a", "b"], "types": ["integer", "text"], "values": [[1, "x"], [2, "y"]]}]}`))
+			}
+		}))
+		defer servers[i].Close()
+	}
+
+	var hosts []string
+	for _, s := range servers {
+		hosts = append(hosts, strings.TrimPrefix(s.URL, "http://"))
+	}
+	cfg, err := ParseDSN("rqlite://" + strings.Join(hosts, ",") + "?read_your_writes=true&retry_backoff=1ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(4)
+	db.SetConnMaxLifetime(10 * time.Millisecond)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				if w%2 == 0 {
+					db.ExecContext(ctx, "INSERT INTO t VALUES (1)")
+				} else if rows, err := db.QueryContext(ctx, "SELECT a, b FROM t"); err == nil {
+					for rows.Next() {
+						var a int
+						var b string
+						rows.Scan(&a, &b)
+					}
+					rows.Close()
+				}
+				cancel()
+			}
+		}(w)
+	}
+
+	// Move the leader and reconfigure the connections while they run
+	for i := 0; i < 40; i++ {
+		time.Sleep(5 * time.Millisecond)
+		leader.Store(int32(i % len(servers)))
+		err := connector.UpdateConfig(func(cfg *Config) {
+			cfg.StreamRows = i%2 == 0
+			cfg.ReadWriteSplit = i%4 < 2
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		connector.Stats()
+		connector.Quarantined()
+		connector.sharedClusterManager().ForceRefresh(context.Background())
+	}
+	close(stop)
+	wg.Wait()
+
+	if _, err := db.Exec("INSERT INTO t VALUES (1)"); err != nil {
+		t.Errorf("write after the leadership changes: %v", err)
+	}
+}
+
+func TestCloseStopsBackgroundWork(t *testing.T) {
+	var polls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			polls.Add(1)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Throttle = &ThrottleConfig{Interval: time.Millisecond, MaxRate: 100}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler, err := connector.ScheduleBackups(BackupSchedule{Interval: time.Hour, Sink: FileSink{Dir: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for polls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if polls.Load() == 0 {
+		t.Fatal("throttle never polled the leader")
+	}
+
+	// sql.DB.Close closes the connector
+	if err := sql.OpenDB(connector).Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-scheduler.done:
+	case <-time.After(time.Second):
+		t.Fatal("backup schedule still running after Close")
+	}
+
+	// Let requests already sent reach the server
+	time.Sleep(20 * time.Millisecond)
+	after := polls.Load()
+	time.Sleep(20 * time.Millisecond)
+	if polls.Load() != after {
+		t.Error("throttle still polling after Close")
+	}
+	if err := connector.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	scheduler.Stop()
+}
+
+func TestRedirectKeepsBasePath(t *testing.T) {
+	// Both nodes sit behind a proxy under a base path
+	var leaderExecs atomic.Int32
+	leaderMux := http.NewServeMux()
+	leaderMux.HandleFunc("/leader/db/execute", func(w http.ResponseWriter, r *http.Request) {
+		leaderExecs.Add(1)
+		w.Write([]byte(`{"results": [{"last_insert_id": 1, "rows_affected": 1}]}`))
+	})
+	leader := httptest.NewServer(leaderMux)
+	defer leader.Close()
+
+	var follower *httptest.Server
+	follower = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/follower/nodes":
+			fmt.Fprintf(w, `{"nodes": [{"id": "n2", "api_addr": %q, "leader": true, "reachable": true, "voter": true}]}`, follower.URL+"/follower")
+		case "/follower/db/execute":
+			http.Redirect(w, r, leader.URL+"/leader/db/execute", http.StatusMovedPermanently)
+		case "/follower/db/query":
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer follower.Close()
+
+	cfg, err := ParseDSN(follower.URL + "/follower?retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NewConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(context.Background(), "INSERT INTO t (id) VALUES (1)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := leaderExecs.Load(); n != 1 {
+		t.Errorf("leader ran %d writes, want 1", n)
+	}
+	if want := leader.URL + "/leader"; conn.clusterManager.GetLeader() != want {
+		t.Errorf("recorded leader %q, want %q", conn.clusterManager.GetLeader(), want)
+	}
+
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{"http://n1:4001/db/execute", "http://n1:4001"},
+		{"http://n1:4001/base/db/execute?x=1", "http://n1:4001/base"},
+		{"/other/db/execute", "http://proxy/other"},
+		{"http://n1:4001/", "http://n1:4001/follower"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "http://proxy/follower/db/execute", nil)
+		resp := &http.Response{
+			StatusCode: http.StatusTemporaryRedirect,
+			Header:     http.Header{"Location": {tt.location}},
+			Request:    req,
+		}
+		if got := transport.RedirectedTo(resp, "http://proxy/follower", "/db/execute"); got != tt.want {
+			t.Errorf("redirect to %q: leader %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestPoolDiscardsInvalidConnections(t *testing.T) {
+	var connects atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/query" {
+			// Every new connection probes its node
+			connects.Add(1)
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"rows_affected": 1}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://") + "?discovery=false&stale_after=50ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	exec := func(wantConnects int32) {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, "INSERT INTO t VALUES (1)"); err != nil {
+			t.Fatal(err)
+		}
+		if n := connects.Load(); n != wantConnects {
+			t.Fatalf("%d connections opened, want %d", n, wantConnects)
+		}
+	}
+
+	exec(1)
+	exec(1)
+
+	// An idle connection goes stale without sending a request
+	time.Sleep(60 * time.Millisecond)
+	exec(2)
+
+	// A quarantined node invalidates its connections at once; the new
+	// connection's probe lifts the quarantine
+	connector.sharedClusterManager().markDown(server.URL, errors.New("connection refused"))
+	exec(3)
+	exec(3)
+}
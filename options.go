@@ -0,0 +1,154 @@
+package rsqlite
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// Option configures a Config created by NewConfig
+type Option func(*Config)
+
+// NewConfig returns a configuration with the same defaults as ParseDSN,
+// modified by opts. Nodes given without a scheme get the default scheme.
+func NewConfig(opts ...Option) *Config {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	for i, node := range cfg.Nodes {
+		if !transport.HasScheme(node) && cfg.DefaultScheme != "" {
+			node = cfg.DefaultScheme + "://" + node
+		}
+		cfg.Nodes[i] = transport.NormalizeNode(node)
+	}
+	return cfg
+}
+
+// WithNodes sets the cluster nodes, e.g. "localhost:4001" or "https://node1:4001"
+func WithNodes(nodes ...string) Option {
+	return func(cfg *Config) {
+		cfg.Nodes = append([]string(nil), nodes...)
+	}
+}
+
+// WithAuth sets the HTTP Basic Auth credentials
+func WithAuth(username, password string) Option {
+	return func(cfg *Config) {
+		cfg.Username = username
+		cfg.Password = password
+	}
+}
+
+// WithCredentialProvider sets the provider supplying the credentials of every request
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(cfg *Config) {
+		cfg.CredentialProvider = provider
+	}
+}
+
+// WithConsistency sets the read consistency level: none, weak, strong,
+// linearizable or auto
+func WithConsistency(level string) Option {
+	return func(cfg *Config) {
+		cfg.ConsistencyLevel = level
+	}
+}
+
+// WithTimeout sets the timeout of each HTTP request
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.Timeout = timeout
+	}
+}
+
+// WithAppName sets the application name sent with every request
+func WithAppName(name string) Option {
+	return func(cfg *Config) {
+		cfg.AppName = name
+	}
+}
+
+// WithTLS sets the TLS configuration and makes https the default scheme
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(cfg *Config) {
+		cfg.TLSConfig = tlsConfig
+		cfg.DefaultScheme = "https"
+	}
+}
+
+// WithReadOnly rejects writes with ErrReadOnly
+func WithReadOnly() Option {
+	return func(cfg *Config) {
+		cfg.ReadOnly = true
+	}
+}
+
+// WithHooks sets the hooks receiving driver events
+func WithHooks(hooks *Hooks) Option {
+	return func(cfg *Config) {
+		cfg.Hooks = hooks
+	}
+}
+
+// WithLastResort sets the handler taking over writes that failed after
+// every retry
+func WithLastResort(handler LastResort) Option {
+	return func(cfg *Config) {
+		cfg.LastResort = handler
+	}
+}
+
+// WithRetryPolicy sets the retry policy of statements, connection attempts
+// and leader discovery, see Config.Retry
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(cfg *Config) {
+		cfg.Retry = &policy
+	}
+}
+
+// WithClock sets the clock of discovery caching, quarantines and retry
+// backoff, see Config.Clock
+func WithClock(clock Clock) Option {
+	return func(cfg *Config) {
+		cfg.Clock = clock
+	}
+}
+
+// WithRand sets the randomness of node selection, see Config.Rand
+func WithRand(r Rand) Option {
+	return func(cfg *Config) {
+		cfg.Rand = r
+	}
+}
+
+// OpenDB returns a database handle for cfg. Like sql.Open it doesn't
+// connect; an invalid configuration is reported by the first use of the
+// handle, e.g. Ping.
+func OpenDB(cfg *Config) *sql.DB {
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		return sql.OpenDB(failedConnector{err: err})
+	}
+	return sql.OpenDB(connector)
+}
+
+// failedConnector reports a configuration error on every connection attempt
+type failedConnector struct {
+	err error
+}
+
+// Connect implements the database/sql/driver.Connector interface
+func (f failedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return nil, f.err
+}
+
+// Driver implements the database/sql/driver.Connector interface
+func (f failedConnector) Driver() driver.Driver {
+	return &Driver{}
+}
@@ -0,0 +1,46 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+)
+
+// OpenPair opens two handles on the cluster described by dsn: primary for
+// writes and reads at the DSN's consistency level, and replica for stale
+// reads configured by Config.ReplicaConfig. Both share one ClusterManager, so
+// leader discovery happens once, and the default pooled HTTP transport.
+func OpenPair(dsn string) (primary, replica *sql.DB, err error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sql.OpenDB(connector), sql.OpenDB(connector.ReplicaConnector()), nil
+}
+
+// ReplicaConnector returns a connector using the replica configuration of c
+// (see Config.ReplicaConfig) that shares c's ClusterManager
+func (c *Connector) ReplicaConnector() *Connector {
+	cfg, _ := c.current()
+
+	replica := &Connector{
+		cfg:            cfg.ReplicaConfig(),
+		conns:          make(map[*Conn]struct{}),
+		clusterManager: c.sharedClusterManager(),
+		memory:         c.memoryBudget(),
+	}
+	// Closing c ends the replica's background work too
+	replica.ctx, replica.cancel = context.WithCancel(c.ctx)
+	replica.cfg.ReplicaCache = nil
+	replica.cfg.Canary = nil
+	replica.clusterManager.OnLeaderChange(func(oldLeader, newLeader string) {
+		replica.invalidateNode(oldLeader)
+	})
+
+	return replica
+}
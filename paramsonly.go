@@ -0,0 +1,61 @@
+package rsqlite
+
+import (
+	"context"
+	"strings"
+)
+
+// checkParamsOnly rejects statements with inline string literals when
+// parameter-only mode is enabled. Schema statements are exempt, since they
+// can't be parameterized, as are statements whose fingerprint or label is
+// listed in ParamsOnlyAllow.
+func checkParamsOnly(ctx context.Context, cfg *Config, warm *warmCache, query string) error {
+	if !cfg.ParamsOnly || !warm.hasStringLiteral(query) {
+		return nil
+	}
+
+	fp := warm.fingerprint(query)
+	for _, keyword := range []string{"create ", "alter ", "drop ", "pragma "} {
+		if strings.HasPrefix(fp, keyword) {
+			return nil
+		}
+	}
+
+	label := LabelFromContext(ctx)
+	for _, allowed := range cfg.ParamsOnlyAllow {
+		if allowed == fp || (label != "" && allowed == label) {
+			return nil
+		}
+	}
+
+	return &InlineLiteralError{Fingerprint: fp}
+}
+
+// scanStringLiteral scans a statement for a string or blob literal
+func scanStringLiteral(query string) bool {
+	for i := 0; i < len(query); {
+		switch ch := query[i]; {
+		case ch == '\'':
+			return true
+		case startsComment(query, i):
+			if query[i] == '-' {
+				for i < len(query) && query[i] != '\n' {
+					i++
+				}
+			} else if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+		case ch == '"':
+			i = skipQuoted(query, i, '"')
+		case ch == '`':
+			i = skipQuoted(query, i, '`')
+		case ch == '[':
+			i = skipQuoted(query, i, ']')
+		default:
+			i++
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckParamsOnly(t *testing.T) {
+	cfg := &Config{
+		ParamsOnly:      true,
+		ParamsOnlyAllow: []string{"select * from flags where name = ?", "migration"},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		ctx      context.Context
+		query    string
+		rejected bool
+	}{
+		{ctx, "SELECT * FROM users WHERE name = ?", false},
+		{ctx, "SELECT * FROM users WHERE id = 42", false},
+		{ctx, "SELECT * FROM users WHERE name = 'alice'", true},
+		{ctx, "SELECT * FROM users WHERE data = X'00'", true},
+		{ctx, `SELECT "it's" FROM t -- don't`, false},
+		{ctx, "SELECT [a'b] FROM t /* 'quoted' */", false},
+		{ctx, "CREATE TABLE t (name TEXT DEFAULT 'none')", false},
+		{ctx, "PRAGMA journal_mode = 'wal'", false},
+		{ctx, "SELECT * FROM flags WHERE name = 'beta'", false},
+		{WithLabel(ctx, "migration"), "UPDATE t SET state = 'done'", false},
+		{WithLabel(ctx, "other"), "UPDATE t SET state = 'done'", true},
+	}
+	for _, tt := range tests {
+		err := checkParamsOnly(tt.ctx, cfg, nil, tt.query)
+		var inline *InlineLiteralError
+		if rejected := errors.As(err, &inline); rejected != tt.rejected {
+			t.Errorf("checkParamsOnly(%q) = %v, want rejected %v", tt.query, err, tt.rejected)
+		}
+	}
+
+	cfg.ParamsOnly = false
+	if err := checkParamsOnly(ctx, cfg, nil, "SELECT 'x'"); err != nil {
+		t.Errorf("disabled check rejected a literal: %v", err)
+	}
+}
+
+func TestParamsOnlyRejectsBeforeSending(t *testing.T) {
+	// The server records every query that isn't a connection probe
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/db/") {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		json.Unmarshal(body, &statements)
+		if query, _ := statements[0][0].(string); query != "SELECT 1" {
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"results": [{"columns": ["id", "name"], "types": ["integer", "text"], "values": [[1, "a"]]}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ParamsOnly = true
+
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	_, err = db.Query("SELECT id, name FROM users WHERE name = 'alice'")
+	var inline *InlineLiteralError
+	if !errors.As(err, &inline) {
+		t.Fatalf("inline literal error = %v, want *InlineLiteralError", err)
+	}
+	if inline.Fingerprint != "select id, name from users where name = ?" {
+		t.Errorf("error fingerprint %q", inline.Fingerprint)
+	}
+
+	rows, err := db.Query("SELECT id, name FROM users WHERE name = ?", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"SELECT id, name FROM users WHERE name = ?"}; !equalStrings(queries, want) {
+		t.Errorf("server ran %q, want %q", queries, want)
+	}
+}
@@ -0,0 +1,133 @@
+package rsqlite
+
+import (
+	"sort"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// defaultMaxQuarantine caps the quarantine of a node that keeps failing when
+// Config.MaxQuarantine is unset
+const defaultMaxQuarantine = 5 * time.Minute
+
+// QuarantinedNode describes a node node selection skips after it failed,
+// see ClusterManager.Quarantined
+type QuarantinedNode struct {
+	Node string `json:"node"`
+	// Failures is the number of consecutive failed attempts
+	Failures int `json:"failures"`
+	// Until is when the node may be tried again
+	Until time.Time `json:"until"`
+	// Err is the last failure
+	Err error `json:"-"`
+}
+
+// failLocked records a failed request or health check of node. A node
+// failing again once its quarantine is over, when it is re-probed, is
+// quarantined twice as long, up to the maximum; failures during the
+// quarantine, e.g. of requests already in flight, don't extend it.
+// cm.healthMu must be held.
+func (cm *ClusterManager) failLocked(node string, err error) {
+	if cm.health == nil {
+		cm.health = make(map[string]healthEntry)
+	}
+
+	now := cm.clock.Now()
+	entry := cm.health[node]
+	if entry.err != nil && now.Before(entry.until) {
+		entry.err, entry.checkedAt = err, now
+		cm.health[node] = entry
+		return
+	}
+
+	failures := 1
+	if entry.err != nil {
+		failures = entry.failures + 1
+	}
+	cm.health[node] = healthEntry{
+		err:       err,
+		checkedAt: now,
+		failures:  failures,
+		until:     now.Add(cm.quarantineFor(failures)),
+	}
+}
+
+// quarantineFor returns how long a node is skipped after its n-th
+// consecutive failure: the down TTL, doubled for each further failure
+func (cm *ClusterManager) quarantineFor(failures int) time.Duration {
+	max := cm.maxQuarantine
+	if max <= 0 {
+		max = defaultMaxQuarantine
+	}
+
+	d := cm.downTTL
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// recoverLocked lifts the quarantine of node after a successful request;
+// cm.healthMu must be held
+func (cm *ClusterManager) recoverLocked(node string) {
+	if entry, ok := cm.health[node]; ok && entry.err != nil {
+		cm.health[node] = healthEntry{checkedAt: cm.clock.Now()}
+	}
+}
+
+// quarantinedLast orders nodes for connection attempts: the nodes not in
+// quarantine first, in order, then the quarantined ones by the end of their
+// quarantine, so they are only tried when every other node failed
+func (cm *ClusterManager) quarantinedLast(nodes []string) []string {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+
+	var healthy, quarantined []string
+	for _, node := range nodes {
+		if cm.downLocked(node) {
+			quarantined = append(quarantined, node)
+		} else {
+			healthy = append(healthy, node)
+		}
+	}
+	sort.SliceStable(quarantined, func(i, j int) bool {
+		return cm.health[transport.NormalizeNode(quarantined[i])].until.Before(cm.health[transport.NormalizeNode(quarantined[j])].until)
+	})
+	return append(healthy, quarantined...)
+}
+
+// Quarantined returns the nodes currently skipped by node selection after
+// failing, the soonest to be re-probed first
+func (cm *ClusterManager) Quarantined() []QuarantinedNode {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+
+	var nodes []QuarantinedNode
+	for node, entry := range cm.health {
+		if cm.downLocked(node) {
+			nodes = append(nodes, QuarantinedNode{Node: node, Failures: entry.failures, Until: entry.until, Err: entry.err})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Until.Before(nodes[j].Until)
+	})
+	return nodes
+}
+
+// Quarantined returns the nodes currently skipped after failing, see
+// ClusterManager.Quarantined
+func (c *Connector) Quarantined() []QuarantinedNode {
+	return c.sharedClusterManager().Quarantined()
+}
+
+// SetMaxQuarantine caps how long a node that keeps failing is skipped; 0
+// restores the default of 5 minutes
+func (cm *ClusterManager) SetMaxQuarantine(max time.Duration) {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+	cm.maxQuarantine = max
+}
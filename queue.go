@@ -0,0 +1,24 @@
+package rsqlite
+
+import (
+	"context"
+	"fmt"
+)
+
+// FlushQueue blocks until the writes queued on the leader before the call,
+// see Config.Queue, are persisted, or ctx is done. It returns the sequence
+// number of the flushing request; every queued write with a lower number
+// is durable.
+func (c *Connector) FlushQueue(ctx context.Context) (int64, error) {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// An empty queued request with wait returns once the queue is flushed
+	result, err := client.executeQueued(ctx, []Statement{}, true)
+	if err != nil {
+		return 0, fmt.Errorf("flushing write queue: %w", err)
+	}
+	return result.SequenceNumber, nil
+}
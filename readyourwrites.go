@@ -0,0 +1,73 @@
+package rsqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// ownWritesWait bounds how long a read waits for its node to apply the
+// connection's last write before it goes to the leader instead
+const ownWritesWait = 100 * time.Millisecond
+
+// noteApplied records the raft index a node reported applied
+func (cm *ClusterManager) noteApplied(node string, index uint64) {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+
+	if cm.applied == nil {
+		cm.applied = make(map[string]uint64)
+	}
+	node = transport.NormalizeNode(node)
+	if index > cm.applied[node] {
+		cm.applied[node] = index
+	}
+}
+
+// appliedAtLeast reports whether node is known to have applied index,
+// without asking it
+func (cm *ClusterManager) appliedAtLeast(node string, index uint64) bool {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+	return cm.applied[transport.NormalizeNode(node)] >= index
+}
+
+// noteWrite remembers the raft index of a write of the connection
+func (c *Conn) noteWrite(result *StatementResult) {
+	if result == nil {
+		return
+	}
+	for {
+		last := c.lastWrite.Load()
+		if result.raftIndex <= last || c.lastWrite.CompareAndSwap(last, result.raftIndex) {
+			return
+		}
+	}
+}
+
+// ownWritesClient returns the client a read is sent with so that it sees the
+// connection's last write. Weak and stronger reads are served by the leader
+// anyway; none and auto reads stay on client once its node applied the
+// write, waiting for it at most ownWritesWait, and go to the leader otherwise.
+func (c *Conn) ownWritesClient(ctx context.Context, client *apiClient) *apiClient {
+	index := c.lastWrite.Load()
+	if !c.cfg.ReadYourWrites || index == 0 {
+		return client
+	}
+	if level := c.cfg.readConsistency(); level != "none" && level != "auto" {
+		return client
+	}
+
+	leader := c.clusterManager.GetLeader()
+	if leader == "" || transport.NormalizeNode(leader) == client.node || c.clusterManager.appliedAtLeast(client.node, index) {
+		return client
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, ownWritesWait)
+	defer cancel()
+	if c.clusterManager.WaitForIndex(waitCtx, client.node, index) == nil {
+		return client
+	}
+	return c.newClient(leader)
+}
@@ -0,0 +1,115 @@
+package rsqlite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// rywNode is a test node counting the queries it serves
+type rywNode struct {
+	server  *httptest.Server
+	queries atomic.Int32
+	// applied is the raft index the node reports in /status
+	applied atomic.Uint64
+}
+
+func TestReadYourWritesWaitsForFollower(t *testing.T) {
+	var leader, follower rywNode
+	nodes := func(w http.ResponseWriter) {
+		fmt.Fprintf(w, `{"nodes": [
+			{"id": "n1", "api_addr": %q, "leader": true, "reachable": true, "voter": true},
+			{"id": "n2", "api_addr": %q, "leader": false, "reachable": true, "voter": true}]}`,
+			leader.server.URL, follower.server.URL)
+	}
+	handler := func(node *rywNode, isLeader bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/nodes":
+				nodes(w)
+			case "/status":
+				fmt.Fprintf(w, `{"store": {"raft": {"applied_index": %d, "commit_index": 10}}}`, node.applied.Load())
+			case "/db/execute":
+				if !isLeader {
+					t.Error("write sent to the follower")
+				}
+				if _, ok := r.URL.Query()["raft_index"]; !ok {
+					t.Error("write didn't ask for its raft index")
+				}
+				w.Write([]byte(`{"results": [{"last_insert_id": 1, "rows_affected": 1}], "raft_index": 10}`))
+			default:
+				node.queries.Add(1)
+				w.Write([]byte(`{"results": [{"columns": ["id"], "types": ["integer"], "values": [[1]]}]}`))
+			}
+		}
+	}
+	leader.server = httptest.NewServer(handler(&leader, true))
+	defer leader.server.Close()
+	follower.server = httptest.NewServer(handler(&follower, false))
+	defer follower.server.Close()
+	leader.applied.Store(10)
+	follower.applied.Store(5)
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(leader.server.URL, "http://") + "," +
+		strings.TrimPrefix(follower.server.URL, "http://") + "?consistency=none&read_write_split=true&read_preference=follower&read_your_writes=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+
+	ctx := context.Background()
+	dc, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	conn := dc.(*Conn)
+
+	query := func() {
+		t.Helper()
+		rows, err := conn.QueryContext(ctx, "SELECT id FROM t", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+	// Connection probes aren't counted
+	leaderBefore, followerBefore := leader.queries.Load(), follower.queries.Load()
+	counts := func() (int32, int32) {
+		return leader.queries.Load() - leaderBefore, follower.queries.Load() - followerBefore
+	}
+
+	// Before any write reads go to the follower
+	query()
+	if l, f := counts(); l != 0 || f != 1 {
+		t.Fatalf("read before writing served by leader %d, follower %d times", l, f)
+	}
+
+	if _, err := conn.ExecContext(ctx, "INSERT INTO t (id) VALUES (1)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if index := conn.lastWrite.Load(); index != 10 {
+		t.Fatalf("last write index %d, want 10", index)
+	}
+
+	// The follower is behind the write, so the read goes to the leader
+	query()
+	if l, f := counts(); l != 1 || f != 1 {
+		t.Errorf("read behind the follower served by leader %d, follower %d times", l, f)
+	}
+
+	// Once it applied the write the follower serves reads again
+	follower.applied.Store(10)
+	query()
+	if l, f := counts(); l != 1 || f != 2 {
+		t.Errorf("read after the follower caught up served by leader %d, follower %d times", l, f)
+	}
+}
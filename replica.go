@@ -0,0 +1,301 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaCacheConfig configures the local read replica cache of a Connector.
+// The cache periodically pulls a snapshot through the backup API into a local
+// SQLite file and serves cacheable queries from it while it is fresh enough.
+type ReplicaCacheConfig struct {
+	// DriverName is the database/sql driver that opens the local SQLite file,
+	// e.g. "sqlite3" from github.com/mattn/go-sqlite3. It must not be a name
+	// registered by this package.
+	DriverName string
+	// Dir holds the snapshot files; os.TempDir() is used when empty
+	Dir string
+	// RefreshInterval is how often a new snapshot is pulled
+	RefreshInterval time.Duration
+	// MaxStaleness is the oldest snapshot served; older snapshots, or a
+	// snapshot taken before this connector's last write, fall through to the cluster
+	MaxStaleness time.Duration
+	// Cacheable reports whether a query may be served locally, typically
+	// queries on reference data. Nothing is cached when nil.
+	Cacheable func(query string) bool
+}
+
+// replicaCache serves cacheable queries from a local snapshot
+type replicaCache struct {
+	cfg    ReplicaCacheConfig
+	backup func(ctx context.Context, w io.Writer) error
+
+	mu         sync.RWMutex
+	snap       *snapshot
+	snapshotAt time.Time
+	lastWrite  time.Time
+
+	refresh chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// newReplicaCache creates a cache and starts its refresh loop, which runs
+// until ctx is cancelled or the cache is closed
+func newReplicaCache(ctx context.Context, cfg ReplicaCacheConfig, backup func(ctx context.Context, w io.Writer) error) *replicaCache {
+	rc := &replicaCache{
+		cfg:     cfg,
+		backup:  backup,
+		refresh: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	ctx, rc.cancel = context.WithCancel(ctx)
+	go rc.run(ctx)
+	return rc
+}
+
+// run pulls snapshots until ctx is cancelled
+func (rc *replicaCache) run(ctx context.Context) {
+	defer close(rc.done)
+
+	ticker := time.NewTicker(rc.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		// Errors leave the previous snapshot in place until it becomes too stale
+		_ = rc.pull(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-rc.refresh:
+		}
+	}
+}
+
+// pull downloads a new snapshot and swaps it in
+func (rc *replicaCache) pull(ctx context.Context) error {
+	started := time.Now()
+
+	path, err := snapshotToFile(ctx, rc.cfg.Dir, "rsqlite-replica-*.db", rc.backup)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open(rc.cfg.DriverName, path)
+	if err == nil {
+		err = db.PingContext(ctx)
+	}
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		os.Remove(path)
+		return err
+	}
+
+	snap := &snapshot{db: db, path: path}
+	snap.refs.Store(1)
+
+	rc.mu.Lock()
+	old := rc.snap
+	rc.snap = snap
+	rc.snapshotAt = started
+	rc.mu.Unlock()
+
+	// Queries still reading the old snapshot keep it open until they finish
+	if old != nil {
+		old.release()
+	}
+
+	return nil
+}
+
+// snapshot is a local snapshot file and its database. It is reference
+// counted, the cache holding one reference while it serves the snapshot and
+// each query one until its rows are closed.
+type snapshot struct {
+	db   *sql.DB
+	path string
+	refs atomic.Int32
+}
+
+// release drops a reference, closing and removing the snapshot with the last one
+func (s *snapshot) release() error {
+	if s.refs.Add(-1) > 0 {
+		return nil
+	}
+	err := s.db.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// snapshotToFile writes a backup into a new temporary file in dir and returns its path
+func snapshotToFile(ctx context.Context, dir, pattern string, backup func(ctx context.Context, w io.Writer) error) (string, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+
+	err = backup(ctx, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// query serves a query from the snapshot. It reports false when the query
+// is not cacheable or the snapshot is missing, stale or failing.
+func (rc *replicaCache) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, bool) {
+	if rc.cfg.Cacheable == nil || !rc.cfg.Cacheable(query) {
+		return nil, false
+	}
+
+	rc.mu.RLock()
+	snap := rc.snap
+	fresh := snap != nil &&
+		time.Since(rc.snapshotAt) <= rc.cfg.MaxStaleness &&
+		rc.snapshotAt.After(rc.lastWrite)
+	if fresh {
+		// The cache's reference can't be dropped while the lock is held
+		snap.refs.Add(1)
+	}
+	rc.mu.RUnlock()
+
+	if !fresh {
+		return nil, false
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			values[i] = sql.Named(arg.Name, arg.Value)
+		} else {
+			values[i] = arg.Value
+		}
+	}
+
+	rows, err := snap.db.QueryContext(ctx, query, values...)
+	if err != nil {
+		snap.release()
+		return nil, false
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		snap.release()
+		return nil, false
+	}
+
+	return &localRows{rows: rows, columns: columns, snap: snap}, true
+}
+
+// noteWrite records a write so older snapshots are no longer served,
+// and asks for a refresh
+func (rc *replicaCache) noteWrite() {
+	rc.mu.Lock()
+	rc.lastWrite = time.Now()
+	rc.mu.Unlock()
+
+	select {
+	case rc.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the refresh loop and removes the snapshot, once the queries
+// still reading it are done
+func (rc *replicaCache) close() error {
+	rc.cancel()
+	<-rc.done
+
+	rc.mu.Lock()
+	snap := rc.snap
+	rc.snap = nil
+	rc.mu.Unlock()
+
+	if snap == nil {
+		return nil
+	}
+	return snap.release()
+}
+
+// validate checks the replica cache configuration
+func (cfg *ReplicaCacheConfig) validate() error {
+	var errs []error
+	if cfg.DriverName == "" {
+		errs = append(errs, errors.New("replica cache needs a local SQLite driver name"))
+	}
+	if isRegistered(cfg.DriverName) {
+		errs = append(errs, errors.New("replica cache driver name must not be a name registered by rsqlite"))
+	}
+	if cfg.RefreshInterval <= 0 {
+		errs = append(errs, errors.New("replica cache refresh interval must be positive"))
+	}
+	if cfg.MaxStaleness <= 0 {
+		errs = append(errs, errors.New("replica cache max staleness must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// localRows adapts *sql.Rows from the local snapshot to driver.Rows
+type localRows struct {
+	rows    *sql.Rows
+	columns []string
+	snap    *snapshot
+	once    sync.Once
+}
+
+// Columns implements the database/sql/driver.Rows interface
+func (r *localRows) Columns() []string {
+	return r.columns
+}
+
+// Close implements the database/sql/driver.Rows interface
+func (r *localRows) Close() error {
+	err := r.rows.Close()
+	r.once.Do(func() { r.snap.release() })
+	return err
+}
+
+// Next implements the database/sql/driver.Rows interface
+func (r *localRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	values := make([]interface{}, len(r.columns))
+	ptrs := make([]interface{}, len(r.columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := r.rows.Scan(ptrs...); err != nil {
+		return err
+	}
+
+	for i := range dest {
+		if i < len(values) {
+			dest[i] = convertValue(values[i])
+		}
+	}
+	return nil
+}
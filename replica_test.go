@@ -0,0 +1,137 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	sql.Register("rsqlite-replica-test", snapshotTestDriver{})
+}
+
+// snapshotTestDriver stands in for a local SQLite driver. Its rows fail once
+// the snapshot file they read is removed.
+type snapshotTestDriver struct{}
+
+func (snapshotTestDriver) Open(name string) (driver.Conn, error) {
+	return &snapshotTestConn{path: name}, nil
+}
+
+type snapshotTestConn struct {
+	path string
+}
+
+func (c *snapshotTestConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *snapshotTestConn) Close() error {
+	return nil
+}
+
+func (c *snapshotTestConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *snapshotTestConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &snapshotTestRows{path: c.path, left: 5}, nil
+}
+
+type snapshotTestRows struct {
+	path string
+	left int
+}
+
+func (r *snapshotTestRows) Columns() []string {
+	return []string{"n"}
+}
+
+func (r *snapshotTestRows) Close() error {
+	return nil
+}
+
+func (r *snapshotTestRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	time.Sleep(100 * time.Microsecond)
+	if _, err := os.Stat(r.path); err != nil {
+		return err
+	}
+	dest[0] = int64(r.left)
+	r.left--
+	return nil
+}
+
+func TestReplicaCacheQueryDuringPull(t *testing.T) {
+	dir := t.TempDir()
+	rc := newReplicaCache(context.Background(), ReplicaCacheConfig{
+		DriverName:      "rsqlite-replica-test",
+		Dir:             dir,
+		RefreshInterval: time.Millisecond,
+		MaxStaleness:    time.Hour,
+		Cacheable:       func(string) bool { return true },
+	}, func(ctx context.Context, w io.Writer) error {
+		_, err := w.Write([]byte("snapshot"))
+		return err
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if rows, ok := rc.query(context.Background(), "SELECT n", nil); ok {
+			rows.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no snapshot pulled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Snapshots are swapped every millisecond while the queries read them
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				rows, ok := rc.query(context.Background(), "SELECT n", nil)
+				if !ok {
+					t.Error("fresh snapshot not served")
+					return
+				}
+				dest := make([]driver.Value, 1)
+				for {
+					err := rows.Next(dest)
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Errorf("snapshot retired during a query: %v", err)
+						break
+					}
+				}
+				rows.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := rc.close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d snapshot files left after close", len(entries))
+	}
+}
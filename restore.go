@@ -0,0 +1,212 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// RestoreOptions configures Connector.Restore
+type RestoreOptions struct {
+	// DriverName is the database/sql driver that opens SQLite files, e.g.
+	// "sqlite3" from github.com/mattn/go-sqlite3. When set, the row count of
+	// every table in the snapshot is compared with the cluster after loading.
+	DriverName string
+	// ReadOnly makes the connector's connections reject writes with
+	// ErrReadOnly while the restore runs, so the application can't write
+	// into a database that is about to be replaced
+	ReadOnly bool
+	// Boot loads the snapshot through the /boot endpoint, which is faster
+	// for large files but only accepted by single-node clusters
+	Boot bool
+}
+
+// RestoreResult describes a completed restore
+type RestoreResult struct {
+	// Tables maps every table in the cluster to its row count after the restore
+	Tables map[string]int64
+	// Verified is true when the row counts were checked against the snapshot
+	Verified bool
+}
+
+// Restore replaces the cluster's database with the SQLite snapshot at path.
+// It checks that the file is a SQLite database and that the cluster has a
+// leader and no unreachable voters before loading anything, then counts the
+// rows of every table and, with opts.DriverName, compares them with the
+// snapshot.
+func (c *Connector) Restore(ctx context.Context, path string, opts RestoreOptions) (*RestoreResult, error) {
+	if err := checkSQLiteFile(path); err != nil {
+		return nil, err
+	}
+
+	var expected map[string]int64
+	if opts.DriverName != "" {
+		counts, err := snapshotRowCounts(ctx, opts.DriverName, path)
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot: %w", err)
+		}
+		expected = counts
+	}
+
+	if err := c.checkRestoreTarget(ctx, opts.Boot); err != nil {
+		return nil, err
+	}
+
+	if opts.ReadOnly {
+		prev := c.setReadOnly(true)
+		defer c.setReadOnly(prev)
+	}
+
+	cfg, _ := c.current()
+	cm := c.sharedClusterManager()
+	// No overall client timeout: snapshots can be large, ctx bounds the transfer
+	client := newAPIClientForConfig(cm.GetLeader(), newHTTPClient(cfg, 0), cfg)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := client.load(ctx, opts.Boot, f); err != nil {
+		return nil, fmt.Errorf("loading snapshot: %w", err)
+	}
+
+	actual, err := clusterRowCounts(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("counting restored rows: %w", err)
+	}
+
+	result := &RestoreResult{Tables: actual}
+	if expected == nil {
+		return result, nil
+	}
+
+	if err := compareRowCounts(expected, actual); err != nil {
+		return result, err
+	}
+	result.Verified = true
+	return result, nil
+}
+
+// checkSQLiteFile verifies that path holds a SQLite database
+func checkSQLiteFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteFileHeader))
+	if _, err := io.ReadFull(f, header); err != nil || string(header) != sqliteFileHeader {
+		return fmt.Errorf("%s is not a SQLite database", path)
+	}
+	return nil
+}
+
+// checkRestoreTarget makes sure the cluster can take a restore: a leader is
+// known and every voter is reachable, and for a boot there is a single node
+func (c *Connector) checkRestoreTarget(ctx context.Context, boot bool) error {
+	cm := c.sharedClusterManager()
+	if err := cm.DiscoverLeader(ctx); err != nil {
+		return fmt.Errorf("cluster has no leader: %w", err)
+	}
+
+	nodes, err := cm.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if boot && len(nodes) > 1 {
+		return fmt.Errorf("boot restores need a single-node cluster, found %d nodes", len(nodes))
+	}
+
+	var unreachable []error
+	for _, node := range nodes {
+		if node.Voter && !node.Reachable {
+			unreachable = append(unreachable, fmt.Errorf("voter %s is unreachable", node.ID))
+		}
+	}
+	return errors.Join(unreachable...)
+}
+
+// snapshotRowCounts counts the rows of every table in a local SQLite file
+func snapshotRowCounts(ctx context.Context, driverName, path string) (map[string]int64, error) {
+	db, err := sql.Open(driverName, path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	schema, err := readSchema(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, obj := range schema {
+		if obj.typ != "table" {
+			continue
+		}
+		var n int64
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(obj.name)).Scan(&n); err != nil {
+			return nil, err
+		}
+		counts[obj.name] = n
+	}
+	return counts, nil
+}
+
+// clusterRowCounts counts the rows of every table on the node at strong consistency
+func clusterRowCounts(ctx context.Context, client *apiClient) (map[string]int64, error) {
+	result, err := client.query(ctx, "strong", "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, row := range result.Values {
+		name, ok := row[0].(string)
+		if !ok {
+			continue
+		}
+
+		count, err := client.query(ctx, "strong", "SELECT COUNT(*) FROM "+quoteIdent(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(count.Values) == 0 || len(count.Values[0]) == 0 {
+			return nil, fmt.Errorf("unexpected row count result for %s", name)
+		}
+		n, err := toInt64(count.Values[0][0])
+		if err != nil {
+			return nil, err
+		}
+		counts[name] = n
+	}
+	return counts, nil
+}
+
+// compareRowCounts reports every table whose row count differs
+func compareRowCounts(expected, actual map[string]int64) error {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		got, ok := actual[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("table %s is missing after restore", name))
+		} else if got != expected[name] {
+			errs = append(errs, fmt.Errorf("table %s has %d rows after restore, snapshot has %d", name, got, expected[name]))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,248 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// restoreNode is a single-node test cluster taking snapshot loads
+type restoreNode struct {
+	server *httptest.Server
+	// nodes is the /nodes listing, the node itself when empty
+	nodes string
+	// counts holds the row count of every table after the load
+	counts map[string]int64
+	// onLoad runs while a load request is served
+	onLoad func()
+
+	mu     sync.Mutex
+	loads  []string
+	loaded string
+}
+
+func newRestoreNode(t *testing.T, counts map[string]int64) *restoreNode {
+	t.Helper()
+	node := &restoreNode{counts: counts}
+	node.server = httptest.NewServer(node)
+	t.Cleanup(node.server.Close)
+	return node
+}
+
+func (n *restoreNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/status":
+		http.NotFound(w, r)
+		return
+	case "/nodes":
+		if n.nodes != "" {
+			w.Write([]byte(n.nodes))
+			return
+		}
+		fmt.Fprintf(w, `{"nodes": [{"id": "n1", "api_addr": %q, "leader": true, "reachable": true, "voter": true}]}`, n.server.URL)
+		return
+	case "/db/load", "/boot":
+		if n.onLoad != nil {
+			n.onLoad()
+		}
+		body, _ := io.ReadAll(r.Body)
+		n.mu.Lock()
+		n.loads = append(n.loads, r.URL.Path)
+		n.loaded = string(body)
+		n.mu.Unlock()
+		w.Write([]byte(`{}`))
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var statements [][]interface{}
+	json.Unmarshal(body, &statements)
+	query, _ := statements[0][0].(string)
+	switch {
+	case strings.Contains(query, "sqlite_master"):
+		var names []string
+		for name := range n.counts {
+			names = append(names, fmt.Sprintf("[%q]", name))
+		}
+		fmt.Fprintf(w, `{"results": [{"columns": ["name"], "types": ["text"], "values": [%s]}]}`, strings.Join(names, ", "))
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM "):
+		table := strings.Trim(strings.TrimPrefix(query, "SELECT COUNT(*) FROM "), `"`)
+		fmt.Fprintf(w, `{"results": [{"columns": ["COUNT(*)"], "types": ["integer"], "values": [[%d]]}]}`, n.counts[table])
+	case strings.HasPrefix(query, "INSERT"):
+		w.Write([]byte(`{"results": [{"rows_affected": 1, "last_insert_id": 1}]}`))
+	default:
+		w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+	}
+}
+
+func (n *restoreNode) connector(t *testing.T) *Connector {
+	t.Helper()
+	cfg, err := ParseDSN(n.server.URL + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connector.Close() })
+	return connector
+}
+
+// writeSnapshot writes a SQLite file whose tables hold the given rows for
+// the diff test driver
+func writeSnapshot(t *testing.T, tables map[string]int) string {
+	t.Helper()
+
+	content := sqliteFileHeader + t.Name()
+	db := &diffTestDB{tables: make(map[string][][]driver.Value)}
+	for name, rows := range tables {
+		db.schema = append(db.schema, []driver.Value{"table", name, "CREATE TABLE " + name + " (v)"})
+		db.tables[name] = make([][]driver.Value, rows)
+	}
+	diffTestDatabases[content] = db
+	t.Cleanup(func() { delete(diffTestDatabases, content) })
+
+	path := filepath.Join(t.TempDir(), "snapshot.sqlite")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRestore(t *testing.T) {
+	node := newRestoreNode(t, map[string]int64{"users": 2, "posts": 0})
+	connector := node.connector(t)
+	path := writeSnapshot(t, map[string]int{"users": 2, "posts": 0})
+
+	result, err := connector.Restore(context.Background(), path, RestoreOptions{DriverName: "rsqlite-diff-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Verified || result.Tables["users"] != 2 || len(result.Tables) != 2 {
+		t.Errorf("restore result %+v", result)
+	}
+	if want := sqliteFileHeader + t.Name(); node.loaded != want || !equalStrings(node.loads, []string{"/db/load"}) {
+		t.Errorf("loads %q of %q", node.loads, node.loaded)
+	}
+
+	// Without a driver the counts are reported unverified
+	result, err = connector.Restore(context.Background(), path, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Verified || len(result.Tables) != 2 {
+		t.Errorf("unverified restore result %+v", result)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.sqlite")
+	if err := os.WriteFile(bad, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connector.Restore(context.Background(), bad, RestoreOptions{}); err == nil || !strings.Contains(err.Error(), "is not a SQLite database") {
+		t.Errorf("restore of a non-SQLite file = %v", err)
+	}
+	if len(node.loads) != 2 {
+		t.Errorf("%d loads, want the bad file rejected before loading", len(node.loads))
+	}
+}
+
+func TestRestoreRowCountMismatch(t *testing.T) {
+	node := newRestoreNode(t, map[string]int64{"users": 1, "extra": 5})
+	connector := node.connector(t)
+	path := writeSnapshot(t, map[string]int{"users": 2, "posts": 3})
+
+	result, err := connector.Restore(context.Background(), path, RestoreOptions{DriverName: "rsqlite-diff-test"})
+	if err == nil {
+		t.Fatal("restore with differing row counts succeeded")
+	}
+	for _, want := range []string{"table posts is missing after restore", "table users has 1 rows after restore, snapshot has 2"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q lacks %q", err, want)
+		}
+	}
+	if result == nil || result.Verified || result.Tables["extra"] != 5 {
+		t.Errorf("restore result %+v", result)
+	}
+}
+
+func TestRestoreReadOnly(t *testing.T) {
+	node := newRestoreNode(t, map[string]int64{"users": 1})
+	connector := node.connector(t)
+	path := writeSnapshot(t, map[string]int{"users": 1})
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var writeErr error
+	var readOnly bool
+	node.onLoad = func() {
+		readOnly = connector.Config().ReadOnly
+		_, writeErr = db.Exec("INSERT INTO users (v) VALUES (1)")
+		// A configuration change made during the restore is kept
+		if err := connector.UpdateConfig(func(cfg *Config) { cfg.AppName = "restored" }); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := connector.Restore(context.Background(), path, RestoreOptions{ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !readOnly || !errors.Is(writeErr, ErrReadOnly) {
+		t.Errorf("write during the restore: read only %v, %v", readOnly, writeErr)
+	}
+	if cfg := connector.Config(); cfg.ReadOnly || cfg.AppName != "restored" {
+		t.Errorf("config after the restore: read only %v, app name %q", cfg.ReadOnly, cfg.AppName)
+	}
+	if _, err := db.Exec("INSERT INTO users (v) VALUES (1)"); err != nil {
+		t.Errorf("write after the restore: %v", err)
+	}
+
+	// A connector that was read only stays so
+	connector.UpdateConfig(func(cfg *Config) { cfg.ReadOnly = true })
+	if _, err := connector.Restore(context.Background(), path, RestoreOptions{ReadOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !connector.Config().ReadOnly {
+		t.Error("read only connector writable after the restore")
+	}
+}
+
+func TestRestoreBoot(t *testing.T) {
+	node := newRestoreNode(t, map[string]int64{"users": 1})
+	connector := node.connector(t)
+	path := writeSnapshot(t, map[string]int{"users": 1})
+
+	if _, err := connector.Restore(context.Background(), path, RestoreOptions{Boot: true, DriverName: "rsqlite-diff-test"}); err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(node.loads, []string{"/boot"}) {
+		t.Errorf("loads %q, want /boot", node.loads)
+	}
+
+	// Boot needs a single node, and every restore reachable voters
+	other := newRestoreNode(t, nil)
+	node.nodes = fmt.Sprintf(`{"nodes": [
+		{"id": "n1", "api_addr": %q, "leader": true, "reachable": true, "voter": true},
+		{"id": "n2", "api_addr": %q, "leader": false, "reachable": false, "voter": true}]}`, node.server.URL, other.server.URL)
+	if _, err := connector.Restore(context.Background(), path, RestoreOptions{Boot: true}); err == nil || !strings.Contains(err.Error(), "single-node cluster, found 2 nodes") {
+		t.Errorf("boot restore on two nodes = %v", err)
+	}
+	if _, err := connector.Restore(context.Background(), path, RestoreOptions{}); err == nil || !strings.Contains(err.Error(), "voter n2 is unreachable") {
+		t.Errorf("restore with an unreachable voter = %v", err)
+	}
+	if len(node.loads) != 1 {
+		t.Errorf("%d loads, want the rejected restores not loaded", len(node.loads))
+	}
+}
@@ -1,34 +1,128 @@
 package rsqlite
 
 import (
+	"context"
 	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"io"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/rqlite/gorqlite"
 )
 
 // Result implements the database/sql/driver.Result interface
 type Result struct {
 	lastInsertID int64
 	rowsAffected int64
+	// unknown is returned instead of the counts of queued writes
+	unknown error
+	// ack supplies the counts of a deferred statement once it is applied
+	ack *writeAck
 }
 
 // LastInsertId implements the database/sql/driver.Result interface
 func (r *Result) LastInsertId() (int64, error) {
+	if r.ack != nil {
+		return r.ack.lastInsertID()
+	}
+	if r.unknown != nil {
+		return 0, r.unknown
+	}
 	return r.lastInsertID, nil
 }
 
 // RowsAffected implements the database/sql/driver.Result interface
 func (r *Result) RowsAffected() (int64, error) {
+	if r.ack != nil {
+		return r.ack.rowsAffected()
+	}
+	if r.unknown != nil {
+		return 0, r.unknown
+	}
 	return r.rowsAffected, nil
 }
 
-// Rows implements the database/sql/driver.Rows interface
+// writeAck holds the counts of a statement whose execution is deferred, e.g.
+// to a DDLBatch, until the acknowledgement of the request applying it
+type writeAck struct {
+	mu       sync.Mutex
+	done     bool
+	insertID int64
+	affected int64
+	err      error
+	// pending is returned until the statement is applied
+	pending error
+}
+
+// resolve records the outcome of the statement; err is returned by the
+// counts when the request applying it failed
+func (a *writeAck) resolve(insertID, affected int64, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.done, a.insertID, a.affected, a.err = true, insertID, affected, err
+}
+
+// lastInsertID returns the insert id once the statement is applied
+func (a *writeAck) lastInsertID() (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case !a.done:
+		return 0, a.pending
+	case a.err != nil:
+		return 0, a.err
+	}
+	return a.insertID, nil
+}
+
+// rowsAffected returns the affected rows once the statement is applied
+func (a *writeAck) rowsAffected() (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case !a.done:
+		return 0, a.pending
+	case a.err != nil:
+		return 0, a.err
+	}
+	return a.affected, nil
+}
+
+// Rows implements the database/sql/driver.Rows interface. A Rows owns the
+// result it was decoded into, which no other Rows or cache shares, and
+// database/sql never calls Next and Close concurrently, so it needs no lock.
 type Rows struct {
-	result *gorqlite.QueryResult
-	closed bool
+	result *StatementResult
+	// stream yields the rows when they are decoded incrementally, see Config.StreamRows
+	stream *rowStream
+	// columns are the names reported to database/sql, in server order
+	columns []string
+	pos     int
+	closed  bool
+	// maxRows fails streamed results with more rows, 0 for no limit
+	maxRows int
+	// streamed counts the rows read from stream, added to metrics under
+	// metricsKey on Close since they are unknown when the query is recorded
+	streamed   int
+	metrics    *connectorMetrics
+	metricsKey string
+	// owners are the statement and connection tracking the open stream
+	owners []*openRows
+	// release returns the result's memory to the connector's budget
+	release func()
+	// strict returns numbers as their exact decimal text
+	strict bool
+	// timeFormat and timeUTC decode date and datetime columns, see Config.TimeFormat
+	timeFormat TimeFormat
+	timeUTC    bool
+	// timeColumns marks the date and datetime columns, computed on the first row
+	timeColumns []bool
+	// ctx, hooks and query are reported with panics recovered in Next
+	ctx   context.Context
+	hooks *Hooks
+	query string
 }
 
 // Columns implements the database/sql/driver.Rows interface
@@ -36,52 +130,231 @@ func (r *Rows) Columns() []string {
 	if r.result == nil {
 		return nil
 	}
-	return r.result.Columns()
+	if r.columns != nil {
+		return r.columns
+	}
+	return r.result.Columns
 }
 
 // Close implements the database/sql/driver.Rows interface
 func (r *Rows) Close() error {
+	if r.closed {
+		return nil
+	}
 	r.closed = true
+	if r.release != nil {
+		r.release()
+	}
+	if r.stream != nil {
+		r.stream.close()
+		if r.metrics != nil {
+			r.metrics.addRows(r.metricsKey, r.streamed)
+		}
+	}
+	for _, owner := range r.owners {
+		owner.remove(r)
+	}
 	return nil
 }
 
+// openRows tracks the streamed Rows of a statement or connection that are
+// still open, so closing it flushes the rows they read into the stats
+type openRows struct {
+	mu   sync.Mutex
+	rows map[*Rows]struct{}
+}
+
+// add tracks a streamed Rows until it is closed
+func (o *openRows) add(r *Rows) {
+	if r.stream == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.rows == nil {
+		o.rows = make(map[*Rows]struct{})
+	}
+	o.rows[r] = struct{}{}
+	r.owners = append(r.owners, o)
+}
+
+// remove stops tracking a closed Rows
+func (o *openRows) remove(r *Rows) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.rows, r)
+}
+
+// closeAll closes the Rows still open
+func (o *openRows) closeAll() {
+	o.mu.Lock()
+	rows := make([]*Rows, 0, len(o.rows))
+	for r := range o.rows {
+		rows = append(rows, r)
+	}
+	o.mu.Unlock()
+
+	for _, r := range rows {
+		r.Close()
+	}
+}
+
 // Next implements the database/sql/driver.Rows interface
-func (r *Rows) Next(dest []driver.Value) error {
+func (r *Rows) Next(dest []driver.Value) (err error) {
+	defer recoverPanic(r.ctx, r.hooks, r.query, &err)
+
 	if r.closed || r.result == nil {
 		return io.EOF
 	}
 
-	if !r.result.Next() {
-		return io.EOF
+	var row []interface{}
+	if r.stream != nil {
+		next, err := r.stream.next()
+		if err != nil {
+			return err
+		}
+		r.streamed++
+		if r.maxRows > 0 && r.streamed > r.maxRows {
+			return &MaxRowsError{Limit: r.maxRows}
+		}
+		row = next
+	} else {
+		if r.pos+1 >= len(r.result.Values) {
+			return io.EOF
+		}
+		r.pos++
+		row = r.result.Values[r.pos]
 	}
 
-	// Use gorqlite's Map() method to get the current row as a map
-	// This avoids the type scanning issues
-	rowMap, err := r.result.Map()
-	if err != nil {
-		return err
+	if r.timeColumns == nil {
+		r.timeColumns = timeColumns(r.result.Columns, r.result.Types)
 	}
 
-	// Get column names to maintain order
-	columns := r.result.Columns()
-
-	// Fill dest slice with values in column order
-	for i, colName := range columns {
+	// Fill dest slice with values in server column order
+	for i := range r.result.Columns {
 		if i >= len(dest) {
 			break
 		}
 
-		val, exists := rowMap[colName]
-		if !exists {
+		if i >= len(row) || row[i] == nil {
 			dest[i] = nil
-		} else {
-			dest[i] = convertValue(val)
+			continue
 		}
+
+		val := row[i]
+		if r.timeColumns[i] {
+			t, err := parseTime(val, r.timeFormat, r.timeUTC)
+			if err != nil {
+				return err
+			}
+			val = t
+		}
+
+		if n, ok := val.(json.Number); ok {
+			if r.strict {
+				dest[i] = n.String()
+				continue
+			}
+			f, err := n.Float64()
+			if err != nil {
+				return err
+			}
+			val = f
+		}
+
+		dest[i] = convertValue(val)
 	}
 
 	return nil
 }
 
+// timeColumns reports for each column whether its declared type is date or
+// datetime, so wide rows don't inspect the type names for every value
+func timeColumns(columns, types []string) []bool {
+	kinds := make([]bool, len(columns))
+	for i := range kinds {
+		if i < len(types) {
+			switch strings.ToLower(types[i]) {
+			case "date", "datetime":
+				kinds[i] = true
+			}
+		}
+	}
+	return kinds
+}
+
+// dedupColumns renames repeated column names to name_1, name_2, ... keeping
+// the first occurrence and the server column order intact
+func dedupColumns(columns []string) []string {
+	taken := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		taken[col] = true
+	}
+
+	seen := make(map[string]bool, len(columns))
+	result := make([]string, len(columns))
+	for i, col := range columns {
+		if !seen[col] {
+			seen[col] = true
+			result[i] = col
+			continue
+		}
+
+		for n := 1; ; n++ {
+			alias := fmt.Sprintf("%s_%d", col, n)
+			if !taken[alias] {
+				taken[alias] = true
+				result[i] = alias
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// parseTime converts a date/datetime column value to time.Time. Numbers are
+// Unix seconds, or milliseconds with TimeFormatUnixMilli; with utc the time
+// is returned in UTC.
+func parseTime(src interface{}, format TimeFormat, utc bool) (time.Time, error) {
+	t, err := parseTimeValue(src, format)
+	if err != nil || !utc {
+		return t, err
+	}
+	return t.UTC(), nil
+}
+
+// parseTimeValue converts a date/datetime column value to time.Time
+func parseTimeValue(src interface{}, format TimeFormat) (time.Time, error) {
+	unix := func(n int64) time.Time {
+		if format == TimeFormatUnixMilli {
+			return time.UnixMilli(n)
+		}
+		return time.Unix(n, 0)
+	}
+
+	switch src := src.(type) {
+	case string:
+		const layout = "2006-01-02 15:04:05"
+		if t, err := time.Parse(layout, src); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.RFC3339, src)
+	case json.Number:
+		sec, err := src.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return unix(int64(sec)), nil
+	case float64:
+		return unix(int64(src)), nil
+	case int64:
+		return unix(src), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time type: %T val: %v", src, src)
+}
+
 // convertValue converts rqlite values to driver values
 func convertValue(val interface{}) driver.Value {
 	if val == nil {
@@ -0,0 +1,167 @@
+package rsqlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// DownloadOptions configures DownloadBackup
+type DownloadOptions struct {
+	// MaxAttempts bounds the number of requests, resumptions included; 5 when 0
+	MaxAttempts int
+	// RetryDelay is the pause between attempts; 1s when 0
+	RetryDelay time.Duration
+}
+
+// BackupInfo describes a downloaded snapshot
+type BackupInfo struct {
+	// Size is the size of the snapshot in bytes
+	Size int64
+	// SHA256 is the hex encoded checksum of the snapshot
+	SHA256 string
+	// Verified is true when the server announced a checksum and it matched
+	Verified bool
+	// Resumed counts the attempts that continued a partial download
+	Resumed int
+}
+
+// DownloadBackup downloads a SQLite snapshot into the file at path. Data is
+// written to path+".part" first and renamed once complete. When a transfer
+// breaks, the next attempt asks for the missing range of the same snapshot,
+// identified by its ETag; servers or gateways unable to serve it send the
+// whole snapshot again and the download restarts. A partial file left by an
+// earlier call is resumed the same way. The checksum of the result is
+// verified against the Repr-Digest or Digest header when the server sends one.
+func (c *Connector) DownloadBackup(ctx context.Context, path string, opts DownloadOptions) (*BackupInfo, error) {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	retryDelay := opts.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+
+	partPath := path + ".part"
+	etagPath := partPath + ".etag"
+
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	etag := ""
+	if saved, err := os.ReadFile(etagPath); err == nil {
+		etag = string(saved)
+	}
+
+	cfg, _ := c.current()
+	// No overall client timeout: snapshots can be large, ctx bounds the transfer
+	httpClient := newHTTPClient(cfg, 0)
+
+	info := &BackupInfo{}
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retryDelay):
+			}
+		}
+
+		nodes := c.candidateNodes(ctx)
+		if len(nodes) == 0 {
+			return nil, errors.New("no nodes available")
+		}
+		client := newAPIClientForConfig(nodes[0], httpClient, cfg)
+
+		offset, err := file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+
+		part, err := client.backupFrom(ctx, offset, etag, func(part *backupPart) (io.Writer, error) {
+			if part.partial {
+				info.Resumed++
+			} else if err := restartFile(file); err != nil {
+				return nil, err
+			}
+
+			etag = part.etag
+			if etag == "" {
+				os.Remove(etagPath)
+				return file, nil
+			}
+			return file, os.WriteFile(etagPath, []byte(etag), 0o600)
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		sum, size, err := fileSHA256(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if part.digest != nil {
+			if !bytes.Equal(part.digest, sum) {
+				// Corrupt data can't be resumed, start over
+				lastErr = fmt.Errorf("backup checksum mismatch: got %x, server announced %x", sum, part.digest)
+				etag = ""
+				os.Remove(etagPath)
+				if err := restartFile(file); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			info.Verified = true
+		}
+
+		info.Size = size
+		info.SHA256 = hex.EncodeToString(sum)
+
+		if err := file.Close(); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(partPath, path); err != nil {
+			return nil, err
+		}
+		os.Remove(etagPath)
+		return info, nil
+	}
+
+	return nil, fmt.Errorf("backup download failed after %d attempts: %w", maxAttempts, lastErr)
+}
+
+// restartFile empties a partial download
+func restartFile(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	return err
+}
+
+// fileSHA256 returns the checksum and size of a file's content
+func fileSHA256(file *os.File) ([]byte, int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return nil, 0, err
+	}
+	return h.Sum(nil), size, nil
+}
@@ -0,0 +1,241 @@
+package rsqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// backupVersion is a snapshot served by a test node
+type backupVersion struct {
+	data string
+	etag string
+	// digest overrides the announced checksum when set
+	digest string
+	// breakAt cuts a whole snapshot transfer after that many bytes
+	breakAt int
+}
+
+// backupNode serves one snapshot version per request and records the range
+// headers it received
+type backupNode struct {
+	mu       sync.Mutex
+	versions []backupVersion
+	ranges   []string
+}
+
+func (n *backupNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/db/backup" {
+		http.NotFound(w, r)
+		return
+	}
+
+	n.mu.Lock()
+	v := n.versions[0]
+	if len(n.versions) > 1 {
+		n.versions = n.versions[1:]
+	}
+	rng := r.Header.Get("Range")
+	if rng != "" {
+		rng += " if " + r.Header.Get("If-Range")
+	}
+	n.ranges = append(n.ranges, rng)
+	n.mu.Unlock()
+
+	digest := v.digest
+	if digest == "" {
+		sum := sha256.Sum256([]byte(v.data))
+		digest = base64.StdEncoding.EncodeToString(sum[:])
+	}
+	w.Header().Set("ETag", v.etag)
+	w.Header().Set("Repr-Digest", "sha-256=:"+digest+":")
+
+	if offset, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok && r.Header.Get("If-Range") == v.etag {
+		start, _ := strconv.Atoi(strings.TrimSuffix(offset, "-"))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(v.data)-1, len(v.data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(v.data[start:]))
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(v.data)))
+	if v.breakAt > 0 {
+		w.Write([]byte(v.data[:v.breakAt]))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.Write([]byte(v.data))
+}
+
+// downloadFrom downloads the snapshot of node to path
+func downloadFrom(t *testing.T, node *backupNode, path string) (*BackupInfo, error) {
+	t.Helper()
+
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+
+	return connector.DownloadBackup(context.Background(), path, DownloadOptions{MaxAttempts: 3, RetryDelay: time.Millisecond})
+}
+
+// checkDownloaded verifies the downloaded file and that no partial files are left
+func checkDownloaded(t *testing.T, path, want string) {
+	t.Helper()
+	if data, err := os.ReadFile(path); err != nil || string(data) != want {
+		t.Errorf("downloaded %q, %v, want %q", data, err, want)
+	}
+	for _, leftover := range []string{path + ".part", path + ".part.etag"} {
+		if _, err := os.Stat(leftover); err == nil {
+			t.Errorf("%s left behind", filepath.Base(leftover))
+		}
+	}
+}
+
+func TestDownloadBackupResumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.sqlite")
+	snapshot := strings.Repeat("0123456789", 100)
+	node := &backupNode{versions: []backupVersion{
+		{data: snapshot, etag: `"v1"`, breakAt: 300},
+		{data: snapshot, etag: `"v1"`},
+	}}
+
+	info, err := downloadFrom(t, node, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", `bytes=300- if "v1"`}; !equalStrings(node.ranges, want) {
+		t.Errorf("requested ranges %q, want %q", node.ranges, want)
+	}
+	sum := sha256.Sum256([]byte(snapshot))
+	if info.Resumed != 1 || !info.Verified || info.Size != int64(len(snapshot)) || info.SHA256 != fmt.Sprintf("%x", sum) {
+		t.Errorf("download info %+v", info)
+	}
+	checkDownloaded(t, path, snapshot)
+}
+
+func TestDownloadBackupRestartsOnWholeSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.sqlite")
+	// The snapshot changed between the attempts, the range is answered with all of it
+	node := &backupNode{versions: []backupVersion{
+		{data: strings.Repeat("a", 1000), etag: `"v1"`, breakAt: 300},
+		{data: strings.Repeat("b", 800), etag: `"v2"`},
+	}}
+
+	info, err := downloadFrom(t, node, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", `bytes=300- if "v1"`}; !equalStrings(node.ranges, want) {
+		t.Errorf("requested ranges %q, want %q", node.ranges, want)
+	}
+	if info.Resumed != 0 || !info.Verified || info.Size != 800 {
+		t.Errorf("download info %+v", info)
+	}
+	checkDownloaded(t, path, strings.Repeat("b", 800))
+}
+
+func TestDownloadBackupDigestMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.sqlite")
+	wrong := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	node := &backupNode{versions: []backupVersion{
+		{data: "snapshot", etag: `"v1"`, digest: wrong},
+		{data: "snapshot", etag: `"v1"`},
+	}}
+
+	// Corrupt data is downloaded again from the start, not resumed
+	info, err := downloadFrom(t, node, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", ""}; !equalStrings(node.ranges, want) {
+		t.Errorf("requested ranges %q, want %q", node.ranges, want)
+	}
+	if info.Resumed != 0 || !info.Verified {
+		t.Errorf("download info %+v", info)
+	}
+	checkDownloaded(t, path, "snapshot")
+
+	// A checksum that never matches fails the download
+	path = filepath.Join(t.TempDir(), "backup.sqlite")
+	node = &backupNode{versions: []backupVersion{{data: "snapshot", etag: `"v1"`, digest: wrong}}}
+	if _, err := downloadFrom(t, node, path); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("download with a wrong checksum = %v", err)
+	}
+	if len(node.ranges) != 3 {
+		t.Errorf("%d attempts, want 3", len(node.ranges))
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("corrupt snapshot renamed into place")
+	}
+}
+
+func TestDownloadBackupEarlierPartialFile(t *testing.T) {
+	snapshot := strings.Repeat("0123456789", 10)
+
+	tests := []struct {
+		name    string
+		etag    string
+		ranges  []string
+		resumed int
+	}{
+		// The snapshot of the earlier run is still served and is resumed
+		{"current", `"v1"`, []string{`bytes=40- if "v1"`}, 1},
+		// The earlier run got an older snapshot, its part is replaced
+		{"stale", `"v0"`, []string{`bytes=40- if "v0"`}, 0},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "backup.sqlite")
+		if err := os.WriteFile(path+".part", []byte(snapshot[:40]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+".part.etag", []byte(tt.etag), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		node := &backupNode{versions: []backupVersion{{data: snapshot, etag: `"v1"`}}}
+		info, err := downloadFrom(t, node, path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !equalStrings(node.ranges, tt.ranges) {
+			t.Errorf("%s: requested ranges %q, want %q", tt.name, node.ranges, tt.ranges)
+		}
+		if info.Resumed != tt.resumed || !info.Verified {
+			t.Errorf("%s: download info %+v", tt.name, info)
+		}
+		checkDownloaded(t, path, snapshot)
+	}
+
+	// A partial file without an etag can't be resumed
+	path := filepath.Join(t.TempDir(), "backup.sqlite")
+	if err := os.WriteFile(path+".part", []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	node := &backupNode{versions: []backupVersion{{data: snapshot, etag: `"v1"`}}}
+	if _, err := downloadFrom(t, node, path); err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(node.ranges, []string{""}) {
+		t.Errorf("requested ranges %q without an etag", node.ranges)
+	}
+	checkDownloaded(t, path, snapshot)
+}
@@ -0,0 +1,44 @@
+package rsqlite
+
+import (
+	"errors"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// defaultRetryJitter spreads the backoff when Config.Retry is nil
+const defaultRetryJitter = 0.2
+
+// RetryPolicy controls how failed statements, connection attempts and
+// leader discovery are retried: the first retry waits InitialInterval, every
+// further one Multiplier times longer, each wait randomly shortened or
+// lengthened by up to Jitter of it, so clients that failed together don't
+// retry in lockstep after a failover. See Config.Retry.
+type RetryPolicy = transport.RetryPolicy
+
+// retryPolicyFor returns the retry policy of the configuration: Config.Retry,
+// or the one MaxRetries, RetryBackoff and RetryMaxElapsed describe
+func retryPolicyFor(cfg *Config) transport.Retry {
+	policy := RetryPolicy{
+		MaxRetries:      cfg.MaxRetries,
+		InitialInterval: cfg.RetryBackoff,
+		Jitter:          defaultRetryJitter,
+		MaxElapsed:      cfg.RetryMaxElapsed,
+	}
+	if cfg.Retry != nil {
+		policy = *cfg.Retry
+	}
+	return transport.NewRetry(policy, clockFor(cfg), randFor(cfg))
+}
+
+// retryableError reports whether a statement that failed with err may
+// succeed when sent again, see transport.Retryable. A credential provider
+// that failed is asked again on the next statement, not retried, so
+// non-idempotent writes aren't sent twice for nothing.
+func retryableError(err error) bool {
+	var credErr *CredentialError
+	if errors.As(err, &credErr) {
+		return false
+	}
+	return transport.Retryable(err)
+}
@@ -0,0 +1,70 @@
+package rsqlite
+
+import (
+	"context"
+	"strings"
+)
+
+// returningMinVersion is the first rqlite release answering writes with the
+// rows of their RETURNING clause
+const returningMinVersion = "v8.30.0"
+
+// supportsReturning reports whether the node returns the rows of RETURNING clauses
+func (c *apiClient) supportsReturning() bool {
+	return versionAtLeast(c.serverVersion(), returningMinVersion)
+}
+
+// returningInsert rewrites a single INSERT or REPLACE statement to return
+// the rowid of the inserted rows, reporting false for other statements and
+// those that already have a RETURNING clause
+func returningInsert(query string) (string, bool) {
+	fp := Fingerprint(query)
+	if !strings.HasPrefix(fp, "insert ") && !strings.HasPrefix(fp, "replace ") {
+		return "", false
+	}
+	if strings.Contains(" "+fp+" ", " returning ") {
+		return "", false
+	}
+
+	trimmed := strings.TrimRight(strings.TrimSpace(query), ";")
+	if strings.Contains(trimmed, ";") {
+		return "", false
+	}
+	// A newline keeps the clause out of any trailing line comment
+	return trimmed + "\nRETURNING rowid", true
+}
+
+// execute sends a write to client. With Config.ReturningInsertID, INSERTs
+// sent to servers supporting RETURNING get their LastInsertId from the
+// returned rowid, which unlike last_insert_rowid also identifies the row an
+// upsert updated. Queued writes return no rows and are sent unchanged.
+func (c *Conn) execute(ctx context.Context, client *apiClient, query string, values []interface{}) (*StatementResult, error) {
+	if !c.cfg.ReturningInsertID || client.queue || !client.supportsReturning() {
+		return client.execute(ctx, query, values)
+	}
+	rewritten, ok := returningInsert(query)
+	if !ok {
+		return client.execute(ctx, query, values)
+	}
+
+	result, err := client.execute(ctx, rewritten, values)
+	if err != nil && strings.Contains(err.Error(), "no such column: rowid") {
+		// A WITHOUT ROWID table; the statement failed to prepare, so
+		// nothing was written
+		return client.execute(ctx, query, values)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Writes returning rows don't report rows_affected; every row inserted
+	// or updated returned its rowid, and the last one was inserted last
+	result.RowsAffected = int64(len(result.Values))
+	if n := len(result.Values); n > 0 && len(result.Values[n-1]) > 0 {
+		if id, err := toInt64(result.Values[n-1][0]); err == nil {
+			result.LastInsertID = id
+		}
+	}
+	result.Columns, result.Types, result.Values = nil, nil, nil
+	return result, nil
+}
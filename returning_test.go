@@ -0,0 +1,137 @@
+package rsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReturningInsert(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		ok    bool
+	}{
+		{"INSERT INTO t (x) VALUES (?)", "INSERT INTO t (x) VALUES (?)\nRETURNING rowid", true},
+		{"replace into t (x) values (1); ", "replace into t (x) values (1)\nRETURNING rowid", true},
+		{"INSERT INTO t (x) VALUES (?) -- note", "INSERT INTO t (x) VALUES (?) -- note\nRETURNING rowid", true},
+		{"INSERT INTO t (x) VALUES (?) RETURNING id", "", false},
+		{"INSERT INTO t (x) VALUES (1); INSERT INTO t (x) VALUES (2)", "", false},
+		{"UPDATE t SET x = 1", "", false},
+		{"INSERT INTO t (x) VALUES ('returning')", "INSERT INTO t (x) VALUES ('returning')\nRETURNING rowid", true},
+	}
+	for _, tt := range tests {
+		got, ok := returningInsert(tt.query)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("returningInsert(%q) = %q, %v, want %q, %v", tt.query, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// newReturningServer answers writes like an rqlite node of the given
+// version, returning rowids 41 and 42 for RETURNING clauses unless the
+// table has no rowid
+func newReturningServer(t *testing.T, version string, executed *[]string) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rqlite-Version", version)
+
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		json.Unmarshal(body, &statements)
+		query, _ := statements[0][0].(string)
+
+		if r.URL.Path != "/db/execute" {
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+			return
+		}
+		mu.Lock()
+		*executed = append(*executed, query)
+		mu.Unlock()
+
+		switch {
+		case strings.Contains(query, "norowid") && strings.Contains(query, "RETURNING"):
+			w.Write([]byte(`{"results": [{"error": "no such column: rowid"}]}`))
+		case strings.Contains(query, "RETURNING"):
+			w.Write([]byte(`{"results": [{"columns": ["rowid"], "types": ["integer"], "values": [[41], [42]]}]}`))
+		default:
+			w.Write([]byte(`{"results": [{"last_insert_id": 7, "rows_affected": 1}]}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestReturningInsertIDThroughServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		query    string
+		executed []string
+		id       int64
+		affected int64
+	}{
+		{
+			name:     "rowid returned",
+			version:  "v8.30.0",
+			query:    "INSERT INTO t (x) VALUES (1), (2)",
+			executed: []string{"INSERT INTO t (x) VALUES (1), (2)\nRETURNING rowid"},
+			id:       42,
+			affected: 2,
+		},
+		{
+			name:     "WITHOUT ROWID table",
+			version:  "v8.30.0",
+			query:    "INSERT INTO norowid (x) VALUES (1)",
+			executed: []string{"INSERT INTO norowid (x) VALUES (1)\nRETURNING rowid", "INSERT INTO norowid (x) VALUES (1)"},
+			id:       7,
+			affected: 1,
+		},
+		{
+			name:     "server without RETURNING",
+			version:  "v8.29.9",
+			query:    "INSERT INTO t (x) VALUES (1)",
+			executed: []string{"INSERT INTO t (x) VALUES (1)"},
+			id:       7,
+			affected: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var executed []string
+			server := newReturningServer(t, tt.version, &executed)
+
+			cfg, err := ParseDSN(server.URL + "?discovery=false&returning_insert_id=true")
+			if err != nil {
+				t.Fatal(err)
+			}
+			connector, err := NewConnector(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			result, err := db.Exec(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id, err := result.LastInsertId(); err != nil || id != tt.id {
+				t.Errorf("LastInsertId() = %d, %v, want %d", id, err, tt.id)
+			}
+			if n, err := result.RowsAffected(); err != nil || n != tt.affected {
+				t.Errorf("RowsAffected() = %d, %v, want %d", n, err, tt.affected)
+			}
+			if !equalStrings(executed, tt.executed) {
+				t.Errorf("server ran %q, want %q", executed, tt.executed)
+			}
+		})
+	}
+}
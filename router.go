@@ -0,0 +1,353 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RouterConfig configures a Router
+type RouterConfig struct {
+	// Shards maps shard names to the configuration of their cluster
+	Shards map[string]*Config
+	// Tables maps table names to the shard holding them
+	Tables map[string]string
+	// Default is the shard used for statements referencing no mapped table
+	Default string
+	// Route optionally picks the shard for a statement, e.g. by hashing an
+	// argument. Returning "" falls back to table-based routing.
+	Route func(ctx context.Context, query string, args []driver.NamedValue) string
+}
+
+// Router implements the database/sql/driver.Connector interface on top of
+// several rqlite clusters. Each statement is sent to the shard chosen by
+// WithShard, RouterConfig.Route or the tables it references, so a dataset can
+// outgrow a single raft group behind one *sql.DB.
+type Router struct {
+	cfg    RouterConfig
+	shards map[string]*Connector
+	// pools hold the shards' connections for FanOutQuery
+	pools map[string]*sql.DB
+}
+
+// NewRouter creates a router for the given shards
+func NewRouter(cfg RouterConfig) (*Router, error) {
+	if len(cfg.Shards) == 0 {
+		return nil, errors.New("router needs at least one shard")
+	}
+
+	var errs []error
+	shards := make(map[string]*Connector, len(cfg.Shards))
+	pools := make(map[string]*sql.DB, len(cfg.Shards))
+	for name, shardCfg := range cfg.Shards {
+		connector, err := NewConnector(shardCfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shard %q: %w", name, err))
+			continue
+		}
+		shards[name] = connector
+		pools[name] = sql.OpenDB(connector)
+	}
+
+	if cfg.Default != "" && cfg.Shards[cfg.Default] == nil {
+		errs = append(errs, fmt.Errorf("default shard %q is not configured", cfg.Default))
+	}
+
+	tables := make(map[string]string, len(cfg.Tables))
+	for table, shard := range cfg.Tables {
+		if cfg.Shards[shard] == nil {
+			errs = append(errs, fmt.Errorf("table %q is mapped to unknown shard %q", table, shard))
+		}
+		tables[strings.ToLower(table)] = shard
+	}
+	cfg.Tables = tables
+
+	router := &Router{cfg: cfg, shards: shards, pools: pools}
+	if err := errors.Join(errs...); err != nil {
+		// Stop the background work of the shards already created
+		router.Close()
+		return nil, err
+	}
+
+	return router, nil
+}
+
+// Close closes the connector of every shard, stopping their background
+// work, and the fan-out pools; sql.DB.Close calls it
+func (r *Router) Close() error {
+	var errs []error
+	for _, name := range r.ShardNames() {
+		// Closing the pool closes its connector
+		if err := r.pools[name].Close(); err != nil {
+			errs = append(errs, fmt.Errorf("shard %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Connect implements the database/sql/driver.Connector interface.
+// Shard connections are opened lazily on first use.
+func (r *Router) Connect(ctx context.Context) (driver.Conn, error) {
+	return &routerConn{
+		router: r,
+		conns:  make(map[string]driver.Conn),
+	}, nil
+}
+
+// Driver implements the database/sql/driver.Connector interface
+func (r *Router) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// ShardNames returns the configured shard names in sorted order
+func (r *Router) ShardNames() []string {
+	names := make([]string, 0, len(r.shards))
+	for name := range r.shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Shard returns the connector of the named shard, or nil
+func (r *Router) Shard(name string) *Connector {
+	return r.shards[name]
+}
+
+// route picks the shard for a statement
+func (r *Router) route(ctx context.Context, query string, args []driver.NamedValue) (string, error) {
+	if shard := ShardFromContext(ctx); shard != "" {
+		if r.shards[shard] == nil {
+			return "", fmt.Errorf("unknown shard %q", shard)
+		}
+		return shard, nil
+	}
+
+	if r.cfg.Route != nil {
+		if shard := r.cfg.Route(ctx, query, args); shard != "" {
+			if r.shards[shard] == nil {
+				return "", fmt.Errorf("route returned unknown shard %q", shard)
+			}
+			return shard, nil
+		}
+	}
+
+	shard := ""
+	for _, table := range referencedTables(query) {
+		tableShard, ok := r.cfg.Tables[table]
+		if !ok {
+			continue
+		}
+		if shard != "" && shard != tableShard {
+			return "", fmt.Errorf("statement spans shards %q and %q", shard, tableShard)
+		}
+		shard = tableShard
+	}
+
+	if shard == "" {
+		shard = r.cfg.Default
+	}
+	if shard == "" {
+		return "", errors.New("no shard for statement: map its tables or set a default shard")
+	}
+
+	return shard, nil
+}
+
+// referencedTables extracts the lowercased table names following FROM, JOIN,
+// INTO, UPDATE and TABLE keywords. It is a heuristic, not a SQL parser.
+func referencedTables(query string) []string {
+	tokens := strings.Fields(Fingerprint(query))
+
+	var tables []string
+	for i := 0; i+1 < len(tokens); i++ {
+		switch tokens[i] {
+		case "from", "join", "into", "update", "table":
+		default:
+			continue
+		}
+
+		j := i + 1
+		// Skip IF NOT EXISTS / IF EXISTS
+		for j < len(tokens) && (tokens[j] == "if" || tokens[j] == "not" || tokens[j] == "exists") {
+			j++
+		}
+		if j >= len(tokens) {
+			break
+		}
+
+		name := strings.TrimRight(tokens[j], ",;")
+		if i := strings.IndexByte(name, '('); i >= 0 {
+			name = name[:i]
+		}
+		if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+			name = name[dot+1:]
+		}
+		name = strings.Trim(name, "\"`[]")
+		if name != "" && name != "?" {
+			tables = append(tables, strings.ToLower(name))
+		}
+	}
+
+	return tables
+}
+
+// routerConn is the driver connection handed out by a Router
+type routerConn struct {
+	router *Router
+	mu     sync.Mutex
+	conns  map[string]driver.Conn
+	closed bool
+}
+
+// conn returns the connection to the named shard, opening it if needed
+func (rc *routerConn) conn(ctx context.Context, shard string) (driver.Conn, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed {
+		return nil, errors.New("connection is closed")
+	}
+
+	if conn, ok := rc.conns[shard]; ok {
+		return conn, nil
+	}
+
+	conn, err := rc.router.shards[shard].Connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("shard %q: %w", shard, err)
+	}
+
+	rc.conns[shard] = conn
+	return conn, nil
+}
+
+// Prepare implements the database/sql/driver.Conn interface
+func (rc *routerConn) Prepare(query string) (driver.Stmt, error) {
+	return rc.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext implements the database/sql/driver.ConnPrepareContext interface.
+// The shard is chosen when the statement is executed.
+func (rc *routerConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return &routerStmt{conn: rc, query: query}, nil
+}
+
+// Close implements the database/sql/driver.Conn interface
+func (rc *routerConn) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed {
+		return nil
+	}
+	rc.closed = true
+
+	var errs []error
+	for _, conn := range rc.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	rc.conns = nil
+
+	return errors.Join(errs...)
+}
+
+// Begin implements the database/sql/driver.Conn interface
+func (rc *routerConn) Begin() (driver.Tx, error) {
+	return rc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx implements the database/sql/driver.ConnBeginTx interface
+func (rc *routerConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	// rqlite doesn't support transactions, so this is a no-op
+	return &Tx{}, nil
+}
+
+// ExecContext implements the database/sql/driver.ExecerContext interface
+func (rc *routerConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	shard, err := rc.router.route(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := rc.conn(ctx, shard)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+// QueryContext implements the database/sql/driver.QueryerContext interface
+func (rc *routerConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	shard, err := rc.router.route(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := rc.conn(ctx, shard)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+// Ping implements the database/sql/driver.Pinger interface by pinging every shard
+func (rc *routerConn) Ping(ctx context.Context) error {
+	var errs []error
+	for _, shard := range rc.router.ShardNames() {
+		conn, err := rc.conn(ctx, shard)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := conn.(driver.Pinger).Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shard %q: %w", shard, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// routerStmt is a prepared statement routed at execution time
+type routerStmt struct {
+	conn  *routerConn
+	query string
+}
+
+// Close implements the database/sql/driver.Stmt interface
+func (s *routerStmt) Close() error {
+	return nil
+}
+
+// NumInput implements the database/sql/driver.Stmt interface
+func (s *routerStmt) NumInput() int {
+	return -1
+}
+
+// Exec implements the database/sql/driver.Stmt interface
+func (s *routerStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), convertToNamedValues(args))
+}
+
+// ExecContext implements the database/sql/driver.StmtExecContext interface
+func (s *routerStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+// Query implements the database/sql/driver.Stmt interface
+func (s *routerStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), convertToNamedValues(args))
+}
+
+// QueryContext implements the database/sql/driver.StmtQueryContext interface
+func (s *routerStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
@@ -0,0 +1,224 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newPolledShard returns the configuration of a shard whose write throttle
+// polls a test server, counting the polls
+func newPolledShard(t *testing.T, polls *atomic.Int64) *Config {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			polls.Add(1)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Throttle = &ThrottleConfig{Interval: time.Millisecond, MaxRate: 100}
+	return cfg
+}
+
+// waitForPolls waits until the throttle polled at least once
+func waitForPolls(t *testing.T, polls *atomic.Int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for polls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if polls.Load() == 0 {
+		t.Fatal("throttle never polled the leader")
+	}
+}
+
+// newCountingShard returns the configuration of a shard whose test server
+// counts the queries that aren't connection probes
+func newCountingShard(t *testing.T, queries *atomic.Int32) *Config {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/db/") {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		json.Unmarshal(body, &statements)
+		if query, _ := statements[0][0].(string); query != "SELECT 1" {
+			queries.Add(1)
+		}
+		w.Write([]byte(`{"results": [{"columns": ["id", "name"], "types": ["integer", "text"], "values": [[1, "a"]]}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestRouterCloseStopsShards(t *testing.T) {
+	var pollsA, pollsB atomic.Int64
+	router, err := NewRouter(RouterConfig{
+		Shards:  map[string]*Config{"a": newPolledShard(t, &pollsA), "b": newPolledShard(t, &pollsB)},
+		Default: "a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPolls(t, &pollsA)
+	waitForPolls(t, &pollsB)
+
+	// sql.DB.Close closes the router
+	if err := sql.OpenDB(router).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Let requests already sent reach the servers
+	time.Sleep(20 * time.Millisecond)
+	a, b := pollsA.Load(), pollsB.Load()
+	time.Sleep(20 * time.Millisecond)
+	if pollsA.Load() != a || pollsB.Load() != b {
+		t.Error("shards still polling after Close")
+	}
+}
+
+func TestNewRouterFailureClosesShards(t *testing.T) {
+	var polls atomic.Int64
+	_, err := NewRouter(RouterConfig{
+		Shards:  map[string]*Config{"a": newPolledShard(t, &polls)},
+		Default: "missing",
+	})
+	if err == nil {
+		t.Fatal("router with an unknown default shard created")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	after := polls.Load()
+	time.Sleep(20 * time.Millisecond)
+	if polls.Load() != after {
+		t.Error("shard of the failed router still polling")
+	}
+}
+
+func TestReferencedTables(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT * FROM users WHERE id = 1", []string{"users"}},
+		{"select u.name from Users u join main.orders o on o.user_id = u.id", []string{"users", "orders"}},
+		{"INSERT INTO \"Orders\" (id) VALUES (?)", []string{"orders"}},
+		{"UPDATE [users] SET name = 'from x'", []string{"users"}},
+		{"CREATE TABLE IF NOT EXISTS orders(id INTEGER)", []string{"orders"}},
+		{"SELECT 1", nil},
+	}
+	for _, tt := range tests {
+		if got := referencedTables(tt.query); !equalStrings(got, tt.want) {
+			t.Errorf("referencedTables(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRouterRoutesStatements(t *testing.T) {
+	var a, b atomic.Int32
+	router, err := NewRouter(RouterConfig{
+		Shards:  map[string]*Config{"a": newCountingShard(t, &a), "b": newCountingShard(t, &b)},
+		Tables:  map[string]string{"users": "a", "orders": "b"},
+		Default: "a",
+		Route: func(ctx context.Context, query string, args []driver.NamedValue) string {
+			if strings.Contains(query, "events") && len(args) > 0 {
+				if id, _ := args[0].Value.(int64); id%2 == 0 {
+					return "b"
+				}
+				return "a"
+			}
+			return ""
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(router)
+	defer db.Close()
+
+	ctx := context.Background()
+	tests := []struct {
+		ctx   context.Context
+		query string
+		args  []interface{}
+		shard string
+	}{
+		{ctx, "SELECT id, name FROM users", nil, "a"},
+		{ctx, "SELECT id, name FROM orders", nil, "b"},
+		{ctx, "SELECT id, name FROM settings", nil, "a"},
+		{WithShard(ctx, "b"), "SELECT id, name FROM users", nil, "b"},
+		{ctx, "SELECT id, name FROM events WHERE id = ?", []interface{}{int64(4)}, "b"},
+		{ctx, "SELECT id, name FROM events WHERE id = ?", []interface{}{int64(5)}, "a"},
+	}
+	for _, tt := range tests {
+		rows, err := db.QueryContext(tt.ctx, tt.query, tt.args...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		rows.Close()
+
+		shard := ""
+		if a.Swap(0) > 0 {
+			shard = "a"
+		}
+		if b.Swap(0) > 0 {
+			shard += "b"
+		}
+		if shard != tt.shard {
+			t.Errorf("%s routed to %q, want %q", tt.query, shard, tt.shard)
+		}
+	}
+
+	// Prepared statements are routed when they run
+	stmt, err := db.Prepare("SELECT id, name FROM events WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{6, 7} {
+		rows, err := stmt.Query(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+	stmt.Close()
+	if a.Load() != 1 || b.Load() != 1 {
+		t.Errorf("prepared statement ran %d times on a and %d on b, want once each", a.Load(), b.Load())
+	}
+
+	for _, tt := range []struct {
+		ctx   context.Context
+		query string
+	}{
+		{ctx, "SELECT * FROM users JOIN orders ON orders.user_id = users.id"},
+		{WithShard(ctx, "c"), "SELECT * FROM users"},
+	} {
+		if _, err := db.QueryContext(tt.ctx, tt.query); err == nil {
+			t.Errorf("%s routed despite no single shard", tt.query)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp embedded in scheduled backup names. It
+// sorts lexically in time order.
+const backupTimeFormat = "20060102T150405Z"
+
+// BackupSink stores the snapshots taken by a BackupScheduler. Object stores
+// such as S3-compatible services are plugged in by implementing it over
+// their client, with names used as object keys.
+type BackupSink interface {
+	// Put stores the backup read from r under name
+	Put(ctx context.Context, name string, r io.Reader) error
+	// List returns the names of the stored backups
+	List(ctx context.Context) ([]string, error)
+	// Delete removes a stored backup
+	Delete(ctx context.Context, name string) error
+}
+
+// FileSink is a BackupSink writing backups as files in Dir
+type FileSink struct {
+	Dir string
+}
+
+// Put implements the BackupSink interface. The file only appears under its
+// final name once it has been written completely.
+func (s FileSink) Put(ctx context.Context, name string, r io.Reader) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, name))
+}
+
+// List implements the BackupSink interface
+func (s FileSink) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete implements the BackupSink interface
+func (s FileSink) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(s.Dir, name))
+}
+
+// BackupSchedule configures periodic backups
+type BackupSchedule struct {
+	// Interval between backups
+	Interval time.Duration
+	// Sink receives the backups
+	Sink BackupSink
+	// Prefix starts the name of every backup, default "rqlite-". Only
+	// backups with this prefix are subject to retention.
+	Prefix string
+	// Retain is the number of most recent backups kept, 0 keeps all
+	Retain int
+	// MaxAge removes backups older than this, 0 disables age-based pruning
+	MaxAge time.Duration
+	// OnBackup is called after every successful backup
+	OnBackup func(name string)
+	// OnError is called when a backup or pruning fails
+	OnError func(err error)
+}
+
+// BackupScheduler takes backups of a cluster at a fixed interval
+type BackupScheduler struct {
+	connector *Connector
+	schedule  BackupSchedule
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	// last is the timestamp of the latest backup name and seq the number of
+	// backups named with it, so backups taken within a second get a suffix
+	last string
+	seq  int
+}
+
+// ScheduleBackups starts taking a backup every schedule.Interval into
+// schedule.Sink, pruning old backups after each one, until Stop or the
+// connector's Close. The first backup is taken after one interval; call
+// RunNow for an immediate one.
+func (c *Connector) ScheduleBackups(schedule BackupSchedule) (*BackupScheduler, error) {
+	if schedule.Interval <= 0 {
+		return nil, errors.New("backup interval must be positive")
+	}
+	if schedule.Sink == nil {
+		return nil, errors.New("backup sink is required")
+	}
+	if schedule.Retain < 0 {
+		return nil, errors.New("backup retention must not be negative")
+	}
+	if schedule.MaxAge < 0 {
+		return nil, errors.New("backup max age must not be negative")
+	}
+	if schedule.Prefix == "" {
+		schedule.Prefix = "rqlite-"
+	}
+
+	s := &BackupScheduler{
+		connector: c,
+		schedule:  schedule,
+		done:      make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	s.cancel = cancel
+	go s.loop(ctx)
+
+	return s, nil
+}
+
+// loop runs scheduled backups until ctx is cancelled
+func (s *BackupScheduler) loop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.schedule.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunNow(ctx); err != nil && s.schedule.OnError != nil && ctx.Err() == nil {
+				s.schedule.OnError(err)
+			}
+		}
+	}
+}
+
+// RunNow takes a backup immediately, prunes old backups and returns the
+// name the backup was stored under
+func (s *BackupScheduler) RunNow(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	name := s.backupName(now)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.connector.Backup(ctx, pw))
+	}()
+
+	if err := s.schedule.Sink.Put(ctx, name, pr); err != nil {
+		pr.CloseWithError(err)
+		return "", fmt.Errorf("backup %s failed: %w", name, err)
+	}
+
+	if s.schedule.OnBackup != nil {
+		s.schedule.OnBackup(name)
+	}
+
+	if err := s.prune(ctx, now); err != nil {
+		return name, fmt.Errorf("backup retention failed: %w", err)
+	}
+
+	return name, nil
+}
+
+// backupName returns the name of a backup taken at now. Names have one
+// second resolution, so later backups in the same second are numbered from
+// 2 on: rqlite-20240102T150405Z.sqlite, rqlite-20240102T150405Z-2.sqlite.
+func (s *BackupScheduler) backupName(now time.Time) string {
+	stamp := now.Format(backupTimeFormat)
+	if stamp != s.last {
+		s.last, s.seq = stamp, 1
+		return s.schedule.Prefix + stamp + ".sqlite"
+	}
+	s.seq++
+	return s.schedule.Prefix + stamp + "-" + strconv.Itoa(s.seq) + ".sqlite"
+}
+
+// prune deletes backups beyond the retention count or older than MaxAge
+func (s *BackupScheduler) prune(ctx context.Context, now time.Time) error {
+	if s.schedule.Retain == 0 && s.schedule.MaxAge == 0 {
+		return nil
+	}
+
+	names, err := s.schedule.Sink.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	type backup struct {
+		name  string
+		taken time.Time
+		seq   int
+	}
+	var backups []backup
+	for _, name := range names {
+		if taken, seq, ok := s.backupTime(name); ok {
+			backups = append(backups, backup{name: name, taken: taken, seq: seq})
+		}
+	}
+
+	// Newest first
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].taken.Equal(backups[j].taken) {
+			return backups[i].taken.After(backups[j].taken)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+
+	var errs []error
+	for i, b := range backups {
+		expired := s.schedule.MaxAge > 0 && now.Sub(b.taken) > s.schedule.MaxAge
+		if (s.schedule.Retain > 0 && i >= s.schedule.Retain) || expired {
+			if err := s.schedule.Sink.Delete(ctx, b.name); err != nil {
+				errs = append(errs, fmt.Errorf("delete %s: %w", b.name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// backupTime parses the time a scheduled backup was taken from its name,
+// and its number among the backups taken in that second
+func (s *BackupScheduler) backupTime(name string) (time.Time, int, bool) {
+	rest, ok := strings.CutPrefix(name, s.schedule.Prefix)
+	if !ok || len(rest) < len(backupTimeFormat) {
+		return time.Time{}, 0, false
+	}
+
+	taken, err := time.Parse(backupTimeFormat, rest[:len(backupTimeFormat)])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	seq := 1
+	if suffix, ok := strings.CutPrefix(rest[len(backupTimeFormat):], "-"); ok {
+		digits, _, _ := strings.Cut(suffix, ".")
+		if n, err := strconv.Atoi(digits); err == nil {
+			seq = n
+		}
+	}
+	return taken, seq, true
+}
+
+// Stop stops the schedule and waits for a running backup to be cancelled
+func (s *BackupScheduler) Stop() {
+	s.cancel()
+	<-s.done
+}
@@ -0,0 +1,231 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink is a BackupSink keeping backups in memory
+type memorySink struct {
+	mu      sync.Mutex
+	backups map[string]string
+}
+
+func (s *memorySink) Put(ctx context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backups == nil {
+		s.backups = make(map[string]string)
+	}
+	if _, ok := s.backups[name]; ok {
+		return errors.New("backup " + name + " overwritten")
+	}
+	s.backups[name] = string(data)
+	return nil
+}
+
+func (s *memorySink) List(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.backups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *memorySink) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.backups, name)
+	return nil
+}
+
+// newBackupConnector returns a connector to a node serving snapshot as its backup
+func newBackupConnector(t *testing.T, snapshot string) *Connector {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/backup" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(snapshot))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connector.Close() })
+	return connector
+}
+
+func TestScheduleBackupsValidation(t *testing.T) {
+	connector := newBackupConnector(t, "")
+	sink := &memorySink{}
+	for _, schedule := range []BackupSchedule{
+		{Sink: sink},
+		{Interval: time.Hour},
+		{Interval: time.Hour, Sink: sink, Retain: -1},
+		{Interval: time.Hour, Sink: sink, MaxAge: -time.Hour},
+	} {
+		if _, err := connector.ScheduleBackups(schedule); err == nil {
+			t.Errorf("schedule %+v accepted", schedule)
+		}
+	}
+}
+
+func TestBackupSchedulerRunNow(t *testing.T) {
+	connector := newBackupConnector(t, "snapshot")
+	sink := &memorySink{}
+	var taken []string
+	scheduler, err := connector.ScheduleBackups(BackupSchedule{
+		Interval: time.Hour,
+		Sink:     sink,
+		Retain:   2,
+		OnBackup: func(name string) { taken = append(taken, name) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Stop()
+
+	// Backups in quick succession, within a second, get distinct names
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		name, err := scheduler.RunNow(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(name, "rqlite-") || !strings.HasSuffix(name, ".sqlite") {
+			t.Errorf("backup name %q", name)
+		}
+	}
+	if len(taken) != 3 || taken[0] == taken[1] || taken[1] == taken[2] {
+		t.Fatalf("backups taken as %q", taken)
+	}
+
+	// Retention keeps the two newest
+	names, _ := sink.List(ctx)
+	newest := append([]string(nil), taken[1:]...)
+	sort.Strings(newest)
+	if !equalStrings(names, newest) {
+		t.Errorf("sink holds %q after retention, want the last two of %q", names, taken)
+	}
+	if data := sink.backups[names[0]]; data != "snapshot" {
+		t.Errorf("backup holds %q", data)
+	}
+}
+
+func TestBackupSchedulerPrune(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	sink := &memorySink{backups: map[string]string{
+		"rqlite-20240102T150405Z.sqlite":   "",
+		"rqlite-20240102T150405Z-2.sqlite": "",
+		"rqlite-20240102T150405Z-3.sqlite": "",
+		"rqlite-20240102T140405Z.sqlite":   "",
+		"rqlite-20231231T150405Z.sqlite":   "",
+		"other-20200101T000000Z.sqlite":    "",
+		"rqlite-latest.sqlite":             "",
+	}}
+
+	tests := []struct {
+		retain int
+		maxAge time.Duration
+		want   []string
+	}{
+		{0, 0, []string{
+			"other-20200101T000000Z.sqlite", "rqlite-20231231T150405Z.sqlite", "rqlite-20240102T140405Z.sqlite",
+			"rqlite-20240102T150405Z-2.sqlite", "rqlite-20240102T150405Z-3.sqlite", "rqlite-20240102T150405Z.sqlite", "rqlite-latest.sqlite",
+		}},
+		{0, 24 * time.Hour, []string{
+			"other-20200101T000000Z.sqlite", "rqlite-20240102T140405Z.sqlite",
+			"rqlite-20240102T150405Z-2.sqlite", "rqlite-20240102T150405Z-3.sqlite", "rqlite-20240102T150405Z.sqlite", "rqlite-latest.sqlite",
+		}},
+		// Backups of the same second are ordered by their number
+		{2, 0, []string{
+			"other-20200101T000000Z.sqlite", "rqlite-20240102T150405Z-2.sqlite", "rqlite-20240102T150405Z-3.sqlite", "rqlite-latest.sqlite",
+		}},
+		{1, time.Minute, []string{"other-20200101T000000Z.sqlite", "rqlite-20240102T150405Z-3.sqlite", "rqlite-latest.sqlite"}},
+	}
+	for _, tt := range tests {
+		s := &BackupScheduler{schedule: BackupSchedule{Prefix: "rqlite-", Retain: tt.retain, MaxAge: tt.maxAge, Sink: sink}}
+		if err := s.prune(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+		if names, _ := sink.List(context.Background()); !equalStrings(names, tt.want) {
+			t.Errorf("retain %d, max age %v: kept %q, want %q", tt.retain, tt.maxAge, names, tt.want)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	sink := FileSink{Dir: dir}
+	ctx := context.Background()
+
+	// Listing a directory that doesn't exist yet is empty
+	if names, err := sink.List(ctx); err != nil || len(names) != 0 {
+		t.Fatalf("list of a missing dir = %q, %v", names, err)
+	}
+
+	for _, name := range []string{"b.sqlite", "a.sqlite"} {
+		if err := sink.Put(ctx, name, strings.NewReader("data of "+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A failed upload leaves nothing behind
+	if err := sink.Put(ctx, "c.sqlite", io.MultiReader(strings.NewReader("partial"), errReader{})); err == nil {
+		t.Error("put of a failing reader succeeded")
+	}
+
+	names, err := sink.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if want := []string{"a.sqlite", "b.sqlite"}; !equalStrings(names, want) {
+		t.Errorf("listed %q, want %q", names, want)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d files in the sink dir, want no temporary files", len(entries))
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.sqlite")); string(data) != "data of a.sqlite" {
+		t.Errorf("a.sqlite holds %q", data)
+	}
+
+	if err := sink.Delete(ctx, "a.sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := sink.List(ctx); !equalStrings(names, []string{"b.sqlite"}) {
+		t.Errorf("listed %q after delete", names)
+	}
+}
+
+// errReader fails every read
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
@@ -0,0 +1,164 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// scoreAlpha is the weight of a new sample in the moving averages of a node's
+// round-trip and error rate
+const scoreAlpha = 0.2
+
+// scoreErrorPenalty scales how much the error rate inflates a node's score,
+// so a node failing half its requests ranks like one six times slower
+const scoreErrorPenalty = 10
+
+// nodeStats holds the moving averages of a node's requests and health probes
+type nodeStats struct {
+	// latency is the average round-trip of successful samples
+	latency   time.Duration
+	errorRate float64
+	samples   int64
+	successes int64
+	updatedAt time.Time
+}
+
+// NodeScore describes how node selection ranks a node, see ClusterManager.Scores
+type NodeScore struct {
+	Node string `json:"node"`
+	// Latency is the moving average round-trip of the node's successful
+	// requests and health probes
+	Latency time.Duration `json:"latency"`
+	// ErrorRate is the moving average share of failed requests, from 0 to 1
+	ErrorRate float64 `json:"error_rate"`
+	// Samples is the number of requests and probes observed
+	Samples int64 `json:"samples"`
+	// Score is the latency in seconds inflated by the error rate; lower is
+	// better, and +Inf until a request succeeds
+	Score float64 `json:"score"`
+	// Down reports whether node selection skips the node as recently failed
+	Down bool `json:"down"`
+	// UpdatedAt is the time of the last sample
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// score ranks the node, lower is better
+func (s *nodeStats) score() float64 {
+	if s.successes == 0 {
+		return math.Inf(1)
+	}
+	return s.latency.Seconds() * (1 + scoreErrorPenalty*s.errorRate)
+}
+
+// recordSample adds the round-trip of a request or health probe to the
+// node's moving averages; err marks the request failed. A success ends the
+// node's quarantine.
+func (cm *ClusterManager) recordSample(node string, latency time.Duration, err error) {
+	node = transport.NormalizeNode(node)
+
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+	if cm.scores == nil {
+		cm.scores = make(map[string]*nodeStats)
+	}
+	stats, ok := cm.scores[node]
+	if !ok {
+		stats = &nodeStats{}
+		cm.scores[node] = stats
+	}
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	if stats.samples == 0 {
+		stats.errorRate = failed
+	} else {
+		stats.errorRate += scoreAlpha * (failed - stats.errorRate)
+	}
+	if err == nil {
+		if stats.successes == 0 {
+			stats.latency = latency
+		} else {
+			stats.latency += time.Duration(scoreAlpha * float64(latency-stats.latency))
+		}
+		stats.successes++
+		cm.recoverLocked(node)
+	}
+	stats.samples++
+	stats.updatedAt = cm.clock.Now()
+}
+
+// scoreLocked returns the node's score, +Inf without samples; cm.healthMu must be held
+func (cm *ClusterManager) scoreLocked(node string) float64 {
+	stats, ok := cm.scores[transport.NormalizeNode(node)]
+	if !ok {
+		return math.Inf(1)
+	}
+	return stats.score()
+}
+
+// fastestLocked returns the node with the lowest score, the first one on
+// ties, so nodes without samples keep their order; cm.healthMu must be held
+func (cm *ClusterManager) fastestLocked(nodes []string) string {
+	var fastest string
+	best := math.Inf(1)
+	for _, node := range nodes {
+		if score := cm.scoreLocked(node); fastest == "" || score < best {
+			fastest, best = node, score
+		}
+	}
+	return fastest
+}
+
+// Scores returns the ranking of every node requests or health probes were
+// sent to, best first, for debugging node selection
+func (cm *ClusterManager) Scores() []NodeScore {
+	cm.healthMu.Lock()
+	defer cm.healthMu.Unlock()
+
+	scores := make([]NodeScore, 0, len(cm.scores))
+	for node, stats := range cm.scores {
+		scores = append(scores, NodeScore{
+			Node:      node,
+			Latency:   stats.latency,
+			ErrorRate: stats.errorRate,
+			Samples:   stats.samples,
+			Score:     stats.score(),
+			Down:      cm.downLocked(node),
+			UpdatedAt: stats.updatedAt,
+		})
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score < scores[j].Score
+		}
+		return scores[i].Node < scores[j].Node
+	})
+	return scores
+}
+
+// NodeScores returns the ranking of the cluster's nodes, see ClusterManager.Scores
+func (c *Connector) NodeScores() []NodeScore {
+	return c.sharedClusterManager().Scores()
+}
+
+// recordSample reports the round-trip of a statement request to the sample
+// hook. Server errors count as failures; requests the caller cancelled say
+// nothing about the node and are not recorded.
+func (c *apiClient) recordSample(start time.Time, resp *http.Response, err error) {
+	if c.sample == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		err = errors.New(resp.Status)
+	}
+	c.sample(c.node, time.Since(start), err)
+}
@@ -0,0 +1,97 @@
+package rsqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Sequences returns the AUTOINCREMENT counters of sqlite_sequence, keyed by table
+func (c *Connector) Sequences(ctx context.Context) (map[string]int64, error) {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.query(ctx, "strong", "SELECT name, seq FROM sqlite_sequence", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sequences := make(map[string]int64, len(result.Values))
+	for _, row := range result.Values {
+		if len(row) < 2 {
+			continue
+		}
+		name, _ := row[0].(string)
+		seq, err := toInt64(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("sequence of %q: %w", name, err)
+		}
+		sequences[name] = seq
+	}
+
+	return sequences, nil
+}
+
+// SetSequence sets the AUTOINCREMENT counter of a table, so the next generated
+// id is seq+1. The counter row is created when the table has none yet.
+func (c *Connector) SetSequence(ctx context.Context, table string, seq int64) error {
+	return c.writeSequence(ctx,
+		Statement{Query: "UPDATE sqlite_sequence SET seq = ? WHERE name = ?", Args: []interface{}{seq, table}},
+		Statement{
+			Query: "INSERT INTO sqlite_sequence (name, seq) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = ?)",
+			Args:  []interface{}{table, seq, table},
+		},
+	)
+}
+
+// ResetSequence sets the AUTOINCREMENT counter of a table to its largest rowid,
+// or 0 when it is empty, which is what bulk loads with explicit ids need
+func (c *Connector) ResetSequence(ctx context.Context, table string) error {
+	maxRowid := "(SELECT COALESCE(MAX(rowid), 0) FROM " + quoteIdent(table) + ")"
+	return c.writeSequence(ctx,
+		Statement{Query: "UPDATE sqlite_sequence SET seq = " + maxRowid + " WHERE name = ?", Args: []interface{}{table}},
+		Statement{
+			Query: "INSERT INTO sqlite_sequence (name, seq) SELECT ?, " + maxRowid + " WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = ?)",
+			Args:  []interface{}{table, table},
+		},
+	)
+}
+
+// writeSequence runs sequence updates atomically on the leader
+func (c *Connector) writeSequence(ctx context.Context, statements ...Statement) error {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	results, err := client.executeBatch(ctx, statements, true)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			return errors.New(result.Error)
+		}
+	}
+	return nil
+}
+
+// toInt64 converts an integer result value to int64
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return strconv.ParseInt(n.String(), 10, 64)
+	case int64:
+		return n, nil
+	case float64:
+		return int64(n), nil
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	}
+	return 0, fmt.Errorf("unexpected integer value %v", v)
+}
@@ -0,0 +1,408 @@
+//go:build soak
+
+package rsqlite
+
+// The soak test runs a mixed read and write workload for a long time while
+// the cluster's leader keeps changing, and checks that no acknowledged write
+// is lost and that the share of failed operations stays bounded:
+//
+//	go test -tags soak -run TestSoak -timeout 0 -soak.duration 4h .
+//
+// By default it runs against an in-process fake cluster of three nodes whose
+// leader is crashed, re-elected and restarted, or hands over leadership, on
+// a schedule. With -soak.dsn, or RQLITE_DSN, it runs against a real cluster
+// instead, e.g. one started by devcluster, and faults are left to the
+// operator, e.g. killing and restarting nodes while the test runs.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	soakDuration      = flag.Duration("soak.duration", time.Minute, "how long the workload runs")
+	soakWorkers       = flag.Int("soak.workers", 8, "number of concurrent workers")
+	soakWriteRatio    = flag.Float64("soak.write-ratio", 0.3, "share of operations that are writes")
+	soakFaultInterval = flag.Duration("soak.fault-interval", 5*time.Second, "time between injected faults")
+	soakElection      = flag.Duration("soak.election", 500*time.Millisecond, "how long the fake cluster has no leader after a crash")
+	soakMaxErrorRate  = flag.Float64("soak.max-error-rate", 0.05, "largest accepted share of failed operations")
+	soakDSN           = flag.String("soak.dsn", os.Getenv("RQLITE_DSN"), "run against this cluster instead of the fake one")
+)
+
+const (
+	soakCreate = "CREATE TABLE IF NOT EXISTS rsqlite_soak (id INTEGER PRIMARY KEY, val TEXT NOT NULL)"
+	soakDrop   = "DROP TABLE IF EXISTS rsqlite_soak"
+	soakInsert = "INSERT OR REPLACE INTO rsqlite_soak (id, val) VALUES (?, ?)"
+	soakSelect = "SELECT val FROM rsqlite_soak WHERE id = ?"
+)
+
+// soakValue is the value written for id, so reads can be checked without
+// sharing state between workers
+func soakValue(id int64) string {
+	return fmt.Sprintf("v%d-%x", id, id*2654435761)
+}
+
+// soakCounts are the outcomes of the workload
+type soakCounts struct {
+	reads, writes         atomic.Int64
+	readErrors, writeErrs atomic.Int64
+	// lost counts acknowledged writes missing or wrong when read back
+	lost atomic.Int64
+	// logged limits how many failures are logged on long runs
+	logged atomic.Int64
+}
+
+// logFailure logs the first failures of the workload
+func (c *soakCounts) logFailure(t *testing.T, format string, args ...interface{}) {
+	if c.logged.Add(1) <= 100 {
+		t.Logf(format, args...)
+	}
+}
+
+func TestSoak(t *testing.T) {
+	// stopFaults ends fault injection and heals the cluster
+	stopFaults := func() {}
+	dsn := *soakDSN
+	if dsn == "" {
+		fc := newFakeCluster(3)
+		defer fc.close()
+		dsn = fc.dsn() + "?max_retries=5&retry_backoff=100ms"
+
+		stop := make(chan struct{})
+		var faults sync.WaitGroup
+		faults.Add(1)
+		go func() {
+			defer faults.Done()
+			fc.injectFaults(t, *soakFaultInterval, *soakElection, stop)
+		}()
+		var once sync.Once
+		stopFaults = func() {
+			once.Do(func() {
+				close(stop)
+				faults.Wait()
+				fc.heal()
+			})
+		}
+		defer stopFaults()
+	}
+
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := context.Background()
+	for _, stmt := range []string{soakDrop, soakCreate} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	var (
+		counts soakCounts
+		nextID atomic.Int64
+		wg     sync.WaitGroup
+		acked  = make([][]int64, *soakWorkers)
+	)
+	deadline := time.Now().Add(*soakDuration)
+	for w := 0; w < *soakWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(w), 0))
+			for time.Now().Before(deadline) {
+				opCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				if len(acked[w]) == 0 || rng.Float64() < *soakWriteRatio {
+					id := nextID.Add(1)
+					counts.writes.Add(1)
+					if _, err := db.ExecContext(opCtx, soakInsert, id, soakValue(id)); err != nil {
+						counts.writeErrs.Add(1)
+						counts.logFailure(t, "write %d: %v", id, err)
+					} else {
+						acked[w] = append(acked[w], id)
+					}
+				} else {
+					id := acked[w][rng.IntN(len(acked[w]))]
+					counts.reads.Add(1)
+					var val string
+					err := db.QueryRowContext(opCtx, soakSelect, id).Scan(&val)
+					switch {
+					case errors.Is(err, sql.ErrNoRows):
+						counts.lost.Add(1)
+						t.Errorf("read %d: acknowledged write missing", id)
+					case err != nil:
+						counts.readErrors.Add(1)
+						counts.logFailure(t, "read %d: %v", id, err)
+					case val != soakValue(id):
+						counts.lost.Add(1)
+						t.Errorf("read %d: got %q, want %q", id, val, soakValue(id))
+					}
+				}
+				cancel()
+			}
+		}(w)
+	}
+	wg.Wait()
+	stopFaults()
+
+	// Every acknowledged write must have survived the faults
+	for _, ids := range acked {
+		for _, id := range ids {
+			var val string
+			err := db.QueryRowContext(ctx, soakSelect, id).Scan(&val)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				counts.lost.Add(1)
+				t.Errorf("final read %d: acknowledged write missing", id)
+			case err != nil:
+				t.Errorf("final read %d: %v", id, err)
+			case val != soakValue(id):
+				counts.lost.Add(1)
+				t.Errorf("final read %d: got %q, want %q", id, val, soakValue(id))
+			}
+		}
+	}
+
+	ops := counts.reads.Load() + counts.writes.Load()
+	failed := counts.readErrors.Load() + counts.writeErrs.Load()
+	t.Logf("%d reads (%d failed), %d writes (%d failed), %d lost",
+		counts.reads.Load(), counts.readErrors.Load(), counts.writes.Load(), counts.writeErrs.Load(), counts.lost.Load())
+	stats := connector.Stats()
+	t.Logf("%d statements, %d errors", stats.Statements, stats.Errors)
+	for _, score := range connector.NodeScores() {
+		t.Logf("node %s: latency %v, error rate %.3f, %d samples", score.Node, score.Latency, score.ErrorRate, score.Samples)
+	}
+
+	if ops == 0 {
+		t.Fatal("no operations ran")
+	}
+	if rate := float64(failed) / float64(ops); rate > *soakMaxErrorRate {
+		t.Errorf("error rate %.4f above %.4f", rate, *soakMaxErrorRate)
+	}
+}
+
+// fakeCluster is an in-process stand-in for a three node rqlite cluster
+// sharing one table. Statements fail with 503 while there is no leader, and
+// a crashed node drops every connection, like a killed process would.
+type fakeCluster struct {
+	mu      sync.Mutex
+	rows    map[int64]string
+	leader  int // -1 during an election
+	down    []bool
+	servers []*httptest.Server
+}
+
+func newFakeCluster(n int) *fakeCluster {
+	fc := &fakeCluster{rows: make(map[int64]string), down: make([]bool, n)}
+	for i := 0; i < n; i++ {
+		fc.servers = append(fc.servers, httptest.NewServer(fc.handler(i)))
+	}
+	return fc
+}
+
+func (fc *fakeCluster) close() {
+	for _, server := range fc.servers {
+		server.CloseClientConnections()
+		server.Close()
+	}
+}
+
+// dsn lists every node of the cluster
+func (fc *fakeCluster) dsn() string {
+	hosts := make([]string, len(fc.servers))
+	for i, server := range fc.servers {
+		hosts[i] = strings.TrimPrefix(server.URL, "http://")
+	}
+	return "rqlite://" + strings.Join(hosts, ",")
+}
+
+// injectFaults cycles through leader crashes and leadership transfers until
+// stop is closed
+func (fc *fakeCluster) injectFaults(t *testing.T, interval, election time.Duration, stop <-chan struct{}) {
+	for round := 0; ; round++ {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+
+		if round%2 == 1 {
+			fc.mu.Lock()
+			fc.leader = fc.nextUpLocked(fc.leader)
+			leader := fc.leader
+			fc.mu.Unlock()
+			t.Logf("fault: leadership moved to node %d", leader)
+			continue
+		}
+
+		fc.mu.Lock()
+		crashed := fc.leader
+		fc.down[crashed] = true
+		fc.leader = -1
+		fc.mu.Unlock()
+		fc.servers[crashed].CloseClientConnections()
+		t.Logf("fault: leader %d crashed", crashed)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(election):
+		}
+		fc.mu.Lock()
+		fc.leader = fc.nextUpLocked(crashed)
+		leader := fc.leader
+		fc.mu.Unlock()
+		t.Logf("fault: node %d elected", leader)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval / 2):
+		}
+		fc.mu.Lock()
+		fc.down[crashed] = false
+		fc.mu.Unlock()
+		t.Logf("fault: node %d restarted", crashed)
+	}
+}
+
+// heal restarts every node and elects a leader if there is none
+func (fc *fakeCluster) heal() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for i := range fc.down {
+		fc.down[i] = false
+	}
+	if fc.leader < 0 {
+		fc.leader = 0
+	}
+}
+
+// nextUpLocked returns the first node after i that is up; fc.mu must be held
+func (fc *fakeCluster) nextUpLocked(i int) int {
+	for j := 1; j <= len(fc.down); j++ {
+		if next := (i + j) % len(fc.down); !fc.down[next] {
+			return next
+		}
+	}
+	return -1
+}
+
+func (fc *fakeCluster) handler(i int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fc.mu.Lock()
+		down, leader := fc.down[i], fc.leader
+		fc.mu.Unlock()
+
+		if down {
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					conn.Close()
+				}
+			}
+			return
+		}
+
+		switch r.URL.Path {
+		case "/readyz":
+			if leader < 0 {
+				http.Error(w, "leader not found", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("[+]node ok\n[+]leader ok\n[+]store ok\n"))
+		case "/nodes":
+			json.NewEncoder(w).Encode(fc.nodes())
+		case "/db/execute", "/db/query":
+			if leader < 0 && r.URL.Query().Get("level") != "none" {
+				http.Error(w, "leader not found", http.StatusServiceUnavailable)
+				return
+			}
+			var statements [][]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&statements); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			results := make([]map[string]interface{}, len(statements))
+			for j, stmt := range statements {
+				results[j] = fc.run(stmt)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// nodes answers /nodes?ver=2
+func (fc *fakeCluster) nodes() map[string]interface{} {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	nodes := make([]map[string]interface{}, len(fc.servers))
+	for i, server := range fc.servers {
+		nodes[i] = map[string]interface{}{
+			"id":        fmt.Sprint(i + 1),
+			"api_addr":  server.URL,
+			"addr":      fmt.Sprintf("127.0.0.1:%d", 4002+i),
+			"voter":     true,
+			"reachable": !fc.down[i],
+			"leader":    i == fc.leader,
+		}
+	}
+	return map[string]interface{}{"nodes": nodes}
+}
+
+// run executes one of the statements the soak test and the driver send
+func (fc *fakeCluster) run(stmt []interface{}) map[string]interface{} {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if len(stmt) == 0 {
+		return map[string]interface{}{"error": "empty statement"}
+	}
+	query, _ := stmt[0].(string)
+	args := stmt[1:]
+
+	switch query {
+	case soakCreate:
+		return map[string]interface{}{}
+	case soakDrop:
+		fc.rows = make(map[int64]string)
+		return map[string]interface{}{}
+	case soakInsert:
+		id, _ := args[0].(float64)
+		val, _ := args[1].(string)
+		fc.rows[int64(id)] = val
+		return map[string]interface{}{"last_insert_id": int64(id), "rows_affected": 1}
+	case soakSelect:
+		id, _ := args[0].(float64)
+		result := map[string]interface{}{"columns": []string{"val"}, "types": []string{"text"}}
+		if val, ok := fc.rows[int64(id)]; ok {
+			result["values"] = [][]interface{}{{val}}
+		}
+		return result
+	case "SELECT 1":
+		return map[string]interface{}{"columns": []string{"1"}, "types": []string{"integer"}, "values": [][]interface{}{{1}}}
+	default:
+		return map[string]interface{}{"error": "unsupported statement: " + query}
+	}
+}
@@ -0,0 +1,419 @@
+package rsqlite
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SpillFile is a LastResort that appends failed writes to a local log file,
+// synced before ExecContext returns, so they survive process restarts, and
+// replays them in order once the cluster recovers. Every spilled write
+// keeps an idempotency key: with Config.Idempotency set on the handle
+// replaying it, a write that was applied although its failure was reported,
+// or replayed just before a crash, isn't applied twice.
+//
+// Writes that succeed while others wait in the file are not held back, so
+// only the spilled writes keep their order.
+type SpillFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// pending are the spilled writes not replayed yet, oldest first
+	pending []spillEntry
+	// seq is the sequence number of the last spilled write
+	seq int64
+	// replaying is set while Replay runs, so only one replay runs at a time
+	replaying bool
+}
+
+// spillRecord is a line of the spill file: a spilled write, or the mark
+// that the write with sequence number Done was replayed
+type spillRecord struct {
+	Seq   int64      `json:"seq,omitempty"`
+	Key   string     `json:"key,omitempty"`
+	Query string     `json:"query,omitempty"`
+	Args  []spillArg `json:"args,omitempty"`
+	Time  *time.Time `json:"time,omitempty"`
+	Err   string     `json:"err,omitempty"`
+	Done  int64      `json:"done,omitempty"`
+}
+
+// spillEntry is a spilled write waiting for its replay
+type spillEntry struct {
+	seq      int64
+	key      string
+	query    string
+	args     []interface{}
+	failedAt time.Time
+}
+
+// spillArg is a bound argument tagged with its type, which JSON alone loses
+type spillArg struct {
+	Kind  string          `json:"k"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// OpenSpillFile opens the spill file at path, creating it if missing, and
+// loads the writes an earlier process spilled but didn't replay. A record
+// torn by a crash while it was written is discarded.
+func OpenSpillFile(path string) (*SpillFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening spill file: %w", err)
+	}
+
+	s := &SpillFile{path: path, file: file}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the spill file and positions it for appending
+func (s *SpillFile) load() error {
+	var (
+		valid   int64
+		pending []spillEntry
+		done    = make(map[int64]bool)
+		reader  = bufio.NewReader(s.file)
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without its newline was torn by a crash
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading spill file: %w", err)
+		}
+
+		var record spillRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("reading spill file: record at offset %d: %w", valid, err)
+		}
+		valid += int64(len(line))
+
+		if record.Done > 0 {
+			done[record.Done] = true
+			continue
+		}
+		args, err := decodeSpillArgs(record.Args)
+		if err != nil {
+			return fmt.Errorf("reading spill file: record %d: %w", record.Seq, err)
+		}
+		entry := spillEntry{seq: record.Seq, key: record.Key, query: record.Query, args: args}
+		if record.Time != nil {
+			entry.failedAt = *record.Time
+		}
+		pending = append(pending, entry)
+		if record.Seq > s.seq {
+			s.seq = record.Seq
+		}
+	}
+
+	for _, entry := range pending {
+		if !done[entry.seq] {
+			s.pending = append(s.pending, entry)
+		}
+	}
+
+	if len(s.pending) == 0 {
+		valid = 0
+	}
+	if err := s.file.Truncate(valid); err != nil {
+		return fmt.Errorf("truncating spill file: %w", err)
+	}
+	if _, err := s.file.Seek(valid, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking spill file: %w", err)
+	}
+	return nil
+}
+
+// HandleFailedWrite appends the write to the spill file and syncs it
+func (s *SpillFile) HandleFailedWrite(ctx context.Context, write FailedWrite) error {
+	encoded, err := encodeSpillArgs(write.Args)
+	if err != nil {
+		return err
+	}
+	// Keep a copy, the caller may reuse its buffers
+	args, err := decodeSpillArgs(encoded)
+	if err != nil {
+		return err
+	}
+	key := write.IdempotencyKey
+	if key == "" {
+		if key, err = newIdempotencyKey(); err != nil {
+			return fmt.Errorf("generating idempotency key: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("spill file is closed")
+	}
+
+	record := spillRecord{Seq: s.seq + 1, Key: key, Query: write.Query, Args: encoded, Time: &write.FailedAt}
+	if write.Err != nil {
+		record.Err = write.Err.Error()
+	}
+	if err := s.appendLocked(record); err != nil {
+		return err
+	}
+
+	s.seq++
+	s.pending = append(s.pending, spillEntry{seq: s.seq, key: key, query: write.Query, args: args, failedAt: write.FailedAt})
+	return nil
+}
+
+// appendLocked writes a record and syncs the file; s.mu must be held
+func (s *SpillFile) appendLocked(record spillRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encoding spill record: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing spill file: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("syncing spill file: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of spilled writes waiting for their replay
+func (s *SpillFile) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Replay sends the spilled writes through db, oldest first, each with its
+// idempotency key, and returns how many were applied. It stops at the first
+// write that fails to reach the cluster, which stays first in line. Writes
+// the server rejects, e.g. for a constraint violation, would fail forever;
+// they are appended to the file at path + ".rejected" instead, one JSON
+// record per line, and replay continues. Writes failing during the replay
+// aren't handed to db's LastResort again.
+func (s *SpillFile) Replay(ctx context.Context, db *sql.DB) (int, error) {
+	s.mu.Lock()
+	if s.replaying {
+		s.mu.Unlock()
+		return 0, errors.New("spill file is already replaying")
+	}
+	s.replaying = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.replaying = false
+		s.mu.Unlock()
+	}()
+
+	ctx = withReplay(ctx)
+	replayed := 0
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 || s.file == nil {
+			s.mu.Unlock()
+			return replayed, nil
+		}
+		entry := s.pending[0]
+		s.mu.Unlock()
+
+		_, err := db.ExecContext(WithIdempotencyKey(ctx, entry.key), entry.query, entry.args...)
+		var stmtErr *statementError
+		switch {
+		case errors.As(err, &stmtErr):
+			if err := s.reject(entry, err); err != nil {
+				return replayed, err
+			}
+		case err != nil:
+			return replayed, fmt.Errorf("replaying spilled write %d: %w", entry.seq, err)
+		default:
+			replayed++
+		}
+
+		if err := s.markDone(entry.seq); err != nil {
+			return replayed, err
+		}
+	}
+}
+
+// markDone records that the first pending write was replayed, and empties
+// the file once none is left
+func (s *SpillFile) markDone(seq int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("spill file is closed")
+	}
+	s.pending = s.pending[1:]
+
+	if len(s.pending) == 0 {
+		if err := s.file.Truncate(0); err != nil {
+			return fmt.Errorf("truncating spill file: %w", err)
+		}
+		if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seeking spill file: %w", err)
+		}
+		return s.file.Sync()
+	}
+	return s.appendLocked(spillRecord{Done: seq})
+}
+
+// reject appends a write the server rejected to the rejected file
+func (s *SpillFile) reject(entry spillEntry, err error) error {
+	args, encodeErr := encodeSpillArgs(entry.args)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	line, encodeErr := json.Marshal(spillRecord{Seq: entry.seq, Key: entry.key, Query: entry.query, Args: args, Time: &entry.failedAt, Err: err.Error()})
+	if encodeErr != nil {
+		return fmt.Errorf("encoding rejected write: %w", encodeErr)
+	}
+
+	file, openErr := os.OpenFile(s.path+".rejected", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if openErr != nil {
+		return fmt.Errorf("opening rejected file: %w", openErr)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing rejected file: %w", err)
+	}
+	return file.Sync()
+}
+
+// Run replays the spilled writes through db every interval until ctx is
+// done, so they are applied once the cluster recovers. It returns ctx.Err().
+func (s *SpillFile) Run(ctx context.Context, db *sql.DB, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.Len() > 0 {
+			// Failures are retried on the next tick
+			s.Replay(ctx, db)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the spill file; writes not replayed stay in it for the next
+// OpenSpillFile
+func (s *SpillFile) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// replayKey marks contexts of writes replayed from a spill file
+type replayKey struct{}
+
+// withReplay marks ctx as replaying spilled writes
+func withReplay(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replayKey{}, true)
+}
+
+// replaying reports whether ctx replays spilled writes
+func replaying(ctx context.Context) bool {
+	replay, _ := ctx.Value(replayKey{}).(bool)
+	return replay
+}
+
+// encodeSpillArgs tags the bound arguments of a write with their types
+func encodeSpillArgs(args []interface{}) ([]spillArg, error) {
+	encoded := make([]spillArg, len(args))
+	for i, arg := range args {
+		var kind string
+		switch arg.(type) {
+		case nil:
+			encoded[i] = spillArg{Kind: "null"}
+			continue
+		case int64:
+			kind = "int"
+		case float64:
+			kind = "float"
+		case bool:
+			kind = "bool"
+		case string:
+			kind = "text"
+		case []byte:
+			kind = "blob"
+		case time.Time:
+			kind = "time"
+		default:
+			return nil, fmt.Errorf("spilling argument %d: unsupported type %T", i+1, arg)
+		}
+
+		value, err := json.Marshal(arg)
+		if err != nil {
+			return nil, fmt.Errorf("spilling argument %d: %w", i+1, err)
+		}
+		encoded[i] = spillArg{Kind: kind, Value: value}
+	}
+	return encoded, nil
+}
+
+// decodeSpillArgs restores the bound arguments of a spilled write
+func decodeSpillArgs(encoded []spillArg) ([]interface{}, error) {
+	args := make([]interface{}, len(encoded))
+	for i, arg := range encoded {
+		var err error
+		switch arg.Kind {
+		case "null":
+			args[i] = nil
+		case "int":
+			var v int64
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "float":
+			var v float64
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "bool":
+			var v bool
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "text":
+			var v string
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "blob":
+			var v []byte
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "time":
+			var v time.Time
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		default:
+			err = fmt.Errorf("unknown type %q", arg.Kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,171 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpillFileSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writes.spill")
+	failedAt := time.Date(2024, 2, 29, 13, 14, 15, 0, time.UTC)
+	args := []interface{}{nil, int64(1 << 60), 1.5, true, "text", []byte{0, 1}, failedAt}
+
+	spill, err := OpenSpillFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, query := range []string{"INSERT INTO a VALUES (?, ?, ?, ?, ?, ?, ?)", "INSERT INTO b VALUES (?, ?, ?, ?, ?, ?, ?)"} {
+		write := FailedWrite{Query: query, Args: args, FailedAt: failedAt, Err: errors.New("unavailable")}
+		if err := spill.HandleFailedWrite(ctx, write); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := spill.HandleFailedWrite(ctx, FailedWrite{Query: "INSERT INTO c VALUES (?)", Args: []interface{}{struct{}{}}}); err == nil {
+		t.Error("write with an unsupported argument spilled")
+	}
+	if err := spill.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record torn by a crash is discarded
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"seq": 3, "query": "INSERT`)
+	file.Close()
+
+	spill, err = OpenSpillFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+
+	if n := spill.Len(); n != 2 {
+		t.Fatalf("%d writes loaded, want 2", n)
+	}
+	for i, entry := range spill.pending {
+		if entry.seq != int64(i+1) || entry.key == "" || !entry.failedAt.Equal(failedAt) {
+			t.Errorf("entry %d = %+v", i, entry)
+		}
+		if !reflect.DeepEqual(entry.args, args) {
+			t.Errorf("entry %d args %#v, want %#v", i, entry.args, args)
+		}
+	}
+}
+
+func TestSpillFileReplay(t *testing.T) {
+	// The server is down until up is set, and rejects writes to table r
+	var up atomic.Bool
+	var mu sync.Mutex
+	var executed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		json.Unmarshal(body, &statements)
+		query, _ := statements[0][0].(string)
+
+		if r.URL.Path != "/db/execute" {
+			w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+			return
+		}
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		executed = append(executed, query)
+		mu.Unlock()
+		if strings.Contains(query, " r ") {
+			w.Write([]byte(`{"results": [{"error": "UNIQUE constraint failed"}]}`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"last_insert_id": 1, "rows_affected": 1}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false&max_retries=0&retry_backoff=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "writes.spill")
+	spill, err := OpenSpillFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+
+	ctx := context.Background()
+	queries := []string{"INSERT INTO a VALUES (1)", "INSERT INTO r VALUES (1)", "INSERT INTO b VALUES (?)"}
+	for i, query := range queries {
+		write := FailedWrite{Query: query, FailedAt: time.Now()}
+		if i == 2 {
+			write.Args = []interface{}{int64(2)}
+		}
+		if err := spill.HandleFailedWrite(ctx, write); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// While the cluster is down the first write stays first in line
+	if n, err := spill.Replay(ctx, db); n != 0 || err == nil {
+		t.Fatalf("replay while down = %d, %v", n, err)
+	}
+	if n := spill.Len(); n != 3 {
+		t.Fatalf("%d writes pending after a failed replay, want 3", n)
+	}
+
+	up.Store(true)
+	n, err := spill.Replay(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || spill.Len() != 0 {
+		t.Errorf("replayed %d writes leaving %d, want 2 leaving 0", n, spill.Len())
+	}
+
+	mu.Lock()
+	if !equalStrings(executed, queries) {
+		t.Errorf("server ran %q, want %q in order", executed, queries)
+	}
+	mu.Unlock()
+
+	rejected, err := os.ReadFile(path + ".rejected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record spillRecord
+	if err := json.Unmarshal(rejected, &record); err != nil || record.Query != queries[1] || record.Err == "" {
+		t.Errorf("rejected record %s", rejected)
+	}
+
+	// The replayed file is emptied
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("spill file has %d bytes after replay, want 0", info.Size())
+	}
+}
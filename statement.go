@@ -9,11 +9,18 @@ import (
 type Stmt struct {
 	conn  *Conn
 	query string
+	// streams are the statement's streamed Rows still open
+	streams openRows
 }
 
-// Close implements the database/sql/driver.Stmt interface
+// Close implements the database/sql/driver.Stmt interface. There is nothing
+// to close on the server for prepared statements in rqlite; streamed Rows
+// still open are closed, adding the rows they read to the stats. The
+// statement's entry in Stats.ByStatement is shared with every statement of
+// the same label or fingerprint and stays until Config.MaxStatementStats
+// evicts it.
 func (s *Stmt) Close() error {
-	// Nothing to close for prepared statements in rqlite
+	s.streams.closeAll()
 	return nil
 }
 
@@ -40,7 +47,11 @@ func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
 
 // QueryContext implements the database/sql/driver.StmtQueryContext interface
 func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	return s.conn.QueryContext(ctx, s.query, args)
+	rows, err := s.conn.QueryContext(ctx, s.query, args)
+	if r, ok := rows.(*Rows); ok {
+		s.streams.add(r)
+	}
+	return rows, err
 }
 
 // convertToNamedValues converts []driver.Value to []driver.NamedValue
@@ -0,0 +1,240 @@
+package rsqlite
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats describes a single driver connection
+type ConnStats struct {
+	// Node is the rqlite node the connection currently talks to
+	Node string
+	// CreatedAt is when the connection was opened
+	CreatedAt time.Time
+	// Age is how long the connection has been open
+	Age time.Duration
+}
+
+// Stats describes the driver connections created by a Connector. Comparing it
+// with sql.DBStats shows how the database/sql pool maps onto cluster nodes.
+type Stats struct {
+	// OpenConnections is the number of driver connections currently open
+	OpenConnections int
+	// ConnsPerNode counts open connections by the node they are pinned to
+	ConnsPerNode map[string]int
+	// Conns describes each open connection, oldest first
+	Conns []ConnStats
+
+	// Statements is the number of statements sent since the connector was created
+	Statements int64
+	// Errors is the number of statements that failed
+	Errors int64
+	// BytesSent is the total size of request bodies
+	BytesSent int64
+	// BytesReceived is the total size of response bodies
+	BytesReceived int64
+	// RowsReturned is the total number of rows returned by queries
+	RowsReturned int64
+	// ResultMemory is the response bytes of query results held by open
+	// Rows, tracked when Config.MaxResultMemory is set
+	ResultMemory int64
+	// ByControl aggregates the requests the driver sent on its own behalf,
+	// such as leader discovery and health probes, by kind
+	ByControl map[ControlKind]ControlStats
+	// ByStatement aggregates statements by the label attached with WithLabel,
+	// or by their Fingerprint when unlabeled, for the Config.MaxStatementStats
+	// most recently run statements
+	ByStatement map[string]StatementStats
+	// Canary is the latest canary result, nil without a canary or before its first run
+	Canary *CanaryResult
+	// Throttle is the state of the write throttle, nil without one
+	Throttle *ThrottleState
+}
+
+// StatementStats aggregates the executions of one kind of statement
+type StatementStats struct {
+	// Count is the number of executions
+	Count int64
+	// Errors is the number of failed executions
+	Errors int64
+	// TotalDuration is the time spent across all executions
+	TotalDuration time.Duration
+	// BytesSent is the total size of request bodies
+	BytesSent int64
+	// BytesReceived is the total size of response bodies
+	BytesReceived int64
+	// Rows is the total number of rows returned
+	Rows int64
+}
+
+// ControlStats aggregates the control requests of one kind
+type ControlStats struct {
+	// Count is the number of requests
+	Count int64
+	// Errors is the number of failed requests
+	Errors int64
+	// TotalDuration is the time spent across all requests
+	TotalDuration time.Duration
+}
+
+// add folds a finished statement into the aggregate
+func (s *StatementStats) add(event QueryEvent) {
+	s.Count++
+	if event.Err != nil {
+		s.Errors++
+	}
+	s.TotalDuration += event.Duration
+	s.BytesSent += int64(event.BytesSent)
+	s.BytesReceived += int64(event.BytesReceived)
+	s.Rows += int64(event.Rows)
+}
+
+// connectorMetrics accumulates traffic counters for a Connector
+type connectorMetrics struct {
+	statements    atomic.Int64
+	errors        atomic.Int64
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	rowsReturned  atomic.Int64
+
+	mu          sync.Mutex
+	byControl   map[ControlKind]ControlStats
+	byStatement map[string]*StatementStats
+	// recent evicts the least recently run statements from byStatement
+	recent keyLRU
+}
+
+// record adds a finished statement to the counters, keeping per-statement
+// aggregates for at most maxStatements statements
+func (m *connectorMetrics) record(event QueryEvent, maxStatements int) {
+	m.statements.Add(1)
+	if event.Err != nil {
+		m.errors.Add(1)
+	}
+	m.bytesSent.Add(int64(event.BytesSent))
+	m.bytesReceived.Add(int64(event.BytesReceived))
+	m.rowsReturned.Add(int64(event.Rows))
+
+	key := event.key()
+	m.mu.Lock()
+	if m.byStatement == nil {
+		m.byStatement = make(map[string]*StatementStats)
+	}
+	stats, ok := m.byStatement[key]
+	if !ok {
+		stats = &StatementStats{}
+		m.byStatement[key] = stats
+	}
+	stats.add(event)
+	if evicted, ok := m.recent.touch(key, maxStatements); ok {
+		delete(m.byStatement, evicted)
+	}
+	m.mu.Unlock()
+}
+
+// recordControl adds a finished control request to the counters
+func (m *connectorMetrics) recordControl(event ControlEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.byControl == nil {
+		m.byControl = make(map[ControlKind]ControlStats)
+	}
+	stats := m.byControl[event.Kind]
+	stats.Count++
+	if event.Err != nil {
+		stats.Errors++
+	}
+	stats.TotalDuration += event.Duration
+	m.byControl[event.Kind] = stats
+}
+
+// controlSnapshot copies the control request aggregates
+func (m *connectorMetrics) controlSnapshot() map[ControlKind]ControlStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[ControlKind]ControlStats, len(m.byControl))
+	for kind, stats := range m.byControl {
+		snapshot[kind] = stats
+	}
+	return snapshot
+}
+
+// addRows counts rows read from a streamed result after its statement was
+// recorded
+func (m *connectorMetrics) addRows(key string, rows int) {
+	m.rowsReturned.Add(int64(rows))
+
+	m.mu.Lock()
+	if stats, ok := m.byStatement[key]; ok {
+		stats.Rows += int64(rows)
+	}
+	m.mu.Unlock()
+}
+
+// statementSnapshot copies the per-statement aggregates
+func (m *connectorMetrics) statementSnapshot() map[string]StatementStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]StatementStats, len(m.byStatement))
+	for key, stats := range m.byStatement {
+		snapshot[key] = *stats
+	}
+	return snapshot
+}
+
+// Stats returns a snapshot of the driver connections created by the connector
+func (c *Connector) Stats() Stats {
+	c.connsMu.Lock()
+	conns := make([]*Conn, 0, len(c.conns))
+	for conn := range c.conns {
+		conns = append(conns, conn)
+	}
+	c.connsMu.Unlock()
+
+	now := time.Now()
+	stats := Stats{
+		OpenConnections: len(conns),
+		ConnsPerNode:    make(map[string]int),
+		Conns:           make([]ConnStats, 0, len(conns)),
+		Statements:      c.metrics.statements.Load(),
+		Errors:          c.metrics.errors.Load(),
+		BytesSent:       c.metrics.bytesSent.Load(),
+		BytesReceived:   c.metrics.bytesReceived.Load(),
+		RowsReturned:    c.metrics.rowsReturned.Load(),
+		ByControl:       c.metrics.controlSnapshot(),
+		ByStatement:     c.metrics.statementSnapshot(),
+	}
+
+	if budget := c.memoryBudget(); budget != nil {
+		stats.ResultMemory = budget.inUse()
+	}
+
+	if c.canary != nil {
+		stats.Canary = c.canary.lastResult()
+	}
+	if c.throttle != nil {
+		state := c.throttle.current()
+		stats.Throttle = &state
+	}
+
+	for _, conn := range conns {
+		node := conn.currentNode()
+		stats.ConnsPerNode[node]++
+		stats.Conns = append(stats.Conns, ConnStats{
+			Node:      node,
+			CreatedAt: conn.createdAt,
+			Age:       now.Sub(conn.createdAt),
+		})
+	}
+
+	sort.Slice(stats.Conns, func(i, j int) bool {
+		return stats.Conns[i].CreatedAt.Before(stats.Conns[j].CreatedAt)
+	})
+
+	return stats
+}
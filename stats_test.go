@@ -0,0 +1,130 @@
+package rsqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newStatsConnector returns a connector for a server answering every query
+// with three rows
+func newStatsConnector(t *testing.T, params string) *Connector {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"columns": ["id"], "types": ["integer"], "values": [[1], [2], [3]]}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := ParseDSN("rqlite://" + strings.TrimPrefix(server.URL, "http://") + "?discovery=false&" + params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connector.Close() })
+	return connector
+}
+
+func TestStatementStatsEvictLeastRecentlyRun(t *testing.T) {
+	connector := newStatsConnector(t, "max_statement_stats=2")
+	ctx := context.Background()
+
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	run := func(query string) {
+		t.Helper()
+		rows, err := conn.(*Conn).QueryContext(ctx, query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+	}
+	run("SELECT id FROM a")
+	run("SELECT id FROM b")
+	run("SELECT id FROM a")
+	run("SELECT id FROM c")
+
+	byStatement := connector.Stats().ByStatement
+	if len(byStatement) != 2 {
+		t.Fatalf("%d statements tracked, want 2", len(byStatement))
+	}
+	if _, ok := byStatement[Fingerprint("SELECT id FROM b")]; ok {
+		t.Error("least recently run statement not evicted")
+	}
+	if stats := byStatement[Fingerprint("SELECT id FROM a")]; stats.Count != 2 {
+		t.Errorf("recently run statement counted %d times, want 2", stats.Count)
+	}
+	if _, ok := byStatement[Fingerprint("SELECT id FROM c")]; !ok {
+		t.Error("latest statement not tracked")
+	}
+}
+
+func TestCloseFlushesStreamedRows(t *testing.T) {
+	connector := newStatsConnector(t, "stream_rows=true")
+	ctx := context.Background()
+	query := "SELECT id FROM t"
+
+	read := func(rows driver.Rows, n int) {
+		t.Helper()
+		dest := make([]driver.Value, 1)
+		for i := 0; i < n; i++ {
+			if err := rows.Next(dest); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	rowsFor := func() int64 {
+		return connector.Stats().ByStatement[Fingerprint(query)].Rows
+	}
+
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := stmt.(*Stmt).QueryContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read(rows, 2)
+	if n := rowsFor(); n != 0 {
+		t.Fatalf("%d rows counted before close", n)
+	}
+
+	// Closing the statement closes its open rows
+	stmt.Close()
+	if n := rowsFor(); n != 2 {
+		t.Errorf("%d rows counted after closing the statement, want 2", n)
+	}
+
+	rows, err = conn.(*Conn).QueryContext(ctx, query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read(rows, 1)
+
+	// So does closing the connection
+	conn.Close()
+	if n := rowsFor(); n != 3 {
+		t.Errorf("%d rows counted after closing the connection, want 3", n)
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("closing rows again: %v", err)
+	}
+	if n := rowsFor(); n != 3 {
+		t.Errorf("rows counted twice: %d", n)
+	}
+}
@@ -0,0 +1,247 @@
+package rsqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// rowStream decodes the rows of a query response one at a time, so a large
+// result set is never held in memory as a whole
+type rowStream struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+	// row is reused for every row; it is sized to the column count so wide
+	// rows don't grow it element by element
+	row  []interface{}
+	done bool
+	err  error
+	// cancel releases the statement's context once the rows are read
+	cancel context.CancelFunc
+}
+
+// next returns the next row, or io.EOF after the last one. The returned
+// slice is only valid until the next call.
+func (s *rowStream) next() ([]interface{}, error) {
+	if s.done {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+
+	if !s.dec.More() {
+		// Consume the closing bracket of the values array
+		if _, err := s.dec.Token(); err != nil {
+			return nil, s.fail(err)
+		}
+		s.close()
+		return nil, io.EOF
+	}
+
+	s.row = s.row[:0]
+	if err := s.dec.Decode(&s.row); err != nil {
+		return nil, s.fail(err)
+	}
+	return s.row, nil
+}
+
+// fail ends the stream with an error
+func (s *rowStream) fail(err error) error {
+	s.err = fmt.Errorf("decoding streamed rows: %w", err)
+	s.close()
+	return s.err
+}
+
+// close releases the response body
+func (s *rowStream) close() {
+	if !s.done {
+		s.done = true
+		s.body.Close()
+		if s.cancel != nil {
+			s.cancel()
+		}
+	}
+}
+
+// queryStream runs a read statement and decodes the response only up to the
+// first row. The returned result holds the columns and types; its rows are
+// read from the stream, which is nil when the result has no rows. Only the
+// JSON encoding of the rqlite API can be streamed.
+func (c *apiClient) queryStream(ctx context.Context, level string, query string, args []interface{}) (*StatementResult, *rowStream, error) {
+	params := url.Values{}
+	if level != "" {
+		params.Set("level", level)
+	}
+
+	resp, body, err := c.post(ctx, "/db/query", params, []Statement{{Query: query, Args: args}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode == http.StatusRequestEntityTooLarge {
+			return nil, nil, &RequestTooLargeError{Size: len(body)}
+		}
+		return nil, nil, &transport.StatusError{Path: "/db/query", Code: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+
+	result, stream, err := decodeStreamHeader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	if stream == nil {
+		resp.Body.Close()
+	}
+
+	result.node = c.node
+	result.bytesSent = len(body)
+	return result, stream, nil
+}
+
+// decodeStreamHeader reads a query response up to the first row of its
+// first result. Fields following the rows are not read.
+func decodeStreamHeader(body io.ReadCloser) (*StatementResult, *rowStream, error) {
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, nil, err
+	}
+
+	var topError string
+	for dec.More() {
+		key, err := objectKey(dec)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch key {
+		case "error":
+			if err := dec.Decode(&topError); err != nil {
+				return nil, nil, err
+			}
+		case "results":
+			if err := expectDelim(dec, '['); err != nil {
+				return nil, nil, err
+			}
+			if !dec.More() {
+				return nil, nil, errors.New("no results in response")
+			}
+			return decodeResultHeader(dec, body)
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if topError != "" {
+		return nil, nil, &transport.RequestError{Msg: topError}
+	}
+	return nil, nil, errors.New("no results in response")
+}
+
+// decodeResultHeader reads the fields of a result object up to its rows
+func decodeResultHeader(dec *json.Decoder, body io.ReadCloser) (*StatementResult, *rowStream, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, nil, err
+	}
+
+	result := &StatementResult{}
+	for dec.More() {
+		key, err := objectKey(dec)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var target interface{}
+		switch key {
+		case "columns":
+			target = &result.Columns
+		case "types":
+			target = &result.Types
+		case "error":
+			target = &result.Error
+		case "values":
+			if result.Error != "" {
+				return nil, nil, &statementError{msg: result.Error}
+			}
+			if err := expectDelim(dec, '['); err != nil {
+				return nil, nil, err
+			}
+			if result.Columns == nil {
+				// Rows ahead of the columns can't be streamed; read them all
+				if err := decodeRemainingRows(dec, result); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			return result, &rowStream{
+				body: body,
+				dec:  dec,
+				row:  make([]interface{}, 0, len(result.Columns)),
+			}, nil
+		default:
+			target = new(json.RawMessage)
+		}
+
+		if err := dec.Decode(target); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if result.Error != "" {
+		return nil, nil, &statementError{msg: result.Error}
+	}
+	return result, nil, nil
+}
+
+// decodeRemainingRows reads the rest of a values array into result.Values
+func decodeRemainingRows(dec *json.Decoder, result *StatementResult) error {
+	for dec.More() {
+		var row []interface{}
+		if err := dec.Decode(&row); err != nil {
+			return err
+		}
+		result.Values = append(result.Values, row)
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// expectDelim reads the next token and checks that it is the given delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("unexpected %v in response, expected %v", tok, delim)
+	}
+	return nil
+}
+
+// objectKey reads the next key of a JSON object
+func objectKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected %v in response, expected an object key", tok)
+	}
+	return key, nil
+}
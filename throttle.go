@@ -0,0 +1,222 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig slows the writes of a Connector while the leader reports
+// pressure, i.e. its raft log holds more committed entries than it has
+// applied to the database. The write rate is halved each time the leader
+// is found under pressure, down to MinRate, and recovers by a tenth of
+// MaxRate per poll once it keeps up.
+type ThrottleConfig struct {
+	// Interval between polls of the leader's /status, default 1s
+	Interval time.Duration
+	// MaxRate is the writes per second allowed while the leader keeps up
+	MaxRate float64
+	// MinRate is the lowest rate pressure slows writes to, default 1
+	MinRate float64
+	// Backlog is the number of committed raft entries the leader hasn't
+	// applied yet at which it counts as under pressure, default 1000
+	Backlog uint64
+}
+
+// validate checks the throttle configuration
+func (cfg *ThrottleConfig) validate() error {
+	var errs []error
+	if cfg.Interval < 0 {
+		errs = append(errs, errors.New("throttle interval cannot be negative"))
+	}
+	if cfg.MaxRate <= 0 {
+		errs = append(errs, errors.New("throttle max rate must be positive"))
+	}
+	if cfg.MinRate < 0 {
+		errs = append(errs, errors.New("throttle min rate cannot be negative"))
+	} else if cfg.MaxRate > 0 && cfg.MinRate > cfg.MaxRate {
+		errs = append(errs, errors.New("throttle min rate cannot exceed the max rate"))
+	}
+	return errors.Join(errs...)
+}
+
+// ThrottleState describes the write throttle of a Connector
+type ThrottleState struct {
+	// Rate is the writes per second currently allowed
+	Rate float64
+	// Backlog is the leader's backlog at the last poll
+	Backlog uint64
+	// Pressure reports whether the backlog reached ThrottleConfig.Backlog
+	Pressure bool
+	// CheckedAt is the time of the last poll
+	CheckedAt time.Time
+	// Err is set when the last poll failed; the rate is kept until a poll succeeds
+	Err error
+}
+
+// throttle paces the writes of a Connector and adapts the pace to the
+// leader's backlog in the background
+type throttle struct {
+	cfg       ThrottleConfig
+	connector *Connector
+
+	mu    sync.Mutex
+	state ThrottleState
+	// tokens is the token bucket writes draw from; it holds at most one
+	// second of writes and goes negative while writes wait
+	tokens float64
+	filled time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newThrottle creates a throttle and starts its loop, which runs until ctx
+// is cancelled or the throttle is closed
+func newThrottle(ctx context.Context, cfg ThrottleConfig, connector *Connector) *throttle {
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.MinRate == 0 {
+		cfg.MinRate = 1
+	}
+	if cfg.MinRate > cfg.MaxRate {
+		cfg.MinRate = cfg.MaxRate
+	}
+	if cfg.Backlog == 0 {
+		cfg.Backlog = 1000
+	}
+
+	t := &throttle{
+		cfg:       cfg,
+		connector: connector,
+		state:     ThrottleState{Rate: cfg.MaxRate},
+		tokens:    cfg.MaxRate,
+		filled:    time.Now(),
+		done:      make(chan struct{}),
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	go t.run(ctx)
+	return t
+}
+
+// run polls the leader until ctx is cancelled
+func (t *throttle) run(ctx context.Context) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			backlog, err := t.poll(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			t.adapt(backlog, err)
+		}
+	}
+}
+
+// poll reads the leader's backlog: the committed entries it hasn't applied
+func (t *throttle) poll(ctx context.Context) (uint64, error) {
+	nodes := t.connector.candidateNodes(ctx)
+	if len(nodes) == 0 {
+		return 0, errors.New("no nodes available")
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, t.cfg.Interval)
+	defer cancel()
+	status, err := t.connector.sharedClusterManager().RaftStatus(pollCtx, nodes[0])
+	if err != nil {
+		return 0, err
+	}
+
+	backlog := status.FSMPending
+	if status.CommitIndex > status.AppliedIndex && status.CommitIndex-status.AppliedIndex > backlog {
+		backlog = status.CommitIndex - status.AppliedIndex
+	}
+	return backlog, nil
+}
+
+// adapt halves the rate under pressure and raises it again otherwise
+func (t *throttle) adapt(backlog uint64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state.CheckedAt = time.Now()
+	t.state.Err = err
+	if err != nil {
+		return
+	}
+
+	t.state.Backlog = backlog
+	t.state.Pressure = backlog >= t.cfg.Backlog
+	t.refillLocked(t.state.CheckedAt)
+	if t.state.Pressure {
+		t.state.Rate /= 2
+	} else {
+		t.state.Rate += t.cfg.MaxRate / 10
+	}
+	if t.state.Rate < t.cfg.MinRate {
+		t.state.Rate = t.cfg.MinRate
+	}
+	if t.state.Rate > t.cfg.MaxRate {
+		t.state.Rate = t.cfg.MaxRate
+	}
+}
+
+// refillLocked adds the tokens earned since the last refill; t.mu must be held
+func (t *throttle) refillLocked(now time.Time) {
+	t.tokens += now.Sub(t.filled).Seconds() * t.state.Rate
+	if t.tokens > t.state.Rate {
+		t.tokens = t.state.Rate
+	}
+	t.filled = now
+}
+
+// wait blocks until a write may be sent at the current rate, or ctx is done
+func (t *throttle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	t.refillLocked(time.Now())
+	t.tokens--
+	var delay time.Duration
+	if t.tokens < 0 && t.state.Rate > 0 {
+		delay = time.Duration(-t.tokens / t.state.Rate * float64(time.Second))
+	}
+	t.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the slot back to the writes still waiting
+		t.mu.Lock()
+		t.tokens++
+		t.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// current returns the throttle state
+func (t *throttle) current() ThrottleState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// close stops the throttle loop
+func (t *throttle) close() {
+	t.cancel()
+	<-t.done
+}
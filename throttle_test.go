@@ -0,0 +1,119 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThrottleAdapt(t *testing.T) {
+	th := &throttle{
+		cfg:    ThrottleConfig{MaxRate: 100, MinRate: 10, Backlog: 50},
+		state:  ThrottleState{Rate: 100},
+		filled: time.Now(),
+	}
+
+	steps := []struct {
+		backlog  uint64
+		err      error
+		rate     float64
+		pressure bool
+	}{
+		{60, nil, 50, true},
+		{50, nil, 25, true},
+		{500, nil, 12.5, true},
+		{500, nil, 10, true},
+		{0, errors.New("unreachable"), 10, true},
+		{49, nil, 20, false},
+		{0, nil, 30, false},
+	}
+	for i, step := range steps {
+		th.adapt(step.backlog, step.err)
+		state := th.current()
+		if state.Rate != step.rate || state.Pressure != step.pressure || (state.Err != nil) != (step.err != nil) {
+			t.Errorf("step %d: state %+v, want rate %v pressure %v", i, state, step.rate, step.pressure)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		th.adapt(0, nil)
+	}
+	if rate := th.current().Rate; rate != 100 {
+		t.Errorf("recovered rate %v, want the max rate", rate)
+	}
+}
+
+func TestThrottleWaitCancelled(t *testing.T) {
+	th := &throttle{state: ThrottleState{Rate: 1}, tokens: 1, filled: time.Now()}
+
+	// The first write uses the one token a second allows
+	if err := th.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := th.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait = %v, want the context's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled wait took %v", elapsed)
+	}
+
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	if th.tokens > 0.5 || th.tokens < -0.5 {
+		t.Errorf("%v tokens left, want the cancelled write's slot given back", th.tokens)
+	}
+}
+
+func TestThrottleFollowsLeaderBacklog(t *testing.T) {
+	var backlog atomic.Uint64
+	backlog.Store(5000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			fmt.Fprintf(w, `{"store": {"raft": {"applied_index": 100, "commit_index": %d}}}`, 100+backlog.Load())
+			return
+		}
+		w.Write([]byte(`{"results": [{"columns": ["1"], "types": ["integer"], "values": [[1]]}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Throttle = &ThrottleConfig{Interval: time.Millisecond, MaxRate: 1000, MinRate: 10}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connector.Close()
+
+	waitFor := func(what string, ok func(ThrottleState) bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if state := connector.Stats().Throttle; state != nil && ok(*state) {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("throttle never %s: %+v", what, connector.Stats().Throttle)
+	}
+
+	waitFor("slowed to the min rate", func(s ThrottleState) bool {
+		return s.Pressure && s.Backlog == 5000 && s.Rate == 10
+	})
+
+	backlog.Store(0)
+	waitFor("recovered", func(s ThrottleState) bool {
+		return !s.Pressure && s.Rate == 1000
+	})
+}
@@ -0,0 +1,66 @@
+package rsqlite
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// TimeFormat selects how time.Time arguments are stored, see Config.TimeFormat
+type TimeFormat string
+
+const (
+	// TimeFormatRFC3339 stores times as RFC 3339 text with nanoseconds and
+	// the zone offset, e.g. "2024-02-29T13:14:15.5+01:00". It is the default.
+	TimeFormatRFC3339 TimeFormat = "rfc3339"
+	// TimeFormatDateTime stores times as text in SQLite's datetime() format,
+	// e.g. "2024-02-29 13:14:15.5", which has no zone: combine it with
+	// Config.TimeUTC so values don't depend on the writer's zone
+	TimeFormatDateTime TimeFormat = "datetime"
+	// TimeFormatUnix stores times as integer seconds since the Unix epoch
+	TimeFormatUnix TimeFormat = "unix"
+	// TimeFormatUnixMilli stores times as integer milliseconds since the Unix epoch
+	TimeFormatUnixMilli TimeFormat = "unix_milli"
+)
+
+// validTimeFormats are the accepted time formats; "" is TimeFormatRFC3339
+var validTimeFormats = map[TimeFormat]bool{
+	"":                  true,
+	TimeFormatRFC3339:   true,
+	TimeFormatDateTime:  true,
+	TimeFormatUnix:      true,
+	TimeFormatUnixMilli: true,
+}
+
+// encodeTime converts a time argument to its stored representation
+func encodeTime(t time.Time, format TimeFormat, utc bool) interface{} {
+	if utc {
+		t = t.UTC()
+	}
+
+	switch format {
+	case TimeFormatDateTime:
+		return t.Format("2006-01-02 15:04:05.999999999")
+	case TimeFormatUnix:
+		return t.Unix()
+	case TimeFormatUnixMilli:
+		return t.UnixMilli()
+	default:
+		return t.Format(time.RFC3339Nano)
+	}
+}
+
+// bindArgs converts statement arguments for a request, storing times in the
+// configured format
+func (c *Conn) bindArgs(args []driver.NamedValue) []interface{} {
+	values := namedValuesToInterfaces(args)
+	if c.cfg.TimeFormat == "" && !c.cfg.TimeUTC {
+		return values
+	}
+
+	for i, v := range values {
+		if t, ok := v.(time.Time); ok {
+			values[i] = encodeTime(t, c.cfg.TimeFormat, c.cfg.TimeUTC)
+		}
+	}
+	return values
+}
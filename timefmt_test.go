@@ -0,0 +1,106 @@
+package rsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimeFormatRoundTrip(t *testing.T) {
+	zone := time.FixedZone("UTC+1", 3600)
+	at := time.Date(2024, 2, 29, 13, 14, 15, 500600700, zone)
+
+	tests := []struct {
+		format TimeFormat
+		utc    bool
+		stored interface{}
+		read   time.Time
+	}{
+		{"", false, "2024-02-29T13:14:15.5006007+01:00", at},
+		{TimeFormatRFC3339, true, "2024-02-29T12:14:15.5006007Z", at.UTC()},
+		{TimeFormatDateTime, true, "2024-02-29 12:14:15.5006007", at.UTC()},
+		{TimeFormatUnix, true, at.Unix(), at.Truncate(time.Second).UTC()},
+		{TimeFormatUnixMilli, true, at.UnixMilli(), at.Truncate(time.Millisecond).UTC()},
+	}
+	for _, tt := range tests {
+		stored := encodeTime(at, tt.format, tt.utc)
+		if stored != tt.stored {
+			t.Errorf("%q: stored %#v, want %#v", tt.format, stored, tt.stored)
+		}
+
+		// Numbers come back from the JSON API as json.Number
+		if n, ok := stored.(int64); ok {
+			encoded, _ := json.Marshal(n)
+			stored = json.Number(encoded)
+		}
+		read, err := parseTime(stored, tt.format, tt.utc)
+		if err != nil {
+			t.Errorf("%q: %v", tt.format, err)
+			continue
+		}
+		if !read.Equal(tt.read) || (tt.utc && read.Location() != time.UTC) {
+			t.Errorf("%q: read back %v, want %v", tt.format, read, tt.read)
+		}
+	}
+}
+
+func TestTimeFormatThroughServer(t *testing.T) {
+	// The server stores the argument of the last write and returns it from
+	// a DATETIME column
+	var mu sync.Mutex
+	var stored json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]json.RawMessage
+		json.Unmarshal(body, &statements)
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/db/execute":
+			stored = statements[0][1]
+			w.Write([]byte(`{"results": [{"last_insert_id": 1, "rows_affected": 1}]}`))
+		default:
+			value := stored
+			if value == nil {
+				value = json.RawMessage("1")
+			}
+			w.Write([]byte(`{"results": [{"columns": ["at"], "types": ["datetime"], "values": [[` + string(value) + `]]}]}`))
+		}
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false&time_format=unix_milli&time_utc=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	at := time.Date(2024, 2, 29, 13, 14, 15, 250_000_000, time.FixedZone("UTC+1", 3600))
+	if _, err := db.Exec("INSERT INTO events (at) VALUES (?)", at); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if string(stored) != "1709208855250" {
+		t.Errorf("stored %s, want milliseconds since the epoch", stored)
+	}
+	mu.Unlock()
+
+	var read time.Time
+	if err := db.QueryRow("SELECT at FROM events").Scan(&read); err != nil {
+		t.Fatal(err)
+	}
+	if !read.Equal(at) || read.Location() != time.UTC {
+		t.Errorf("read back %v, want %v in UTC", read, at)
+	}
+}
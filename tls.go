@@ -0,0 +1,24 @@
+package rsqlite
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zhenruyan/rsqlite/internal/transport"
+)
+
+// newHTTPClient creates an HTTP client applying the TLS settings and the
+// credential provider of the configuration. Clients with the same TLS
+// configuration and dial timeout share a pooled transport.
+func newHTTPClient(cfg *Config, timeout time.Duration) *http.Client {
+	rt := transport.For(cfg.TLSConfig, cfg.DialTimeout)
+	if cfg.CredentialProvider != nil {
+		rt = &credentialTransport{base: rt, provider: cfg.CredentialProvider}
+	}
+
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     rt,
+		CheckRedirect: transport.CheckRedirect,
+	}
+}
@@ -0,0 +1,151 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// defaultImportBatchSize is the number of rows written per request by ImportTables
+const defaultImportBatchSize = 500
+
+// TableFilter selects the rows of a table to export
+type TableFilter struct {
+	Table string
+	// Where is an optional condition, without the WHERE keyword
+	Where string
+	// Args are the positional arguments of Where
+	Args []interface{}
+}
+
+// TableData holds the rows exported from a table. It can be stored as JSON;
+// decode it with json.Decoder.UseNumber so integers are not imported as reals.
+type TableData struct {
+	Table   string          `json:"table"`
+	Columns []string        `json:"columns"`
+	Types   []string        `json:"types"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// ImportOptions configures ImportTables
+type ImportOptions struct {
+	// BatchSize is the number of rows written atomically per request; 500 when zero
+	BatchSize int
+	// OnConflict is the conflict resolution of the INSERT statements:
+	// "", "ABORT", "FAIL", "IGNORE", "REPLACE" or "ROLLBACK"
+	OnConflict string
+}
+
+// ExportTables reads the rows selected by each filter with strong consistency,
+// e.g. to promote data from a staging cluster to production with ImportTables
+func (c *Connector) ExportTables(ctx context.Context, filters ...TableFilter) ([]TableData, error) {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]TableData, 0, len(filters))
+	for _, filter := range filters {
+		if filter.Table == "" {
+			return nil, errors.New("export filter needs a table")
+		}
+
+		query := "SELECT * FROM " + quoteIdent(filter.Table)
+		if filter.Where != "" {
+			query += " WHERE " + filter.Where
+		}
+
+		result, err := client.query(ctx, "strong", query, filter.Args)
+		if err != nil {
+			return nil, fmt.Errorf("exporting table %q: %w", filter.Table, err)
+		}
+
+		data = append(data, TableData{
+			Table:   filter.Table,
+			Columns: result.Columns,
+			Types:   result.Types,
+			Rows:    result.Values,
+		})
+	}
+
+	return data, nil
+}
+
+// ImportTables inserts exported rows. Rows are written in batches, each batch
+// in a single atomic request, so a failure leaves whole batches applied and
+// the returned count tells how many rows were written before it.
+func (c *Connector) ImportTables(ctx context.Context, data []TableData, opts ImportOptions) (int64, error) {
+	insert := "INSERT"
+	switch conflict := strings.ToUpper(opts.OnConflict); conflict {
+	case "":
+	case "ABORT", "FAIL", "IGNORE", "REPLACE", "ROLLBACK":
+		insert += " OR " + conflict
+	default:
+		return 0, fmt.Errorf("invalid conflict resolution: %s", opts.OnConflict)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var imported int64
+	for _, table := range data {
+		columns := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = quoteIdent(column)
+		}
+		prefix := insert + " INTO " + quoteIdent(table.Table) + " (" + strings.Join(columns, ", ") + ") VALUES ("
+
+		for start := 0; start < len(table.Rows); start += batchSize {
+			end := start + batchSize
+			if end > len(table.Rows) {
+				end = len(table.Rows)
+			}
+
+			statements := make([]Statement, 0, end-start)
+			for _, row := range table.Rows[start:end] {
+				if len(row) != len(table.Columns) {
+					return imported, fmt.Errorf("table %q: row has %d values, expected %d", table.Table, len(row), len(table.Columns))
+				}
+				statements = append(statements, Statement{Query: prefix + rowLiterals(row, table.Types) + ")"})
+			}
+
+			results, err := client.executeBatch(ctx, statements, true)
+			if err == nil {
+				for _, result := range results {
+					if result.Error != "" {
+						err = errors.New(result.Error)
+						break
+					}
+				}
+			}
+			if err != nil {
+				return imported, fmt.Errorf("importing table %q rows %d-%d: %w", table.Table, start, end-1, err)
+			}
+
+			imported += int64(end - start)
+		}
+	}
+
+	return imported, nil
+}
+
+// rowLiterals formats a row as a comma separated list of SQL literals
+func rowLiterals(row []interface{}, types []string) string {
+	literals := make([]string, len(row))
+	for i, value := range row {
+		declType := ""
+		if i < len(types) {
+			declType = types[i]
+		}
+		literals[i] = sqlLiteral(value, declType)
+	}
+	return strings.Join(literals, ",")
+}
@@ -0,0 +1,43 @@
+package rsqlite
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// GetUserVersion returns PRAGMA user_version of the database, read with strong
+// consistency. Hand-rolled migration schemes use it to track the schema version.
+func (c *Connector) GetUserVersion(ctx context.Context) (int64, error) {
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := client.query(ctx, "strong", "PRAGMA user_version", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(result.Values) == 0 || len(result.Values[0]) == 0 {
+		return 0, errors.New("unexpected PRAGMA user_version result")
+	}
+	return toInt64(result.Values[0][0])
+}
+
+// SetUserVersion sets PRAGMA user_version of the database. The statement is
+// sent as a write so it goes through the raft log and reaches every node.
+func (c *Connector) SetUserVersion(ctx context.Context, version int64) error {
+	if version < -1<<31 || version > 1<<31-1 {
+		return errors.New("user_version must fit in a 32-bit signed integer")
+	}
+
+	client, err := c.leaderClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	// PRAGMA values can't be bound as parameters
+	_, err = client.execute(ctx, "PRAGMA user_version = "+strconv.FormatInt(version, 10), nil)
+	return err
+}
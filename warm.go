@@ -0,0 +1,112 @@
+package rsqlite
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// maxWarmStatements bounds the statements a connector keeps warm
+const maxWarmStatements = 4096
+
+// warmStatement holds what the driver derives from a statement's text,
+// computed once by Connector.Warm instead of on every execution
+type warmStatement struct {
+	fingerprint string
+	literal     bool
+	// encoded is the query text as a JSON string, ready for the request body
+	encoded json.RawMessage
+}
+
+// warmCache maps query text to its precomputed facts. Its methods work on a
+// nil cache, which holds nothing.
+type warmCache struct {
+	mu         sync.RWMutex
+	statements map[string]*warmStatement
+}
+
+// lookup returns the precomputed facts of a warmed statement, or nil
+func (w *warmCache) lookup(query string) *warmStatement {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.statements[query]
+}
+
+// fingerprint returns the fingerprint of a statement, precomputed when warm
+func (w *warmCache) fingerprint(query string) string {
+	if ws := w.lookup(query); ws != nil {
+		return ws.fingerprint
+	}
+	return fingerprint(query)
+}
+
+// hasStringLiteral reports whether a statement contains a single-quoted string
+// or blob literal outside comments and quoted identifiers
+func (w *warmCache) hasStringLiteral(query string) bool {
+	if ws := w.lookup(query); ws != nil {
+		return ws.literal
+	}
+	return scanStringLiteral(query)
+}
+
+// add precomputes the facts of a statement, unless the cache is full
+func (w *warmCache) add(query string) {
+	w.mu.RLock()
+	_, ok := w.statements[query]
+	full := len(w.statements) >= maxWarmStatements
+	w.mu.RUnlock()
+	if ok || full {
+		return
+	}
+
+	encoded, err := json.Marshal(query)
+	if err != nil {
+		return
+	}
+	ws := &warmStatement{
+		fingerprint: fingerprint(query),
+		literal:     scanStringLiteral(query),
+		encoded:     encoded,
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.statements == nil {
+		w.statements = make(map[string]*warmStatement)
+	}
+	if len(w.statements) < maxWarmStatements {
+		w.statements[query] = ws
+	}
+}
+
+// clear drops every warmed statement
+func (w *warmCache) clear() {
+	w.mu.Lock()
+	w.statements = nil
+	w.mu.Unlock()
+}
+
+// Warm preloads known hot statements, e.g. at startup, so their first
+// executions after a deploy skip the parsing the driver does per statement:
+// fingerprinting for metrics and classification, the inline literal scan of
+// params_only and the JSON encoding of the query text. Statements are
+// registered in every form the connector's connections send them, given the
+// current logical databases, interactive limit, max rows and app name comment
+// settings. At most 4096 forms are kept; Close drops them.
+func (c *Connector) Warm(queries ...string) {
+	cfg, _ := c.current()
+
+	for _, query := range queries {
+		rewritten := rewriteDatabases(query, cfg.Databases)
+		limited := applyInteractiveLimit(rewritten, cfg.InteractiveLimit)
+		capped := applyMaxRowsLimit(limited, cfg.MaxRows)
+
+		for _, form := range []string{query, rewritten, limited, capped,
+			annotateQuery(cfg, rewritten), annotateQuery(cfg, limited), annotateQuery(cfg, capped)} {
+			c.warm.add(form)
+		}
+	}
+}
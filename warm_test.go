@@ -0,0 +1,117 @@
+package rsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestWarmCoversSentForms(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var statements [][]interface{}
+		if err := json.Unmarshal(body, &statements); err != nil {
+			t.Errorf("request body %s: %v", body, err)
+		}
+		if len(statements) > 0 && statements[0][0] != "SELECT 1" {
+			mu.Lock()
+			bodies = append(bodies, statements[0])
+			mu.Unlock()
+		}
+		w.Write([]byte(`{"results": [{"columns": ["id"], "types": ["integer"], "values": [[1]]}]}`))
+	}))
+	defer server.Close()
+
+	cfg, err := ParseDSN(server.URL + "?discovery=false&interactive_limit=100&max_rows=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	query := "SELECT id FROM t WHERE id > ?"
+	connector.Warm(query)
+
+	// QueryContext sends the statement capped at max rows
+	sent := applyMaxRowsLimit(applyInteractiveLimit(query, 100), 10)
+	ws := connector.warm.lookup(sent)
+	if ws == nil {
+		t.Fatalf("%q not warmed", sent)
+	}
+	if ws.fingerprint != fingerprint(sent) || ws.literal {
+		t.Errorf("warmed facts %+v", ws)
+	}
+	if other.warm.lookup(sent) != nil {
+		t.Error("warmed statement shared with another connector")
+	}
+
+	db := sql.OpenDB(connector)
+	rows, err := db.Query(query, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	mu.Lock()
+	if len(bodies) != 1 || fmt.Sprint(bodies[0]) != fmt.Sprint([]interface{}{sent, float64(5)}) {
+		t.Errorf("server received %v, want the warmed statement and its argument", bodies)
+	}
+	mu.Unlock()
+
+	db.Close()
+	if connector.warm.lookup(sent) != nil {
+		t.Error("warmed statements kept after Close")
+	}
+}
+
+func TestWarmCacheBounded(t *testing.T) {
+	var w warmCache
+	for i := 0; i < maxWarmStatements+10; i++ {
+		w.add(fmt.Sprintf("SELECT %d", i))
+	}
+	if n := len(w.statements); n != maxWarmStatements {
+		t.Errorf("%d statements warm, want %d", n, maxWarmStatements)
+	}
+	if w.lookup("SELECT 0") == nil || w.lookup(fmt.Sprintf("SELECT %d", maxWarmStatements)) != nil {
+		t.Error("full cache replaced warm statements")
+	}
+
+	// A nil cache computes everything
+	var none *warmCache
+	if none.lookup("SELECT 0") != nil || none.fingerprint("SELECT 'a'") != "select ?" || !none.hasStringLiteral("SELECT 'a'") {
+		t.Error("nil cache answered differently from the uncached functions")
+	}
+}
+
+func TestWarmedStatementEncoding(t *testing.T) {
+	var w warmCache
+	w.add(`SELECT "a" FROM t WHERE b = ?`)
+	client := &apiClient{codec: JSONCodec{}, warm: &w}
+
+	statements := []Statement{{Query: `SELECT "a" FROM t WHERE b = ?`, Args: []interface{}{"x", nil, 1.5}}}
+	got, err := client.encodeStatements(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := JSONCodec{}.EncodeStatements(statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("warmed encoding %s, want %s", got, want)
+	}
+}